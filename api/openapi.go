@@ -0,0 +1,12 @@
+// Package api embeds the OpenAPI specification of the server
+package api
+
+import (
+	_ "embed"
+)
+
+// OpenAPISpec is the contents of openapi.yaml, the source of truth for all
+// API contracts
+//
+//go:embed openapi.yaml
+var OpenAPISpec []byte
@@ -0,0 +1,65 @@
+// Command fakeproductservice runs an in-memory Product Service for local
+// development:
+//
+//	go run ./cmd/fakeproductservice -catalog products.yaml -latency 100ms -error-rate 0.05
+//
+// Point the orders service at it with PRODUCT_SERVICE_URL=http://localhost:8200.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/Bitovi/example-go-server/internal/fakeproductservice"
+	"github.com/Bitovi/example-go-server/internal/services"
+)
+
+func main() {
+	addr := flag.String("addr", ":8200", "address to listen on")
+	catalogPath := flag.String("catalog", "", "JSON or YAML catalog file; defaults to the products of the seeded mock orders")
+	latency := flag.Duration("latency", 0, "delay added to every product request")
+	errorRate := flag.Float64("error-rate", 0, "fraction of product requests, from 0 to 1, that fail")
+	errorStatus := flag.Int("error-status", http.StatusServiceUnavailable, "status of failed product requests")
+	noBulkLookup := flag.Bool("no-bulk-lookup", false, "reject GET /products?ids= like a Product Service without bulk lookups")
+	flag.Parse()
+
+	products := fakeproductservice.DefaultCatalog()
+	if *catalogPath != "" {
+		var err error
+		if products, err = fakeproductservice.LoadCatalog(*catalogPath); err != nil {
+			log.Fatalf("Failed to load catalog: %v", err)
+		}
+	}
+	if *errorRate < 0 || *errorRate > 1 {
+		log.Fatalf("Invalid -error-rate %v: must be between 0 and 1", *errorRate)
+	}
+
+	opts := []fakeproductservice.Option{fakeproductservice.WithFaults(fakeproductservice.Faults{
+		Latency:     *latency,
+		ErrorRate:   *errorRate,
+		ErrorStatus: *errorStatus,
+	})}
+	if *noBulkLookup {
+		opts = append(opts, fakeproductservice.WithoutBulkLookup())
+	}
+	fake := fakeproductservice.New(products, opts...)
+
+	log.Printf("Fake Product Service serving %d products on %s", len(products), *addr)
+	log.Printf("  - GET /products, GET /products?ids=a,b and GET /products/{id}")
+	log.Printf("  - PUT /admin/products/{id}/availability {\"availability\": false}")
+	log.Printf("  - GET and PUT /admin/faults {\"latency\": \"250ms\", \"errorRate\": 0.1, \"errorStatus\": 503}")
+	for _, product := range products {
+		log.Printf("  %s %s (%s)%s", product.ID, product.Name, product.Price, unavailable(product))
+	}
+	if err := http.ListenAndServe(*addr, fake); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+func unavailable(product services.ProductResponse) string {
+	if product.Availability {
+		return ""
+	}
+	return " unavailable"
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/Bitovi/example-go-server/internal/config"
 	"github.com/Bitovi/example-go-server/internal/handlers"
-	"github.com/Bitovi/example-go-server/internal/middleware"
+	"github.com/Bitovi/example-go-server/internal/models"
 	"github.com/Bitovi/example-go-server/internal/services"
-	authmiddleware "github.com/bitovi-corp/auth-middleware-go/middleware"
 )
 
 func main() {
@@ -17,21 +24,88 @@ func main() {
 	log.Printf("Configuration loaded:")
 	log.Printf("  - Product Service URL: %s", cfg.ProductServiceURL)
 	log.Printf("  - Loyalty Service URL: %s", cfg.LoyaltyServiceURL)
+	log.Printf("  - Order Store: %s", cfg.OrderStore)
 
-	// Initialize Product Service client
-	productClient := services.NewProductServiceClient(cfg.ProductServiceURL, "")
-	log.Printf("Product Service client initialized")
+	// Accept product IDs in the Product Service's format
+	productIDScheme, err := services.ParseProductIDScheme(cfg.ProductIDScheme)
+	if err != nil {
+		log.Fatalf("Invalid PRODUCT_ID_SCHEME: %v", err)
+	}
+	handlers.SetProductIDScheme(productIDScheme)
 
-	// Initialize order service with product client
-	handlers.InitializeOrderService(productClient)
+	// Initialize Product Service client, cached unless PRODUCT_CACHE_TTL is 0
+	productClientOptions := []services.ProductClientOption{
+		services.WithProductIDScheme(productIDScheme),
+		services.WithValidationConcurrency(cfg.ProductValidationConcurrency),
+		services.WithRetryPolicy(services.RetryPolicy{
+			MaxAttempts:    cfg.ProductRetryMaxAttempts,
+			InitialBackoff: cfg.ProductRetryInitialBackoff,
+			MaxBackoff:     cfg.ProductRetryMaxBackoff,
+			Budget:         cfg.ProductRetryBudget,
+		}),
+	}
+	if cfg.ProductBulkLookup {
+		productClientOptions = append(productClientOptions, services.WithBulkLookup())
+	}
+	var productClient services.ProductClient = services.NewProductServiceClient(cfg.ProductServiceURL, "", productClientOptions...)
+	log.Printf("Product Service client initialized (%s product IDs, up to %d attempts per lookup)", productIDScheme, cfg.ProductRetryMaxAttempts)
 
-	// Register routes according to api/openapi.yaml
-	// Health check endpoint - no auth required
-	http.HandleFunc("/health", middleware.LoggingMiddleware(handlers.HealthCheck))
+	// Stop calling the Product Service while it keeps failing
+	if cfg.ProductBreakerFailureThreshold > 0 {
+		breaker := services.NewCircuitBreakerProductClient(productClient, cfg.ProductBreakerFailureThreshold, cfg.ProductBreakerCooldown)
+		handlers.RegisterHealthReporter("productService", breaker.Health)
+		productClient = breaker
+		log.Printf("Product Service circuit breaker opens after %d failures for %v", cfg.ProductBreakerFailureThreshold, cfg.ProductBreakerCooldown)
+	}
+
+	// Serve repeated lookups from the cache, even while the circuit is open
+	if cfg.ProductCacheTTL > 0 {
+		cache := services.NewCachingProductClient(productClient, cfg.ProductCacheTTL, cfg.ProductCacheNegativeTTL)
+		handlers.RegisterHealthReporter("productCache", cache.Health)
+		productClient = cache
+		log.Printf("Product lookups cached for %v, unknown products for %v", cfg.ProductCacheTTL, cfg.ProductCacheNegativeTTL)
+	}
+
+	// Initialize order repository
+	orderRepository := newOrderRepository(cfg)
+
+	// Award and redeem loyalty points unless LOYALTY_SERVICE_URL is unset
+	pointValue, err := models.ParseMoney(cfg.LoyaltyPointValue, models.DefaultCurrency)
+	if err != nil || pointValue.Amount <= 0 {
+		log.Fatalf("Invalid LOYALTY_POINT_VALUE %q: must be a positive amount such as 0.01", cfg.LoyaltyPointValue)
+	}
+	orderServiceOptions := []services.OrderServiceOption{services.WithLoyaltyPointValue(pointValue)}
+	if cfg.LoyaltyServiceURL != "" {
+		orderServiceOptions = append(orderServiceOptions, services.WithLoyaltyClient(services.NewLoyaltyServiceClient(cfg.LoyaltyServiceURL, "")))
+		log.Printf("Loyalty Service client initialized (points redeemed at %s each)", pointValue)
+	} else {
+		log.Printf("LOYALTY_SERVICE_URL not set: no loyalty points are awarded or redeemed")
+	}
+
+	// Queue loyalty side effects in the order store's outbox, written with the
+	// order changes that trigger them
+	outboxRepository, hasOutbox := orderRepository.(services.OutboxRepository)
+	useOutbox := cfg.OutboxEnabled && hasOutbox
+	if useOutbox {
+		orderServiceOptions = append(orderServiceOptions, services.WithOutbox())
+	}
+
+	// Initialize order service with repository, product and loyalty clients
+	orderService := handlers.InitializeOrderService(orderRepository, productClient, orderServiceOptions...)
+
+	var outboxDispatcher *services.OutboxDispatcher
+	if useOutbox {
+		outboxDispatcher = services.NewOutboxDispatcher(outboxRepository, orderService.DeliverOutboxMessage, services.RetryPolicy{
+			MaxAttempts:    cfg.OutboxMaxAttempts,
+			InitialBackoff: cfg.OutboxInitialBackoff,
+			MaxBackoff:     cfg.OutboxMaxBackoff,
+		})
+		handlers.InitializeOutbox(outboxDispatcher)
+		handlers.RegisterHealthReporter("outbox", outboxDispatcher.Health)
+	}
 
-	// Order endpoints - auth required
-	http.HandleFunc("/orders/", middleware.LoggingMiddleware(authmiddleware.RequireRoles("admin")(handleOrdersWithID)))
-	http.HandleFunc("/orders", middleware.LoggingMiddleware(authmiddleware.RequireRoles("admin")(handleOrders)))
+	// Register routes according to api/openapi.yaml
+	router := NewRouter(cfg)
 
 	// Start server
 	port := cfg.Port
@@ -43,48 +117,116 @@ func main() {
 	log.Printf("  - GET http://localhost%s/orders/{orderId} (auth required)", port)
 	log.Printf("  - PATCH http://localhost%s/orders/{orderId} (auth required)", port)
 	log.Printf("  - POST http://localhost%s/orders/{orderId}/submit (auth required)", port)
+	log.Printf("  - POST http://localhost%s/orders/{orderId}/ship (auth required)", port)
+	log.Printf("  - POST http://localhost%s/orders/{orderId}/deliver (auth required)", port)
+	log.Printf("  - POST http://localhost%s/orders/{orderId}/return (auth required)", port)
+	log.Printf("  - POST http://localhost%s/orders/{orderId}/reprice (auth required)", port)
+	log.Printf("  - GET http://localhost%s/orders/{orderId}/events (auth required)", port)
+	log.Printf("  - GET http://localhost%s/users/{userId}/orders (auth required)", port)
+	log.Printf("  - GET http://localhost%s/admin/outbox (auth required)", port)
+	log.Printf("  - POST http://localhost%s/admin/outbox/{messageId}/replay (auth required)", port)
 	log.Printf("")
 	log.Printf("Authentication: Include 'Authorization: Bearer {token}' header")
 	log.Printf("Global middlewares: Logging enabled for all requests")
+	log.Printf("Idempotency-Key honored on POST requests (responses kept for %v)", cfg.IdempotencyKeyTTL)
+	log.Printf("Requests time out after %v", cfg.RequestTimeout)
 
-	if err := http.ListenAndServe(port, nil); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	// Every request context derives from requestCtx, so canceling it stops the
+	// Product Service lookups of requests still running at shutdown
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	server := &http.Server{
+		Addr:        port,
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return requestCtx },
 	}
-}
 
-// handleOrders routes to the appropriate handler based on method
-func handleOrders(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		handlers.ListOrders(w, r)
-	case http.MethodPost:
-		handlers.CreateOrder(w, r)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	// Release the points held by orders that are never submitted
+	if cfg.LoyaltyServiceURL != "" && cfg.LoyaltyReservationTTL > 0 {
+		go releaseExpiredRedemptions(requestCtx, orderService, cfg.LoyaltyReservationTTL)
+		log.Printf("Loyalty points reserved by unsubmitted orders are released after %v", cfg.LoyaltyReservationTTL)
 	}
+
+	// Deliver the side effects queued in the outbox
+	if outboxDispatcher != nil {
+		go outboxDispatcher.Run(requestCtx, cfg.OutboxPollInterval, cfg.OutboxRetention)
+		log.Printf("Outbox messages delivered every %v, dead-lettered after %d attempts", cfg.OutboxPollInterval, cfg.OutboxMaxAttempts)
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	log.Printf("Shutting down, waiting up to %v for in-flight requests", cfg.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		// Cancel the requests still running and give them a moment to respond
+		log.Printf("Canceling in-flight requests: %v", err)
+		cancelRequests()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}
+	log.Printf("Server stopped")
 }
 
-// handleOrdersWithID routes to the appropriate handler based on method for /orders/{orderId}
-func handleOrdersWithID(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
+// redemptionSweepInterval is how often reservations of unsubmitted orders are
+// checked for expiry
+const redemptionSweepInterval = time.Minute
 
-	// Check if it's the submit endpoint: /orders/{orderId}/submit
-	if len(path) > 7 && path[len(path)-7:] == "/submit" {
-		if r.Method == http.MethodPost {
-			handlers.CancelOrSubmitOrder(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// releaseExpiredRedemptions periodically releases the loyalty points reserved
+// by orders pending for longer than ttl, until ctx is done
+func releaseExpiredRedemptions(ctx context.Context, orderService *services.OrderService, ttl time.Duration) {
+	ticker := time.NewTicker(redemptionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			released, err := orderService.ReleaseExpiredRedemptions(ctx, ttl, services.SystemActor)
+			if err != nil {
+				log.Printf("Failed to release expired loyalty reservations: %v", err)
+			} else if released > 0 {
+				log.Printf("Released the loyalty reservations of %d unsubmitted orders", released)
+			}
 		}
-		return
 	}
+}
 
-	// Regular /orders/{orderId} endpoints
-	switch r.Method {
-	case http.MethodGet:
-		handlers.GetOrderByID(w, r)
-	case http.MethodPatch:
-		handlers.UpdateOrder(w, r)
+// newOrderRepository builds the order storage backend selected in configuration
+func newOrderRepository(cfg *config.Config) services.OrderRepository {
+	switch cfg.OrderStore {
+	case "file":
+		repo, err := services.NewFileOrderRepository(cfg.OrderStorePath, cfg.OrderStoreSnapshotEvery)
+		if err != nil {
+			log.Fatalf("Failed to open file order store: %v", err)
+		}
+		log.Printf("Order repository initialized (file: %s)", cfg.OrderStorePath)
+		return repo
+	case "sqlite":
+		dbPath := filepath.Join(cfg.OrderStorePath, "orders.db")
+		db, err := services.OpenSQLiteOrderDB(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to open sqlite order store: %v", err)
+		}
+		if err := services.MigrateOrderDB(db); err != nil {
+			log.Fatalf("Failed to migrate sqlite order store: %v", err)
+		}
+		log.Printf("Order repository initialized (sqlite: %s)", dbPath)
+		return services.NewSQLOrderRepository(db)
+	case "memory":
+		log.Printf("Order repository initialized (in-memory, seeded with mock data)")
+		return services.NewMockOrderRepository()
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Fatalf("Unknown ORDER_STORE %q: must be memory, file or sqlite", cfg.OrderStore)
+		return nil
 	}
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Bitovi/example-go-server/api"
+	"github.com/Bitovi/example-go-server/internal/config"
+	"github.com/Bitovi/example-go-server/internal/handlers"
+	"github.com/Bitovi/example-go-server/internal/middleware"
+	"github.com/Bitovi/example-go-server/internal/openapi"
+	authmiddleware "github.com/bitovi-corp/auth-middleware-go/middleware"
+)
+
+// NewRouter returns the handler serving the endpoints of api/openapi.yaml,
+// rejecting requests the spec does not allow before they reach a handler.
+// The services behind the handlers package must be initialized first.
+func NewRouter(cfg *config.Config) http.Handler {
+	mux := http.NewServeMux()
+	spec := openapi.MustLoad(api.OpenAPISpec)
+
+	// Health check endpoint - no auth required
+	mux.HandleFunc("GET /health", handlers.HealthCheck)
+
+	// Order endpoints - auth required, checked against the OpenAPI spec and
+	// bounded by REQUEST_TIMEOUT; POST requests honor Idempotency-Key
+	timeout := middleware.TimeoutMiddleware(cfg.RequestTimeout)
+	validate := middleware.RequestValidationMiddleware(spec)
+	idempotency := middleware.IdempotencyMiddleware(middleware.NewInMemoryIdempotencyStore(), cfg.IdempotencyKeyTTL)
+	admin := func(next http.HandlerFunc) http.HandlerFunc {
+		return timeout(authmiddleware.RequireRoles("admin")(validate(next)))
+	}
+	orders := func(next http.HandlerFunc) http.HandlerFunc {
+		return admin(idempotency(next))
+	}
+	mux.HandleFunc("GET /orders", orders(handlers.ListOrders))
+	mux.HandleFunc("POST /orders", orders(handlers.CreateOrder))
+	mux.HandleFunc("GET /orders/{orderId}", orders(handlers.GetOrderByID))
+	mux.HandleFunc("PATCH /orders/{orderId}", orders(handlers.UpdateOrder))
+	mux.HandleFunc("POST /orders/{orderId}/submit", orders(handlers.CancelOrSubmitOrder))
+	mux.HandleFunc("POST /orders/{orderId}/ship", orders(handlers.ShipOrder))
+	mux.HandleFunc("POST /orders/{orderId}/deliver", orders(handlers.DeliverOrder))
+	mux.HandleFunc("POST /orders/{orderId}/return", orders(handlers.ReturnOrder))
+	mux.HandleFunc("POST /orders/{orderId}/reprice", orders(handlers.RepriceOrder))
+	mux.HandleFunc("GET /orders/{orderId}/events", orders(handlers.GetOrderEvents))
+	mux.HandleFunc("GET /users/{userId}/orders", admin(handlers.ListUserOrders))
+
+	// Outbox endpoints - auth required
+	mux.HandleFunc("GET /admin/outbox", admin(handlers.ListOutboxMessages))
+	mux.HandleFunc("POST /admin/outbox/{messageId}/replay", admin(handlers.ReplayOutboxMessage))
+
+	route := func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern == "" {
+			w = &routeErrorWriter{ResponseWriter: w, request: r}
+		}
+		mux.ServeHTTP(w, r)
+	}
+	if cfg.ValidateResponses {
+		route = middleware.ResponseValidationMiddleware(spec, middleware.LogResponseDifferences)(route)
+	}
+
+	// Every request is logged, including those no endpoint serves
+	return middleware.LoggingMiddleware(route)
+}
+
+// routeErrorWriter replaces the plain-text 404 and 405 responses ServeMux
+// writes for requests no pattern matches with an ErrorResponse. The Allow
+// header ServeMux sets on a 405 is kept.
+type routeErrorWriter struct {
+	http.ResponseWriter
+	request  *http.Request
+	replaced bool
+}
+
+func (w *routeErrorWriter) WriteHeader(statusCode int) {
+	switch statusCode {
+	case http.StatusNotFound:
+		w.replaced = true
+		handlers.NotFound(w.ResponseWriter, w.request)
+	case http.StatusMethodNotAllowed:
+		w.replaced = true
+		handlers.MethodNotAllowed(w.ResponseWriter, w.request)
+	default:
+		w.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (w *routeErrorWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		// Drop the plain-text body
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
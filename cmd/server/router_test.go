@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bitovi/example-go-server/api"
+	"github.com/Bitovi/example-go-server/internal/config"
+	"github.com/Bitovi/example-go-server/internal/fakeproductservice"
+	"github.com/Bitovi/example-go-server/internal/handlers"
+	"github.com/Bitovi/example-go-server/internal/middleware"
+	"github.com/Bitovi/example-go-server/internal/models"
+	"github.com/Bitovi/example-go-server/internal/openapi"
+	"github.com/Bitovi/example-go-server/internal/services"
+)
+
+// adminToken is an unsigned JWT with the admin role, accepted by the auth
+// middleware in mock mode
+func adminToken() string {
+	encode := func(v any) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	header := encode(map[string]string{"alg": "HS256", "typ": "JWT"})
+	claims := encode(map[string]any{"sub": "router-test", "roles": []string{"admin"}})
+	return header + "." + claims + "." + base64.RawURLEncoding.EncodeToString([]byte("mock-signature"))
+}
+
+// checkResponses fails t when a response of handler does not match api/openapi.yaml
+func checkResponses(t *testing.T, handler http.Handler) http.HandlerFunc {
+	report := func(r *http.Request, status int, fields []models.FieldError) {
+		t.Errorf("Response %d to %s %s does not match the spec: %v", status, r.Method, r.URL.Path, fields)
+	}
+	return middleware.ResponseValidationMiddleware(openapi.MustLoad(api.OpenAPISpec), report)(handler.ServeHTTP)
+}
+
+func TestNewRouter(t *testing.T) {
+	productService := httptest.NewServer(fakeproductservice.New(fakeproductservice.DefaultCatalog()))
+	t.Cleanup(productService.Close)
+	handlers.InitializeOrderService(services.NewMockOrderRepository(), services.NewProductServiceClient(productService.URL, ""))
+	router := NewRouter(&config.Config{RequestTimeout: 5 * time.Second, IdempotencyKeyTTL: time.Hour})
+
+	const orderID = "650e8400-e29b-41d4-a716-446655440000"
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		noAuth         bool
+		expectedStatus int
+		expectedCode   string
+		expectedAllow  string
+	}{
+		{
+			name:           "Health check needs no auth",
+			method:         http.MethodGet,
+			path:           "/health",
+			noAuth:         true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Order endpoints require auth",
+			method:         http.MethodGet,
+			path:           "/orders/" + orderID,
+			noAuth:         true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Order ID is read from the path",
+			method:         http.MethodGet,
+			path:           "/orders/" + orderID,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Action endpoint",
+			method:         http.MethodPost,
+			path:           "/orders/" + orderID + "/submit",
+			body:           `{"action":"SUBMIT"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "List orders",
+			method:         http.MethodGet,
+			path:           "/orders?status=PENDING&limit=5",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Create order",
+			method:         http.MethodPost,
+			path:           "/orders",
+			body:           `{"userId":"550e8400-e29b-41d4-a716-446655440010","products":[{"productId":"550e8400-e29b-41d4-a716-446655440000","quantity":2}]}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Order history",
+			method:         http.MethodGet,
+			path:           "/orders/" + orderID + "/events",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid order ID is rejected",
+			method:         http.MethodGet,
+			path:           "/orders/not-a-uuid/events",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_ORDER_ID",
+		},
+		{
+			name:           "Invalid query parameter is rejected",
+			method:         http.MethodGet,
+			path:           "/orders?limit=500",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_LIMIT",
+		},
+		{
+			name:           "Missing user ID is rejected on create",
+			method:         http.MethodPost,
+			path:           "/orders",
+			body:           `{"products":[{"productId":"550e8400-e29b-41d4-a716-446655440000","quantity":1}]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_REQUEST_BODY",
+		},
+		{
+			name:           "Empty products are rejected on update",
+			method:         http.MethodPatch,
+			path:           "/orders/" + orderID,
+			body:           `{"products":[]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_REQUEST_BODY",
+		},
+		{
+			name:           "Invalid user ID filter is rejected",
+			method:         http.MethodGet,
+			path:           "/orders?userId=not-a-uuid",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_USER_ID",
+		},
+		{
+			name:           "Invalid user ID is rejected",
+			method:         http.MethodGet,
+			path:           "/users/not-a-uuid/orders",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_USER_ID",
+		},
+		{
+			name:           "Invalid outbox message ID is rejected",
+			method:         http.MethodPost,
+			path:           "/admin/outbox/not-a-uuid/replay",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_MESSAGE_ID",
+		},
+		{
+			name:           "Quantity below 1 is rejected on create",
+			method:         http.MethodPost,
+			path:           "/orders",
+			body:           `{"userId":"550e8400-e29b-41d4-a716-446655440010","products":[{"productId":"550e8400-e29b-41d4-a716-446655440000","quantity":0}]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_REQUEST_BODY",
+		},
+		{
+			name:           "Negative pointsToRedeem is rejected on create",
+			method:         http.MethodPost,
+			path:           "/orders",
+			body:           `{"userId":"550e8400-e29b-41d4-a716-446655440010","products":[{"productId":"550e8400-e29b-41d4-a716-446655440000","quantity":1}],"pointsToRedeem":-5}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_REQUEST_BODY",
+		},
+		{
+			name:           "Extra path segments return 404",
+			method:         http.MethodPost,
+			path:           "/orders/" + orderID + "/lines/submit",
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   "NOT_FOUND",
+		},
+		{
+			name:           "Unknown path returns 404",
+			method:         http.MethodGet,
+			path:           "/products",
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   "NOT_FOUND",
+		},
+		{
+			name:           "Unsupported method returns 405 with Allow",
+			method:         http.MethodDelete,
+			path:           "/orders/" + orderID,
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedCode:   "METHOD_NOT_ALLOWED",
+			expectedAllow:  "GET, HEAD, PATCH",
+		},
+		{
+			name:           "Action endpoints only accept POST",
+			method:         http.MethodGet,
+			path:           "/orders/" + orderID + "/submit",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedCode:   "METHOD_NOT_ALLOWED",
+			expectedAllow:  "POST",
+		},
+		{
+			name:           "Order history only accepts GET",
+			method:         http.MethodPost,
+			path:           "/orders/" + orderID + "/events",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedCode:   "METHOD_NOT_ALLOWED",
+			expectedAllow:  "GET, HEAD",
+		},
+		{
+			name:           "Health check only accepts GET",
+			method:         http.MethodPost,
+			path:           "/health",
+			noAuth:         true,
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedCode:   "METHOD_NOT_ALLOWED",
+			expectedAllow:  "GET, HEAD",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if !tt.noAuth {
+				req.Header.Set("Authorization", "Bearer "+adminToken())
+			}
+			w := httptest.NewRecorder()
+
+			checkResponses(t, router)(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.expectedAllow {
+				t.Errorf("Expected Allow %q, got %q", tt.expectedAllow, allow)
+			}
+			if tt.expectedCode == "" {
+				return
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Expected a JSON response, got %q", contentType)
+			}
+			var response models.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Code != tt.expectedCode {
+				t.Errorf("Expected error code %s, got %s", tt.expectedCode, response.Code)
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Config holds the application configuration
@@ -10,6 +12,82 @@ type Config struct {
 	ProductServiceURL string
 	LoyaltyServiceURL string
 	Port              string
+
+	// OrderStore selects the order storage backend: "memory", "file" or "sqlite"
+	OrderStore string
+	// OrderStorePath is the directory used by the file and sqlite order stores
+	OrderStorePath string
+	// OrderStoreSnapshotEvery is the number of journal entries between snapshots
+	OrderStoreSnapshotEvery int
+
+	// RequestTimeout bounds how long a request may take, including the
+	// Product Service lookups it makes; zero means no limit
+	RequestTimeout time.Duration
+	// ShutdownTimeout is how long in-flight requests may run after a shutdown
+	// signal before they are canceled
+	ShutdownTimeout time.Duration
+
+	// IdempotencyKeyTTL is how long responses to requests with an
+	// Idempotency-Key are kept for replay
+	IdempotencyKeyTTL time.Duration
+
+	// ValidateResponses logs responses that do not match api/openapi.yaml;
+	// meant for development, as every response is checked
+	ValidateResponses bool
+
+	// ProductCacheTTL is how long products are cached; zero disables the cache
+	ProductCacheTTL time.Duration
+	// ProductCacheNegativeTTL is how long unknown product IDs are remembered
+	ProductCacheNegativeTTL time.Duration
+	// ProductIDScheme is the product ID format used by the Product Service:
+	// uuid, numeric or any
+	ProductIDScheme string
+	// ProductValidationConcurrency bounds the parallel product lookups made
+	// while validating an order
+	ProductValidationConcurrency int
+	// ProductBulkLookup enables fetching an order's products with a single
+	// GET /products?ids= request
+	ProductBulkLookup bool
+
+	// ProductRetryMaxAttempts is the number of attempts made for a product
+	// lookup, including the first; 1 disables retries
+	ProductRetryMaxAttempts int
+	// ProductRetryInitialBackoff is the delay before the first retry, doubled
+	// for each further retry up to ProductRetryMaxBackoff
+	ProductRetryInitialBackoff time.Duration
+	ProductRetryMaxBackoff     time.Duration
+	// ProductRetryBudget bounds the total time spent on one product lookup
+	ProductRetryBudget time.Duration
+
+	// ProductBreakerFailureThreshold is the number of consecutive failed
+	// product lookups that opens the circuit breaker; zero disables it
+	ProductBreakerFailureThreshold int
+	// ProductBreakerCooldown is how long the circuit stays open before a
+	// probe request is let through
+	ProductBreakerCooldown time.Duration
+
+	// LoyaltyPointValue is the discount given for each redeemed loyalty
+	// point, as a decimal amount of the order currency such as "0.01"
+	LoyaltyPointValue string
+	// LoyaltyReservationTTL is how long points reserved by an order that is
+	// not submitted are held before they are released; zero holds them until
+	// the order is submitted or canceled
+	LoyaltyReservationTTL time.Duration
+
+	// OutboxEnabled queues loyalty side effects in the order store's outbox,
+	// written with the order change, for background delivery
+	OutboxEnabled bool
+	// OutboxPollInterval is how often pending outbox messages are delivered
+	OutboxPollInterval time.Duration
+	// OutboxMaxAttempts is the number of delivery attempts after which a
+	// message is dead-lettered
+	OutboxMaxAttempts int
+	// OutboxInitialBackoff is the delay before a failed delivery is retried,
+	// doubled for each further retry up to OutboxMaxBackoff
+	OutboxInitialBackoff time.Duration
+	OutboxMaxBackoff     time.Duration
+	// OutboxRetention is how long delivered messages are kept
+	OutboxRetention time.Duration
 }
 
 // LoadConfig loads configuration from environment variables
@@ -24,6 +102,43 @@ func LoadConfig() *Config {
 		ProductServiceURL: getEnv("PRODUCT_SERVICE_URL", ""),
 		LoyaltyServiceURL: getEnv("LOYALTY_SERVICE_URL", ""),
 		Port:              port,
+
+		OrderStore:              getEnv("ORDER_STORE", "memory"),
+		OrderStorePath:          getEnv("ORDER_STORE_PATH", "data"),
+		OrderStoreSnapshotEvery: getEnvInt("ORDER_STORE_SNAPSHOT_EVERY", 100),
+
+		RequestTimeout:  getEnvDuration("REQUEST_TIMEOUT", 10*time.Second),
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 10*time.Second),
+
+		IdempotencyKeyTTL: getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+
+		ValidateResponses: getEnvBool("OPENAPI_VALIDATE_RESPONSES", false),
+
+		ProductCacheTTL:         getEnvDuration("PRODUCT_CACHE_TTL", time.Minute),
+		ProductCacheNegativeTTL: getEnvDuration("PRODUCT_CACHE_NEGATIVE_TTL", 10*time.Second),
+
+		ProductIDScheme: getEnv("PRODUCT_ID_SCHEME", "uuid"),
+
+		ProductValidationConcurrency: getEnvInt("PRODUCT_VALIDATION_CONCURRENCY", 8),
+		ProductBulkLookup:            getEnvBool("PRODUCT_BULK_LOOKUP", false),
+
+		ProductRetryMaxAttempts:    getEnvInt("PRODUCT_RETRY_MAX_ATTEMPTS", 3),
+		ProductRetryInitialBackoff: getEnvDuration("PRODUCT_RETRY_INITIAL_BACKOFF", 100*time.Millisecond),
+		ProductRetryMaxBackoff:     getEnvDuration("PRODUCT_RETRY_MAX_BACKOFF", time.Second),
+		ProductRetryBudget:         getEnvDuration("PRODUCT_RETRY_BUDGET", 3*time.Second),
+
+		ProductBreakerFailureThreshold: getEnvInt("PRODUCT_BREAKER_FAILURE_THRESHOLD", 5),
+		ProductBreakerCooldown:         getEnvDuration("PRODUCT_BREAKER_COOLDOWN", 30*time.Second),
+
+		LoyaltyPointValue:     getEnv("LOYALTY_POINT_VALUE", "0.01"),
+		LoyaltyReservationTTL: getEnvDuration("LOYALTY_RESERVATION_TTL", 24*time.Hour),
+
+		OutboxEnabled:        getEnvBool("OUTBOX_ENABLED", true),
+		OutboxPollInterval:   getEnvDuration("OUTBOX_POLL_INTERVAL", time.Second),
+		OutboxMaxAttempts:    getEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+		OutboxInitialBackoff: getEnvDuration("OUTBOX_INITIAL_BACKOFF", time.Second),
+		OutboxMaxBackoff:     getEnvDuration("OUTBOX_MAX_BACKOFF", 5*time.Minute),
+		OutboxRetention:      getEnvDuration("OUTBOX_RETENTION", 24*time.Hour),
 	}
 }
 
@@ -35,3 +150,32 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvInt retrieves an integer environment variable or returns a default value
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvBool retrieves a boolean environment variable (e.g. "true", "1") or
+// returns a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDuration retrieves a duration environment variable (e.g. "30s", "24h")
+// or returns a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
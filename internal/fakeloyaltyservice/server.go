@@ -0,0 +1,398 @@
+// Package fakeloyaltyservice is an in-memory stand-in for the Loyalty Service,
+// for tests. It keeps a points balance per user, the reservations holding
+// points for orders and a ledger of the award, redemption and reversal
+// transactions made through it, honoring Idempotency-Key the way the Loyalty
+// Service does:
+//
+//	fake := fakeloyaltyservice.New()
+//	server := httptest.NewServer(fake)
+//	defer server.Close()
+//	client := services.NewLoyaltyServiceClient(server.URL, "")
+package fakeloyaltyservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// TransactionType is the kind of a points transaction
+type TransactionType string
+
+const (
+	TransactionAward      TransactionType = "AWARD"
+	TransactionRedemption TransactionType = "REDEMPTION"
+	TransactionReversal   TransactionType = "REVERSAL"
+)
+
+// Transaction is a points transaction in the fake's ledger. Reversals undo
+// the award or redemption named by Reverses.
+type Transaction struct {
+	ID       string          `json:"transactionId"`
+	Type     TransactionType `json:"type"`
+	UserID   string          `json:"userId"`
+	OrderID  string          `json:"orderId"`
+	Points   int             `json:"points"`
+	Reverses string          `json:"reverses,omitempty"`
+}
+
+// ReservationStatus is the state of a reservation
+type ReservationStatus string
+
+const (
+	ReservationHeld      ReservationStatus = "HELD"
+	ReservationCommitted ReservationStatus = "COMMITTED"
+	ReservationReleased  ReservationStatus = "RELEASED"
+)
+
+// Reservation holds points of a user for an order until it is committed,
+// redeeming them under TransactionID, or released
+type Reservation struct {
+	ID            string            `json:"reservationId"`
+	UserID        string            `json:"userId"`
+	OrderID       string            `json:"orderId"`
+	Points        int               `json:"points"`
+	Status        ReservationStatus `json:"status"`
+	TransactionID string            `json:"transactionId,omitempty"`
+}
+
+// Server is a fake Loyalty Service. It is an http.Handler and safe for
+// concurrent use.
+type Server struct {
+	mux      *http.ServeMux
+	requests atomic.Int64
+
+	mu      sync.Mutex
+	failing bool
+	ledger  []Transaction
+	// byID indexes the ledger by transaction ID
+	byID map[string]int
+	// responses holds the response to each Idempotency-Key, replayed for
+	// repeated requests
+	responses map[string]any
+	// reversals maps transaction IDs to their reversal
+	reversals    map[string]string
+	reservations map[string]*Reservation
+	balances     map[string]int
+}
+
+// New returns a fake Loyalty Service with no transactions
+func New() *Server {
+	s := &Server{
+		mux:          http.NewServeMux(),
+		byID:         make(map[string]int),
+		responses:    make(map[string]any),
+		reversals:    make(map[string]string),
+		reservations: make(map[string]*Reservation),
+		balances:     make(map[string]int),
+	}
+	s.mux.HandleFunc("POST /users/{userId}/points/awards", s.award)
+	s.mux.HandleFunc("POST /users/{userId}/points/reversals", s.reverse)
+	s.mux.HandleFunc("POST /users/{userId}/points/reservations", s.reserve)
+	s.mux.HandleFunc("POST /users/{userId}/points/reservations/{reservationId}/commit", s.commit)
+	s.mux.HandleFunc("POST /users/{userId}/points/reservations/{reservationId}/release", s.release)
+	s.mux.HandleFunc("GET /users/{userId}/points", s.getBalance)
+	return s
+}
+
+// ServeHTTP serves the Loyalty Service API
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	if s.Failing() {
+		writeError(w, http.StatusServiceUnavailable, "INJECTED_FAILURE", "Injected failure")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Requests returns the number of requests received, including failed ones
+func (s *Server) Requests() int {
+	return int(s.requests.Load())
+}
+
+// SetFailing makes every request fail with 503 until it is called with false
+func (s *Server) SetFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+// Failing reports whether requests are failing
+func (s *Server) Failing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failing
+}
+
+// Balance returns a user's points balance, including points held by
+// reservations
+func (s *Server) Balance(userID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.balances[userID]
+}
+
+// SetBalance sets a user's points balance
+func (s *Server) SetBalance(userID string, points int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balances[userID] = points
+}
+
+// Held returns the points held by a user's reservations
+func (s *Server) Held(userID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.held(userID)
+}
+
+// held returns the points held by a user's reservations. The caller must
+// hold s.mu.
+func (s *Server) held(userID string) int {
+	held := 0
+	for _, reservation := range s.reservations {
+		if reservation.UserID == userID && reservation.Status == ReservationHeld {
+			held += reservation.Points
+		}
+	}
+	return held
+}
+
+// Reservation returns a reservation by ID
+func (s *Server) Reservation(id string) (Reservation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reservation, ok := s.reservations[id]
+	if !ok {
+		return Reservation{}, false
+	}
+	return *reservation, true
+}
+
+// Transactions returns the ledger, oldest first
+func (s *Server) Transactions() []Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Transaction{}, s.ledger...)
+}
+
+// transactionRequest is the body of POST .../awards, .../reversals and
+// .../reservations
+type transactionRequest struct {
+	OrderID       string `json:"orderId"`
+	TransactionID string `json:"transactionId"`
+	Points        int    `json:"points"`
+}
+
+// decodeRequest reads a request body, answering 400 if the request has no
+// Idempotency-Key or its body is invalid
+func decodeRequest(w http.ResponseWriter, r *http.Request, body any) bool {
+	if r.Header.Get("Idempotency-Key") == "" {
+		writeError(w, http.StatusBadRequest, "IDEMPOTENCY_KEY_REQUIRED", "Idempotency-Key header is required")
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", err.Error())
+		return false
+	}
+	return true
+}
+
+// replay answers a request whose Idempotency-Key was seen before with the
+// original response. The caller must hold s.mu.
+func (s *Server) replay(w http.ResponseWriter, r *http.Request) bool {
+	response, ok := s.responses[r.Header.Get("Idempotency-Key")]
+	if ok {
+		writeJSON(w, http.StatusOK, response)
+	}
+	return ok
+}
+
+// respond answers a request with 201 and remembers the response for its
+// Idempotency-Key. The caller must hold s.mu.
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, response any) {
+	s.responses[r.Header.Get("Idempotency-Key")] = response
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// record appends a transaction and applies it to the user's balance. The
+// caller must hold s.mu.
+func (s *Server) record(txn Transaction) Transaction {
+	txn.ID = fmt.Sprintf("txn-%d", len(s.ledger)+1)
+	s.ledger = append(s.ledger, txn)
+	s.byID[txn.ID] = len(s.ledger) - 1
+	switch txn.Type {
+	case TransactionAward:
+		s.balances[txn.UserID] += txn.Points
+	case TransactionRedemption:
+		s.balances[txn.UserID] -= txn.Points
+	case TransactionReversal:
+		s.reversals[txn.Reverses] = txn.ID
+		if s.ledger[s.byID[txn.Reverses]].Type == TransactionAward {
+			s.balances[txn.UserID] -= txn.Points
+		} else {
+			s.balances[txn.UserID] += txn.Points
+		}
+	}
+	return txn
+}
+
+// award implements POST /users/{userId}/points/awards
+func (s *Server) award(w http.ResponseWriter, r *http.Request) {
+	var body transactionRequest
+	if !decodeRequest(w, r, &body) {
+		return
+	}
+	if body.Points <= 0 {
+		writeError(w, http.StatusBadRequest, "INVALID_POINTS", "points must be positive")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replay(w, r) {
+		return
+	}
+	txn := s.record(Transaction{Type: TransactionAward, UserID: r.PathValue("userId"), OrderID: body.OrderID, Points: body.Points})
+	s.respond(w, r, txn)
+}
+
+// reverse implements POST /users/{userId}/points/reversals. An award or
+// redemption can be reversed only once; its full points are debited or
+// credited again.
+func (s *Server) reverse(w http.ResponseWriter, r *http.Request) {
+	var body transactionRequest
+	if !decodeRequest(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replay(w, r) {
+		return
+	}
+	i, ok := s.byID[body.TransactionID]
+	if !ok || s.ledger[i].Type == TransactionReversal || s.ledger[i].UserID != r.PathValue("userId") {
+		writeError(w, http.StatusNotFound, "TRANSACTION_NOT_FOUND", "Transaction not found")
+		return
+	}
+	if reversal, reversed := s.reversals[body.TransactionID]; reversed {
+		writeError(w, http.StatusConflict, "ALREADY_REVERSED", "Transaction already reversed by "+reversal)
+		return
+	}
+	original := s.ledger[i]
+	txn := s.record(Transaction{Type: TransactionReversal, UserID: original.UserID, OrderID: original.OrderID, Points: original.Points, Reverses: original.ID})
+	s.respond(w, r, txn)
+}
+
+// reserve implements POST /users/{userId}/points/reservations, holding points
+// the user has and that are not already held
+func (s *Server) reserve(w http.ResponseWriter, r *http.Request) {
+	var body transactionRequest
+	if !decodeRequest(w, r, &body) {
+		return
+	}
+	if body.Points <= 0 {
+		writeError(w, http.StatusBadRequest, "INVALID_POINTS", "points must be positive")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replay(w, r) {
+		return
+	}
+	userID := r.PathValue("userId")
+	if available := s.balances[userID] - s.held(userID); available < body.Points {
+		writeError(w, http.StatusConflict, "INSUFFICIENT_POINTS", fmt.Sprintf("%d points available", available))
+		return
+	}
+	reservation := &Reservation{
+		ID:      fmt.Sprintf("res-%d", len(s.reservations)+1),
+		UserID:  userID,
+		OrderID: body.OrderID,
+		Points:  body.Points,
+		Status:  ReservationHeld,
+	}
+	s.reservations[reservation.ID] = reservation
+	s.respond(w, r, *reservation)
+}
+
+// heldReservation returns the reservation named in the path, answering 404 or
+// 409 unless it is held. The caller must hold s.mu.
+func (s *Server) heldReservation(w http.ResponseWriter, r *http.Request) (*Reservation, bool) {
+	reservation, ok := s.reservations[r.PathValue("reservationId")]
+	if !ok || reservation.UserID != r.PathValue("userId") {
+		writeError(w, http.StatusNotFound, "RESERVATION_NOT_FOUND", "Reservation not found")
+		return nil, false
+	}
+	if reservation.Status != ReservationHeld {
+		writeError(w, http.StatusConflict, "RESERVATION_"+string(reservation.Status), "Reservation is "+string(reservation.Status))
+		return nil, false
+	}
+	return reservation, true
+}
+
+// commit implements POST /users/{userId}/points/reservations/{reservationId}/commit,
+// redeeming the held points
+func (s *Server) commit(w http.ResponseWriter, r *http.Request) {
+	var body struct{}
+	if !decodeRequest(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replay(w, r) {
+		return
+	}
+	reservation, ok := s.heldReservation(w, r)
+	if !ok {
+		return
+	}
+	txn := s.record(Transaction{Type: TransactionRedemption, UserID: reservation.UserID, OrderID: reservation.OrderID, Points: reservation.Points})
+	reservation.Status = ReservationCommitted
+	reservation.TransactionID = txn.ID
+	s.respond(w, r, txn)
+}
+
+// release implements POST /users/{userId}/points/reservations/{reservationId}/release,
+// returning the held points to the user
+func (s *Server) release(w http.ResponseWriter, r *http.Request) {
+	var body struct{}
+	if !decodeRequest(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replay(w, r) {
+		return
+	}
+	reservation, ok := s.heldReservation(w, r)
+	if !ok {
+		return
+	}
+	reservation.Status = ReservationReleased
+	s.respond(w, r, *reservation)
+}
+
+// getBalance implements GET /users/{userId}/points
+func (s *Server) getBalance(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("userId")
+	writeJSON(w, http.StatusOK, map[string]any{"userId": userID, "points": s.Balance(userID), "held": s.Held(userID)})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, models.ErrorResponse{Code: code, Message: message})
+}
@@ -0,0 +1,87 @@
+package fakeproductservice
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Bitovi/example-go-server/internal/services"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed catalog.yaml
+var defaultCatalog []byte
+
+// catalogFile is the layout of a catalog file. Products use the Product
+// Service's wire format: numeric or UUID ids and decimal prices.
+type catalogFile struct {
+	Products []services.ProductResponse `json:"products"`
+}
+
+// DefaultCatalog returns the products of the seeded mock orders
+func DefaultCatalog() []services.ProductResponse {
+	products, err := ParseCatalog(defaultCatalog, "yaml")
+	if err != nil {
+		panic(fmt.Sprintf("fakeproductservice: invalid default catalog: %v", err))
+	}
+	return products
+}
+
+// LoadCatalog reads a catalog from a .json, .yaml or .yml file
+func LoadCatalog(path string) ([]services.ProductResponse, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+	return ParseCatalog(data, strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// ParseCatalog parses a catalog in format "json" or "yaml" (or "yml")
+func ParseCatalog(data []byte, format string) ([]services.ProductResponse, error) {
+	switch strings.ToLower(format) {
+	case "json":
+	case "yaml", "yml":
+		// Decode through JSON so products are read exactly as the Product
+		// Service's responses are
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid YAML catalog: %w", err)
+		}
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("invalid YAML catalog: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown catalog format %q: must be json or yaml", format)
+	}
+
+	var catalog catalogFile
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("invalid catalog: %w", err)
+	}
+
+	seen := make(map[string]bool, len(catalog.Products))
+	for i, product := range catalog.Products {
+		if product.ID == "" {
+			return nil, fmt.Errorf("invalid catalog: product %d has no id", i)
+		}
+		key := productKey(string(product.ID))
+		if seen[key] {
+			return nil, fmt.Errorf("invalid catalog: duplicate product id %s", product.ID)
+		}
+		seen[key] = true
+	}
+	return catalog.Products, nil
+}
+
+// productKey returns the canonical form of a product ID, so that "007" finds
+// product 7 as it would in the Product Service
+func productKey(id string) string {
+	if canonical, err := services.ProductIDSchemeAny.Normalize(id); err == nil {
+		return canonical
+	}
+	return id
+}
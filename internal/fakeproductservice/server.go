@@ -0,0 +1,272 @@
+// Package fakeproductservice is an in-memory stand-in for the Product Service,
+// for local development and tests. It serves GET /products and
+// GET /products/{id} in the Product Service's wire format, and can inject
+// latency and errors to exercise the orders service's retries, circuit
+// breaker and timeouts.
+//
+// Tests use it in process:
+//
+//	fake := fakeproductservice.New(fakeproductservice.DefaultCatalog())
+//	server := httptest.NewServer(fake)
+//	defer server.Close()
+//
+// cmd/fakeproductservice runs it as a standalone server.
+package fakeproductservice
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+	"github.com/Bitovi/example-go-server/internal/services"
+)
+
+// Faults are the failures injected into product requests
+type Faults struct {
+	// Latency delays every product request
+	Latency time.Duration
+	// ErrorRate is the fraction of product requests, from 0 to 1, answered
+	// with ErrorStatus instead of the product
+	ErrorRate float64
+	// ErrorStatus defaults to 503 Service Unavailable
+	ErrorStatus int
+}
+
+// Option configures optional Server behavior
+type Option func(*Server)
+
+// WithFaults injects faults from the start
+func WithFaults(faults Faults) Option {
+	return func(s *Server) {
+		s.faults = faults
+	}
+}
+
+// WithoutBulkLookup makes GET /products?ids= fail with 400, like a Product
+// Service that predates bulk lookups
+func WithoutBulkLookup() Option {
+	return func(s *Server) {
+		s.noBulkLookup = true
+	}
+}
+
+// Server is a fake Product Service. It is an http.Handler and safe for
+// concurrent use.
+type Server struct {
+	mux          *http.ServeMux
+	noBulkLookup bool
+	requests     atomic.Int64
+
+	mu     sync.Mutex
+	faults Faults
+	// products holds the catalog in order; index maps canonical IDs into it
+	products []services.ProductResponse
+	index    map[string]int
+}
+
+// New returns a fake Product Service serving products
+func New(products []services.ProductResponse, opts ...Option) *Server {
+	s := &Server{
+		mux:      http.NewServeMux(),
+		products: make([]services.ProductResponse, len(products)),
+		index:    make(map[string]int, len(products)),
+	}
+	copy(s.products, products)
+	for i, product := range s.products {
+		s.index[productKey(string(product.ID))] = i
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.mux.HandleFunc("GET /products", s.faulty(s.listProducts))
+	s.mux.HandleFunc("GET /products/{id}", s.faulty(s.getProduct))
+	s.mux.HandleFunc("PUT /admin/products/{id}/availability", s.setAvailability)
+	s.mux.HandleFunc("GET /admin/faults", s.getFaults)
+	s.mux.HandleFunc("PUT /admin/faults", s.putFaults)
+	return s
+}
+
+// ServeHTTP serves the Product Service API and the admin endpoints
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Requests returns the number of product requests received, including those
+// answered with an injected error
+func (s *Server) Requests() int {
+	return int(s.requests.Load())
+}
+
+// SetAvailability marks a product as available or not, reporting whether it exists
+func (s *Server) SetAvailability(productID string, available bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.index[productKey(productID)]
+	if ok {
+		s.products[i].Availability = available
+	}
+	return ok
+}
+
+// SetFaults replaces the injected faults
+func (s *Server) SetFaults(faults Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = faults
+}
+
+// Faults returns the injected faults
+func (s *Server) Faults() Faults {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.faults
+}
+
+// faulty counts a product request and applies the injected latency and errors
+// before handling it
+func (s *Server) faulty(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		faults := s.Faults()
+
+		if faults.Latency > 0 {
+			timer := time.NewTimer(faults.Latency)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if faults.ErrorRate > 0 && rand.Float64() < faults.ErrorRate {
+			status := faults.ErrorStatus
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			writeError(w, status, "INJECTED_FAILURE", "Injected failure")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// getProduct implements GET /products/{id}
+func (s *Server) getProduct(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	i, ok := s.index[productKey(r.PathValue("id"))]
+	var product services.ProductResponse
+	if ok {
+		product = s.products[i]
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "PRODUCT_NOT_FOUND", "Product not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, product)
+}
+
+// listProducts implements GET /products, or GET /products?ids= for a
+// comma-separated list of products. Unknown IDs are left out.
+func (s *Server) listProducts(w http.ResponseWriter, r *http.Request) {
+	ids, bulk := r.URL.Query()["ids"]
+	if bulk && s.noBulkLookup {
+		writeError(w, http.StatusBadRequest, "INVALID_QUERY", "ids is not supported")
+		return
+	}
+
+	s.mu.Lock()
+	var data []services.ProductResponse
+	if bulk {
+		data = []services.ProductResponse{}
+		for _, id := range strings.Split(strings.Join(ids, ","), ",") {
+			if i, ok := s.index[productKey(strings.TrimSpace(id))]; ok {
+				data = append(data, s.products[i])
+			}
+		}
+	} else {
+		data = append([]services.ProductResponse{}, s.products...)
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, services.ProductListResponse{Data: data, Count: len(data)})
+}
+
+// setAvailability implements PUT /admin/products/{id}/availability with a
+// body of {"availability": true|false}
+func (s *Server) setAvailability(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Availability *bool `json:"availability"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Availability == nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", `Body must be {"availability": true|false}`)
+		return
+	}
+	if !s.SetAvailability(r.PathValue("id"), *body.Availability) {
+		writeError(w, http.StatusNotFound, "PRODUCT_NOT_FOUND", "Product not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// faultsJSON is the admin representation of Faults
+type faultsJSON struct {
+	Latency     string  `json:"latency"`
+	ErrorRate   float64 `json:"errorRate"`
+	ErrorStatus int     `json:"errorStatus,omitempty"`
+}
+
+// getFaults implements GET /admin/faults
+func (s *Server) getFaults(w http.ResponseWriter, r *http.Request) {
+	faults := s.Faults()
+	writeJSON(w, http.StatusOK, faultsJSON{Latency: faults.Latency.String(), ErrorRate: faults.ErrorRate, ErrorStatus: faults.ErrorStatus})
+}
+
+// putFaults implements PUT /admin/faults with a body such as
+// {"latency": "250ms", "errorRate": 0.1, "errorStatus": 503}
+func (s *Server) putFaults(w http.ResponseWriter, r *http.Request) {
+	var body faultsJSON
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", err.Error())
+		return
+	}
+
+	faults := Faults{ErrorRate: body.ErrorRate, ErrorStatus: body.ErrorStatus}
+	if body.Latency != "" {
+		latency, err := time.ParseDuration(body.Latency)
+		if err != nil || latency < 0 {
+			writeError(w, http.StatusBadRequest, "INVALID_LATENCY", "latency must be a duration such as 250ms")
+			return
+		}
+		faults.Latency = latency
+	}
+	if faults.ErrorRate < 0 || faults.ErrorRate > 1 {
+		writeError(w, http.StatusBadRequest, "INVALID_ERROR_RATE", "errorRate must be between 0 and 1")
+		return
+	}
+	if faults.ErrorStatus != 0 && (faults.ErrorStatus < 400 || faults.ErrorStatus > 599) {
+		writeError(w, http.StatusBadRequest, "INVALID_ERROR_STATUS", "errorStatus must be a 4xx or 5xx status")
+		return
+	}
+
+	s.SetFaults(faults)
+	s.getFaults(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, models.ErrorResponse{Code: code, Message: message})
+}
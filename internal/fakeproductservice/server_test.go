@@ -0,0 +1,199 @@
+package fakeproductservice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+	"github.com/Bitovi/example-go-server/internal/services"
+)
+
+const testCatalogYAML = `
+products:
+  - id: 7
+    name: Laptop
+    price: 1299.99
+    availability: true
+  - id: 3fa85f64-5717-4562-b3fc-2c963f66afa6
+    name: Wireless Mouse
+    price: 29.99
+    availability: false
+`
+
+// startFake serves the test catalog and returns a client for it
+func startFake(t *testing.T, opts ...Option) (*Server, *services.ProductServiceClient) {
+	t.Helper()
+	products, err := ParseCatalog([]byte(testCatalogYAML), "yaml")
+	if err != nil {
+		t.Fatalf("Failed to parse catalog: %v", err)
+	}
+	fake := New(products, opts...)
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, services.NewProductServiceClient(server.URL, "")
+}
+
+func TestServer_GetProduct(t *testing.T) {
+	_, client := startFake(t)
+
+	product, err := client.GetProduct(context.Background(), "007", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if product.ID != "7" || product.Name != "Laptop" || product.Price != models.NewMoney(129999, models.DefaultCurrency) {
+		t.Errorf("Unexpected product %+v", product)
+	}
+
+	if _, err := client.GetProduct(context.Background(), "8", ""); !errors.Is(err, services.ErrProductNotFound) {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+}
+
+func TestServer_Availability(t *testing.T) {
+	fake, client := startFake(t)
+	const mouse = "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+
+	if _, _, err := client.ValidateProduct(context.Background(), mouse, ""); err == nil {
+		t.Fatal("Expected the unavailable product to fail validation")
+	}
+	if !fake.SetAvailability(strings.ToUpper(mouse), true) {
+		t.Fatal("Expected the product to be found")
+	}
+	if _, _, err := client.ValidateProduct(context.Background(), mouse, ""); err != nil {
+		t.Errorf("Expected the product to be available, got %v", err)
+	}
+	if fake.SetAvailability("8", true) {
+		t.Error("Expected an unknown product not to be found")
+	}
+}
+
+func TestServer_BulkLookup(t *testing.T) {
+	fake, _ := startFake(t)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := services.NewProductServiceClient(server.URL, "", services.WithBulkLookup())
+
+	results := client.ValidateProducts(context.Background(), []string{"7", "8"}, "")
+	if results[0].Err != nil || !errors.Is(results[1].Err, services.ErrProductNotFound) {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if fake.Requests() != 1 {
+		t.Errorf("Expected a single bulk request, got %d requests", fake.Requests())
+	}
+}
+
+func TestServer_WithoutBulkLookup(t *testing.T) {
+	fake, _ := startFake(t, WithoutBulkLookup())
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := services.NewProductServiceClient(server.URL, "", services.WithBulkLookup())
+
+	results := client.ValidateProducts(context.Background(), []string{"7", "8"}, "")
+	if results[0].Err != nil || !errors.Is(results[1].Err, services.ErrProductNotFound) {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	// The rejected bulk request, then one request per product
+	if fake.Requests() != 3 {
+		t.Errorf("Expected the client to fall back to single lookups, got %d requests", fake.Requests())
+	}
+}
+
+func TestServer_InjectedFaults(t *testing.T) {
+	fake, client := startFake(t, WithFaults(Faults{ErrorRate: 1}))
+
+	if _, err := client.GetProduct(context.Background(), "7", ""); !errors.Is(err, services.ErrProductServiceUnavailable) {
+		t.Errorf("Expected ErrProductServiceUnavailable, got %v", err)
+	}
+
+	fake.SetFaults(Faults{Latency: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetProduct(ctx, "7", ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the lookup to time out, got %v", err)
+	}
+
+	fake.SetFaults(Faults{})
+	if _, err := client.GetProduct(context.Background(), "7", ""); err != nil {
+		t.Errorf("Expected no error once faults are cleared, got %v", err)
+	}
+}
+
+func TestServer_AdminEndpoints(t *testing.T) {
+	fake, _ := startFake(t)
+
+	tests := []struct {
+		path, body     string
+		expectedStatus int
+	}{
+		{"/admin/products/3fa85f64-5717-4562-b3fc-2c963f66afa6/availability", `{"availability": true}`, http.StatusNoContent},
+		{"/admin/products/8/availability", `{"availability": true}`, http.StatusNotFound},
+		{"/admin/products/7/availability", `{}`, http.StatusBadRequest},
+		{"/admin/faults", `{"latency": "5ms", "errorRate": 0.5, "errorStatus": 500}`, http.StatusOK},
+		{"/admin/faults", `{"errorRate": 2}`, http.StatusBadRequest},
+		{"/admin/faults", `{"latency": "soon"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		fake.ServeHTTP(w, httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body)))
+		if w.Code != tt.expectedStatus {
+			t.Errorf("PUT %s %s: expected status %d, got %d", tt.path, tt.body, tt.expectedStatus, w.Code)
+		}
+	}
+
+	if faults := fake.Faults(); faults != (Faults{Latency: 5 * time.Millisecond, ErrorRate: 0.5, ErrorStatus: 500}) {
+		t.Errorf("Unexpected faults %+v", faults)
+	}
+	if fake.Requests() != 0 {
+		t.Errorf("Expected admin requests not to be counted, got %d", fake.Requests())
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "products.json")
+	os.WriteFile(jsonPath, []byte(`{"products": [{"id": 7, "name": "Laptop", "price": 1299.99, "availability": true}]}`), 0o644)
+
+	products, err := LoadCatalog(jsonPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(products) != 1 || products[0].ID != "7" || products[0].Price.String() != "1299.99" {
+		t.Errorf("Unexpected products %+v", products)
+	}
+
+	for name, catalog := range map[string]string{
+		"duplicate.yaml": "products:\n  - id: 7\n  - id: 007\n",
+		"missing.yaml":   "products:\n  - name: Laptop\n",
+		"products.txt":   "",
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(catalog), 0o644)
+		if _, err := LoadCatalog(path); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
+
+func TestDefaultCatalog(t *testing.T) {
+	// The default catalog prices the seeded mock orders' products as they were ordered
+	catalog := make(map[string]services.ProductResponse)
+	for _, product := range DefaultCatalog() {
+		catalog[string(product.ID)] = product
+	}
+	orders, _ := services.NewMockOrderRepository().List()
+	for _, order := range orders {
+		for _, line := range order.Products {
+			product, ok := catalog[line.ProductID]
+			if !ok || product.Name != line.ProductName || product.Price != line.UnitPrice {
+				t.Errorf("Expected %s to be in the default catalog as %s at %s, got %+v", line.ProductID, line.ProductName, line.UnitPrice, product)
+			}
+		}
+	}
+}
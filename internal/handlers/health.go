@@ -4,20 +4,46 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"sync"
+
+	"github.com/Bitovi/example-go-server/internal/models"
 )
 
+// HealthReporter reports the state of one dependency for GET /health
+type HealthReporter func() models.ComponentHealth
+
+var (
+	healthMu        sync.RWMutex
+	healthReporters = map[string]HealthReporter{}
+)
+
+// RegisterHealthReporter adds a dependency to the health check response
+func RegisterHealthReporter(name string, reporter HealthReporter) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	healthReporters[name] = reporter
+}
+
 // HealthCheck implements GET /health endpoint as defined in api/openapi.yaml
 func HealthCheck(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET method
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	// Prepare response; the service keeps serving while a dependency is
+	// down, so an unhealthy dependency only degrades the overall status
+	response := models.HealthResponse{
+		Status: models.HealthStatusHealthy,
 	}
-
-	// Prepare response
-	response := map[string]string{
-		"status": "healthy",
+	healthMu.RLock()
+	for name, reporter := range healthReporters {
+		if response.Components == nil {
+			response.Components = make(map[string]models.ComponentHealth)
+		}
+		component := reporter()
+		response.Components[name] = component
+		if component.Status != models.HealthStatusHealthy {
+			response.Status = models.HealthStatusDegraded
+		}
 	}
+	healthMu.RUnlock()
 
 	// Set content type and status code (200 OK as per OpenAPI spec)
 	w.Header().Set("Content-Type", "application/json")
@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/Bitovi/example-go-server/internal/models"
 )
 
 func TestHealthCheck(t *testing.T) {
@@ -20,12 +22,6 @@ func TestHealthCheck(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectedBody:   map[string]string{"status": "healthy"},
 		},
-		{
-			name:           "POST request returns 405 Method Not Allowed",
-			method:         http.MethodPost,
-			expectedStatus: http.StatusMethodNotAllowed,
-			expectedBody:   nil,
-		},
 	}
 
 	for _, tt := range tests {
@@ -56,3 +52,40 @@ func TestHealthCheck(t *testing.T) {
 		})
 	}
 }
+
+func TestHealthCheck_Components(t *testing.T) {
+	RegisterHealthReporter("productService", func() models.ComponentHealth {
+		return models.ComponentHealth{Status: models.HealthStatusUnhealthy, Details: map[string]any{"circuit": "open"}}
+	})
+	RegisterHealthReporter("productCache", func() models.ComponentHealth {
+		return models.ComponentHealth{Status: models.HealthStatusHealthy}
+	})
+	t.Cleanup(func() {
+		healthMu.Lock()
+		defer healthMu.Unlock()
+		delete(healthReporters, "productService")
+		delete(healthReporters, "productCache")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	w := httptest.NewRecorder()
+	HealthCheck(w, req)
+
+	// A dependency being down degrades the service without failing the check
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var response models.HealthResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Status != models.HealthStatusDegraded {
+		t.Errorf("Expected status %q, got %q", models.HealthStatusDegraded, response.Status)
+	}
+	if len(response.Components) != 2 {
+		t.Fatalf("Expected 2 components, got %v", response.Components)
+	}
+	if component := response.Components["productService"]; component.Status != models.HealthStatusUnhealthy || component.Details["circuit"] != "open" {
+		t.Errorf("Unexpected productService component %+v", component)
+	}
+}
@@ -1,25 +1,52 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Bitovi/example-go-server/internal/models"
 	"github.com/Bitovi/example-go-server/internal/services"
-	"github.com/google/uuid"
+	authmiddleware "github.com/bitovi-corp/auth-middleware-go/middleware"
 )
 
 var (
 	orderService *services.OrderService
+	// productIDScheme is the product ID format accepted in requests
+	productIDScheme = services.ProductIDSchemeUUID
 )
 
-// InitializeOrderService sets up the order service with dependencies
-func InitializeOrderService(productClient services.ProductClient) {
-	orderService = services.NewOrderService(productClient)
+// InitializeOrderService sets up the order service with dependencies and
+// returns it for use outside request handling
+func InitializeOrderService(repo services.OrderRepository, productClient services.ProductClient, opts ...services.OrderServiceOption) *services.OrderService {
+	orderService = services.NewOrderService(repo, productClient, opts...)
+	return orderService
+}
+
+// SetProductIDScheme sets the product ID format accepted in requests, which
+// should match the Product Service deployment. The default is UUIDs.
+func SetProductIDScheme(scheme services.ProductIDScheme) {
+	productIDScheme = scheme
+}
+
+// normalizeProductIDs replaces each product's ID with its canonical form,
+// writing an INVALID_PRODUCT_ID response for the first ID outside the scheme
+func normalizeProductIDs(w http.ResponseWriter, products []models.OrderProduct) bool {
+	for i := range products {
+		id, err := productIDScheme.Normalize(products[i].ProductID)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_PRODUCT_ID", "Invalid product ID format", fmt.Sprintf("Product at index %d: %v", i, err))
+			return false
+		}
+		products[i].ProductID = id
+	}
+	return true
 }
 
 // writeErrorResponse writes a standardized error response
@@ -38,27 +65,161 @@ func writeErrorResponse(w http.ResponseWriter, statusCode int, code, message, de
 	}
 }
 
-// isValidUUID performs UUID format validation using google/uuid
-func isValidUUID(uuidStr string) bool {
-	_, err := uuid.Parse(uuidStr)
-	return err == nil
+// NotFound answers requests for a path no endpoint serves
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeErrorResponse(w, http.StatusNotFound, "NOT_FOUND", "The requested resource could not be found", "")
+}
+
+// MethodNotAllowed answers requests with a method the path does not support.
+// The caller sets the Allow header listing the methods it does.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", "")
+}
+
+// actorFromRequest identifies the caller for the order history, using the
+// subject of the authenticated token
+func actorFromRequest(r *http.Request) string {
+	if claims := authmiddleware.GetUserClaims(r); claims != nil && claims.Subject != "" {
+		return claims.Subject
+	}
+	return "anonymous"
+}
+
+// orderETag returns the strong entity tag for the current version of an order
+func orderETag(order *models.Order) string {
+	return `"` + strconv.Itoa(order.Version) + `"`
+}
+
+// expectedVersionFromRequest returns the order version required by the
+// If-Match header. A missing header or "*" places no requirement on the
+// version. ok is false if the header cannot match any version of an order.
+func expectedVersionFromRequest(r *http.Request) (version int, ok bool) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return services.AnyVersion, true
+	}
+
+	// If-Match uses strong comparison, so weak tags never match
+	if len(ifMatch) < 3 || ifMatch[0] != '"' || ifMatch[len(ifMatch)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(ifMatch[1 : len(ifMatch)-1])
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// etagMatchesNoneMatch reports whether the If-None-Match header matches etag,
+// using weak comparison as required for conditional GET
+func etagMatchesNoneMatch(r *http.Request, etag string) bool {
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writePreconditionFailed reports that the order changed since the caller read it
+func writePreconditionFailed(w http.ResponseWriter, details string) {
+	writeErrorResponse(w, http.StatusPreconditionFailed, "VERSION_MISMATCH", "The order has been modified since it was retrieved", details)
+}
+
+// writeProductServiceUnavailable writes a 503 for a failed product lookup. When
+// the circuit breaker is open the client is told when to retry.
+func writeProductServiceUnavailable(w http.ResponseWriter, err error) {
+	var circuitOpen *services.CircuitOpenError
+	if errors.As(err, &circuitOpen) {
+		w.Header().Set("Retry-After", strconv.Itoa(circuitOpen.RetryAfterSeconds()))
+	}
+	writeErrorResponse(w, http.StatusServiceUnavailable, "PRODUCT_SERVICE_UNAVAILABLE", "Product validation service is currently unavailable", err.Error())
+}
+
+// writeContextError writes the response for a request that ran out of time or
+// was canceled, e.g. by the client going away or the server shutting down, and
+// reports whether err was caused by that. Deadlines the services set on their
+// own calls, such as the Product Service retry budget, are not the request's
+// and are left to the other error checks.
+func writeContextError(w http.ResponseWriter, r *http.Request, err error) bool {
+	ctxErr := r.Context().Err()
+	if ctxErr == nil || !errors.Is(err, ctxErr) {
+		return false
+	}
+	if errors.Is(ctxErr, context.DeadlineExceeded) {
+		writeErrorResponse(w, http.StatusGatewayTimeout, "REQUEST_TIMEOUT", "The request took too long to complete", err.Error())
+	} else {
+		writeErrorResponse(w, http.StatusServiceUnavailable, "REQUEST_CANCELED", "The request was canceled before it completed", err.Error())
+	}
+	return true
+}
+
+// writeLifecycleError writes the response for an order status that does not
+// allow the requested change and reports whether err was such an error
+func writeLifecycleError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrOrderNotPending):
+		writeErrorResponse(w, http.StatusBadRequest, "ORDER_NOT_PENDING", "Only pending orders can be changed this way", err.Error())
+	case errors.Is(err, services.ErrInvalidTransition):
+		writeErrorResponse(w, http.StatusConflict, "INVALID_TRANSITION", "The order cannot move to the requested status", err.Error())
+	default:
+		return false
+	}
+	return true
+}
+
+// writeLoyaltyError writes the response for points that cannot be redeemed
+// and reports whether err was such an error
+func writeLoyaltyError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrRedemptionUnavailable):
+		writeErrorResponse(w, http.StatusBadRequest, "REDEMPTION_NOT_AVAILABLE", "Loyalty points cannot be redeemed", err.Error())
+	case errors.Is(err, services.ErrRedemptionExceedsTotal):
+		writeErrorResponse(w, http.StatusBadRequest, "REDEMPTION_EXCEEDS_TOTAL", "The points to redeem are worth more than the order", err.Error())
+	case errors.Is(err, services.ErrInsufficientLoyaltyPoints):
+		writeErrorResponse(w, http.StatusConflict, "INSUFFICIENT_POINTS", "The user does not have enough loyalty points", err.Error())
+	case errors.Is(err, services.ErrLoyaltyServiceUnavailable):
+		writeErrorResponse(w, http.StatusServiceUnavailable, "LOYALTY_SERVICE_UNAVAILABLE", "Loyalty service is currently unavailable", err.Error())
+	case errors.Is(err, services.ErrLoyaltyRequestRejected):
+		writeErrorResponse(w, http.StatusConflict, "REDEMPTION_REJECTED", "The loyalty service rejected the redemption", err.Error())
+	default:
+		return false
+	}
+	return true
 }
 
 // ListOrders implements GET /orders endpoint as defined in api/openapi.yaml
 func ListOrders(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET method
-	if r.Method != http.MethodGet {
-		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", "")
+	// Parse filters, sort order and page size
+	query, ok := parseOrderListQuery(w, r)
+	if !ok {
 		return
 	}
 
-	// Get orders from service
-	orders, total := orderService.ListOrders()
+	// Get one page of orders from service
+	page, err := orderService.QueryOrders(r.Context(), query, r.URL.Query().Get("cursor"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_CURSOR", "Invalid pagination cursor", err.Error())
+			return
+		}
+		log.Printf("Error listing orders: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", "")
+		return
+	}
 
 	// Prepare response
 	response := models.OrderListResponse{
-		Orders: orders,
-		Total:  total,
+		Orders:     page.Orders,
+		Total:      page.Total,
+		Limit:      query.Limit,
+		NextCursor: page.NextCursor,
+		HasMore:    page.NextCursor != "",
 	}
 
 	// Send response
@@ -69,40 +230,113 @@ func ListOrders(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// CreateOrder implements POST /orders endpoint as defined in api/openapi.yaml
-func CreateOrder(w http.ResponseWriter, r *http.Request) {
-	// Only allow POST method
-	if r.Method != http.MethodPost {
-		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", "")
-		return
+// parseOrderListQuery reads the GET /orders query parameters, writing a 400
+// response and returning false if any of them is invalid
+func parseOrderListQuery(w http.ResponseWriter, r *http.Request) (services.OrderQuery, bool) {
+	params := r.URL.Query()
+	query := services.OrderQuery{
+		SortBy: services.OrderSortByOrderDate,
+		Limit:  services.DefaultOrderPageSize,
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > services.MaxOrderPageSize {
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_LIMIT", "Invalid limit",
+				fmt.Sprintf("limit must be an integer between 1 and %d", services.MaxOrderPageSize))
+			return query, false
+		}
+		query.Limit = n
 	}
 
-	// Parse request body
-	var requestBody struct {
-		UserID   string                `json:"userId"`
-		Products []models.OrderProduct `json:"products"`
+	if status := params.Get("status"); status != "" {
+		switch models.OrderStatus(status) {
+		case models.OrderStatusPending, models.OrderStatusProcessing, models.OrderStatusShipped,
+			models.OrderStatusDelivered, models.OrderStatusCanceled, models.OrderStatusReturned:
+			query.Filter.Status = models.OrderStatus(status)
+		default:
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_STATUS", "Invalid status", fmt.Sprintf("Unknown order status %q", status))
+			return query, false
+		}
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
-		return
+	if userID := params.Get("userId"); userID != "" {
+		query.Filter.UserID = userID
 	}
 
-	// Validate userId is required
-	if requestBody.UserID == "" {
-		writeErrorResponse(w, http.StatusBadRequest, "MISSING_USER_ID", "User ID is required", "")
-		return
+	if productID := params.Get("productId"); productID != "" {
+		id, err := productIDScheme.Normalize(productID)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_PRODUCT_ID", "Invalid product ID format", err.Error())
+			return query, false
+		}
+		query.Filter.ProductID = id
+	}
+
+	for _, bound := range []struct {
+		name   string
+		target *time.Time
+	}{
+		{"orderDateFrom", &query.Filter.OrderDateFrom},
+		{"orderDateTo", &query.Filter.OrderDateTo},
+	} {
+		value := params.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			// A plain date means midnight UTC
+			if t, err = time.Parse(time.DateOnly, value); err != nil {
+				writeErrorResponse(w, http.StatusBadRequest, "INVALID_DATE", "Invalid date",
+					fmt.Sprintf("%s must be an RFC 3339 date-time or a YYYY-MM-DD date", bound.name))
+				return query, false
+			}
+		}
+		*bound.target = t
+	}
+	if !query.Filter.OrderDateFrom.IsZero() && !query.Filter.OrderDateTo.IsZero() &&
+		!query.Filter.OrderDateFrom.Before(query.Filter.OrderDateTo) {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_DATE", "Invalid date range", "orderDateFrom must be before orderDateTo")
+		return query, false
+	}
+
+	switch sortBy := services.OrderSortField(params.Get("sortBy")); sortBy {
+	case "":
+	case services.OrderSortByOrderDate, services.OrderSortByTotalPrice:
+		query.SortBy = sortBy
+	default:
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_SORT", "Invalid sort field", "sortBy must be orderDate or totalPrice")
+		return query, false
+	}
+	switch params.Get("sortOrder") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_SORT", "Invalid sort order", "sortOrder must be asc or desc")
+		return query, false
 	}
 
-	// Validate userId format
-	if _, err := uuid.Parse(requestBody.UserID); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID format", "User ID must be a valid UUID")
+	return query, true
+}
+
+// CreateOrder implements POST /orders endpoint as defined in api/openapi.yaml
+func CreateOrder(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var requestBody struct {
+		UserID         string                `json:"userId"`
+		Products       []models.OrderProduct `json:"products"`
+		PointsToRedeem int                   `json:"pointsToRedeem"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
 		return
 	}
 
-	// Validate products
-	if len(requestBody.Products) == 0 {
-		writeErrorResponse(w, http.StatusBadRequest, "EMPTY_PRODUCTS", "Order must contain at least one product", "")
+	// Normalize product IDs to the configured scheme
+	if !normalizeProductIDs(w, requestBody.Products) {
 		return
 	}
 
@@ -110,24 +344,31 @@ func CreateOrder(w http.ResponseWriter, r *http.Request) {
 	authToken := r.Header.Get("Authorization")
 
 	// Create order
-	order, err := orderService.CreateOrder(requestBody.UserID, requestBody.Products, authToken)
+	order, err := orderService.CreateOrderRedeemingPoints(r.Context(), requestBody.UserID, requestBody.Products, requestBody.PointsToRedeem, authToken, actorFromRequest(r))
 	if err != nil {
 		log.Printf("Error creating order: %v", err)
+		if writeContextError(w, r, err) {
+			return
+		}
 		// Handle specific errors from Product Service
 		if errors.Is(err, services.ErrProductServiceUnavailable) {
-			writeErrorResponse(w, http.StatusServiceUnavailable, "PRODUCT_SERVICE_UNAVAILABLE", "Product validation service is currently unavailable", err.Error())
+			writeProductServiceUnavailable(w, err)
 			return
 		}
 		if errors.Is(err, services.ErrProductNotFound) {
 			writeErrorResponse(w, http.StatusBadRequest, "INVALID_PRODUCT", "One or more products are invalid", err.Error())
 			return
 		}
+		if writeLoyaltyError(w, err) {
+			return
+		}
 		writeErrorResponse(w, http.StatusInternalServerError, "ORDER_CREATION_FAILED", "Failed to create order", err.Error())
 		return
 	}
 
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", orderETag(order))
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(order); err != nil {
 		log.Printf("Error encoding order response: %v", err)
@@ -136,29 +377,10 @@ func CreateOrder(w http.ResponseWriter, r *http.Request) {
 
 // GetOrderByID implements GET /orders/{orderId} endpoint as defined in api/openapi.yaml
 func GetOrderByID(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET method
-	if r.Method != http.MethodGet {
-		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", "")
-		return
-	}
-
-	// Extract order ID from URL path
-	path := strings.TrimPrefix(r.URL.Path, "/orders/")
-	orderID := strings.Split(path, "/")[0]
-
-	if orderID == "" {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_ORDER_ID", "Order ID is required", "")
-		return
-	}
-
-	// UUID format validation using google/uuid
-	if _, err := uuid.Parse(orderID); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_ORDER_ID", "Invalid order ID format", "Order ID must be a valid UUID")
-		return
-	}
+	orderID := r.PathValue("orderId")
 
 	// Get order from service
-	order, err := orderService.GetOrderByID(orderID)
+	order, err := orderService.GetOrderByID(r.Context(), orderID)
 	if err != nil {
 		if errors.Is(err, services.ErrOrderNotFound) {
 			writeErrorResponse(w, http.StatusNotFound, "ORDER_NOT_FOUND", "The requested order could not be found", "")
@@ -169,6 +391,14 @@ func GetOrderByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Conditional GET: the client's copy is still current
+	etag := orderETag(order)
+	w.Header().Set("ETag", etag)
+	if etagMatchesNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -179,26 +409,7 @@ func GetOrderByID(w http.ResponseWriter, r *http.Request) {
 
 // UpdateOrder implements PATCH /orders/{orderId} endpoint as defined in api/openapi.yaml
 func UpdateOrder(w http.ResponseWriter, r *http.Request) {
-	// Only allow PATCH method
-	if r.Method != http.MethodPatch {
-		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", "")
-		return
-	}
-
-	// Extract order ID from URL path
-	path := strings.TrimPrefix(r.URL.Path, "/orders/")
-	orderID := strings.Split(path, "/")[0]
-
-	if orderID == "" {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_ORDER_ID", "Order ID is required", "")
-		return
-	}
-
-	// UUID format validation using google/uuid
-	if _, err := uuid.Parse(orderID); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_ORDER_ID", "Invalid order ID format", "")
-		return
-	}
+	orderID := r.PathValue("orderId")
 
 	// Parse request body
 	var requestBody struct {
@@ -210,38 +421,45 @@ func UpdateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate products
-	if len(requestBody.Products) == 0 {
-		writeErrorResponse(w, http.StatusBadRequest, "EMPTY_PRODUCTS", "Order must contain at least one product", "")
+	// Quantities can be positive (add), negative (remove), or 0 (no-op)
+	if !normalizeProductIDs(w, requestBody.Products) {
 		return
 	}
 
-	// Validate each product has required fields
-	for i, product := range requestBody.Products {
-		if product.ProductID == "" {
-			writeErrorResponse(w, http.StatusBadRequest, "INVALID_PRODUCT", "Product ID is required", fmt.Sprintf("Product at index %d is missing productId", i))
-			return
-		}
-		if _, err := uuid.Parse(product.ProductID); err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "INVALID_PRODUCT_ID", "Invalid product ID format", fmt.Sprintf("Product at index %d has invalid UUID", i))
-			return
-		}
-		// Note: quantity can be positive (add), negative (remove), or 0 (no-op)
+	// Optimistic concurrency: only apply the change to the version the client saw
+	expectedVersion, ok := expectedVersionFromRequest(r)
+	if !ok {
+		writePreconditionFailed(w, "If-Match must be an ETag returned for this order")
+		return
 	}
 
 	// Extract auth token from request
 	authToken := r.Header.Get("Authorization")
 
 	// Update order products
-	order, err := orderService.UpdateOrderProducts(orderID, requestBody.Products, authToken)
+	order, err := orderService.UpdateOrderProducts(r.Context(), orderID, requestBody.Products, authToken, actorFromRequest(r), expectedVersion)
 	if err != nil {
 		if errors.Is(err, services.ErrOrderNotFound) {
 			writeErrorResponse(w, http.StatusNotFound, "ORDER_NOT_FOUND", "The requested order could not be found", "")
 			return
 		}
+		if errors.Is(err, services.ErrVersionMismatch) {
+			writePreconditionFailed(w, err.Error())
+			return
+		}
+		if writeLifecycleError(w, err) {
+			return
+		}
+		if writeContextError(w, r, err) {
+			return
+		}
+		if errors.Is(err, services.ErrRedemptionExceedsTotal) {
+			writeErrorResponse(w, http.StatusConflict, "REDEMPTION_EXCEEDS_TOTAL", "The order would be worth less than the points redeemed against it", err.Error())
+			return
+		}
 		// Handle specific errors from Product Service
 		if errors.Is(err, services.ErrProductServiceUnavailable) {
-			writeErrorResponse(w, http.StatusServiceUnavailable, "PRODUCT_SERVICE_UNAVAILABLE", "Product validation service is currently unavailable", err.Error())
+			writeProductServiceUnavailable(w, err)
 			return
 		}
 		if errors.Is(err, services.ErrProductNotFound) {
@@ -255,6 +473,7 @@ func UpdateOrder(w http.ResponseWriter, r *http.Request) {
 
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", orderETag(order))
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(order); err != nil {
 		log.Printf("Error encoding order response: %v", err)
@@ -263,27 +482,7 @@ func UpdateOrder(w http.ResponseWriter, r *http.Request) {
 
 // CancelOrSubmitOrder implements POST /orders/{orderId}/submit endpoint as defined in api/openapi.yaml
 func CancelOrSubmitOrder(w http.ResponseWriter, r *http.Request) {
-	// Only allow POST method
-	if r.Method != http.MethodPost {
-		writeErrorResponse(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", "")
-		return
-	}
-
-	// Extract order ID from URL path: /orders/{orderId}/submit
-	path := strings.TrimPrefix(r.URL.Path, "/orders/")
-	path = strings.TrimSuffix(path, "/submit")
-	orderID := strings.Split(path, "/")[0]
-
-	if orderID == "" {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_ORDER_ID", "Order ID is required", "")
-		return
-	}
-
-	// UUID format validation using google/uuid
-	if _, err := uuid.Parse(orderID); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "INVALID_ORDER_ID", "Invalid order ID format", "")
-		return
-	}
+	orderID := r.PathValue("orderId")
 
 	// Parse request body
 	var requestBody struct {
@@ -295,15 +494,22 @@ func CancelOrSubmitOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Optimistic concurrency: only apply the action to the version the client saw
+	expectedVersion, ok := expectedVersionFromRequest(r)
+	if !ok {
+		writePreconditionFailed(w, "If-Match must be an ETag returned for this order")
+		return
+	}
+
 	var order *models.Order
 	var err error
 
 	// Perform action
 	switch requestBody.Action {
 	case "CANCEL":
-		order, err = orderService.CancelOrder(orderID)
+		order, err = orderService.CancelOrder(r.Context(), orderID, actorFromRequest(r), expectedVersion)
 	case "SUBMIT":
-		order, err = orderService.SubmitOrder(orderID)
+		order, err = orderService.SubmitOrder(r.Context(), orderID, actorFromRequest(r), expectedVersion)
 	default:
 		writeErrorResponse(w, http.StatusBadRequest, "INVALID_ACTION", "Invalid action. Must be CANCEL or SUBMIT", "")
 		return
@@ -314,14 +520,152 @@ func CancelOrSubmitOrder(w http.ResponseWriter, r *http.Request) {
 			writeErrorResponse(w, http.StatusNotFound, "ORDER_NOT_FOUND", "The requested order could not be found", "")
 			return
 		}
+		if errors.Is(err, services.ErrVersionMismatch) {
+			writePreconditionFailed(w, err.Error())
+			return
+		}
+		if writeLifecycleError(w, err) || writeContextError(w, r, err) || writeLoyaltyError(w, err) {
+			return
+		}
 		writeErrorResponse(w, http.StatusBadRequest, "ACTION_FAILED", err.Error(), "")
 		return
 	}
 
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", orderETag(order))
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(order); err != nil {
+		log.Printf("Error encoding order response: %v", err)
+	}
+}
+
+// ShipOrder implements POST /orders/{orderId}/ship endpoint as defined in api/openapi.yaml
+func ShipOrder(w http.ResponseWriter, r *http.Request) {
+	changeOrder(w, r, orderService.ShipOrder)
+}
+
+// DeliverOrder implements POST /orders/{orderId}/deliver endpoint as defined in api/openapi.yaml
+func DeliverOrder(w http.ResponseWriter, r *http.Request) {
+	changeOrder(w, r, orderService.DeliverOrder)
+}
+
+// ReturnOrder implements POST /orders/{orderId}/return endpoint as defined in api/openapi.yaml
+func ReturnOrder(w http.ResponseWriter, r *http.Request) {
+	changeOrder(w, r, orderService.ReturnOrder)
+}
+
+// RepriceOrder implements POST /orders/{orderId}/reprice endpoint as defined in api/openapi.yaml
+func RepriceOrder(w http.ResponseWriter, r *http.Request) {
+	authToken := r.Header.Get("Authorization")
+	changeOrder(w, r, func(ctx context.Context, orderID, actor string, expectedVersion int) (*models.Order, error) {
+		return orderService.RepriceOrder(ctx, orderID, authToken, actor, expectedVersion)
+	})
+}
+
+// changeOrder handles the action endpoints POST /orders/{orderId}/{action},
+// applying change to the order named in the path
+func changeOrder(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, orderID, actor string, expectedVersion int) (*models.Order, error)) {
+	orderID := r.PathValue("orderId")
+
+	// Optimistic concurrency: only apply the change to the version the client saw
+	expectedVersion, ok := expectedVersionFromRequest(r)
+	if !ok {
+		writePreconditionFailed(w, "If-Match must be an ETag returned for this order")
+		return
+	}
+
+	order, err := change(r.Context(), orderID, actorFromRequest(r), expectedVersion)
+	if err != nil {
+		if errors.Is(err, services.ErrOrderNotFound) {
+			writeErrorResponse(w, http.StatusNotFound, "ORDER_NOT_FOUND", "The requested order could not be found", "")
+			return
+		}
+		if errors.Is(err, services.ErrVersionMismatch) {
+			writePreconditionFailed(w, err.Error())
+			return
+		}
+		if writeLifecycleError(w, err) || writeContextError(w, r, err) {
+			return
+		}
+		if errors.Is(err, services.ErrRedemptionExceedsTotal) {
+			writeErrorResponse(w, http.StatusConflict, "REDEMPTION_EXCEEDS_TOTAL", "The order would be worth less than the points redeemed against it", err.Error())
+			return
+		}
+		if errors.Is(err, services.ErrProductServiceUnavailable) {
+			writeProductServiceUnavailable(w, err)
+			return
+		}
+		if errors.Is(err, services.ErrProductNotFound) {
+			writeErrorResponse(w, http.StatusBadRequest, "INVALID_PRODUCT", "One or more products are invalid", err.Error())
+			return
+		}
+		log.Printf("Error changing order: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", "")
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", orderETag(order))
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(order); err != nil {
 		log.Printf("Error encoding order response: %v", err)
 	}
 }
+
+// GetOrderEvents implements GET /orders/{orderId}/events endpoint as defined in api/openapi.yaml
+func GetOrderEvents(w http.ResponseWriter, r *http.Request) {
+	orderID := r.PathValue("orderId")
+
+	// Get order history from service
+	events, err := orderService.GetOrderEvents(r.Context(), orderID)
+	if err != nil {
+		if errors.Is(err, services.ErrOrderNotFound) {
+			writeErrorResponse(w, http.StatusNotFound, "ORDER_NOT_FOUND", "The requested order could not be found", "")
+			return
+		}
+		log.Printf("Error retrieving order events: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", "")
+		return
+	}
+
+	// Prepare response
+	response := models.OrderEventListResponse{
+		Events: events,
+		Total:  len(events),
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding order events response: %v", err)
+	}
+}
+
+// ListUserOrders implements GET /users/{userId}/orders endpoint as defined in api/openapi.yaml
+func ListUserOrders(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("userId")
+
+	// Get the user's orders from service
+	orders, _, err := orderService.ListOrdersByUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing user orders: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", "")
+		return
+	}
+
+	// Prepare response; user profiles live outside this service, so only the ID is known
+	response := models.UserOrders{
+		User:   models.User{ID: userID},
+		Orders: orders,
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding user orders response: %v", err)
+	}
+}
@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Bitovi/example-go-server/internal/models"
 	"github.com/Bitovi/example-go-server/internal/services"
@@ -15,16 +18,16 @@ import (
 // MockProductServiceClient is a test mock for ProductServiceClient
 type MockProductServiceClient struct{}
 
-func (m *MockProductServiceClient) GetProduct(productID string, authToken string) (*services.ProductResponse, error) {
+func (m *MockProductServiceClient) GetProduct(ctx context.Context, productID string, authToken string) (*services.ProductResponse, error) {
 	// Return mock data for known product IDs (supports both simple names and UUIDs)
 	mockProducts := map[string]*services.ProductResponse{
-		"product-1":                               {ID: 1, Name: "Product 1", Description: "Test product 1", Price: 10.00, Availability: true},
-		"product-2":                               {ID: 2, Name: "Product 2", Description: "Test product 2", Price: 20.00, Availability: true},
-		"product-3":                               {ID: 3, Name: "Product 3", Description: "Test product 3", Price: 30.00, Availability: true},
-		"550e8400-e29b-41d4-a716-446655440000":   {ID: 100, Name: "UUID Product 1", Description: "Test UUID product 1", Price: 10.00, Availability: true},
-		"550e8400-e29b-41d4-a716-446655440001":   {ID: 101, Name: "UUID Product 2", Description: "Test UUID product 2", Price: 10.00, Availability: true},
-		"550e8400-e29b-41d4-a716-446655440003":   {ID: 103, Name: "UUID Product 3", Description: "Test UUID product 3", Price: 15.00, Availability: true},
-		"999e9999-e99b-99d9-a999-999999999999":   {ID: 999, Name: "Random UUID Product", Description: "Any valid UUID product", Price: 10.00, Availability: true},
+		"product-1":                               {ID: "1", Name: "Product 1", Description: "Test product 1", Price: usd(1000), Availability: true},
+		"product-2":                               {ID: "2", Name: "Product 2", Description: "Test product 2", Price: usd(2000), Availability: true},
+		"product-3":                               {ID: "3", Name: "Product 3", Description: "Test product 3", Price: usd(3000), Availability: true},
+		"550e8400-e29b-41d4-a716-446655440000":   {ID: "100", Name: "UUID Product 1", Description: "Test UUID product 1", Price: usd(1000), Availability: true},
+		"550e8400-e29b-41d4-a716-446655440001":   {ID: "101", Name: "UUID Product 2", Description: "Test UUID product 2", Price: usd(1000), Availability: true},
+		"550e8400-e29b-41d4-a716-446655440003":   {ID: "103", Name: "UUID Product 3", Description: "Test UUID product 3", Price: usd(1500), Availability: true},
+		"999e9999-e99b-99d9-a999-999999999999":   {ID: "999", Name: "Random UUID Product", Description: "Any valid UUID product", Price: usd(1000), Availability: true},
 	}
 	if product, ok := mockProducts[productID]; ok {
 		return product, nil
@@ -32,24 +35,30 @@ func (m *MockProductServiceClient) GetProduct(productID string, authToken string
 	return nil, services.ErrProductNotFound
 }
 
-func (m *MockProductServiceClient) ValidateProduct(productID string, authToken string) (float64, string, error) {
-	product, err := m.GetProduct(productID, authToken)
+func (m *MockProductServiceClient) ValidateProduct(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+	product, err := m.GetProduct(ctx, productID, authToken)
 	if err != nil {
-		return 0, "", err
+		return models.Money{}, "", err
 	}
 	if !product.Availability {
-		return 0, "", services.ErrProductNotFound
+		return models.Money{}, "", services.ErrProductNotFound
 	}
 	return product.Price, product.Name, nil
 }
 
+func (m *MockProductServiceClient) ValidateProducts(ctx context.Context, productIDs []string, authToken string) []services.ProductValidation {
+	results := make([]services.ProductValidation, len(productIDs))
+	for i, id := range productIDs {
+		product, err := m.GetProduct(ctx, id, authToken)
+		results[i] = services.ProductValidation{ProductID: id, Product: product, Err: err}
+	}
+	return results
+}
+
 func TestMain(m *testing.M) {
-	// Initialize order service with mock product client
+	// Initialize order service with mock order data and mock product client
 	mockClient := &MockProductServiceClient{}
-	InitializeOrderService(mockClient)
-
-	// Reset mock data before running tests
-	services.ResetOrderMockData()
+	InitializeOrderService(services.NewMockOrderRepository(), mockClient)
 
 	// Run tests
 	code := m.Run()
@@ -59,10 +68,9 @@ func TestMain(m *testing.M) {
 
 // resetMockData should be called at the start of each test that modifies data
 func resetMockData() {
-	// Re-initialize to ensure clean state
+	// Re-initialize with a fresh repository to ensure clean state
 	mockClient := &MockProductServiceClient{}
-	InitializeOrderService(mockClient)
-	services.ResetOrderMockData()
+	InitializeOrderService(services.NewMockOrderRepository(), mockClient)
 }
 
 func TestListOrders(t *testing.T) {
@@ -98,18 +106,12 @@ func TestListOrders(t *testing.T) {
 					if len(order.Products) == 0 {
 						t.Error("Order should have products")
 					}
-					if order.TotalPrice <= 0 {
+					if order.TotalPrice.Cmp(models.Money{}) <= 0 {
 						t.Error("Order total price should be positive")
 					}
 				}
 			},
 		},
-		{
-			name:           "POST request returns 405",
-			method:         http.MethodPost,
-			expectedStatus: http.StatusMethodNotAllowed,
-			checkResponse:  nil,
-		},
 	}
 
 	for _, tt := range tests {
@@ -160,9 +162,8 @@ func TestCreateOrder(t *testing.T) {
 					t.Errorf("New order should have PENDING status, got %s", order.Status)
 				}
 				// Verify placeholder price calculation: 2 items * $10 = $20
-				expectedPrice := 20.0
-				if order.TotalPrice < expectedPrice-0.01 || order.TotalPrice > expectedPrice+0.01 {
-					t.Errorf("Expected total price %.2f, got %.2f", expectedPrice, order.TotalPrice)
+				if expectedPrice := usd(2000); order.TotalPrice != expectedPrice {
+					t.Errorf("Expected total price %s, got %s", expectedPrice, order.TotalPrice)
 				}
 			},
 		},
@@ -184,33 +185,11 @@ func TestCreateOrder(t *testing.T) {
 					t.Error("Order ID should not be empty")
 				}
 				// Verify placeholder price calculation: 1 item * $10 = $10
-				expectedPrice := 10.0
-				if order.TotalPrice < expectedPrice-0.01 || order.TotalPrice > expectedPrice+0.01 {
-					t.Errorf("Expected total price %.2f, got %.2f", expectedPrice, order.TotalPrice)
+				if expectedPrice := usd(1000); order.TotalPrice != expectedPrice {
+					t.Errorf("Expected total price %s, got %s", expectedPrice, order.TotalPrice)
 				}
 			},
 		},
-		{
-			name: "Missing userId returns 400",
-			requestBody: map[string]interface{}{
-				"products": []map[string]interface{}{
-					{"productId": "550e8400-e29b-41d4-a716-446655440000", "quantity": 1},
-				},
-			},
-			expectedStatus: http.StatusBadRequest,
-			checkResponse:  nil,
-		},
-		{
-			name: "Invalid userId format returns 400",
-			requestBody: map[string]interface{}{
-				"userId": "invalid-uuid",
-				"products": []map[string]interface{}{
-					{"productId": "550e8400-e29b-41d4-a716-446655440000", "quantity": 1},
-				},
-			},
-			expectedStatus: http.StatusBadRequest,
-			checkResponse:  nil,
-		},
 		{
 			name: "Any valid UUID productId is accepted (no product service validation)",
 			requestBody: map[string]interface{}{
@@ -226,19 +205,20 @@ func TestCreateOrder(t *testing.T) {
 					t.Fatalf("Failed to decode response: %v", err)
 				}
 				// Should succeed with placeholder pricing
-				if order.TotalPrice != 10.0 {
-					t.Errorf("Expected total price 10.00, got %.2f", order.TotalPrice)
+				if order.TotalPrice != usd(1000) {
+					t.Errorf("Expected total price 10.00, got %s", order.TotalPrice)
 				}
 			},
 		},
 		{
-			name: "Empty products array returns 400",
+			name: "Redeeming points without a loyalty service returns 400",
 			requestBody: map[string]interface{}{
-				"userId":   "750e8400-e29b-41d4-a716-446655440001",
-				"products": []interface{}{},
+				"userId":         "750e8400-e29b-41d4-a716-446655440001",
+				"products":       []map[string]interface{}{{"productId": "550e8400-e29b-41d4-a716-446655440000", "quantity": 1}},
+				"pointsToRedeem": 100,
 			},
 			expectedStatus: http.StatusBadRequest,
-			checkResponse:  nil,
+			checkResponse:  expectErrorCode("REDEMPTION_NOT_AVAILABLE"),
 		},
 		{
 			name:           "Invalid request body returns 400",
@@ -308,17 +288,12 @@ func TestGetOrderByID(t *testing.T) {
 			expectedStatus: http.StatusNotFound,
 			checkResponse:  nil,
 		},
-		{
-			name:           "Invalid UUID format returns 400",
-			orderID:        "invalid-uuid",
-			expectedStatus: http.StatusBadRequest,
-			checkResponse:  nil,
-		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, "/orders/"+tt.orderID, nil)
+			req.SetPathValue("orderId", tt.orderID)
 			w := httptest.NewRecorder()
 
 			GetOrderByID(w, req)
@@ -469,15 +444,6 @@ func TestUpdateOrder(t *testing.T) {
 				}
 			},
 		},
-		{
-			name:    "Empty products array returns 400",
-			orderID: "650e8400-e29b-41d4-a716-446655440000",
-			requestBody: map[string]interface{}{
-				"products": []interface{}{},
-			},
-			expectedStatus: http.StatusBadRequest,
-			checkResponse:  nil,
-		},
 		{
 			name:    "Invalid product ID returns 400",
 			orderID: "650e8400-e29b-41d4-a716-446655440000",
@@ -537,6 +503,7 @@ func TestUpdateOrder(t *testing.T) {
 			}
 
 			req := httptest.NewRequest(http.MethodPatch, "/orders/"+tt.orderID, bytes.NewReader(body))
+			req.SetPathValue("orderId", tt.orderID)
 			req.Header.Set("Content-Type", "application/json")
 			w := httptest.NewRecorder()
 
@@ -553,6 +520,19 @@ func TestUpdateOrder(t *testing.T) {
 	}
 }
 
+// expectErrorCode returns a response check for an error with the given code
+func expectErrorCode(code string) func(*testing.T, *httptest.ResponseRecorder) {
+	return func(t *testing.T, w *httptest.ResponseRecorder) {
+		var response models.ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Code != code {
+			t.Errorf("Expected error code %s, got %s", code, response.Code)
+		}
+	}
+}
+
 func TestCancelOrSubmitOrder(t *testing.T) {
 	resetMockData()
 
@@ -565,7 +545,7 @@ func TestCancelOrSubmitOrder(t *testing.T) {
 	}{
 		{
 			name:    "Cancel order",
-			orderID: "650e8400-e29b-41d4-a716-446655440001",
+			orderID: "650e8400-e29b-41d4-a716-446655440002",
 			requestBody: map[string]interface{}{
 				"action": "CANCEL",
 			},
@@ -596,6 +576,20 @@ func TestCancelOrSubmitOrder(t *testing.T) {
 			expectedStatus: http.StatusNotFound,
 			checkResponse:  nil,
 		},
+		{
+			name:           "Cancel shipped order returns 409",
+			orderID:        "650e8400-e29b-41d4-a716-446655440001",
+			requestBody:    map[string]interface{}{"action": "CANCEL"},
+			expectedStatus: http.StatusConflict,
+			checkResponse:  expectErrorCode("INVALID_TRANSITION"),
+		},
+		{
+			name:           "Submit canceled order returns 400",
+			orderID:        "650e8400-e29b-41d4-a716-446655440002",
+			requestBody:    map[string]interface{}{"action": "SUBMIT"},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorCode("ORDER_NOT_PENDING"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -606,6 +600,7 @@ func TestCancelOrSubmitOrder(t *testing.T) {
 			}
 
 			req := httptest.NewRequest(http.MethodPost, "/orders/"+tt.orderID+"/submit", bytes.NewReader(body))
+			req.SetPathValue("orderId", tt.orderID)
 			req.Header.Set("Content-Type", "application/json")
 			w := httptest.NewRecorder()
 
@@ -621,3 +616,702 @@ func TestCancelOrSubmitOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestGetOrderEvents(t *testing.T) {
+	resetMockData()
+
+	// Produce some history for a seeded order
+	submitReq := httptest.NewRequest(http.MethodPost, "/orders/650e8400-e29b-41d4-a716-446655440000/submit", bytes.NewReader([]byte(`{"action":"SUBMIT"}`)))
+	submitReq.SetPathValue("orderId", "650e8400-e29b-41d4-a716-446655440000")
+	CancelOrSubmitOrder(httptest.NewRecorder(), submitReq)
+
+	tests := []struct {
+		name           string
+		method         string
+		orderID        string
+		expectedStatus int
+		checkResponse  func(*testing.T, *httptest.ResponseRecorder)
+	}{
+		{
+			name:           "Returns recorded events",
+			method:         http.MethodGet,
+			orderID:        "650e8400-e29b-41d4-a716-446655440000",
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var response models.OrderEventListResponse
+				if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if response.Total != 2 || len(response.Events) != 2 {
+					t.Fatalf("Expected 2 events, got %d", response.Total)
+				}
+				// Seeded orders start their history with an OrderCreated event
+				if created := response.Events[0]; created.Type != models.OrderEventCreated || created.Actor != services.SystemActor {
+					t.Errorf("Expected OrderCreated by %s, got %s by %s", services.SystemActor, created.Type, created.Actor)
+				}
+				event := response.Events[1]
+				if event.Type != models.OrderEventSubmitted || event.Actor != "anonymous" {
+					t.Errorf("Expected Submitted by anonymous, got %s by %s", event.Type, event.Actor)
+				}
+				if event.After.Status != models.OrderStatusProcessing {
+					t.Errorf("Expected after status PROCESSING, got %s", event.After.Status)
+				}
+			},
+		},
+		{
+			name:           "Non-existent order returns 404",
+			method:         http.MethodGet,
+			orderID:        "650e8400-e29b-41d4-a716-446655440099",
+			expectedStatus: http.StatusNotFound,
+			checkResponse:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/orders/"+tt.orderID+"/events", nil)
+			req.SetPathValue("orderId", tt.orderID)
+			w := httptest.NewRecorder()
+
+			GetOrderEvents(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.checkResponse != nil {
+				tt.checkResponse(t, w)
+			}
+		})
+	}
+}
+
+func TestOrderConditionalRequests(t *testing.T) {
+	resetMockData()
+	const orderID = "650e8400-e29b-41d4-a716-446655440000"
+
+	getOrder := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orders/"+orderID, nil)
+		req.SetPathValue("orderId", orderID)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		GetOrderByID(w, req)
+		return w
+	}
+	patchOrder := func(ifMatch string) *httptest.ResponseRecorder {
+		body := []byte(`{"products":[{"productId":"550e8400-e29b-41d4-a716-446655440000","quantity":1}]}`)
+		req := httptest.NewRequest(http.MethodPatch, "/orders/"+orderID, bytes.NewReader(body))
+		req.SetPathValue("orderId", orderID)
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		UpdateOrder(w, req)
+		return w
+	}
+
+	w := getOrder("")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag != `"1"` {
+		t.Fatalf("Expected 200 with ETag \"1\", got %d with %q", w.Code, etag)
+	}
+
+	// Conditional GET with the current ETag
+	w = getOrder(etag)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected 304 with no body, got %d with %q", w.Code, w.Body.String())
+	}
+
+	// First admin patches the version they read
+	w = patchOrder(etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("ETag") != `"2"` {
+		t.Errorf("Expected ETag \"2\", got %q", w.Header().Get("ETag"))
+	}
+
+	// Second admin patches the same stale version
+	w = patchOrder(etag)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected 412, got %d", w.Code)
+	}
+	var errResp models.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if errResp.Code != "VERSION_MISMATCH" {
+		t.Errorf("Expected error code VERSION_MISMATCH, got %s", errResp.Code)
+	}
+
+	// A malformed or weak tag can never match
+	if w = patchOrder(`W/"2"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for weak ETag, got %d", w.Code)
+	}
+
+	// The old ETag no longer satisfies a conditional GET
+	if w = getOrder(etag); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for stale If-None-Match, got %d", w.Code)
+	}
+
+	// Submit honors If-Match as well
+	req := httptest.NewRequest(http.MethodPost, "/orders/"+orderID+"/submit", bytes.NewReader([]byte(`{"action":"SUBMIT"}`)))
+	req.SetPathValue("orderId", orderID)
+	req.Header.Set("If-Match", etag)
+	w = httptest.NewRecorder()
+	CancelOrSubmitOrder(w, req)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for stale submit, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/orders/"+orderID+"/submit", bytes.NewReader([]byte(`{"action":"SUBMIT"}`)))
+	req.SetPathValue("orderId", orderID)
+	req.Header.Set("If-Match", `"2"`)
+	w = httptest.NewRecorder()
+	CancelOrSubmitOrder(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+		t.Errorf("Expected 200 with ETag \"3\", got %d with %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestListOrders_FilterByUser(t *testing.T) {
+	resetMockData()
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedTotal  int
+	}{
+		{
+			name:           "Orders of a user with orders",
+			query:          "?userId=750e8400-e29b-41d4-a716-446655440000",
+			expectedStatus: http.StatusOK,
+			expectedTotal:  2,
+		},
+		{
+			name:           "User without orders returns empty list",
+			query:          "?userId=750e8400-e29b-41d4-a716-446655440002",
+			expectedStatus: http.StatusOK,
+			expectedTotal:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			ListOrders(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.OrderListResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Total != tt.expectedTotal || len(response.Orders) != tt.expectedTotal {
+				t.Errorf("Expected %d orders, got %d", tt.expectedTotal, response.Total)
+			}
+			for _, order := range response.Orders {
+				if order.UserID != req.URL.Query().Get("userId") {
+					t.Errorf("Expected only orders of the requested user, got one owned by %s", order.UserID)
+				}
+			}
+		})
+	}
+}
+
+func TestListUserOrders(t *testing.T) {
+	resetMockData()
+
+	// A newly created order is listed under its owner
+	body := []byte(`{"userId":"750e8400-e29b-41d4-a716-446655440001","products":[{"productId":"550e8400-e29b-41d4-a716-446655440000","quantity":1}]}`)
+	createReq := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(body))
+	created := httptest.NewRecorder()
+	CreateOrder(created, createReq)
+	var newOrder models.Order
+	json.NewDecoder(created.Body).Decode(&newOrder)
+	if newOrder.UserID != "750e8400-e29b-41d4-a716-446655440001" {
+		t.Fatalf("Expected created order to carry its owner, got %q", newOrder.UserID)
+	}
+
+	tests := []struct {
+		name           string
+		userID         string
+		expectedStatus int
+		expectedOrders int
+	}{
+		{
+			name:           "Returns the user's orders",
+			userID:         "750e8400-e29b-41d4-a716-446655440001",
+			expectedStatus: http.StatusOK,
+			expectedOrders: 2,
+		},
+		{
+			name:           "User without orders returns empty list",
+			userID:         "750e8400-e29b-41d4-a716-446655440002",
+			expectedStatus: http.StatusOK,
+			expectedOrders: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/"+tt.userID+"/orders", nil)
+			req.SetPathValue("userId", tt.userID)
+			w := httptest.NewRecorder()
+
+			ListUserOrders(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.UserOrders
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.User.ID != tt.userID {
+				t.Errorf("Expected user %s, got %s", tt.userID, response.User.ID)
+			}
+			if response.Orders == nil || len(response.Orders) != tt.expectedOrders {
+				t.Errorf("Expected %d orders, got %+v", tt.expectedOrders, response.Orders)
+			}
+		})
+	}
+}
+
+func TestListOrders_Pagination(t *testing.T) {
+	resetMockData()
+
+	// Page through the three seeded orders two at a time, most expensive first
+	var ids []string
+	cursor := ""
+	for page := 0; page < 2; page++ {
+		url := "/orders?limit=2&sortBy=totalPrice&sortOrder=desc"
+		if cursor != "" {
+			url += "&cursor=" + cursor
+		}
+		w := httptest.NewRecorder()
+		ListOrders(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var response models.OrderListResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Total != 3 || response.Limit != 2 {
+			t.Errorf("Expected total 3 and limit 2, got %d and %d", response.Total, response.Limit)
+		}
+		if response.HasMore != (page == 0) || (response.NextCursor != "") != response.HasMore {
+			t.Errorf("Unexpected hasMore %v with nextCursor %q on page %d", response.HasMore, response.NextCursor, page)
+		}
+		for _, order := range response.Orders {
+			ids = append(ids, order.ID)
+		}
+		cursor = response.NextCursor
+	}
+
+	expected := []string{
+		"650e8400-e29b-41d4-a716-446655440000",
+		"650e8400-e29b-41d4-a716-446655440002",
+		"650e8400-e29b-41d4-a716-446655440001",
+	}
+	if strings.Join(ids, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected orders %v, got %v", expected, ids)
+	}
+}
+
+func TestListOrders_Filters(t *testing.T) {
+	resetMockData()
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedTotal int
+	}{
+		{"By status", "?status=SHIPPED", 1},
+		{"By product", "?productId=550e8400-e29b-41d4-a716-446655440003", 1},
+		{"By date range", "?orderDateFrom=" + time.Now().AddDate(0, 0, -4).Format(time.DateOnly) + "&orderDateTo=" + time.Now().AddDate(0, 0, 1).Format(time.DateOnly), 2},
+		{"By user and status", "?userId=750e8400-e29b-41d4-a716-446655440000&status=PENDING", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ListOrders(w, httptest.NewRequest(http.MethodGet, "/orders"+tt.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var response models.OrderListResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Total != tt.expectedTotal || len(response.Orders) != tt.expectedTotal {
+				t.Errorf("Expected %d orders, got %d", tt.expectedTotal, response.Total)
+			}
+		})
+	}
+}
+
+func TestListOrders_InvalidParameters(t *testing.T) {
+	resetMockData()
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode string
+	}{
+		{"Limit too large", "?limit=101", "INVALID_LIMIT"},
+		{"Limit not a number", "?limit=ten", "INVALID_LIMIT"},
+		{"Unknown status", "?status=LOST", "INVALID_STATUS"},
+		{"Invalid product ID", "?productId=abc", "INVALID_PRODUCT_ID"},
+		{"Invalid date", "?orderDateFrom=yesterday", "INVALID_DATE"},
+		{"Empty date range", "?orderDateFrom=2026-01-02&orderDateTo=2026-01-01", "INVALID_DATE"},
+		{"Unknown sort field", "?sortBy=status", "INVALID_SORT"},
+		{"Unknown sort order", "?sortOrder=up", "INVALID_SORT"},
+		{"Garbage cursor", "?cursor=not-a-cursor", "INVALID_CURSOR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ListOrders(w, httptest.NewRequest(http.MethodGet, "/orders"+tt.query, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d", w.Code)
+			}
+			var response models.ErrorResponse
+			json.NewDecoder(w.Body).Decode(&response)
+			if response.Code != tt.expectedCode {
+				t.Errorf("Expected error code %s, got %s", tt.expectedCode, response.Code)
+			}
+		})
+	}
+}
+
+func TestShipAndDeliverOrder(t *testing.T) {
+	resetMockData()
+
+	tests := []struct {
+		name           string
+		orderID        string
+		handler        http.HandlerFunc
+		suffix         string
+		expectedStatus int
+		checkResponse  func(*testing.T, *httptest.ResponseRecorder)
+	}{
+		{
+			name:           "Ship pending order returns 409",
+			orderID:        "650e8400-e29b-41d4-a716-446655440000",
+			handler:        ShipOrder,
+			suffix:         "/ship",
+			expectedStatus: http.StatusConflict,
+			checkResponse:  expectErrorCode("INVALID_TRANSITION"),
+		},
+		{
+			name:           "Ship processing order",
+			orderID:        "650e8400-e29b-41d4-a716-446655440002",
+			handler:        ShipOrder,
+			suffix:         "/ship",
+			expectedStatus: http.StatusOK,
+			checkResponse:  expectOrderStatus(models.OrderStatusShipped),
+		},
+		{
+			name:           "Deliver shipped order",
+			orderID:        "650e8400-e29b-41d4-a716-446655440002",
+			handler:        DeliverOrder,
+			suffix:         "/deliver",
+			expectedStatus: http.StatusOK,
+			checkResponse:  expectOrderStatus(models.OrderStatusDelivered),
+		},
+		{
+			name:           "Deliver delivered order returns 409",
+			orderID:        "650e8400-e29b-41d4-a716-446655440002",
+			handler:        DeliverOrder,
+			suffix:         "/deliver",
+			expectedStatus: http.StatusConflict,
+			checkResponse:  expectErrorCode("INVALID_TRANSITION"),
+		},
+		{
+			name:           "Return delivered order",
+			orderID:        "650e8400-e29b-41d4-a716-446655440002",
+			handler:        ReturnOrder,
+			suffix:         "/return",
+			expectedStatus: http.StatusOK,
+			checkResponse:  expectOrderStatus(models.OrderStatusReturned),
+		},
+		{
+			name:           "Return returned order returns 409",
+			orderID:        "650e8400-e29b-41d4-a716-446655440002",
+			handler:        ReturnOrder,
+			suffix:         "/return",
+			expectedStatus: http.StatusConflict,
+			checkResponse:  expectErrorCode("INVALID_TRANSITION"),
+		},
+		{
+			name:           "Non-existent order returns 404",
+			orderID:        "650e8400-e29b-41d4-a716-446655440099",
+			handler:        ShipOrder,
+			suffix:         "/ship",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/orders/"+tt.orderID+tt.suffix, nil)
+			req.SetPathValue("orderId", tt.orderID)
+			w := httptest.NewRecorder()
+
+			tt.handler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.checkResponse != nil {
+				tt.checkResponse(t, w)
+			}
+		})
+	}
+}
+
+func TestRepriceOrder(t *testing.T) {
+	resetMockData()
+
+	tests := []struct {
+		name           string
+		orderID        string
+		expectedStatus int
+		checkResponse  func(*testing.T, *httptest.ResponseRecorder)
+	}{
+		{
+			name:           "Reprice pending order at current prices",
+			orderID:        "650e8400-e29b-41d4-a716-446655440000",
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var order models.Order
+				if err := json.NewDecoder(w.Body).Decode(&order); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				// Captured at 1299.99 and 29.99; the mock Product Service charges 10.00 for both
+				if order.TotalPrice != usd(3000) {
+					t.Errorf("Expected total price 30.00, got %s", order.TotalPrice)
+				}
+				if line := order.Products[0]; line.ProductName != "UUID Product 1" || line.UnitPrice != usd(1000) || line.LineTotal != usd(1000) {
+					t.Errorf("Expected the line to be repriced, got %+v", line)
+				}
+			},
+		},
+		{
+			name:           "Reprice processing order returns 400",
+			orderID:        "650e8400-e29b-41d4-a716-446655440002",
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorCode("ORDER_NOT_PENDING"),
+		},
+		{
+			name:           "Non-existent order returns 404",
+			orderID:        "650e8400-e29b-41d4-a716-446655440099",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/orders/"+tt.orderID+"/reprice", nil)
+			req.SetPathValue("orderId", tt.orderID)
+			w := httptest.NewRecorder()
+
+			RepriceOrder(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.checkResponse != nil {
+				tt.checkResponse(t, w)
+			}
+		})
+	}
+}
+
+// unavailableProductClient fails every lookup as if the Product Service were down
+type unavailableProductClient struct{}
+
+func (c unavailableProductClient) GetProduct(ctx context.Context, productID string, authToken string) (*services.ProductResponse, error) {
+	return nil, services.ErrProductServiceUnavailable
+}
+
+func (c unavailableProductClient) ValidateProduct(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+	return models.Money{}, "", services.ErrProductServiceUnavailable
+}
+
+func (c unavailableProductClient) ValidateProducts(ctx context.Context, productIDs []string, authToken string) []services.ProductValidation {
+	results := make([]services.ProductValidation, len(productIDs))
+	for i, id := range productIDs {
+		results[i] = services.ProductValidation{ProductID: id, Err: services.ErrProductServiceUnavailable}
+	}
+	return results
+}
+
+func TestCreateOrder_CircuitOpen(t *testing.T) {
+	breaker := services.NewCircuitBreakerProductClient(unavailableProductClient{}, 1, 30*time.Second)
+	InitializeOrderService(services.NewMockOrderRepository(), breaker)
+	t.Cleanup(resetMockData)
+
+	createOrder := func() *httptest.ResponseRecorder {
+		body := `{"userId": "750e8400-e29b-41d4-a716-446655440001", "products": [{"productId": "550e8400-e29b-41d4-a716-446655440000", "quantity": 1}]}`
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		CreateOrder(w, req)
+		return w
+	}
+
+	// The first failure opens the circuit
+	w := createOrder()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if w.Header().Get("Retry-After") != "" {
+		t.Errorf("Expected no Retry-After header before the circuit opens, got %q", w.Header().Get("Retry-After"))
+	}
+
+	w = createOrder()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	expectErrorCode("PRODUCT_SERVICE_UNAVAILABLE")(t, w)
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "30" {
+		t.Errorf("Expected Retry-After 30, got %q", retryAfter)
+	}
+}
+
+// blockingProductClient holds every lookup until the request context is done
+type blockingProductClient struct{}
+
+func (c blockingProductClient) GetProduct(ctx context.Context, productID string, authToken string) (*services.ProductResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c blockingProductClient) ValidateProduct(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+	<-ctx.Done()
+	return models.Money{}, "", ctx.Err()
+}
+
+func (c blockingProductClient) ValidateProducts(ctx context.Context, productIDs []string, authToken string) []services.ProductValidation {
+	<-ctx.Done()
+	results := make([]services.ProductValidation, len(productIDs))
+	for i, id := range productIDs {
+		results[i] = services.ProductValidation{ProductID: id, Err: ctx.Err()}
+	}
+	return results
+}
+
+func TestCreateOrder_RequestContextDone(t *testing.T) {
+	InitializeOrderService(services.NewMockOrderRepository(), blockingProductClient{})
+	t.Cleanup(resetMockData)
+
+	timedOut, cancelTimedOut := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelTimedOut()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name           string
+		ctx            context.Context
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "Deadline exceeded returns 504",
+			ctx:            timedOut,
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedCode:   "REQUEST_TIMEOUT",
+		},
+		{
+			name:           "Canceled request returns 503",
+			ctx:            canceled,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   "REQUEST_CANCELED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"userId": "750e8400-e29b-41d4-a716-446655440001", "products": [{"productId": "550e8400-e29b-41d4-a716-446655440000", "quantity": 1}]}`
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)).WithContext(tt.ctx)
+			w := httptest.NewRecorder()
+
+			CreateOrder(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			expectErrorCode(tt.expectedCode)(t, w)
+		})
+	}
+}
+
+func TestCreateOrder_ProductServiceBudgetExhausted(t *testing.T) {
+	// The Product Service never answers within the retry budget
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+	client := services.NewProductServiceClient(hanging.URL, "", services.WithRetryPolicy(services.RetryPolicy{MaxAttempts: 2, Budget: 50 * time.Millisecond}))
+	InitializeOrderService(services.NewMockOrderRepository(), client)
+	t.Cleanup(resetMockData)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	body := `{"userId": "750e8400-e29b-41d4-a716-446655440001", "products": [{"productId": "550e8400-e29b-41d4-a716-446655440000", "quantity": 1}]}`
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	CreateOrder(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusServiceUnavailable, w.Code, w.Body.String())
+	}
+	var response models.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Code != "PRODUCT_SERVICE_UNAVAILABLE" {
+		t.Errorf("Expected error code PRODUCT_SERVICE_UNAVAILABLE, got %s", response.Code)
+	}
+	if strings.Count(response.Details, "product service unavailable") != 1 {
+		t.Errorf("Expected the error to be wrapped once, got %q", response.Details)
+	}
+}
+
+// expectOrderStatus returns a response check for an order in the given status
+func expectOrderStatus(status models.OrderStatus) func(*testing.T, *httptest.ResponseRecorder) {
+	return func(t *testing.T, w *httptest.ResponseRecorder) {
+		var order models.Order
+		if err := json.NewDecoder(w.Body).Decode(&order); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if order.Status != status {
+			t.Errorf("Expected status %s, got %s", status, order.Status)
+		}
+		if w.Header().Get("ETag") != orderETag(&order) {
+			t.Errorf("Expected ETag %s, got %s", orderETag(&order), w.Header().Get("ETag"))
+		}
+	}
+}
+
+// usd returns an amount of cents in the default currency
+func usd(cents int64) models.Money {
+	return models.NewMoney(cents, models.DefaultCurrency)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+	"github.com/Bitovi/example-go-server/internal/services"
+)
+
+// outboxDispatcher delivers the outbox messages inspected and replayed by the
+// admin endpoints; nil when the outbox is disabled
+var outboxDispatcher *services.OutboxDispatcher
+
+// InitializeOutbox sets the dispatcher behind the /admin/outbox endpoints
+func InitializeOutbox(dispatcher *services.OutboxDispatcher) {
+	outboxDispatcher = dispatcher
+}
+
+// ListOutboxMessages implements GET /admin/outbox endpoint as defined in api/openapi.yaml
+func ListOutboxMessages(w http.ResponseWriter, r *http.Request) {
+	if outboxDispatcher == nil {
+		writeErrorResponse(w, http.StatusNotFound, "OUTBOX_DISABLED", "The outbox is not enabled", "")
+		return
+	}
+
+	status := models.OutboxStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", models.OutboxStatusPending, models.OutboxStatusDelivered, models.OutboxStatusDead:
+	default:
+		writeErrorResponse(w, http.StatusBadRequest, "INVALID_STATUS", "Invalid outbox status", "status must be PENDING, DELIVERED or DEAD")
+		return
+	}
+
+	messages, err := outboxDispatcher.Messages(status)
+	if err != nil {
+		log.Printf("Error listing outbox messages: %v", err)
+		writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", "")
+		return
+	}
+
+	response := models.OutboxMessageListResponse{
+		Messages: messages,
+		Total:    len(messages),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding outbox messages response: %v", err)
+	}
+}
+
+// ReplayOutboxMessage implements POST /admin/outbox/{messageId}/replay endpoint as defined in api/openapi.yaml
+func ReplayOutboxMessage(w http.ResponseWriter, r *http.Request) {
+	if outboxDispatcher == nil {
+		writeErrorResponse(w, http.StatusNotFound, "OUTBOX_DISABLED", "The outbox is not enabled", "")
+		return
+	}
+
+	messageID := r.PathValue("messageId")
+	message, err := outboxDispatcher.Replay(messageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOutboxMessageNotFound):
+			writeErrorResponse(w, http.StatusNotFound, "OUTBOX_MESSAGE_NOT_FOUND", "The requested outbox message could not be found", "")
+		case errors.Is(err, services.ErrOutboxMessageDelivered):
+			writeErrorResponse(w, http.StatusConflict, "OUTBOX_MESSAGE_DELIVERED", "The outbox message has already been delivered", "")
+		default:
+			log.Printf("Error replaying outbox message: %v", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", "")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(message); err != nil {
+		log.Printf("Error encoding outbox message response: %v", err)
+	}
+}
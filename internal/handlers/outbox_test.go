@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+	"github.com/Bitovi/example-go-server/internal/services"
+)
+
+// setupOutbox initializes a dispatcher over an outbox holding one delivered
+// message, for the first order, and one dead message, for the second
+func setupOutbox(t *testing.T) (delivered, dead models.OutboxMessage) {
+	t.Helper()
+	repo := services.NewInMemoryOrderRepository()
+	for _, id := range []string{"650e8400-e29b-41d4-a716-446655440000", "650e8400-e29b-41d4-a716-446655440001"} {
+		order := &models.Order{ID: id, Status: models.OrderStatusProcessing}
+		if err := repo.Create(order, nil); err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+		message := services.NewOutboxMessage(models.OutboxLoyaltyAward, id, "user-1")
+		if err := repo.UpdateWithOutbox(order, nil, []models.OutboxMessage{message}); err != nil {
+			t.Fatalf("Failed to queue outbox message: %v", err)
+		}
+	}
+
+	// The Loyalty Service accepts the first order's award and rejects the second
+	deliver := func(ctx context.Context, message *models.OutboxMessage) error {
+		if message.OrderID == "650e8400-e29b-41d4-a716-446655440001" {
+			return errors.New("loyalty service unavailable")
+		}
+		return nil
+	}
+	dispatcher := services.NewOutboxDispatcher(repo, deliver, services.RetryPolicy{MaxAttempts: 1})
+	if _, err := dispatcher.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Failed to dispatch: %v", err)
+	}
+	InitializeOutbox(dispatcher)
+	t.Cleanup(func() { InitializeOutbox(nil) })
+
+	messages, err := dispatcher.Messages("")
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("Expected 2 outbox messages, got %v (%v)", messages, err)
+	}
+	return messages[0], messages[1]
+}
+
+func TestListOutboxMessages(t *testing.T) {
+	delivered, dead := setupOutbox(t)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedIDs    []string
+		checkResponse  func(*testing.T, *httptest.ResponseRecorder)
+	}{
+		{
+			name:           "List all messages",
+			url:            "/admin/outbox",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []string{delivered.ID, dead.ID},
+		},
+		{
+			name:           "Filter by status",
+			url:            "/admin/outbox?status=DEAD",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []string{dead.ID},
+		},
+		{
+			name:           "Invalid status returns 400",
+			url:            "/admin/outbox?status=LOST",
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  expectErrorCode("INVALID_STATUS"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+
+			ListOutboxMessages(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.checkResponse != nil {
+				tt.checkResponse(t, w)
+				return
+			}
+
+			var response models.OutboxMessageListResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Total != len(tt.expectedIDs) {
+				t.Fatalf("Expected %d messages, got %+v", len(tt.expectedIDs), response)
+			}
+			for i, id := range tt.expectedIDs {
+				if response.Messages[i].ID != id {
+					t.Errorf("Expected message %s at %d, got %s", id, i, response.Messages[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayOutboxMessage(t *testing.T) {
+	delivered, dead := setupOutbox(t)
+
+	tests := []struct {
+		name           string
+		messageID      string
+		expectedStatus int
+		checkResponse  func(*testing.T, *httptest.ResponseRecorder)
+	}{
+		{
+			name:           "Replay dead message",
+			messageID:      dead.ID,
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var message models.OutboxMessage
+				if err := json.NewDecoder(w.Body).Decode(&message); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if message.Status != models.OutboxStatusPending || message.Attempts != 0 {
+					t.Errorf("Expected a pending message with no attempts, got %+v", message)
+				}
+				if message.LastError == "" {
+					t.Errorf("Expected the last error to be kept")
+				}
+			},
+		},
+		{
+			name:           "Delivered message returns 409",
+			messageID:      delivered.ID,
+			expectedStatus: http.StatusConflict,
+			checkResponse:  expectErrorCode("OUTBOX_MESSAGE_DELIVERED"),
+		},
+		{
+			name:           "Unknown message returns 404",
+			messageID:      "750e8400-e29b-41d4-a716-446655440099",
+			expectedStatus: http.StatusNotFound,
+			checkResponse:  expectErrorCode("OUTBOX_MESSAGE_NOT_FOUND"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/outbox/"+tt.messageID+"/replay", nil)
+			req.SetPathValue("messageId", tt.messageID)
+			w := httptest.NewRecorder()
+
+			ReplayOutboxMessage(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.checkResponse != nil {
+				tt.checkResponse(t, w)
+			}
+		})
+	}
+}
+
+func TestOutboxDisabled(t *testing.T) {
+	InitializeOutbox(nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/outbox", nil)
+	w := httptest.NewRecorder()
+	ListOutboxMessages(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	expectErrorCode("OUTBOX_DISABLED")(t, w)
+}
@@ -0,0 +1,283 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+	authmiddleware "github.com/bitovi-corp/auth-middleware-go/middleware"
+)
+
+// IdempotencyKeyHeader is the request header that identifies a retryable request
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the size of client supplied keys
+const maxIdempotencyKeyLength = 255
+
+// MaxRequestBodySize bounds the request bodies middleware reads into memory
+const MaxRequestBodySize = 1 << 20
+
+// replayedHeaders are the response headers stored and replayed with a response
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// fingerprintedHeaders are the request headers that, like the body, change
+// what a request does; a key reused with different values is rejected
+var fingerprintedHeaders = []string{"If-Match", "If-None-Match"}
+
+// IdempotencyRecord is the stored outcome of the first request made with a key
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request the key was first used with
+	Fingerprint string
+	// Completed is false while the first request is still being handled
+	Completed  bool
+	StatusCode int
+	Header     map[string]string
+	Body       []byte
+	ExpiresAt  time.Time
+}
+
+// IdempotencyStore keeps the responses of requests made with an idempotency key
+type IdempotencyStore interface {
+	// Reserve claims key for a request with the given fingerprint. If the key
+	// is already in use its record is returned and nothing is reserved.
+	Reserve(key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error)
+	// Complete stores the response for a reserved key
+	Complete(key string, record *IdempotencyRecord) error
+	// Release drops a reservation so that the request can be retried
+	Release(key string) error
+}
+
+// InMemoryIdempotencyStore is an IdempotencyStore backed by process memory.
+// Expired records are removed lazily. It is safe for concurrent use.
+type InMemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]*IdempotencyRecord
+	now       func() time.Time
+	nextSweep time.Time
+}
+
+// NewInMemoryIdempotencyStore creates an empty in-memory idempotency store
+func NewInMemoryIdempotencyStore() *InMemoryIdempotencyStore {
+	return &InMemoryIdempotencyStore{
+		records: make(map[string]*IdempotencyRecord),
+		now:     time.Now,
+	}
+}
+
+// Reserve claims key unless an unexpired record already exists for it
+func (s *InMemoryIdempotencyStore) Reserve(key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.After(s.nextSweep) {
+		for k, record := range s.records {
+			if now.After(record.ExpiresAt) {
+				delete(s.records, k)
+			}
+		}
+		s.nextSweep = now.Add(time.Minute)
+	}
+
+	if record, ok := s.records[key]; ok && !now.After(record.ExpiresAt) {
+		existing := *record
+		return &existing, nil
+	}
+
+	s.records[key] = &IdempotencyRecord{
+		Fingerprint: fingerprint,
+		ExpiresAt:   now.Add(ttl),
+	}
+	return nil, nil
+}
+
+// Complete stores the response for a reserved key, keeping its expiry
+func (s *InMemoryIdempotencyStore) Complete(key string, record *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reserved, ok := s.records[key]
+	if !ok {
+		return nil
+	}
+	completed := *record
+	completed.Fingerprint = reserved.Fingerprint
+	completed.ExpiresAt = reserved.ExpiresAt
+	completed.Completed = true
+	s.records[key] = &completed
+	return nil
+}
+
+// Release removes a reservation
+func (s *InMemoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+// IdempotencyMiddleware makes POST requests that carry an Idempotency-Key
+// header safe to retry. The first response for a key is stored for ttl and
+// replayed verbatim for later requests with the same key, body and
+// precondition headers; reusing a key with a different request returns 422.
+// Server errors (5xx) are not stored so that a retry can succeed once the
+// failure clears. Keys are scoped to the authenticated user.
+func IdempotencyMiddleware(store IdempotencyStore, ttl time.Duration) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if r.Method != http.MethodPost || key == "" {
+				next(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				writeJSONError(w, http.StatusBadRequest, "INVALID_IDEMPOTENCY_KEY", "Idempotency-Key is too long", "Keys must be at most 255 characters")
+				return
+			}
+
+			body, ok := readRequestBody(w, r)
+			if !ok {
+				return
+			}
+
+			scopedKey := key
+			if claims := authmiddleware.GetUserClaims(r); claims != nil {
+				scopedKey = claims.Subject + ":" + key
+			}
+			fingerprint := requestFingerprint(r, body)
+
+			existing, err := store.Reserve(scopedKey, fingerprint, ttl)
+			if err != nil {
+				log.Printf("Error reserving idempotency key: %v", err)
+				writeJSONError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", "")
+				return
+			}
+			if existing != nil {
+				replayIdempotentResponse(w, existing, fingerprint)
+				return
+			}
+
+			// Release the key unless a response is stored, including when the
+			// handler panics, so the client is not locked out until expiry
+			stored := false
+			defer func() {
+				if !stored {
+					if err := store.Release(scopedKey); err != nil {
+						log.Printf("Error releasing idempotency key: %v", err)
+					}
+				}
+			}()
+
+			recorder := &recordingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next(recorder, r)
+
+			if recorder.statusCode >= http.StatusInternalServerError {
+				return
+			}
+
+			record := &IdempotencyRecord{
+				StatusCode: recorder.statusCode,
+				Header:     make(map[string]string),
+				Body:       recorder.body.Bytes(),
+			}
+			for _, name := range replayedHeaders {
+				if value := recorder.Header().Get(name); value != "" {
+					record.Header[name] = value
+				}
+			}
+			if err := store.Complete(scopedKey, record); err != nil {
+				log.Printf("Error storing idempotent response: %v", err)
+				return
+			}
+			stored = true
+		}
+	}
+}
+
+// readRequestBody reads a request body of at most MaxRequestBodySize bytes
+// and puts it back for the next handler. If the body cannot be read it
+// answers 413 or 400 and returns false.
+func readRequestBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestBodySize))
+	if maxBytesErr := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesErr) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "REQUEST_BODY_TOO_LARGE", "Request body is too large",
+			fmt.Sprintf("Request bodies must be at most %d bytes", maxBytesErr.Limit))
+		return nil, false
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return nil, false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// replayIdempotentResponse answers a request whose key has been seen before
+func replayIdempotentResponse(w http.ResponseWriter, record *IdempotencyRecord, fingerprint string) {
+	if record.Fingerprint != fingerprint {
+		writeJSONError(w, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED",
+			"Idempotency-Key was already used for a different request", "")
+		return
+	}
+	if !record.Completed {
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, http.StatusConflict, "IDEMPOTENCY_KEY_IN_USE",
+			"A request with this Idempotency-Key is still being processed", "")
+		return
+	}
+
+	for name, value := range record.Header {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+// requestFingerprint identifies a request by its method, path, precondition
+// headers and body
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	for _, name := range fingerprintedHeaders {
+		hash.Write([]byte(name + ": " + r.Header.Get(name) + "\n"))
+	}
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// writeJSONError writes a standardized error response
+func writeJSONError(w http.ResponseWriter, statusCode int, code, message, details string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(models.ErrorResponse{Code: code, Message: message, Details: details}); err != nil {
+		log.Printf("Error encoding error response: %v", err)
+	}
+}
+
+// recordingResponseWriter passes a response through while keeping a copy of it
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingHandler returns a handler that creates a new resource on every call
+func countingHandler(calls *atomic.Int32, status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n))
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"id":"order-%d"}`, n)
+	}
+}
+
+func idempotentRequest(key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	return req
+}
+
+func TestIdempotencyMiddleware_ReplaysFirstResponse(t *testing.T) {
+	var calls atomic.Int32
+	handler := IdempotencyMiddleware(NewInMemoryIdempotencyStore(), time.Hour)(countingHandler(&calls, http.StatusCreated))
+
+	first := httptest.NewRecorder()
+	handler(first, idempotentRequest("key-1", `{"userId":"u1"}`))
+
+	replay := httptest.NewRecorder()
+	handler(replay, idempotentRequest("key-1", `{"userId":"u1"}`))
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected handler to run once, ran %d times", calls.Load())
+	}
+	if replay.Code != first.Code || replay.Body.String() != first.Body.String() {
+		t.Errorf("Expected replay %d %s, got %d %s", first.Code, first.Body.String(), replay.Code, replay.Body.String())
+	}
+	if replay.Header().Get("ETag") != first.Header().Get("ETag") || replay.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected stored headers to be replayed, got %v", replay.Header())
+	}
+	if replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected Idempotent-Replayed header on replay")
+	}
+	if first.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected no Idempotent-Replayed header on first response")
+	}
+}
+
+func TestIdempotencyMiddleware_DifferentBodyReturns422(t *testing.T) {
+	var calls atomic.Int32
+	handler := IdempotencyMiddleware(NewInMemoryIdempotencyStore(), time.Hour)(countingHandler(&calls, http.StatusCreated))
+
+	handler(httptest.NewRecorder(), idempotentRequest("key-1", `{"userId":"u1"}`))
+
+	w := httptest.NewRecorder()
+	handler(w, idempotentRequest("key-1", `{"userId":"u2"}`))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "IDEMPOTENCY_KEY_REUSED") {
+		t.Errorf("Expected IDEMPOTENCY_KEY_REUSED error, got %s", w.Body.String())
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected handler to run once, ran %d times", calls.Load())
+	}
+}
+
+func TestIdempotencyMiddleware_DifferentPreconditionReturns422(t *testing.T) {
+	var calls atomic.Int32
+	handler := IdempotencyMiddleware(NewInMemoryIdempotencyStore(), time.Hour)(countingHandler(&calls, http.StatusOK))
+
+	first := idempotentRequest("key-1", `{"action":"SUBMIT"}`)
+	first.Header.Set("If-Match", `"1"`)
+	handler(httptest.NewRecorder(), first)
+
+	retry := idempotentRequest("key-1", `{"action":"SUBMIT"}`)
+	retry.Header.Set("If-Match", `"2"`)
+	w := httptest.NewRecorder()
+	handler(w, retry)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", w.Code)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected handler to run once, ran %d times", calls.Load())
+	}
+}
+
+func TestIdempotencyMiddleware_ServerErrorsAreNotStored(t *testing.T) {
+	var calls atomic.Int32
+	handler := IdempotencyMiddleware(NewInMemoryIdempotencyStore(), time.Hour)(countingHandler(&calls, http.StatusServiceUnavailable))
+
+	handler(httptest.NewRecorder(), idempotentRequest("key-1", `{}`))
+	handler(httptest.NewRecorder(), idempotentRequest("key-1", `{}`))
+
+	if calls.Load() != 2 {
+		t.Errorf("Expected a retry after a server error to run the handler again, ran %d times", calls.Load())
+	}
+}
+
+func TestIdempotencyMiddleware_ExpiredKeysAreForgotten(t *testing.T) {
+	store := NewInMemoryIdempotencyStore()
+	now := time.Date(2026, 1, 14, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	var calls atomic.Int32
+	handler := IdempotencyMiddleware(store, time.Hour)(countingHandler(&calls, http.StatusCreated))
+
+	handler(httptest.NewRecorder(), idempotentRequest("key-1", `{}`))
+	now = now.Add(59 * time.Minute)
+	handler(httptest.NewRecorder(), idempotentRequest("key-1", `{}`))
+	if calls.Load() != 1 {
+		t.Fatalf("Expected replay within TTL, handler ran %d times", calls.Load())
+	}
+
+	now = now.Add(2 * time.Minute)
+	handler(httptest.NewRecorder(), idempotentRequest("key-1", `{}`))
+	if calls.Load() != 2 {
+		t.Errorf("Expected handler to run again after TTL, ran %d times", calls.Load())
+	}
+}
+
+func TestIdempotencyMiddleware_InProgressReturns409(t *testing.T) {
+	store := NewInMemoryIdempotencyStore()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}
+	handler := IdempotencyMiddleware(store, time.Hour)(slow)
+
+	done := make(chan struct{})
+	go func() {
+		handler(httptest.NewRecorder(), idempotentRequest("key-1", `{}`))
+		close(done)
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	handler(w, idempotentRequest("key-1", `{}`))
+	close(release)
+	<-done
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected Retry-After header")
+	}
+}
+
+func TestIdempotencyMiddleware_PassesThroughWithoutKey(t *testing.T) {
+	var calls atomic.Int32
+	handler := IdempotencyMiddleware(NewInMemoryIdempotencyStore(), time.Hour)(countingHandler(&calls, http.StatusCreated))
+
+	handler(httptest.NewRecorder(), idempotentRequest("", `{}`))
+	handler(httptest.NewRecorder(), idempotentRequest("", `{}`))
+
+	// Only POST requests are affected
+	get := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	get.Header.Set(IdempotencyKeyHeader, "key-1")
+	handler(httptest.NewRecorder(), get)
+	handler(httptest.NewRecorder(), get)
+
+	if calls.Load() != 4 {
+		t.Errorf("Expected handler to run for every request, ran %d times", calls.Load())
+	}
+}
+
+func TestIdempotencyMiddleware_RejectsLargeBodies(t *testing.T) {
+	var calls atomic.Int32
+	handler := IdempotencyMiddleware(NewInMemoryIdempotencyStore(), time.Hour)(countingHandler(&calls, http.StatusCreated))
+
+	w := httptest.NewRecorder()
+	handler(w, idempotentRequest("key-1", `{"userId":"`+strings.Repeat("u", MaxRequestBodySize)+`"}`))
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "REQUEST_BODY_TOO_LARGE") {
+		t.Errorf("Expected REQUEST_BODY_TOO_LARGE error, got %s", w.Body.String())
+	}
+	if calls.Load() != 0 {
+		t.Errorf("Expected handler not to run, ran %d times", calls.Load())
+	}
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+	"github.com/Bitovi/example-go-server/internal/openapi"
+)
+
+// RequestValidationMiddleware rejects requests whose path parameters, query
+// parameters, headers or body do not match the operation doc describes for
+// them, answering 400 with every field at fault. The error code names the
+// first of them: INVALID_ORDER_ID for the orderId parameter, for example, or
+// INVALID_REQUEST_BODY for the body. Bodies larger than MaxRequestBodySize
+// are answered with 413. Requests doc does not describe are passed on
+// unchecked.
+func RequestValidationMiddleware(doc *openapi.Document) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			op, pathParams, ok := doc.FindOperation(r.Method, r.URL.Path)
+			if !ok {
+				next(w, r)
+				return
+			}
+
+			var body []byte
+			if op.HasRequestBody() {
+				if body, ok = readRequestBody(w, r); !ok {
+					return
+				}
+			}
+
+			if fields := op.ValidateRequest(r, pathParams, body); len(fields) > 0 {
+				writeValidationError(w, fields)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// writeValidationError writes the 400 response for a request that does not
+// match the API specification
+func writeValidationError(w http.ResponseWriter, fields []models.FieldError) {
+	code, message := "INVALID_REQUEST_BODY", "Invalid request body"
+	if first := fields[0]; first.In != openapi.InBody {
+		code, message = "INVALID_"+screamingSnakeCase(first.Field), "Invalid "+first.In+" parameter "+first.Field
+	}
+	details := make([]string, len(fields))
+	for i, field := range fields {
+		details[i] = field.String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	response := models.ErrorResponse{
+		Code:    code,
+		Message: message,
+		Details: strings.Join(details, "; "),
+		Fields:  fields,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding error response: %v", err)
+	}
+}
+
+// screamingSnakeCase turns a parameter name such as orderId or
+// Idempotency-Key into ORDER_ID or IDEMPOTENCY_KEY
+func screamingSnakeCase(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		switch {
+		case c == '-' || c == '_':
+			b.WriteByte('_')
+		case unicode.IsUpper(c) && i > 0 && !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+			b.WriteRune(c)
+		default:
+			b.WriteRune(unicode.ToUpper(c))
+		}
+	}
+	return b.String()
+}
+
+// ResponseValidationMiddleware checks every response against the schema doc
+// documents for its operation and status, calling report with the
+// differences. Responses reach the client unchanged. It is meant for tests,
+// which report by failing, and for development, where differences are logged.
+func ResponseValidationMiddleware(doc *openapi.Document, report func(r *http.Request, status int, fields []models.FieldError)) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			op, _, ok := doc.FindOperation(r.Method, r.URL.Path)
+			if !ok {
+				next(w, r)
+				return
+			}
+
+			recorder := &teeResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next(recorder, r)
+
+			// Neither a HEAD response nor a 304 has a body to check
+			if r.Method == http.MethodHead || recorder.statusCode == http.StatusNotModified {
+				return
+			}
+			if fields := op.ValidateResponse(recorder.statusCode, recorder.body.Bytes()); len(fields) > 0 {
+				report(r, recorder.statusCode, fields)
+			}
+		}
+	}
+}
+
+// LogResponseDifferences is a ResponseValidationMiddleware report that logs
+// responses that do not match the API specification
+func LogResponseDifferences(r *http.Request, status int, fields []models.FieldError) {
+	for _, field := range fields {
+		log.Printf("[%s] %s --- Response %d does not match api/openapi.yaml: %s", r.Method, r.URL.Path, status, field)
+	}
+}
+
+// teeResponseWriter passes a response on while keeping a copy of it
+type teeResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rw *teeResponseWriter) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *teeResponseWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
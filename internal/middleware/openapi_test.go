@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Bitovi/example-go-server/api"
+	"github.com/Bitovi/example-go-server/internal/models"
+	"github.com/Bitovi/example-go-server/internal/openapi"
+)
+
+func TestRequestValidationMiddleware(t *testing.T) {
+	doc := openapi.MustLoad(api.OpenAPISpec)
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+		expectedCode   string
+		expectedFields int
+	}{
+		{
+			name:           "Valid request reaches the handler",
+			method:         http.MethodPost,
+			target:         "/orders/650e8400-e29b-41d4-a716-446655440000/submit",
+			body:           `{"action":"SUBMIT"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid body",
+			method:         http.MethodPost,
+			target:         "/orders",
+			body:           `{"products":[{"productId":"550e8400-e29b-41d4-a716-446655440000","quantity":0}]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_REQUEST_BODY",
+			expectedFields: 2,
+		},
+		{
+			name:           "Body too large",
+			method:         http.MethodPost,
+			target:         "/orders/650e8400-e29b-41d4-a716-446655440000/submit",
+			body:           `{"action":"SUBMIT","note":"` + strings.Repeat("x", MaxRequestBodySize) + `"}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedCode:   "REQUEST_BODY_TOO_LARGE",
+		},
+		{
+			name:           "Invalid path parameter",
+			method:         http.MethodGet,
+			target:         "/users/not-a-uuid/orders",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_USER_ID",
+			expectedFields: 1,
+		},
+		{
+			name:           "Invalid query parameter",
+			method:         http.MethodGet,
+			target:         "/orders?sortOrder=sideways",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_SORT_ORDER",
+			expectedFields: 1,
+		},
+		{
+			name:           "Undocumented requests pass through",
+			method:         http.MethodGet,
+			target:         "/products?limit=abc",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			handler := RequestValidationMiddleware(doc)(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received = string(body)
+				w.WriteHeader(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+
+			handler(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedCode == "" {
+				if received != tt.body {
+					t.Errorf("Expected the handler to read body %q, got %q", tt.body, received)
+				}
+				return
+			}
+			var response models.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Code != tt.expectedCode {
+				t.Errorf("Expected error code %s, got %s", tt.expectedCode, response.Code)
+			}
+			if len(response.Fields) != tt.expectedFields {
+				t.Errorf("Expected %d fields, got %+v", tt.expectedFields, response.Fields)
+			}
+			if response.Details == "" {
+				t.Error("Expected details listing the fields")
+			}
+		})
+	}
+}
+
+func TestResponseValidationMiddleware(t *testing.T) {
+	doc := openapi.MustLoad(api.OpenAPISpec)
+	var reported []models.FieldError
+	report := func(r *http.Request, status int, fields []models.FieldError) {
+		reported = fields
+	}
+	const body = `{"status":"healthy","timestamp":"now"}`
+	handler := ResponseValidationMiddleware(doc, report)(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(body))
+	})
+	w := httptest.NewRecorder()
+
+	handler(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if w.Code != http.StatusCreated || w.Body.String() != body {
+		t.Errorf("Expected the response to pass through unchanged, got %d %s", w.Code, w.Body.String())
+	}
+	if len(reported) != 1 || reported[0].Message != "status 201 is not documented" {
+		t.Errorf("Expected the undocumented status to be reported, got %+v", reported)
+	}
+}
+
+func TestScreamingSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"orderId":         "ORDER_ID",
+		"limit":           "LIMIT",
+		"sortBy":          "SORT_BY",
+		"Idempotency-Key": "IDEMPOTENCY_KEY",
+	}
+	for name, expected := range tests {
+		if got := screamingSnakeCase(name); got != expected {
+			t.Errorf("screamingSnakeCase(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+}
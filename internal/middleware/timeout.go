@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// TimeoutMiddleware gives every request a deadline of timeout from when it
+// arrives. Handlers pass the request context on, so product lookups and waits
+// for order locks are abandoned once the deadline passes. A zero timeout
+// leaves requests without a deadline.
+func TimeoutMiddleware(timeout time.Duration) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if timeout <= 0 {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			next(w, r.WithContext(ctx))
+		}
+	}
+}
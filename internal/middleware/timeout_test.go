@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	var ctxErr error
+	handler := TimeoutMiddleware(10 * time.Millisecond)(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("Expected the request context to have a deadline")
+		}
+		<-r.Context().Done()
+		ctxErr = r.Context().Err()
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	if !errors.Is(ctxErr, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", ctxErr)
+	}
+}
+
+func TestTimeoutMiddleware_Disabled(t *testing.T) {
+	handler := TimeoutMiddleware(0)(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Error("Expected no deadline when the timeout is zero")
+		}
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+}
+
+func TestTimeoutMiddleware_KeepsEarlierDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	want, _ := ctx.Deadline()
+
+	handler := TimeoutMiddleware(time.Hour)(func(w http.ResponseWriter, r *http.Request) {
+		if got, _ := r.Context().Deadline(); !got.Equal(want) {
+			t.Errorf("Expected deadline %v, got %v", want, got)
+		}
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil).WithContext(ctx))
+}
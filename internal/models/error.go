@@ -2,7 +2,26 @@ package models
 
 // ErrorResponse represents an error response as defined in api/openapi.yaml
 type ErrorResponse struct {
-	Code    string `json:"code"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details string       `json:"details,omitempty"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes a request value that does not match api/openapi.yaml
+type FieldError struct {
+	// In is where the value was sent: path, query, header or body
+	In string `json:"in"`
+	// Field names the parameter, or the body field as a path such as
+	// products[0].quantity; empty for the body as a whole
+	Field   string `json:"field,omitempty"`
 	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
+}
+
+// String formats the error as "field: message"
+func (e FieldError) String() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
 }
@@ -0,0 +1,20 @@
+package models
+
+// Health statuses reported by GET /health
+const (
+	HealthStatusHealthy   = "healthy"
+	HealthStatusDegraded  = "degraded"
+	HealthStatusUnhealthy = "unhealthy"
+)
+
+// ComponentHealth is the state of one dependency of the service
+type ComponentHealth struct {
+	Status  string         `json:"status"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// HealthResponse represents the response for GET /health as defined in api/openapi.yaml
+type HealthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components,omitempty"`
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// DefaultCurrency is the currency of every amount handled by the service. The
+// Product Service prices products in it.
+const DefaultCurrency = "USD"
+
+// minorUnitsPerMajor is the number of minor units (cents) in a major unit
+const minorUnitsPerMajor = 100
+
+// Money is an exact amount of money in integer minor units (cents) of an
+// ISO 4217 currency, so sums and products do not drift the way float64 does.
+//
+// In JSON an amount is a decimal number in major units with two decimal
+// places, as in api/openapi.yaml (e.g. 1359.97). The currency is not encoded:
+// decoded amounts are in DefaultCurrency. In SQL it is stored as an integer
+// number of minor units.
+type Money struct {
+	// Amount is in minor units
+	Amount   int64
+	Currency string
+}
+
+// NewMoney returns amount minor units of currency
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney parses a decimal amount in major units, such as "1359.97", as
+// currency. Amounts with more than two decimal places are rounded half away
+// from zero to the nearest minor unit.
+func ParseMoney(s, currency string) (Money, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+
+	num := new(big.Int).Mul(r.Num(), big.NewInt(minorUnitsPerMajor))
+	quo, rem := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if rem.Sign() != 0 && new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(int64(rem.Sign())))
+	}
+	if !quo.IsInt64() {
+		return Money{}, fmt.Errorf("amount %q out of range", s)
+	}
+	return NewMoney(quo.Int64(), currency), nil
+}
+
+// Add returns m + other. Adding amounts in different currencies is a
+// programming error and panics; the zero Money adds to any currency.
+func (m Money) Add(other Money) Money {
+	currency := m.Currency
+	switch {
+	case currency == "":
+		currency = other.Currency
+	case other.Currency != "" && other.Currency != currency:
+		panic(fmt.Sprintf("models: cannot add %s to %s", other.Currency, currency))
+	}
+	return NewMoney(m.Amount+other.Amount, currency)
+}
+
+// Sub returns m - other, with the same currency rules as Add
+func (m Money) Sub(other Money) Money {
+	return m.Add(other.Mul(-1))
+}
+
+// Mul returns m times n, such as a unit price times a quantity
+func (m Money) Mul(n int) Money {
+	return NewMoney(m.Amount*int64(n), m.Currency)
+}
+
+// Cmp compares the amounts of m and other, returning -1, 0 or +1
+func (m Money) Cmp(other Money) int {
+	switch {
+	case m.Amount < other.Amount:
+		return -1
+	case m.Amount > other.Amount:
+		return 1
+	}
+	return 0
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// String returns the amount in major units with two decimal places, e.g. "1359.97"
+func (m Money) String() string {
+	sign, amount := "", uint64(m.Amount)
+	if m.Amount < 0 {
+		sign, amount = "-", uint64(-m.Amount)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/minorUnitsPerMajor, amount%minorUnitsPerMajor)
+}
+
+// MarshalJSON encodes the amount as a decimal number in major units
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON decodes a decimal number in major units as DefaultCurrency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if _, err := strconv.ParseFloat(string(data), 64); err != nil {
+		return fmt.Errorf("invalid amount %s: must be a number", data)
+	}
+	parsed, err := ParseMoney(string(data), DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount as an integer number of minor units
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount, nil
+}
+
+// Scan reads an integer number of minor units as DefaultCurrency
+func (m *Money) Scan(src any) error {
+	amount, ok := src.(int64)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	*m = NewMoney(amount, DefaultCurrency)
+	return nil
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestMoney_ExactTotals(t *testing.T) {
+	// Laptop 1299.99 plus two mice at 29.99 sums to exactly 1359.97
+	laptop, _ := ParseMoney("1299.99", DefaultCurrency)
+	mouse, _ := ParseMoney("29.99", DefaultCurrency)
+	total := laptop.Add(mouse.Mul(2))
+	if total != NewMoney(135997, DefaultCurrency) || total.String() != "1359.97" {
+		t.Errorf("Expected 1359.97, got %s", total)
+	}
+
+	// Ten dimes are a dollar, unlike ten float64 0.1s
+	dime, _ := ParseMoney("0.1", DefaultCurrency)
+	sum := NewMoney(0, DefaultCurrency)
+	for i := 0; i < 10; i++ {
+		sum = sum.Add(dime)
+	}
+	if sum.Amount != 100 {
+		t.Errorf("Expected 100 cents, got %d", sum.Amount)
+	}
+
+	// A $5.00 discount off the laptop
+	if discounted := laptop.Sub(NewMoney(500, DefaultCurrency)); discounted.String() != "1294.99" {
+		t.Errorf("Expected 1294.99, got %s", discounted)
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int64
+		ok       bool
+	}{
+		{"1359.97", 135997, true},
+		{"20", 2000, true},
+		{"0.5", 50, true},
+		{"-4.25", -425, true},
+		{"1e2", 10000, true},
+		{"0.005", 1, true},
+		{"0.004", 0, true},
+		{"-0.005", -1, true},
+		{"", 0, false},
+		{"ten", 0, false},
+		{"100000000000000000000", 0, false},
+	}
+	for _, tt := range tests {
+		m, err := ParseMoney(tt.value, DefaultCurrency)
+		if (err == nil) != tt.ok || m.Amount != tt.expected {
+			t.Errorf("ParseMoney(%q) = %d, %v; expected %d, ok %v", tt.value, m.Amount, err, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestMoney_String(t *testing.T) {
+	tests := map[int64]string{0: "0.00", 5: "0.05", 2000: "20.00", 135997: "1359.97", -425: "-4.25", -5: "-0.05"}
+	for amount, expected := range tests {
+		if s := NewMoney(amount, DefaultCurrency).String(); s != expected {
+			t.Errorf("Expected %d cents to format as %s, got %s", amount, expected, s)
+		}
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	order := Order{
+		Products:   []OrderProduct{{ProductID: "prod-1", Quantity: 3, UnitPrice: NewMoney(4999, DefaultCurrency), LineTotal: NewMoney(14997, DefaultCurrency)}},
+		TotalPrice: NewMoney(14997, DefaultCurrency),
+	}
+	data, err := json.Marshal(order)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Amounts are plain decimal numbers, as documented in api/openapi.yaml
+	var raw struct {
+		Products []struct {
+			UnitPrice json.Number `json:"unitPrice"`
+			LineTotal json.Number `json:"lineTotal"`
+		} `json:"products"`
+		TotalPrice json.Number `json:"totalPrice"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		t.Fatalf("Expected amounts to be numbers, got %s: %v", data, err)
+	}
+	if raw.TotalPrice != "149.97" || raw.Products[0].UnitPrice != "49.99" || raw.Products[0].LineTotal != "149.97" {
+		t.Errorf("Unexpected encoding %s", data)
+	}
+
+	var decoded Order
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if decoded.TotalPrice != order.TotalPrice || decoded.Products[0] != order.Products[0] {
+		t.Errorf("Expected %+v, got %+v", order, decoded)
+	}
+}
+
+func TestMoney_UnmarshalJSON(t *testing.T) {
+	var m Money
+	if err := json.Unmarshal([]byte(`1359.97`), &m); err != nil || m != NewMoney(135997, DefaultCurrency) {
+		t.Errorf("Expected 1359.97 USD, got %+v, %v", m, err)
+	}
+	if err := json.Unmarshal([]byte(`"1359.97"`), &m); err == nil {
+		t.Error("Expected an amount given as a string to be rejected")
+	}
+
+	// A missing or null amount leaves the zero value, as for an unpriced line
+	var line OrderProduct
+	if err := json.Unmarshal([]byte(`{"productId":"prod-1","quantity":2,"unitPrice":null}`), &line); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if line.HasPriceSnapshot() {
+		t.Errorf("Expected an unpriced line, got %+v", line)
+	}
+}
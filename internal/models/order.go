@@ -4,10 +4,43 @@ import (
 	"time"
 )
 
-// OrderProduct represents a product within an order
+// OrderProduct represents a product within an order. ProductName and
+// UnitPrice are captured from the Product Service when the line is added and
+// kept until the order is explicitly repriced; LineTotal is UnitPrice times
+// Quantity. Clients only supply ProductID and Quantity.
 type OrderProduct struct {
-	ProductID string `json:"productId"`
-	Quantity  int    `json:"quantity"`
+	ProductID   string `json:"productId"`
+	Quantity    int    `json:"quantity"`
+	ProductName string `json:"productName,omitempty"`
+	UnitPrice   Money  `json:"unitPrice"`
+	LineTotal   Money  `json:"lineTotal"`
+}
+
+// HasPriceSnapshot reports whether the line's price was captured. Lines stored
+// before prices were captured have neither a name nor a price.
+func (p OrderProduct) HasPriceSnapshot() bool {
+	return p.ProductName != "" || !p.UnitPrice.IsZero()
+}
+
+// DiscountType identifies the kind of an order discount
+type DiscountType string
+
+const (
+	DiscountLoyaltyPoints DiscountType = "LOYALTY_POINTS"
+)
+
+// OrderDiscount is a deduction of Amount from an order's total. A
+// LOYALTY_POINTS discount redeems Points: the Loyalty Service holds them under
+// ReservationID while the order is pending and redeems them under
+// RedemptionID when it is submitted. RefundID is the transaction that credits
+// them back if the order is canceled after submission.
+type OrderDiscount struct {
+	Type          DiscountType `json:"type"`
+	Points        int          `json:"points,omitempty"`
+	Amount        Money        `json:"amount"`
+	ReservationID string       `json:"reservationId,omitempty"`
+	RedemptionID  string       `json:"redemptionId,omitempty"`
+	RefundID      string       `json:"refundId,omitempty"`
 }
 
 // OrderStatus represents the status of an order
@@ -19,19 +52,34 @@ const (
 	OrderStatusShipped    OrderStatus = "SHIPPED"
 	OrderStatusDelivered  OrderStatus = "DELIVERED"
 	OrderStatusCanceled   OrderStatus = "CANCELED"
+	OrderStatusReturned   OrderStatus = "RETURNED"
 )
 
-// Order represents an order as defined in api/openapi.yaml
+// Order represents an order as defined in api/openapi.yaml.
+// AccruedLoyaltyPoints are the points credited to the owner by the Loyalty
+// Service when the order was submitted, under LoyaltyTransactionID. When the
+// order is canceled they are debited again under LoyaltyReversalID and
+// AccruedLoyaltyPoints drops to zero. TotalPrice is the sum of the line totals
+// less any Discounts, and never negative.
 type Order struct {
-	ID         string         `json:"id"`
-	Products   []OrderProduct `json:"products"`
-	TotalPrice float64        `json:"totalPrice"`
-	OrderDate  time.Time      `json:"orderDate"`
-	Status     OrderStatus    `json:"status"`
+	ID                   string          `json:"id"`
+	UserID               string          `json:"userId"`
+	Products             []OrderProduct  `json:"products"`
+	Discounts            []OrderDiscount `json:"discounts,omitempty"`
+	TotalPrice           Money           `json:"totalPrice"`
+	AccruedLoyaltyPoints int             `json:"accruedLoyaltyPoints"`
+	LoyaltyTransactionID string          `json:"loyaltyTransactionId,omitempty"`
+	LoyaltyReversalID    string          `json:"loyaltyReversalId,omitempty"`
+	OrderDate            time.Time       `json:"orderDate"`
+	Status               OrderStatus     `json:"status"`
+	Version              int             `json:"version"`
 }
 
 // OrderListResponse represents the response for GET /orders
 type OrderListResponse struct {
-	Orders []Order `json:"orders"`
-	Total  int     `json:"total"`
+	Orders     []Order `json:"orders"`
+	Total      int     `json:"total"`
+	Limit      int     `json:"limit"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+	HasMore    bool    `json:"hasMore"`
 }
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// OrderEventType identifies the kind of change recorded by an OrderEvent
+type OrderEventType string
+
+const (
+	OrderEventCreated            OrderEventType = "OrderCreated"
+	OrderEventProductsAdjusted   OrderEventType = "ProductsAdjusted"
+	OrderEventRepriced           OrderEventType = "Repriced"
+	OrderEventSubmitted          OrderEventType = "Submitted"
+	OrderEventCanceled           OrderEventType = "Canceled"
+	OrderEventShipped            OrderEventType = "Shipped"
+	OrderEventDelivered          OrderEventType = "Delivered"
+	OrderEventReturned           OrderEventType = "Returned"
+	OrderEventRedemptionReleased OrderEventType = "RedemptionReleased"
+	OrderEventPointsRedeemed     OrderEventType = "PointsRedeemed"
+	OrderEventLoyaltyAwarded     OrderEventType = "LoyaltyAwarded"
+	OrderEventLoyaltyReversed    OrderEventType = "LoyaltyReversed"
+)
+
+// OrderEvent records a single change to an order as defined in api/openapi.yaml
+type OrderEvent struct {
+	ID        string         `json:"id"`
+	OrderID   string         `json:"orderId"`
+	Sequence  int            `json:"sequence"`
+	Type      OrderEventType `json:"type"`
+	Actor     string         `json:"actor"`
+	Timestamp time.Time      `json:"timestamp"`
+	Before    *Order         `json:"before,omitempty"`
+	After     *Order         `json:"after"`
+}
+
+// OrderEventListResponse represents the response for GET /orders/{orderId}/events
+type OrderEventListResponse struct {
+	Events []OrderEvent `json:"events"`
+	Total  int          `json:"total"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+// OutboxMessageType identifies the side effect an OutboxMessage delivers
+type OutboxMessageType string
+
+const (
+	// OutboxLoyaltyRedemption redeems the loyalty points reserved by a
+	// submitted order
+	OutboxLoyaltyRedemption OutboxMessageType = "LOYALTY_REDEMPTION"
+	// OutboxLoyaltyAward credits the loyalty points earned by a submitted order
+	OutboxLoyaltyAward OutboxMessageType = "LOYALTY_AWARD"
+	// OutboxLoyaltyReversal gives back the loyalty points awarded, redeemed or
+	// reserved by a canceled order
+	OutboxLoyaltyReversal OutboxMessageType = "LOYALTY_REVERSAL"
+)
+
+// OutboxStatus represents the delivery state of an OutboxMessage
+type OutboxStatus string
+
+const (
+	// OutboxStatusPending messages are waiting to be delivered or retried
+	OutboxStatusPending OutboxStatus = "PENDING"
+	// OutboxStatusDelivered messages have been delivered
+	OutboxStatusDelivered OutboxStatus = "DELIVERED"
+	// OutboxStatusDead messages failed too often and wait for an operator
+	OutboxStatusDead OutboxStatus = "DEAD"
+)
+
+// OutboxMessage is a side effect of an order change, stored together with the
+// change and delivered afterwards, as defined in api/openapi.yaml
+type OutboxMessage struct {
+	ID      string            `json:"id"`
+	Type    OutboxMessageType `json:"type"`
+	OrderID string            `json:"orderId"`
+	// Actor made the order change that produced the message
+	Actor         string       `json:"actor"`
+	Status        OutboxStatus `json:"status"`
+	Attempts      int          `json:"attempts"`
+	LastError     string       `json:"lastError,omitempty"`
+	CreatedAt     time.Time    `json:"createdAt"`
+	NextAttemptAt time.Time    `json:"nextAttemptAt"`
+	DeliveredAt   *time.Time   `json:"deliveredAt,omitempty"`
+}
+
+// OutboxMessageListResponse represents the response for GET /admin/outbox
+type OutboxMessageListResponse struct {
+	Messages []OutboxMessage `json:"messages"`
+	Total    int             `json:"total"`
+}
@@ -0,0 +1,323 @@
+// Package openapi loads an OpenAPI 3 document and checks requests and
+// responses against the operations it describes. It supports the parts of
+// OpenAPI and JSON Schema that api/openapi.yaml uses: path, query and header
+// parameters, JSON bodies, local $refs, and the type, format, enum, pattern,
+// length, item count, range, required and additionalProperties keywords.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a loaded OpenAPI document
+type Document struct {
+	routes     []*route
+	schemas    map[string]*Schema
+	parameters map[string]*Parameter
+}
+
+// route is a path template of the document, split into segments
+type route struct {
+	segments   []string
+	operations map[string]*Operation
+}
+
+// Operation is an operation of the document, such as POST /orders
+type Operation struct {
+	Method      string               `yaml:"-"`
+	Path        string               `yaml:"-"`
+	OperationID string               `yaml:"operationId"`
+	Parameters  []*Parameter         `yaml:"parameters"`
+	RequestBody *RequestBody         `yaml:"requestBody"`
+	Responses   map[string]*Response `yaml:"responses"`
+	doc         *Document
+}
+
+// Parameter is a path, query or header parameter of an operation
+type Parameter struct {
+	Ref      string  `yaml:"$ref"`
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+// RequestBody is the body an operation accepts
+type RequestBody struct {
+	Required bool                 `yaml:"required"`
+	Content  map[string]MediaType `yaml:"content"`
+}
+
+// Response is a response an operation documents for a status code
+type Response struct {
+	Content map[string]MediaType `yaml:"content"`
+}
+
+// MediaType holds the schema of a request or response body
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+// Schema is a JSON Schema, or a $ref to one in components/schemas
+type Schema struct {
+	Ref                  string               `yaml:"$ref"`
+	Type                 string               `yaml:"type"`
+	Format               string               `yaml:"format"`
+	Enum                 []any                `yaml:"enum"`
+	Pattern              string               `yaml:"pattern"`
+	MinLength            *int                 `yaml:"minLength"`
+	MaxLength            *int                 `yaml:"maxLength"`
+	MinItems             *int                 `yaml:"minItems"`
+	MaxItems             *int                 `yaml:"maxItems"`
+	Minimum              *float64             `yaml:"minimum"`
+	Maximum              *float64             `yaml:"maximum"`
+	Required             []string             `yaml:"required"`
+	Properties           map[string]*Schema   `yaml:"properties"`
+	Items                *Schema              `yaml:"items"`
+	AdditionalProperties additionalProperties `yaml:"additionalProperties"`
+	pattern              *regexp.Regexp
+}
+
+// additionalProperties is either a boolean or a schema the properties not
+// listed in properties must match
+type additionalProperties struct {
+	forbidden bool
+	schema    *Schema
+}
+
+func (a *additionalProperties) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var allowed bool
+		if err := node.Decode(&allowed); err != nil {
+			return err
+		}
+		a.forbidden = !allowed
+		return nil
+	}
+	a.schema = &Schema{}
+	return node.Decode(a.schema)
+}
+
+// document is the layout of an OpenAPI document
+type document struct {
+	Paths      map[string]map[string]yaml.Node `yaml:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `yaml:"schemas"`
+		Parameters map[string]*Parameter `yaml:"parameters"`
+	} `yaml:"components"`
+}
+
+// methods are the operation keys of a path item
+var methods = map[string]string{
+	"get":    http.MethodGet,
+	"put":    http.MethodPut,
+	"post":   http.MethodPost,
+	"delete": http.MethodDelete,
+	"patch":  http.MethodPatch,
+}
+
+// Load parses an OpenAPI document in YAML or JSON
+func Load(data []byte) (*Document, error) {
+	var raw document
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+
+	d := &Document{
+		schemas:    raw.Components.Schemas,
+		parameters: raw.Components.Parameters,
+	}
+	for path, item := range raw.Paths {
+		r := &route{
+			segments:   strings.Split(strings.Trim(path, "/"), "/"),
+			operations: make(map[string]*Operation),
+		}
+		for key, node := range item {
+			method, ok := methods[key]
+			if !ok {
+				continue
+			}
+			op := &Operation{}
+			if err := node.Decode(op); err != nil {
+				return nil, fmt.Errorf("invalid operation %s %s: %w", method, path, err)
+			}
+			op.Method, op.Path, op.doc = method, path, d
+			r.operations[method] = op
+		}
+		d.routes = append(d.routes, r)
+	}
+	// Prefer literal segments, so /orders/search would win over /orders/{orderId}
+	sort.Slice(d.routes, func(i, j int) bool {
+		return d.routes[i].params() < d.routes[j].params()
+	})
+
+	if err := d.compile(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// MustLoad is like Load but panics if the document is invalid. It is meant
+// for documents embedded in the binary.
+func MustLoad(data []byte) *Document {
+	d, err := Load(data)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// compile resolves the $refs of every operation and compiles the patterns of
+// every schema, so a broken document fails to load instead of failing requests
+func (d *Document) compile() error {
+	seen := make(map[*Schema]bool)
+	var compileSchema func(s *Schema, where string) error
+	compileSchema = func(s *Schema, where string) error {
+		if s == nil || seen[s] {
+			return nil
+		}
+		seen[s] = true
+		if s.Ref != "" {
+			target, err := d.schema(s.Ref)
+			if err != nil {
+				return fmt.Errorf("%s: %w", where, err)
+			}
+			return compileSchema(target, s.Ref)
+		}
+		if s.Pattern != "" {
+			pattern, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return fmt.Errorf("%s: invalid pattern: %w", where, err)
+			}
+			s.pattern = pattern
+		}
+		for name, property := range s.Properties {
+			if err := compileSchema(property, where+"."+name); err != nil {
+				return err
+			}
+		}
+		if err := compileSchema(s.Items, where+"[]"); err != nil {
+			return err
+		}
+		return compileSchema(s.AdditionalProperties.schema, where+".*")
+	}
+
+	for _, r := range d.routes {
+		for _, op := range r.operations {
+			where := op.Method + " " + op.Path
+			for i, p := range op.Parameters {
+				if p.Ref != "" {
+					target, err := d.parameter(p.Ref)
+					if err != nil {
+						return fmt.Errorf("%s: %w", where, err)
+					}
+					op.Parameters[i] = target
+				}
+				if err := compileSchema(op.Parameters[i].Schema, where+" "+op.Parameters[i].Name); err != nil {
+					return err
+				}
+			}
+			if op.RequestBody != nil {
+				for _, media := range op.RequestBody.Content {
+					if err := compileSchema(media.Schema, where+" request body"); err != nil {
+						return err
+					}
+				}
+			}
+			for status, response := range op.Responses {
+				for _, media := range response.Content {
+					if err := compileSchema(media.Schema, where+" "+status+" response"); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// schema returns the schema a $ref such as #/components/schemas/Order points to
+func (d *Document) schema(ref string) (*Schema, error) {
+	name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+	if s := d.schemas[name]; ok && s != nil {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unresolved $ref %q", ref)
+}
+
+// parameter returns the parameter a $ref such as #/components/parameters/IfMatch points to
+func (d *Document) parameter(ref string) (*Parameter, error) {
+	name, ok := strings.CutPrefix(ref, "#/components/parameters/")
+	if p := d.parameters[name]; ok && p != nil {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unresolved $ref %q", ref)
+}
+
+// resolve follows a schema's $ref; refs were checked when the document loaded
+func (d *Document) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s, _ = d.schema(s.Ref)
+	}
+	return s
+}
+
+// params counts the templated segments of a route
+func (r *route) params() int {
+	n := 0
+	for _, segment := range r.segments {
+		if isParam(segment) {
+			n++
+		}
+	}
+	return n
+}
+
+// match returns the path parameters if path matches the route's template
+func (r *route) match(path string) (map[string]string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, segment := range r.segments {
+		if isParam(segment) {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[segment[1:len(segment)-1]] = segments[i]
+		} else if segment != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// FindOperation returns the operation documented for method and path, with
+// the values of its path parameters. A HEAD request matches the GET
+// operation. ok is false when the document does not describe the request.
+func (d *Document) FindOperation(method, path string) (op *Operation, pathParams map[string]string, ok bool) {
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	for _, r := range d.routes {
+		params, matched := r.match(path)
+		if !matched {
+			continue
+		}
+		if op := r.operations[method]; op != nil {
+			return op, params, true
+		}
+	}
+	return nil, nil, false
+}
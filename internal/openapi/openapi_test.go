@@ -0,0 +1,276 @@
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Bitovi/example-go-server/api"
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+func TestFindOperation(t *testing.T) {
+	doc := MustLoad(api.OpenAPISpec)
+
+	tests := []struct {
+		method      string
+		path        string
+		operationID string
+		params      map[string]string
+	}{
+		{http.MethodGet, "/orders", "listOrders", nil},
+		{http.MethodPost, "/orders", "createOrder", nil},
+		{http.MethodHead, "/orders/abc", "getOrderById", map[string]string{"orderId": "abc"}},
+		{http.MethodPost, "/orders/abc/submit", "cancelOrSubmitOrder", map[string]string{"orderId": "abc"}},
+		{http.MethodGet, "/users/u1/orders", "listUserOrders", map[string]string{"userId": "u1"}},
+		{http.MethodDelete, "/orders/abc", "", nil},
+		{http.MethodPost, "/orders/abc/lines/submit", "", nil},
+		{http.MethodPost, "/orders//submit", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			op, params, ok := doc.FindOperation(tt.method, tt.path)
+			if tt.operationID == "" {
+				if ok {
+					t.Fatalf("Expected no operation, got %s", op.OperationID)
+				}
+				return
+			}
+			if !ok || op.OperationID != tt.operationID {
+				t.Fatalf("Expected operation %s, got %+v", tt.operationID, op)
+			}
+			for name, want := range tt.params {
+				if params[name] != want {
+					t.Errorf("Expected %s %q, got %q", name, want, params[name])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	doc := MustLoad(api.OpenAPISpec)
+	const orderID = "650e8400-e29b-41d4-a716-446655440000"
+	const line = `{"productId":"550e8400-e29b-41d4-a716-446655440000","quantity":%s}`
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		expected []models.FieldError
+	}{
+		{
+			name:   "Valid create",
+			method: http.MethodPost,
+			target: "/orders",
+			body:   `{"userId":"550e8400-e29b-41d4-a716-446655440010","products":[` + strings.Replace(line, "%s", "2", 1) + `],"pointsToRedeem":0}`,
+		},
+		{
+			name:   "Quantity below 1 on create",
+			method: http.MethodPost,
+			target: "/orders",
+			body:   `{"userId":"550e8400-e29b-41d4-a716-446655440010","products":[` + strings.Replace(line, "%s", "0", 1) + `]}`,
+			expected: []models.FieldError{
+				{In: InBody, Field: "products[0].quantity", Message: "must be at least 1"},
+			},
+		},
+		{
+			name:   "Negative quantity on update",
+			method: http.MethodPatch,
+			target: "/orders/" + orderID,
+			body:   `{"products":[` + strings.Replace(line, "%s", "-1", 1) + `]}`,
+		},
+		{
+			name:   "Missing and mistyped fields",
+			method: http.MethodPost,
+			target: "/orders",
+			body:   `{"products":[{"productId":"p-1","quantity":1.5}],"pointsToRedeem":"10"}`,
+			expected: []models.FieldError{
+				{In: InBody, Field: "userId", Message: "is required"},
+				{In: InBody, Field: "products[0].productId", Message: "must match the pattern ^([0-9]+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})$"},
+				{In: InBody, Field: "products[0].quantity", Message: "must be an integer"},
+				{In: InBody, Field: "pointsToRedeem", Message: "must be an integer"},
+			},
+		},
+		{
+			name:   "Empty products",
+			method: http.MethodPatch,
+			target: "/orders/" + orderID,
+			body:   `{"products":[]}`,
+			expected: []models.FieldError{
+				{In: InBody, Field: "products", Message: "must contain at least 1 item"},
+			},
+		},
+		{
+			name:   "Missing body",
+			method: http.MethodPost,
+			target: "/orders/" + orderID + "/submit",
+			expected: []models.FieldError{
+				{In: InBody, Message: "request body is required"},
+			},
+		},
+		{
+			name:   "Malformed body",
+			method: http.MethodPost,
+			target: "/orders/" + orderID + "/submit",
+			body:   `{"action":`,
+			expected: []models.FieldError{
+				{In: InBody, Message: "must be valid JSON: unexpected EOF"},
+			},
+		},
+		{
+			name:   "Unknown action",
+			method: http.MethodPost,
+			target: "/orders/" + orderID + "/submit",
+			body:   `{"action":"REFUND"}`,
+			expected: []models.FieldError{
+				{In: InBody, Field: "action", Message: "must be one of CANCEL, SUBMIT"},
+			},
+		},
+		{
+			name:   "Invalid path parameter",
+			method: http.MethodGet,
+			target: "/orders/not-a-uuid",
+			expected: []models.FieldError{
+				{In: InPath, Field: "orderId", Message: "must be a valid UUID"},
+			},
+		},
+		{
+			name:   "Invalid query parameters",
+			method: http.MethodGet,
+			target: "/orders?limit=abc&status=LOST&sortOrder=",
+			expected: []models.FieldError{
+				{In: InQuery, Field: "limit", Message: "must be an integer"},
+				{In: InQuery, Field: "status", Message: "must be one of PENDING, PROCESSING, SHIPPED, DELIVERED, CANCELED, RETURNED"},
+			},
+		},
+		{
+			name:   "Query parameter out of range",
+			method: http.MethodGet,
+			target: "/orders?limit=101",
+			expected: []models.FieldError{
+				{In: InQuery, Field: "limit", Message: "must be at most 100"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			op, params, ok := doc.FindOperation(req.Method, req.URL.Path)
+			if !ok {
+				t.Fatalf("No operation for %s %s", tt.method, tt.target)
+			}
+
+			fields := op.ValidateRequest(req, params, []byte(tt.body))
+
+			if len(fields) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, fields)
+			}
+			for _, want := range tt.expected {
+				found := false
+				for _, got := range fields {
+					found = found || got == want
+				}
+				if !found {
+					t.Errorf("Expected %+v among %+v", want, fields)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	doc := MustLoad(api.OpenAPISpec)
+	op, _, _ := doc.FindOperation(http.MethodGet, "/orders/650e8400-e29b-41d4-a716-446655440000")
+
+	valid := `{"id":"650e8400-e29b-41d4-a716-446655440000","userId":"550e8400-e29b-41d4-a716-446655440010",` +
+		`"products":[{"productId":"42","quantity":1,"unitPrice":9.99,"lineTotal":9.99}],` +
+		`"totalPrice":9.99,"orderDate":"2026-01-02T03:04:05Z","status":"PENDING","version":1}`
+	if fields := op.ValidateResponse(http.StatusOK, []byte(valid)); len(fields) != 0 {
+		t.Errorf("Expected a valid order, got %v", fields)
+	}
+
+	drifted := `{"id":"650e8400-e29b-41d4-a716-446655440000","products":null,"totalPrice":-1,"status":"OPEN","orderDate":"yesterday"}`
+	fields := op.ValidateResponse(http.StatusOK, []byte(drifted))
+	expected := map[string]string{
+		"products":   "must not be null",
+		"totalPrice": "must be at least 0",
+		"status":     "must be one of PENDING, PROCESSING, SHIPPED, DELIVERED, CANCELED, RETURNED",
+		"orderDate":  "must be an RFC 3339 date-time",
+	}
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected %d differences, got %v", len(expected), fields)
+	}
+	for _, field := range fields {
+		if field.In != InResponse || expected[field.Field] != field.Message {
+			t.Errorf("Unexpected difference %+v", field)
+		}
+	}
+
+	if fields := op.ValidateResponse(http.StatusTeapot, nil); len(fields) != 1 || fields[0].Message != "status 418 is not documented" {
+		t.Errorf("Expected an undocumented status, got %v", fields)
+	}
+}
+
+func TestLoad_InvalidDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		expected string
+	}{
+		{
+			name: "Unresolved schema",
+			document: `
+paths:
+  /orders:
+    get:
+      responses:
+        '200':
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Missing'
+`,
+			expected: `unresolved $ref "#/components/schemas/Missing"`,
+		},
+		{
+			name: "Unresolved parameter",
+			document: `
+paths:
+  /orders:
+    get:
+      parameters:
+        - $ref: '#/components/parameters/Missing'
+`,
+			expected: `unresolved $ref "#/components/parameters/Missing"`,
+		},
+		{
+			name: "Invalid pattern",
+			document: `
+paths:
+  /orders:
+    get:
+      parameters:
+        - name: productId
+          in: query
+          schema:
+            type: string
+            pattern: '^([0-9]+$'
+`,
+			expected: "invalid pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load([]byte(tt.document))
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// Locations of the values a FieldError is about
+const (
+	InPath     = "path"
+	InQuery    = "query"
+	InHeader   = "header"
+	InBody     = "body"
+	InResponse = "response"
+)
+
+// uuidPattern matches the canonical textual form of a UUID
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// HasRequestBody reports whether the operation documents a request body
+func (o *Operation) HasRequestBody() bool {
+	return o.RequestBody != nil
+}
+
+// ValidateRequest checks the parameters of r, with pathParams as returned by
+// FindOperation, and body against the operation. Empty query and header
+// values count as absent.
+func (o *Operation) ValidateRequest(r *http.Request, pathParams map[string]string, body []byte) []models.FieldError {
+	v := &validator{doc: o.doc}
+	query := r.URL.Query()
+	for _, p := range o.Parameters {
+		var value string
+		switch p.In {
+		case InPath:
+			value = pathParams[p.Name]
+		case InQuery:
+			value = query.Get(p.Name)
+		case InHeader:
+			value = r.Header.Get(p.Name)
+		default:
+			continue
+		}
+		if value == "" {
+			if p.Required {
+				v.fail(p.In, p.Name, "is required")
+			}
+			continue
+		}
+		v.in = p.In
+		v.validate(p.Schema, parameterValue(v.doc.resolve(p.Schema), value), p.Name)
+	}
+
+	if o.RequestBody != nil {
+		media, ok := o.RequestBody.Content["application/json"]
+		switch {
+		case len(bytes.TrimSpace(body)) == 0:
+			if o.RequestBody.Required {
+				v.fail(InBody, "", "request body is required")
+			}
+		case ok && media.Schema != nil:
+			v.in = InBody
+			v.validateJSON(media.Schema, body)
+		}
+	}
+	return v.errs
+}
+
+// ValidateResponse checks a response the operation wrote with status and
+// body against the schema documented for that status, or the default
+// response. Bodies of responses documented without JSON content are not
+// checked.
+func (o *Operation) ValidateResponse(status int, body []byte) []models.FieldError {
+	v := &validator{doc: o.doc, in: InResponse}
+	response := o.Responses[strconv.Itoa(status)]
+	if response == nil {
+		response = o.Responses["default"]
+	}
+	if response == nil {
+		v.fail(InResponse, "", fmt.Sprintf("status %d is not documented", status))
+		return v.errs
+	}
+	if media, ok := response.Content["application/json"]; ok && media.Schema != nil {
+		v.validateJSON(media.Schema, body)
+	}
+	return v.errs
+}
+
+// parameterValue converts the text of a parameter to the JSON value its
+// schema describes, leaving text that does not convert for validate to reject
+func parameterValue(s *Schema, value string) any {
+	if s == nil {
+		return value
+	}
+	switch s.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// validator collects the differences between values and their schemas
+type validator struct {
+	doc  *Document
+	in   string
+	errs []models.FieldError
+}
+
+func (v *validator) fail(in, field, message string) {
+	v.errs = append(v.errs, models.FieldError{In: in, Field: field, Message: message})
+}
+
+// validateJSON parses body and validates it against s
+func (v *validator) validateJSON(s *Schema, body []byte) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		v.fail(v.in, "", "must be valid JSON: "+err.Error())
+		return
+	}
+	v.validate(s, value, "")
+}
+
+// validate checks value, found at field, against s
+func (v *validator) validate(s *Schema, value any, field string) {
+	s = v.doc.resolve(s)
+	if s == nil {
+		return
+	}
+	if value == nil {
+		if s.Type != "" {
+			v.fail(v.in, field, "must not be null")
+		}
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			v.fail(v.in, field, "must be an object")
+			return
+		}
+		v.validateObject(s, object, field)
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			v.fail(v.in, field, "must be an array")
+			return
+		}
+		if s.MinItems != nil && len(array) < *s.MinItems {
+			v.fail(v.in, field, fmt.Sprintf("must contain at least %s", items(*s.MinItems)))
+		}
+		if s.MaxItems != nil && len(array) > *s.MaxItems {
+			v.fail(v.in, field, fmt.Sprintf("must contain at most %s", items(*s.MaxItems)))
+		}
+		for i, item := range array {
+			v.validate(s.Items, item, fmt.Sprintf("%s[%d]", field, i))
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			v.fail(v.in, field, "must be a string")
+			return
+		}
+		v.validateString(s, text, field)
+	case "integer":
+		number, ok := value.(json.Number)
+		if _, err := number.Int64(); !ok || err != nil {
+			v.fail(v.in, field, "must be an integer")
+			return
+		}
+		v.validateRange(s, number, field)
+	case "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			v.fail(v.in, field, "must be a number")
+			return
+		}
+		v.validateRange(s, number, field)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.fail(v.in, field, "must be a boolean")
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		allowed := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			allowed[i] = fmt.Sprint(e)
+		}
+		if !slices.Contains(allowed, fmt.Sprint(value)) {
+			v.fail(v.in, field, "must be one of "+strings.Join(allowed, ", "))
+		}
+	}
+}
+
+func (v *validator) validateObject(s *Schema, object map[string]any, field string) {
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			v.fail(v.in, join(field, name), "is required")
+		}
+	}
+	for name, value := range object {
+		if property, ok := s.Properties[name]; ok {
+			v.validate(property, value, join(field, name))
+			continue
+		}
+		switch {
+		case s.AdditionalProperties.schema != nil:
+			v.validate(s.AdditionalProperties.schema, value, join(field, name))
+		case s.AdditionalProperties.forbidden:
+			v.fail(v.in, join(field, name), "is not allowed")
+		}
+	}
+}
+
+func (v *validator) validateString(s *Schema, text, field string) {
+	length := utf8.RuneCountInString(text)
+	if s.MinLength != nil && length < *s.MinLength {
+		v.fail(v.in, field, fmt.Sprintf("must be at least %d characters long", *s.MinLength))
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		v.fail(v.in, field, fmt.Sprintf("must be at most %d characters long", *s.MaxLength))
+	}
+	if s.pattern != nil && !s.pattern.MatchString(text) {
+		v.fail(v.in, field, "must match the pattern "+s.Pattern)
+	}
+	switch s.Format {
+	case "uuid":
+		if !uuidPattern.MatchString(text) {
+			v.fail(v.in, field, "must be a valid UUID")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, text); err != nil {
+			v.fail(v.in, field, "must be an RFC 3339 date-time")
+		}
+	case "email":
+		if _, err := mail.ParseAddress(text); err != nil {
+			v.fail(v.in, field, "must be an email address")
+		}
+	}
+}
+
+func (v *validator) validateRange(s *Schema, number json.Number, field string) {
+	n, err := number.Float64()
+	if err != nil {
+		v.fail(v.in, field, "must be a number")
+		return
+	}
+	if s.Minimum != nil && n < *s.Minimum {
+		v.fail(v.in, field, "must be at least "+strconv.FormatFloat(*s.Minimum, 'f', -1, 64))
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		v.fail(v.in, field, "must be at most "+strconv.FormatFloat(*s.Maximum, 'f', -1, 64))
+	}
+}
+
+// join appends a property name to the path of a field
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+// items formats a number of array items
+func items(n int) string {
+	if n == 1 {
+		return "1 item"
+	}
+	return fmt.Sprintf("%d items", n)
+}
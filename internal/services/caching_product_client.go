@@ -0,0 +1,309 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// ProductCacheStats counts how product lookups were served by a CachingProductClient
+type ProductCacheStats struct {
+	// Hits were answered from the cache, including cached "not found" results
+	Hits int64 `json:"hits"`
+	// Misses were passed on to the wrapped client
+	Misses int64 `json:"misses"`
+	// Coalesced lookups waited for a concurrent miss for the same product
+	// instead of calling the wrapped client themselves
+	Coalesced int64 `json:"coalesced"`
+	// Entries is the number of products currently cached
+	Entries int `json:"entries"`
+}
+
+// productCacheEntry is a cached lookup result: a product, or ErrProductNotFound
+type productCacheEntry struct {
+	product   *ProductResponse
+	err       error
+	expiresAt time.Time
+}
+
+// productLookup is a lookup in flight that concurrent callers can wait on
+type productLookup struct {
+	done    chan struct{}
+	product *ProductResponse
+	err     error
+	// abandoned is set when the caller making the lookup gave up on it, so
+	// that waiting callers know to look the product up again
+	abandoned bool
+}
+
+// CachingProductClient is a ProductClient that caches the products returned by
+// another ProductClient. Products are kept for ttl and products that do not
+// exist for negativeTTL; other errors are never cached. Concurrent lookups of
+// the same uncached product share a single call to the wrapped client.
+//
+// Products are cached by ID alone, so the auth token of whichever request
+// missed the cache is the one passed on. It is safe for concurrent use.
+type CachingProductClient struct {
+	next        ProductClient
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*productCacheEntry
+	inflight  map[string]*productLookup
+	stats     ProductCacheStats
+	nextSweep time.Time
+}
+
+// NewCachingProductClient wraps next with a cache. A negativeTTL of zero
+// disables caching of products that were not found.
+func NewCachingProductClient(next ProductClient, ttl, negativeTTL time.Duration) *CachingProductClient {
+	return &CachingProductClient{
+		next:        next,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		entries:     make(map[string]*productCacheEntry),
+		inflight:    make(map[string]*productLookup),
+	}
+}
+
+// GetProduct returns the cached product or fetches it from the wrapped client
+func (c *CachingProductClient) GetProduct(ctx context.Context, productID string, authToken string) (*ProductResponse, error) {
+	for {
+		c.mu.Lock()
+		now := c.now()
+		c.sweep(now)
+
+		if entry, ok := c.entries[productID]; ok && now.Before(entry.expiresAt) {
+			c.stats.Hits++
+			c.mu.Unlock()
+			return copyProduct(entry.product), entry.err
+		}
+
+		lookup, ok := c.inflight[productID]
+		if !ok {
+			return c.lookupProduct(ctx, productID, authToken)
+		}
+		c.stats.Coalesced++
+		c.mu.Unlock()
+
+		if err := waitForLookup(ctx, lookup); err != nil {
+			return nil, err
+		}
+		// Look the product up again if the caller that started the lookup
+		// gave up on it
+		if !lookup.abandoned || ctx.Err() != nil {
+			return copyProduct(lookup.product), lookup.err
+		}
+	}
+}
+
+// lookupProduct fetches an uncached product that no one else is looking up.
+// The caller must hold c.mu, which is released.
+func (c *CachingProductClient) lookupProduct(ctx context.Context, productID string, authToken string) (*ProductResponse, error) {
+	// Waiters see ErrProductServiceUnavailable if the wrapped client panics
+	lookup := &productLookup{done: make(chan struct{}), err: ErrProductServiceUnavailable}
+	c.inflight[productID] = lookup
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	// Wake up waiting callers even if the wrapped client panics
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, productID)
+		c.mu.Unlock()
+		close(lookup.done)
+	}()
+
+	lookup.product, lookup.err = c.next.GetProduct(ctx, productID, authToken)
+	lookup.abandoned = ctx.Err() != nil
+
+	c.mu.Lock()
+	c.store(productID, lookup.product, lookup.err)
+	c.mu.Unlock()
+
+	return copyProduct(lookup.product), lookup.err
+}
+
+// ValidateProduct checks a possibly cached product for availability
+func (c *CachingProductClient) ValidateProduct(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+	product, err := c.GetProduct(ctx, productID, authToken)
+	if err != nil {
+		return models.Money{}, "", err
+	}
+	return checkProductAvailable(productID, product)
+}
+
+// ValidateProducts validates products from the cache where possible. Products
+// that are not cached are validated with a single ValidateProducts call to the
+// wrapped client; products already being looked up by another caller are
+// waited for instead.
+func (c *CachingProductClient) ValidateProducts(ctx context.Context, productIDs []string, authToken string) []ProductValidation {
+	results := make([]ProductValidation, len(productIDs))
+	waiting := make(map[int]*productLookup)
+	owned := make(map[string]*productLookup)
+	var missed []string
+
+	c.mu.Lock()
+	now := c.now()
+	c.sweep(now)
+	for i, id := range productIDs {
+		if entry, ok := c.entries[id]; ok && now.Before(entry.expiresAt) {
+			c.stats.Hits++
+			results[i] = newProductValidation(id, copyProduct(entry.product), entry.err)
+			continue
+		}
+		if lookup, ok := owned[id]; ok {
+			waiting[i] = lookup
+			continue
+		}
+		if lookup, ok := c.inflight[id]; ok {
+			c.stats.Coalesced++
+			waiting[i] = lookup
+			continue
+		}
+		lookup := &productLookup{done: make(chan struct{}), err: ErrProductServiceUnavailable}
+		c.inflight[id] = lookup
+		owned[id] = lookup
+		waiting[i] = lookup
+		missed = append(missed, id)
+		c.stats.Misses++
+	}
+	c.mu.Unlock()
+
+	if len(missed) > 0 {
+		c.fetchProducts(ctx, missed, owned, authToken)
+	}
+
+	for i, lookup := range waiting {
+		if err := waitForLookup(ctx, lookup); err != nil {
+			results[i] = ProductValidation{ProductID: productIDs[i], Err: err}
+			continue
+		}
+		if lookup.abandoned && ctx.Err() == nil {
+			// Another caller started the lookup and gave up on it
+			product, err := c.GetProduct(ctx, productIDs[i], authToken)
+			results[i] = newProductValidation(productIDs[i], product, err)
+			continue
+		}
+		results[i] = newProductValidation(productIDs[i], copyProduct(lookup.product), lookup.err)
+	}
+	return results
+}
+
+// fetchProducts validates missed products with the wrapped client, caches the
+// results and completes their lookups
+func (c *CachingProductClient) fetchProducts(ctx context.Context, missed []string, lookups map[string]*productLookup, authToken string) {
+	// Wake up waiting callers even if the wrapped client panics
+	defer func() {
+		c.mu.Lock()
+		for _, id := range missed {
+			delete(c.inflight, id)
+		}
+		c.mu.Unlock()
+		for _, id := range missed {
+			close(lookups[id].done)
+		}
+	}()
+
+	fetched := c.next.ValidateProducts(ctx, missed, authToken)
+	abandoned := ctx.Err() != nil
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, result := range fetched {
+		lookup, ok := lookups[result.ProductID]
+		if !ok {
+			continue
+		}
+		lookup.abandoned = abandoned
+		// A product that was fetched but failed validation, e.g. because it is
+		// unavailable, is still cached; the check is repeated on every hit
+		if result.Product != nil {
+			lookup.product, lookup.err = result.Product, nil
+		} else {
+			lookup.product, lookup.err = nil, result.Err
+		}
+		c.store(result.ProductID, lookup.product, lookup.err)
+	}
+}
+
+// waitForLookup waits for lookup to complete, failing if ctx is done first
+func waitForLookup(ctx context.Context, lookup *productLookup) error {
+	select {
+	case <-lookup.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrProductServiceUnavailable, ctx.Err())
+	}
+}
+
+// store caches the outcome of a lookup. The caller must hold c.mu.
+func (c *CachingProductClient) store(productID string, product *ProductResponse, err error) {
+	switch {
+	case err == nil:
+		c.entries[productID] = &productCacheEntry{product: product, expiresAt: c.now().Add(c.ttl)}
+	case errors.Is(err, ErrProductNotFound) && c.negativeTTL > 0:
+		c.entries[productID] = &productCacheEntry{err: err, expiresAt: c.now().Add(c.negativeTTL)}
+	}
+}
+
+// Invalidate drops a product from the cache so the next lookup fetches it again
+func (c *CachingProductClient) Invalidate(productID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, productID)
+}
+
+// Stats returns the cache counters
+func (c *CachingProductClient) Stats() ProductCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+// Health reports the cache counters for GET /health
+func (c *CachingProductClient) Health() models.ComponentHealth {
+	stats := c.Stats()
+	return models.ComponentHealth{
+		Status: models.HealthStatusHealthy,
+		Details: map[string]any{
+			"hits":      stats.Hits,
+			"misses":    stats.Misses,
+			"coalesced": stats.Coalesced,
+			"entries":   stats.Entries,
+		},
+	}
+}
+
+// sweep drops expired entries at most once a minute. The caller must hold c.mu.
+func (c *CachingProductClient) sweep(now time.Time) {
+	if now.Before(c.nextSweep) {
+		return
+	}
+	for id, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+	c.nextSweep = now.Add(time.Minute)
+}
+
+// copyProduct returns a copy of product so that callers cannot modify the cache
+func copyProduct(product *ProductResponse) *ProductResponse {
+	if product == nil {
+		return nil
+	}
+	clone := *product
+	return &clone
+}
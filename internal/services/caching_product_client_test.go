@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingProductClient returns a product client that counts lookups per ID.
+// Unknown IDs are not found and "prod-down" fails as if the service was down.
+func countingProductClient(calls *atomic.Int32, block <-chan struct{}) *MockProductServiceClient {
+	return &MockProductServiceClient{
+		GetProductFunc: func(ctx context.Context, productID string, authToken string) (*ProductResponse, error) {
+			calls.Add(1)
+			if block != nil {
+				<-block
+			}
+			switch productID {
+			case "prod-1":
+				return &ProductResponse{ID: "1", Name: "Laptop", Price: usd(99999), Availability: true}, nil
+			case "prod-2":
+				return &ProductResponse{ID: "2", Name: "Lamp", Price: usd(4999), Availability: false}, nil
+			case "prod-down":
+				return nil, ErrProductServiceUnavailable
+			}
+			return nil, ErrProductNotFound
+		},
+	}
+}
+
+func TestCachingProductClient_CachesProducts(t *testing.T) {
+	var calls atomic.Int32
+	client := NewCachingProductClient(countingProductClient(&calls, nil), time.Minute, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		price, name, err := client.ValidateProduct(context.Background(), "prod-1", "")
+		if err != nil || price != usd(99999) || name != "Laptop" {
+			t.Fatalf("Unexpected result %v %q %v", price, name, err)
+		}
+	}
+	if _, _, err := client.ValidateProduct(context.Background(), "prod-2", ""); err == nil {
+		t.Error("Expected unavailable product to fail validation")
+	}
+
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 calls to the product service, got %d", calls.Load())
+	}
+	if stats := client.Stats(); stats.Hits != 2 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestCachingProductClient_ReturnsCopies(t *testing.T) {
+	var calls atomic.Int32
+	client := NewCachingProductClient(countingProductClient(&calls, nil), time.Minute, time.Minute)
+
+	product, _ := client.GetProduct(context.Background(), "prod-1", "")
+	product.Price = usd(0)
+
+	if cached, _ := client.GetProduct(context.Background(), "prod-1", ""); cached.Price != usd(99999) {
+		t.Errorf("Expected cached price to be unchanged, got %v", cached.Price)
+	}
+}
+
+func TestCachingProductClient_Expiry(t *testing.T) {
+	var calls atomic.Int32
+	client := NewCachingProductClient(countingProductClient(&calls, nil), time.Minute, 10*time.Second)
+	now := time.Date(2026, 1, 14, 12, 0, 0, 0, time.UTC)
+	client.now = func() time.Time { return now }
+
+	client.GetProduct(context.Background(), "prod-1", "")
+	if _, err := client.GetProduct(context.Background(), "prod-missing", ""); !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("Expected ErrProductNotFound, got %v", err)
+	}
+
+	// Not found results expire first
+	now = now.Add(30 * time.Second)
+	client.GetProduct(context.Background(), "prod-1", "")
+	if _, err := client.GetProduct(context.Background(), "prod-missing", ""); !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("Expected ErrProductNotFound, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("Expected 3 calls after the negative entry expired, got %d", calls.Load())
+	}
+
+	now = now.Add(time.Minute)
+	client.GetProduct(context.Background(), "prod-1", "")
+	if calls.Load() != 4 {
+		t.Errorf("Expected product to be fetched again after TTL, got %d calls", calls.Load())
+	}
+}
+
+func TestCachingProductClient_ErrorsAreNotCached(t *testing.T) {
+	var calls atomic.Int32
+	client := NewCachingProductClient(countingProductClient(&calls, nil), time.Minute, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetProduct(context.Background(), "prod-down", ""); !errors.Is(err, ErrProductServiceUnavailable) {
+			t.Fatalf("Expected ErrProductServiceUnavailable, got %v", err)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected every failed lookup to be retried, got %d calls", calls.Load())
+	}
+}
+
+func TestCachingProductClient_NegativeCachingDisabled(t *testing.T) {
+	var calls atomic.Int32
+	client := NewCachingProductClient(countingProductClient(&calls, nil), time.Minute, 0)
+
+	client.GetProduct(context.Background(), "prod-missing", "")
+	client.GetProduct(context.Background(), "prod-missing", "")
+	if calls.Load() != 2 {
+		t.Errorf("Expected not found results to be refetched, got %d calls", calls.Load())
+	}
+}
+
+func TestCachingProductClient_Invalidate(t *testing.T) {
+	var calls atomic.Int32
+	client := NewCachingProductClient(countingProductClient(&calls, nil), time.Minute, time.Minute)
+
+	client.GetProduct(context.Background(), "prod-1", "")
+	client.Invalidate("prod-1")
+	client.GetProduct(context.Background(), "prod-1", "")
+	if calls.Load() != 2 {
+		t.Errorf("Expected product to be refetched after invalidation, got %d calls", calls.Load())
+	}
+}
+
+func TestCachingProductClient_CoalescesConcurrentLookups(t *testing.T) {
+	var calls atomic.Int32
+	block := make(chan struct{})
+	client := NewCachingProductClient(countingProductClient(&calls, block), time.Minute, time.Minute)
+
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if product, err := client.GetProduct(context.Background(), "prod-1", ""); err != nil || product.Name != "Laptop" {
+				t.Errorf("Unexpected result %+v %v", product, err)
+			}
+		}()
+	}
+
+	// Let the first lookup finish once every other caller is waiting on it
+	for client.Stats().Coalesced < workers-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(block)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 call to the product service, got %d", calls.Load())
+	}
+}
+
+func TestCachingProductClient_WaitingCallerLooksUpAbandonedProduct(t *testing.T) {
+	var calls atomic.Int32
+	next := &MockProductServiceClient{
+		GetProductFunc: func(ctx context.Context, productID string, authToken string) (*ProductResponse, error) {
+			// The first lookup hangs until its caller gives up
+			if calls.Add(1) == 1 {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &ProductResponse{ID: "1", Name: "Laptop", Price: usd(99999), Availability: true}, nil
+		},
+	}
+	client := NewCachingProductClient(next, time.Minute, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	abandoned := make(chan error, 1)
+	go func() {
+		_, err := client.GetProduct(ctx, "prod-1", "")
+		abandoned <- err
+	}()
+	for calls.Load() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	waited := make(chan *ProductResponse, 1)
+	go func() {
+		product, err := client.GetProduct(context.Background(), "prod-1", "")
+		if err != nil {
+			t.Errorf("Expected the waiting caller to succeed, got %v", err)
+		}
+		waited <- product
+	}()
+	for client.Stats().Coalesced < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if err := <-abandoned; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if product := <-waited; product == nil || product.Name != "Laptop" {
+		t.Errorf("Expected the product to be looked up again, got %+v", product)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 calls to the product service, got %d", calls.Load())
+	}
+}
+
+func TestCachingProductClient_WaitingCallerDeadline(t *testing.T) {
+	var calls atomic.Int32
+	block := make(chan struct{})
+	defer close(block)
+	client := NewCachingProductClient(countingProductClient(&calls, block), time.Minute, time.Minute)
+
+	go client.GetProduct(context.Background(), "prod-1", "")
+	for calls.Load() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetProduct(ctx, "prod-1", ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	results := client.ValidateProducts(ctx, []string{"prod-1"}, "")
+	if !errors.Is(results[0].Err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", results[0].Err)
+	}
+}
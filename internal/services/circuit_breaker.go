@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// CircuitState is the state of a CircuitBreakerProductClient
+type CircuitState string
+
+const (
+	// CircuitClosed passes every call through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails every call without contacting the Product Service
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single probe call through to test for recovery
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitOpenError is returned instead of calling the Product Service while
+// the circuit is open. It matches ErrProductServiceUnavailable.
+type CircuitOpenError struct {
+	// RetryAfter is how long until the circuit lets a call through again
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open, retry in %v", e.RetryAfter.Round(time.Second))
+}
+
+// Is makes a CircuitOpenError match ErrProductServiceUnavailable
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrProductServiceUnavailable
+}
+
+// RetryAfterSeconds returns RetryAfter rounded up to whole seconds, as used in
+// a Retry-After header
+func (e *CircuitOpenError) RetryAfterSeconds() int {
+	return max(int(math.Ceil(e.RetryAfter.Seconds())), 1)
+}
+
+// CircuitBreakerProductClient is a ProductClient that stops calling a failing
+// Product Service. After failureThreshold consecutive failed calls the circuit
+// opens and calls fail immediately with a CircuitOpenError. Once cooldown has
+// passed a single probe call is let through: if it succeeds the circuit closes,
+// otherwise it opens for another cooldown.
+//
+// Products that do not exist or are unavailable are answers, not failures, and
+// calls abandoned by their caller are not counted at all.
+// It is safe for concurrent use.
+type CircuitBreakerProductClient struct {
+	next             ProductClient
+	failureThreshold int
+	cooldown         time.Duration
+	now              func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreakerProductClient wraps next with a circuit breaker
+func NewCircuitBreakerProductClient(next ProductClient, failureThreshold int, cooldown time.Duration) *CircuitBreakerProductClient {
+	return &CircuitBreakerProductClient{
+		next:             next,
+		failureThreshold: max(failureThreshold, 1),
+		cooldown:         cooldown,
+		now:              time.Now,
+		state:            CircuitClosed,
+	}
+}
+
+// GetProduct fetches a product unless the circuit is open
+func (b *CircuitBreakerProductClient) GetProduct(ctx context.Context, productID string, authToken string) (*ProductResponse, error) {
+	probe, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	product, err := b.next.GetProduct(ctx, productID, authToken)
+	b.record(ctx, probe, isProductServiceFailure(err))
+	return product, err
+}
+
+// ValidateProduct validates a product unless the circuit is open
+func (b *CircuitBreakerProductClient) ValidateProduct(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+	product, err := b.GetProduct(ctx, productID, authToken)
+	if err != nil {
+		return models.Money{}, "", err
+	}
+	return checkProductAvailable(productID, product)
+}
+
+// ValidateProducts validates products unless the circuit is open. The batch
+// counts as a single call, which fails if any product could not be fetched.
+func (b *CircuitBreakerProductClient) ValidateProducts(ctx context.Context, productIDs []string, authToken string) []ProductValidation {
+	probe, err := b.allow()
+	if err != nil {
+		results := make([]ProductValidation, len(productIDs))
+		for i, id := range productIDs {
+			results[i] = ProductValidation{ProductID: id, Err: err}
+		}
+		return results
+	}
+
+	results := b.next.ValidateProducts(ctx, productIDs, authToken)
+	failed := false
+	for _, result := range results {
+		if result.Product == nil && isProductServiceFailure(result.Err) {
+			failed = true
+			break
+		}
+	}
+	b.record(ctx, probe, failed)
+	return results
+}
+
+// State returns the current circuit state
+func (b *CircuitBreakerProductClient) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.currentState(b.now())
+}
+
+// Health reports the circuit state for GET /health. An open circuit means the
+// Product Service is unhealthy; a half-open one that it may be recovering.
+func (b *CircuitBreakerProductClient) Health() models.ComponentHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	state := b.currentState(now)
+	health := models.ComponentHealth{
+		Status: models.HealthStatusHealthy,
+		Details: map[string]any{
+			"circuit":             state,
+			"consecutiveFailures": b.failures,
+		},
+	}
+	switch state {
+	case CircuitOpen:
+		health.Status = models.HealthStatusUnhealthy
+		health.Details["retryAfterSeconds"] = (&CircuitOpenError{RetryAfter: b.openedAt.Add(b.cooldown).Sub(now)}).RetryAfterSeconds()
+	case CircuitHalfOpen:
+		health.Status = models.HealthStatusDegraded
+	}
+	return health
+}
+
+// currentState returns the state, reporting an open circuit whose cooldown
+// has passed as half-open. The caller must hold b.mu.
+func (b *CircuitBreakerProductClient) currentState(now time.Time) CircuitState {
+	if b.state == CircuitOpen && !now.Before(b.openedAt.Add(b.cooldown)) {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// allow decides whether a call may go through. probe is set for the single
+// call let through by a half-open circuit.
+func (b *CircuitBreakerProductClient) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.state = b.currentState(now)
+	switch b.state {
+	case CircuitOpen:
+		return false, &CircuitOpenError{RetryAfter: b.openedAt.Add(b.cooldown).Sub(now)}
+	case CircuitHalfOpen:
+		if b.probing {
+			return false, &CircuitOpenError{RetryAfter: time.Second}
+		}
+		b.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// record updates the circuit with the outcome of a call made with ctx
+func (b *CircuitBreakerProductClient) record(ctx context.Context, probe, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+	// A call abandoned by its caller says nothing about the Product Service;
+	// an abandoned probe leaves the circuit half-open for the next call
+	if ctx.Err() != nil {
+		return
+	}
+	if !failed {
+		b.state = CircuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if probe || (b.state == CircuitClosed && b.failures >= b.failureThreshold) {
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+// isProductServiceFailure reports whether err means the Product Service could
+// not answer, as opposed to answering that a product does not exist
+func isProductServiceFailure(err error) bool {
+	return err != nil && !errors.Is(err, ErrProductNotFound)
+}
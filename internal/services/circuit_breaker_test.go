@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// switchableProductClient fails every lookup while down is set and otherwise
+// finds only "prod-1"
+func switchableProductClient(down *atomic.Bool, calls *atomic.Int32) *MockProductServiceClient {
+	client := &MockProductServiceClient{
+		GetProductFunc: func(ctx context.Context, productID string, authToken string) (*ProductResponse, error) {
+			calls.Add(1)
+			if down.Load() {
+				return nil, ErrProductServiceUnavailable
+			}
+			if productID != "prod-1" {
+				return nil, ErrProductNotFound
+			}
+			return &ProductResponse{ID: "1", Name: "Laptop", Price: usd(99999), Availability: true}, nil
+		},
+	}
+	client.ValidateProductsFunc = func(ctx context.Context, productIDs []string, authToken string) []ProductValidation {
+		results := make([]ProductValidation, len(productIDs))
+		for i, id := range productIDs {
+			product, err := client.GetProduct(ctx, id, authToken)
+			results[i] = newProductValidation(id, product, err)
+		}
+		return results
+	}
+	return client
+}
+
+// newTestBreaker returns a breaker opening after 3 failures for a minute,
+// with a clock the test controls
+func newTestBreaker(next ProductClient) (*CircuitBreakerProductClient, *time.Time) {
+	breaker := NewCircuitBreakerProductClient(next, 3, time.Minute)
+	now := time.Date(2026, 1, 14, 12, 0, 0, 0, time.UTC)
+	breaker.now = func() time.Time { return now }
+	return breaker, &now
+}
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	var down atomic.Bool
+	var calls atomic.Int32
+	breaker, now := newTestBreaker(switchableProductClient(&down, &calls))
+	down.Store(true)
+
+	for i := 0; i < 3; i++ {
+		breaker.GetProduct(context.Background(), "prod-1", "")
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("Expected circuit to be open, got %s", breaker.State())
+	}
+
+	*now = now.Add(15 * time.Second)
+	_, err := breaker.GetProduct(context.Background(), "prod-1", "")
+	var circuitOpen *CircuitOpenError
+	if !errors.As(err, &circuitOpen) || !errors.Is(err, ErrProductServiceUnavailable) {
+		t.Fatalf("Expected a CircuitOpenError matching ErrProductServiceUnavailable, got %v", err)
+	}
+	if circuitOpen.RetryAfter != 45*time.Second || circuitOpen.RetryAfterSeconds() != 45 {
+		t.Errorf("Expected retry after 45s, got %v", circuitOpen.RetryAfter)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected the open circuit not to call the product service, got %d calls", calls.Load())
+	}
+}
+
+func TestCircuitBreaker_SuccessResetsFailureCount(t *testing.T) {
+	var down atomic.Bool
+	var calls atomic.Int32
+	breaker, _ := newTestBreaker(switchableProductClient(&down, &calls))
+
+	for i := 0; i < 5; i++ {
+		down.Store(true)
+		breaker.GetProduct(context.Background(), "prod-1", "")
+		breaker.GetProduct(context.Background(), "prod-1", "")
+		down.Store(false)
+		breaker.GetProduct(context.Background(), "prod-1", "")
+	}
+	if breaker.State() != CircuitClosed {
+		t.Errorf("Expected circuit to stay closed, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreaker_NotFoundIsNotAFailure(t *testing.T) {
+	var down atomic.Bool
+	var calls atomic.Int32
+	breaker, _ := newTestBreaker(switchableProductClient(&down, &calls))
+
+	for i := 0; i < 5; i++ {
+		if _, err := breaker.GetProduct(context.Background(), "prod-missing", ""); !errors.Is(err, ErrProductNotFound) {
+			t.Fatalf("Expected ErrProductNotFound, got %v", err)
+		}
+	}
+	if breaker.State() != CircuitClosed {
+		t.Errorf("Expected circuit to stay closed, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	var down atomic.Bool
+	var calls atomic.Int32
+	breaker, now := newTestBreaker(switchableProductClient(&down, &calls))
+	down.Store(true)
+	for i := 0; i < 3; i++ {
+		breaker.GetProduct(context.Background(), "prod-1", "")
+	}
+
+	// A failed probe opens the circuit for another cooldown
+	*now = now.Add(time.Minute)
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("Expected circuit to be half-open, got %s", breaker.State())
+	}
+	breaker.GetProduct(context.Background(), "prod-1", "")
+	if breaker.State() != CircuitOpen || calls.Load() != 4 {
+		t.Fatalf("Expected a single failed probe to reopen the circuit, got %s after %d calls", breaker.State(), calls.Load())
+	}
+
+	// A successful probe closes it
+	*now = now.Add(time.Minute)
+	down.Store(false)
+	if _, err := breaker.GetProduct(context.Background(), "prod-1", ""); err != nil {
+		t.Fatalf("Expected probe to succeed, got %v", err)
+	}
+	if breaker.State() != CircuitClosed {
+		t.Errorf("Expected circuit to be closed, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreaker_SingleProbeWhileHalfOpen(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	failing := true
+	next := &MockProductServiceClient{
+		GetProductFunc: func(ctx context.Context, productID string, authToken string) (*ProductResponse, error) {
+			calls.Add(1)
+			if failing {
+				return nil, ErrProductServiceUnavailable
+			}
+			<-release
+			return &ProductResponse{ID: "1", Availability: true}, nil
+		},
+	}
+	breaker, now := newTestBreaker(next)
+	for i := 0; i < 3; i++ {
+		breaker.GetProduct(context.Background(), "prod-1", "")
+	}
+	failing = false
+	*now = now.Add(time.Minute)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		breaker.GetProduct(context.Background(), "prod-1", "")
+	}()
+	for calls.Load() < 4 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Other calls fail fast while the probe is running
+	if _, err := breaker.GetProduct(context.Background(), "prod-1", ""); !errors.Is(err, ErrProductServiceUnavailable) {
+		t.Errorf("Expected call during probe to fail fast, got %v", err)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 4 {
+		t.Errorf("Expected only the probe to reach the product service, got %d calls", calls.Load())
+	}
+	if breaker.State() != CircuitClosed {
+		t.Errorf("Expected circuit to be closed, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreaker_ValidateProducts(t *testing.T) {
+	var down atomic.Bool
+	var calls atomic.Int32
+	breaker, _ := newTestBreaker(switchableProductClient(&down, &calls))
+
+	results := breaker.ValidateProducts(context.Background(), []string{"prod-1", "prod-missing"}, "")
+	if results[0].Err != nil || !errors.Is(results[1].Err, ErrProductNotFound) {
+		t.Fatalf("Unexpected results %+v", results)
+	}
+
+	down.Store(true)
+	for i := 0; i < 3; i++ {
+		breaker.ValidateProducts(context.Background(), []string{"prod-1", "prod-2"}, "")
+	}
+	calls.Store(0)
+	for _, result := range breaker.ValidateProducts(context.Background(), []string{"prod-1", "prod-2"}, "") {
+		if !errors.Is(result.Err, ErrProductServiceUnavailable) {
+			t.Errorf("Expected ErrProductServiceUnavailable, got %v", result.Err)
+		}
+	}
+	if calls.Load() != 0 {
+		t.Errorf("Expected the open circuit not to call the product service, got %d calls", calls.Load())
+	}
+}
+
+func TestCircuitBreaker_Health(t *testing.T) {
+	var down atomic.Bool
+	var calls atomic.Int32
+	breaker, now := newTestBreaker(switchableProductClient(&down, &calls))
+
+	if health := breaker.Health(); health.Status != models.HealthStatusHealthy || health.Details["circuit"] != CircuitClosed {
+		t.Errorf("Expected healthy closed circuit, got %+v", health)
+	}
+
+	down.Store(true)
+	for i := 0; i < 3; i++ {
+		breaker.GetProduct(context.Background(), "prod-1", "")
+	}
+	if health := breaker.Health(); health.Status != models.HealthStatusUnhealthy || health.Details["circuit"] != CircuitOpen || health.Details["retryAfterSeconds"] != 60 {
+		t.Errorf("Expected unhealthy open circuit, got %+v", health)
+	}
+
+	*now = now.Add(time.Minute)
+	if health := breaker.Health(); health.Status != models.HealthStatusDegraded || health.Details["circuit"] != CircuitHalfOpen {
+		t.Errorf("Expected degraded half-open circuit, got %+v", health)
+	}
+}
+
+func TestCircuitBreaker_AbandonedCallsAreNotCounted(t *testing.T) {
+	next := &MockProductServiceClient{
+		GetProductFunc: func(ctx context.Context, productID string, authToken string) (*ProductResponse, error) {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, ErrProductServiceUnavailable
+		},
+	}
+	breaker, now := newTestBreaker(next)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 5; i++ {
+		breaker.GetProduct(canceled, "prod-1", "")
+	}
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("Expected circuit to stay closed, got %s", breaker.State())
+	}
+
+	// An abandoned probe leaves the circuit half-open for the next caller
+	for i := 0; i < 3; i++ {
+		breaker.GetProduct(context.Background(), "prod-1", "")
+	}
+	*now = now.Add(time.Minute)
+	breaker.GetProduct(canceled, "prod-1", "")
+	if breaker.State() != CircuitHalfOpen {
+		t.Errorf("Expected circuit to be half-open, got %s", breaker.State())
+	}
+}
@@ -0,0 +1,526 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+const (
+	orderSnapshotFile = "orders.snapshot.json"
+	orderJournalFile  = "orders.journal"
+
+	// DefaultSnapshotEvery is the number of journal entries after which the
+	// journal is compacted into a snapshot when no interval is configured
+	DefaultSnapshotEvery = 100
+)
+
+// journal operations
+const (
+	journalOpCreate      = "create"
+	journalOpUpdate      = "update"
+	journalOpDelete      = "delete"
+	journalOpOutboxSave  = "outbox-save"
+	journalOpOutboxPrune = "outbox-prune"
+)
+
+// journalEntry is one line of the append-only order journal
+type journalEntry struct {
+	Seq     uint64        `json:"seq"`
+	Op      string        `json:"op"`
+	OrderID string        `json:"orderId"`
+	Order   *models.Order `json:"order,omitempty"`
+	// UserID is only present in entries written before the owner was stored
+	// on the order itself
+	UserID string `json:"userId,omitempty"`
+	// Event records the change made by a create or update entry
+	Event *models.OrderEvent `json:"event,omitempty"`
+	// Outbox holds the messages written with an update, or the single
+	// message replaced by an outbox-save entry
+	Outbox []models.OutboxMessage `json:"outbox,omitempty"`
+	// DeliveredBefore is the cutoff of an outbox-prune entry
+	DeliveredBefore time.Time `json:"deliveredBefore,omitzero"`
+}
+
+// orderSnapshot is the compacted state of the store up to and including Seq
+type orderSnapshot struct {
+	Seq    uint64                 `json:"seq"`
+	Orders []models.Order         `json:"orders"`
+	Events []models.OrderEvent    `json:"events,omitempty"`
+	Outbox []models.OutboxMessage `json:"outbox,omitempty"`
+	// Owners is only present in snapshots written before the owner was stored
+	// on the order itself
+	Owners map[string]string `json:"owners,omitempty"`
+}
+
+// FileOrderRepository is a durable OutboxRepository. Every change, with its
+// event and the outbox messages it produces, is appended to a journal as a
+// single entry and fsynced before it becomes visible; the journal is
+// periodically compacted into a snapshot. On startup the snapshot is loaded
+// and the journal replayed, discarding a torn final entry left by a crash.
+type FileOrderRepository struct {
+	mu            sync.Mutex
+	dir           string
+	journal       *os.File
+	mem           *InMemoryOrderRepository
+	seq           uint64
+	pending       int
+	snapshotEvery int
+}
+
+// NewFileOrderRepository opens (or creates) a file-backed order store in dir,
+// recovering any state persisted by a previous run. The journal is compacted
+// into a snapshot every snapshotEvery entries (DefaultSnapshotEvery if <= 0).
+func NewFileOrderRepository(dir string, snapshotEvery int) (*FileOrderRepository, error) {
+	if snapshotEvery <= 0 {
+		snapshotEvery = DefaultSnapshotEvery
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create order store directory: %w", err)
+	}
+
+	r := &FileOrderRepository{
+		dir:           dir,
+		mem:           NewInMemoryOrderRepository(),
+		snapshotEvery: snapshotEvery,
+	}
+
+	if err := r.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := r.replayJournal(); err != nil {
+		return nil, err
+	}
+
+	// Orders written before orders had versions are at their first version,
+	// as the SQLite store's migration makes them
+	for i := range r.mem.orders {
+		if r.mem.orders[i].Version == 0 {
+			r.mem.orders[i].Version = 1
+		}
+	}
+
+	// Orders written before orders had a history get one, made durable by
+	// compacting before anything else is journaled
+	if r.mem.recordInitialEvents() {
+		if err := r.compact(); err != nil {
+			r.journal.Close()
+			return nil, fmt.Errorf("failed to record order history: %w", err)
+		}
+	}
+
+	return r, nil
+}
+
+// loadSnapshot restores the last compacted state, if any
+func (r *FileOrderRepository) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(r.dir, orderSnapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read order snapshot: %w", err)
+	}
+
+	var snapshot orderSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to parse order snapshot: %w", err)
+	}
+
+	r.seq = snapshot.Seq
+	r.mem.orders = snapshot.Orders
+	if r.mem.orders == nil {
+		r.mem.orders = []models.Order{}
+	}
+	for i := range r.mem.orders {
+		if r.mem.orders[i].UserID == "" {
+			r.mem.orders[i].UserID = snapshot.Owners[r.mem.orders[i].ID]
+		}
+	}
+	for _, event := range snapshot.Events {
+		r.mem.events[event.OrderID] = append(r.mem.events[event.OrderID], event)
+	}
+	r.mem.outbox = snapshot.Outbox
+	return nil
+}
+
+// replayJournal applies journal entries newer than the snapshot and leaves the
+// journal open for appending. A final entry that is incomplete or unparsable is
+// treated as a write torn by a crash and truncated away; corruption anywhere
+// else is reported as an error rather than silently dropping acknowledged data.
+func (r *FileOrderRepository) replayJournal() error {
+	path := filepath.Join(r.dir, orderJournalFile)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open order journal: %w", err)
+	}
+	// Make sure a newly created journal survives a crash
+	if err := syncDir(r.dir); err != nil {
+		f.Close()
+		return err
+	}
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			f.Close()
+			return fmt.Errorf("failed to read order journal: %w", readErr)
+		}
+		if len(line) == 0 {
+			break
+		}
+
+		complete := readErr == nil
+		var entry journalEntry
+		if !complete || json.Unmarshal(bytes.TrimSpace(line), &entry) != nil {
+			if _, err := reader.Peek(1); err == io.EOF {
+				log.Printf("Order journal: discarding torn entry at offset %d", offset)
+				if err := f.Truncate(offset); err != nil {
+					f.Close()
+					return fmt.Errorf("failed to truncate order journal: %w", err)
+				}
+				if err := f.Sync(); err != nil {
+					f.Close()
+					return fmt.Errorf("failed to sync order journal: %w", err)
+				}
+				break
+			}
+			f.Close()
+			return fmt.Errorf("order journal is corrupt at offset %d", offset)
+		}
+
+		offset += int64(len(line))
+		// Entries already folded into the snapshot remain in the journal if the
+		// process crashed between writing the snapshot and truncating the journal
+		if entry.Seq <= r.seq {
+			continue
+		}
+		if err := r.apply(entry); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to replay order journal entry %d: %w", entry.Seq, err)
+		}
+		r.seq = entry.Seq
+		r.pending++
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to seek order journal: %w", err)
+	}
+	r.journal = f
+	return nil
+}
+
+// apply folds a journal entry into the in-memory state
+func (r *FileOrderRepository) apply(entry journalEntry) error {
+	switch entry.Op {
+	case journalOpCreate:
+		if entry.Order.UserID == "" {
+			entry.Order.UserID = entry.UserID
+		}
+		return r.mem.Create(entry.Order, entry.Event)
+	case journalOpUpdate:
+		return r.mem.UpdateWithOutbox(entry.Order, entry.Event, entry.Outbox)
+	case journalOpDelete:
+		return r.mem.Delete(entry.OrderID)
+	case journalOpOutboxSave:
+		if len(entry.Outbox) != 1 {
+			return fmt.Errorf("outbox-save entry has %d messages", len(entry.Outbox))
+		}
+		return r.mem.SaveOutbox(&entry.Outbox[0])
+	case journalOpOutboxPrune:
+		_, err := r.mem.PruneOutbox(entry.DeliveredBefore)
+		return err
+	default:
+		return fmt.Errorf("unknown journal operation %q", entry.Op)
+	}
+}
+
+// validate checks that apply will accept entry, so that commit never makes an
+// entry durable only to have it rejected
+func (r *FileOrderRepository) validate(entry journalEntry) error {
+	switch entry.Op {
+	case journalOpCreate:
+		if _, err := r.mem.Get(entry.OrderID); err == nil {
+			return ErrOrderAlreadyExists
+		}
+		return nil
+	case journalOpUpdate, journalOpDelete:
+		_, err := r.mem.Get(entry.OrderID)
+		return err
+	case journalOpOutboxSave:
+		if len(entry.Outbox) != 1 {
+			return fmt.Errorf("outbox-save entry has %d messages", len(entry.Outbox))
+		}
+		_, err := r.mem.GetOutbox(entry.Outbox[0].ID)
+		return err
+	case journalOpOutboxPrune:
+		return nil
+	default:
+		return fmt.Errorf("unknown journal operation %q", entry.Op)
+	}
+}
+
+// commit durably appends an entry to the journal and then applies it in
+// memory. Entries apply would reject are not written.
+func (r *FileOrderRepository) commit(entry journalEntry) error {
+	if err := r.validate(entry); err != nil {
+		return err
+	}
+	entry.Seq = r.seq + 1
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	offset, err := r.journal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to seek order journal: %w", err)
+	}
+	if _, err := r.journal.Write(data); err != nil {
+		r.rollback(offset)
+		return fmt.Errorf("failed to write order journal: %w", err)
+	}
+	if err := r.journal.Sync(); err != nil {
+		r.rollback(offset)
+		return fmt.Errorf("failed to sync order journal: %w", err)
+	}
+
+	// The entry is replayed after a restart from here on, so its sequence
+	// number is taken even if applying it fails
+	r.seq = entry.Seq
+	r.pending++
+	if err := r.apply(entry); err != nil {
+		return err
+	}
+
+	if r.pending >= r.snapshotEvery {
+		if err := r.compact(); err != nil {
+			// The change is already durable in the journal; compaction is retried
+			// on the next write
+			log.Printf("Order store compaction failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// rollback discards a partially written journal entry so that later appends
+// do not follow a torn line
+func (r *FileOrderRepository) rollback(offset int64) {
+	if err := r.journal.Truncate(offset); err != nil {
+		log.Printf("Order journal rollback failed: %v", err)
+		return
+	}
+	if _, err := r.journal.Seek(offset, io.SeekStart); err != nil {
+		log.Printf("Order journal rollback failed: %v", err)
+	}
+}
+
+// compact writes the current state to a new snapshot and empties the journal.
+// The snapshot is written to a temporary file, fsynced and atomically renamed
+// into place before the journal is truncated.
+func (r *FileOrderRepository) compact() error {
+	r.mem.mu.RLock()
+	snapshot := orderSnapshot{
+		Seq:    r.seq,
+		Orders: r.mem.orders,
+		Outbox: r.mem.outbox,
+	}
+	for _, order := range r.mem.orders {
+		snapshot.Events = append(snapshot.Events, r.mem.events[order.ID]...)
+	}
+	data, err := json.Marshal(snapshot)
+	r.mem.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode order snapshot: %w", err)
+	}
+
+	tmpPath := filepath.Join(r.dir, orderSnapshotFile+".tmp")
+	if err := writeFileSync(tmpPath, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(r.dir, orderSnapshotFile)); err != nil {
+		return fmt.Errorf("failed to install order snapshot: %w", err)
+	}
+	if err := syncDir(r.dir); err != nil {
+		return err
+	}
+
+	if err := r.journal.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate order journal: %w", err)
+	}
+	if _, err := r.journal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek order journal: %w", err)
+	}
+	if err := r.journal.Sync(); err != nil {
+		return fmt.Errorf("failed to sync order journal: %w", err)
+	}
+
+	r.pending = 0
+	return nil
+}
+
+// Get returns a copy of the order with the given ID
+func (r *FileOrderRepository) Get(id string) (*models.Order, error) {
+	return r.mem.Get(id)
+}
+
+// List returns a copy of all orders
+func (r *FileOrderRepository) List() ([]models.Order, error) {
+	return r.mem.List()
+}
+
+// Query returns a copy of the page of orders selected by q
+func (r *FileOrderRepository) Query(q OrderQuery) ([]models.Order, int, error) {
+	return r.mem.Query(q)
+}
+
+// Create durably stores a new order and the event recording its creation
+func (r *FileOrderRepository) Create(order *models.Order, event *models.OrderEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event != nil {
+		event.Sequence = 1
+	}
+	return r.commit(journalEntry{Op: journalOpCreate, OrderID: order.ID, Order: order, Event: event})
+}
+
+// Update durably replaces the stored order with the same ID and appends its event
+func (r *FileOrderRepository) Update(order *models.Order, event *models.OrderEvent) error {
+	return r.UpdateWithOutbox(order, event, nil)
+}
+
+// UpdateWithOutbox durably replaces the stored order with the same ID and
+// appends its event and messages to the outbox in the same journal entry
+func (r *FileOrderRepository) UpdateWithOutbox(order *models.Order, event *models.OrderEvent, messages []models.OutboxMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event != nil {
+		r.mem.mu.RLock()
+		event.Sequence = len(r.mem.events[order.ID]) + 1
+		r.mem.mu.RUnlock()
+	}
+	return r.commit(journalEntry{Op: journalOpUpdate, OrderID: order.ID, Order: order, Event: event, Outbox: messages})
+}
+
+// Delete durably removes the order with the given ID
+func (r *FileOrderRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.commit(journalEntry{Op: journalOpDelete, OrderID: id})
+}
+
+// ListEvents returns a copy of the events recorded for an order
+func (r *FileOrderRepository) ListEvents(orderID string) ([]models.OrderEvent, error) {
+	return r.mem.ListEvents(orderID)
+}
+
+// ListOutbox returns a copy of the outbox messages with status, or of all
+// messages if status is empty
+func (r *FileOrderRepository) ListOutbox(status models.OutboxStatus) ([]models.OutboxMessage, error) {
+	return r.mem.ListOutbox(status)
+}
+
+// GetOutbox returns a copy of the outbox message with the given ID
+func (r *FileOrderRepository) GetOutbox(id string) (*models.OutboxMessage, error) {
+	return r.mem.GetOutbox(id)
+}
+
+// SaveOutbox durably replaces the stored outbox message with the same ID
+func (r *FileOrderRepository) SaveOutbox(message *models.OutboxMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.commit(journalEntry{Op: journalOpOutboxSave, OrderID: message.OrderID, Outbox: []models.OutboxMessage{*message}})
+}
+
+// PruneOutbox durably removes the outbox messages delivered before
+// deliveredBefore. Nothing is journaled if there is nothing to remove.
+func (r *FileOrderRepository) PruneOutbox(deliveredBefore time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delivered, err := r.mem.ListOutbox(models.OutboxStatusDelivered)
+	if err != nil {
+		return 0, err
+	}
+	pruned := 0
+	for _, message := range delivered {
+		if prunable(message, deliveredBefore) {
+			pruned++
+		}
+	}
+	if pruned == 0 {
+		return 0, nil
+	}
+
+	if err := r.commit(journalEntry{Op: journalOpOutboxPrune, DeliveredBefore: deliveredBefore}); err != nil {
+		return 0, err
+	}
+	return pruned, nil
+}
+
+// Compact forces the journal to be folded into a snapshot
+func (r *FileOrderRepository) Compact() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.compact()
+}
+
+// Close releases the journal file handle
+func (r *FileOrderRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.journal.Close()
+}
+
+// writeFileSync writes data to path and fsyncs it before returning
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// syncDir fsyncs a directory so that renames within it are durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory %s: %w", dir, err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+func newTestOrder(id string, quantity int) *models.Order {
+	return &models.Order{
+		ID:         id,
+		Products:   []models.OrderProduct{{ProductID: "prod-1", Quantity: quantity}},
+		TotalPrice: usd(int64(quantity) * 1000),
+		OrderDate:  time.Date(2026, 1, 14, 12, 0, 0, 0, time.UTC),
+		Status:     models.OrderStatusPending,
+		Version:    1,
+	}
+}
+
+func openFileRepo(t *testing.T, dir string, snapshotEvery int) *FileOrderRepository {
+	t.Helper()
+	repo, err := NewFileOrderRepository(dir, snapshotEvery)
+	if err != nil {
+		t.Fatalf("Failed to open file order repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestFileOrderRepository_PersistsAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	repo := openFileRepo(t, dir, 100)
+	first := newTestOrder("order-1", 1)
+	first.UserID = "user-1"
+	repo.Create(first, nil)
+	repo.Create(newTestOrder("order-2", 2), nil)
+
+	updated := newTestOrder("order-1", 5)
+	updated.UserID = "user-1"
+	updated.Status = models.OrderStatusProcessing
+	if err := repo.Update(updated, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.Delete("order-2"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo.Close()
+
+	reopened := openFileRepo(t, dir, 100)
+	orders, _ := reopened.List()
+	if len(orders) != 1 {
+		t.Fatalf("Expected 1 order after restart, got %d", len(orders))
+	}
+	if orders[0].Status != models.OrderStatusProcessing || orders[0].Products[0].Quantity != 5 {
+		t.Errorf("Expected updated order to be recovered, got %+v", orders[0])
+	}
+	if orders[0].UserID != "user-1" {
+		t.Errorf("Expected owner user-1 to be recovered, got %q", orders[0].UserID)
+	}
+}
+
+func TestFileOrderRepository_CompactsIntoSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	repo := openFileRepo(t, dir, 3)
+	for _, id := range []string{"order-1", "order-2", "order-3", "order-4"} {
+		if err := repo.Create(newTestOrder(id, 1), nil); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, orderSnapshotFile)); err != nil {
+		t.Fatalf("Expected snapshot to be written, got %v", err)
+	}
+	journal, _ := os.ReadFile(filepath.Join(dir, orderJournalFile))
+	if lines := countLines(journal); lines != 1 {
+		t.Errorf("Expected 1 journal entry after compaction, got %d", lines)
+	}
+	repo.Close()
+
+	reopened := openFileRepo(t, dir, 3)
+	orders, _ := reopened.List()
+	if len(orders) != 4 {
+		t.Errorf("Expected 4 orders after restart, got %d", len(orders))
+	}
+}
+
+func TestFileOrderRepository_RecoversFromTruncatedTail(t *testing.T) {
+	dir := t.TempDir()
+
+	repo := openFileRepo(t, dir, 100)
+	repo.Create(newTestOrder("order-1", 1), nil)
+	repo.Create(newTestOrder("order-2", 1), nil)
+	repo.Close()
+
+	// Simulate a crash part way through appending the next entry
+	journalPath := filepath.Join(dir, orderJournalFile)
+	f, _ := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	f.WriteString(`{"seq":3,"op":"create","orderId":"order-3","order":{"id":"ord`)
+	f.Close()
+
+	reopened := openFileRepo(t, dir, 100)
+	orders, _ := reopened.List()
+	if len(orders) != 2 {
+		t.Fatalf("Expected 2 orders after recovery, got %d", len(orders))
+	}
+
+	// New writes must land on a clean line boundary and survive another restart
+	if err := reopened.Create(newTestOrder("order-3", 1), nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	reopened.Close()
+
+	again := openFileRepo(t, dir, 100)
+	if orders, _ := again.List(); len(orders) != 3 {
+		t.Errorf("Expected 3 orders after second restart, got %d", len(orders))
+	}
+}
+
+func TestFileOrderRepository_SkipsEntriesCoveredBySnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	repo := openFileRepo(t, dir, 100)
+	repo.Create(newTestOrder("order-1", 1), nil)
+	repo.Create(newTestOrder("order-2", 1), nil)
+	journal, _ := os.ReadFile(filepath.Join(dir, orderJournalFile))
+	if err := repo.Compact(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo.Close()
+
+	// Simulate a crash after the snapshot was installed but before the journal
+	// was truncated: replaying the old entries again must not fail or duplicate
+	os.WriteFile(filepath.Join(dir, orderJournalFile), journal, 0o644)
+
+	reopened := openFileRepo(t, dir, 100)
+	if orders, _ := reopened.List(); len(orders) != 2 {
+		t.Errorf("Expected 2 orders, got %d", len(orders))
+	}
+}
+
+func TestFileOrderRepository_RejectsCorruptJournal(t *testing.T) {
+	dir := t.TempDir()
+
+	repo := openFileRepo(t, dir, 100)
+	repo.Create(newTestOrder("order-1", 1), nil)
+	repo.Create(newTestOrder("order-2", 1), nil)
+	repo.Close()
+
+	// Corruption before the final entry is not a torn write and must not be
+	// silently discarded
+	journalPath := filepath.Join(dir, orderJournalFile)
+	journal, _ := os.ReadFile(journalPath)
+	journal[5] = '#'
+	os.WriteFile(journalPath, journal, 0o644)
+
+	if _, err := NewFileOrderRepository(dir, 100); err == nil {
+		t.Fatal("Expected error for corrupt journal, got nil")
+	}
+}
+
+func TestFileOrderRepository_TypedErrors(t *testing.T) {
+	repo := openFileRepo(t, t.TempDir(), 100)
+
+	if err := repo.Update(newTestOrder("missing", 1), nil); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+	if err := repo.Delete("missing"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+	repo.Create(newTestOrder("order-1", 1), nil)
+	if err := repo.Create(newTestOrder("order-1", 1), nil); !errors.Is(err, ErrOrderAlreadyExists) {
+		t.Errorf("Expected ErrOrderAlreadyExists, got %v", err)
+	}
+}
+
+func TestFileOrderRepository_RejectedWritesAreNotJournaled(t *testing.T) {
+	dir := t.TempDir()
+	repo := openFileRepo(t, dir, 100)
+
+	repo.Create(newTestOrder("order-1", 1), nil)
+	repo.Create(newTestOrder("order-1", 2), nil)
+	repo.Update(newTestOrder("missing", 1), nil)
+	repo.SaveOutbox(&models.OutboxMessage{ID: "missing"})
+	if err := repo.Update(newTestOrder("order-1", 3), nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, orderJournalFile))
+	if lines := countLines(data); lines != 2 {
+		t.Errorf("Expected only the 2 accepted writes in the journal, got %d entries", lines)
+	}
+	repo.Close()
+
+	// The write after the rejected ones is not mistaken for one already applied
+	reopened := openFileRepo(t, dir, 100)
+	if order, err := reopened.Get("order-1"); err != nil || order.Products[0].Quantity != 3 {
+		t.Errorf("Expected the update to survive a restart, got %+v, %v", order, err)
+	}
+}
+
+func countLines(data []byte) int {
+	n := 0
+	for _, b := range data {
+		if b == '\n' {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFileOrderRepository_LegacyOwnershipIsRecovered(t *testing.T) {
+	dir := t.TempDir()
+
+	// State written before the owner was stored on the order itself
+	snapshot := `{"seq":1,"orders":[{"id":"order-1","products":[{"productId":"prod-1","quantity":1}],"status":"PENDING"}],"owners":{"order-1":"user-1"}}`
+	journal := `{"seq":2,"op":"create","orderId":"order-2","userId":"user-2","order":{"id":"order-2","products":[{"productId":"prod-1","quantity":1}],"status":"PENDING"}}` + "\n"
+	os.WriteFile(filepath.Join(dir, orderSnapshotFile), []byte(snapshot), 0o644)
+	os.WriteFile(filepath.Join(dir, orderJournalFile), []byte(journal), 0o644)
+
+	repo := openFileRepo(t, dir, 100)
+	for id, owner := range map[string]string{"order-1": "user-1", "order-2": "user-2"} {
+		order, err := repo.Get(id)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if order.UserID != owner {
+			t.Errorf("Expected %s to be owned by %s, got %q", id, owner, order.UserID)
+		}
+	}
+}
+
+func TestFileOrderRepository_LegacyOrdersGetHistory(t *testing.T) {
+	dir := t.TempDir()
+
+	// State written before orders had a history
+	snapshot := `{"seq":1,"orders":[{"id":"order-1","userId":"user-1","products":[{"productId":"prod-1","quantity":1}],"orderDate":"2026-01-14T12:00:00Z","status":"PENDING","version":1}]}`
+	os.WriteFile(filepath.Join(dir, orderSnapshotFile), []byte(snapshot), 0o644)
+
+	repo := openFileRepo(t, dir, 100)
+	events, _ := repo.ListEvents("order-1")
+	if len(events) != 1 || events[0].Type != models.OrderEventCreated || events[0].Actor != SystemActor || events[0].After.UserID != "user-1" {
+		t.Fatalf("Expected an OrderCreated event by %s, got %+v", SystemActor, events)
+	}
+
+	order, _ := repo.Get("order-1")
+	before := cloneOrder(*order)
+	order.Status = models.OrderStatusCanceled
+	if err := repo.Update(order, newOrderEvent(models.OrderEventCanceled, "alice", &before, order)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo.Close()
+
+	reopened := openFileRepo(t, dir, 100)
+	events, _ = reopened.ListEvents("order-1")
+	if len(events) != 2 || events[0].Type != models.OrderEventCreated || events[1].Sequence != 2 || events[1].Type != models.OrderEventCanceled {
+		t.Errorf("Expected the recorded history to be kept, got %+v", events)
+	}
+}
+
+func TestFileOrderRepository_LegacyOrdersStartAtVersion1(t *testing.T) {
+	dir := t.TempDir()
+
+	// State written before orders had a version
+	snapshot := `{"seq":1,"orders":[{"id":"order-1","products":[{"productId":"prod-1","quantity":1}],"status":"PENDING"}]}`
+	journal := `{"seq":2,"op":"create","orderId":"order-2","order":{"id":"order-2","products":[{"productId":"prod-1","quantity":1}],"status":"PENDING"}}` + "\n"
+	os.WriteFile(filepath.Join(dir, orderSnapshotFile), []byte(snapshot), 0o644)
+	os.WriteFile(filepath.Join(dir, orderJournalFile), []byte(journal), 0o644)
+
+	repo := openFileRepo(t, dir, 100)
+	service := NewOrderService(repo, newYieldingProductClient(usd(1000)))
+	for _, id := range []string{"order-1", "order-2"} {
+		order, err := repo.Get(id)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if order.Version != 1 {
+			t.Errorf("Expected %s at version 1, got %d", id, order.Version)
+		}
+
+		// A client holding the version from the order's ETag can change it
+		submitted, err := service.SubmitOrder(context.Background(), id, "alice", 1)
+		if err != nil {
+			t.Fatalf("Expected no error submitting %s at version 1, got %v", id, err)
+		}
+		if submitted.Version != 2 {
+			t.Errorf("Expected %s at version 2, got %d", id, submitted.Version)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+var (
+	// ErrLoyaltyServiceUnavailable is returned when the Loyalty Service cannot
+	// be reached or fails
+	ErrLoyaltyServiceUnavailable = errors.New("loyalty service unavailable")
+	// ErrLoyaltyRequestRejected is returned when the Loyalty Service refuses a
+	// request, for example for an unknown user
+	ErrLoyaltyRequestRejected = errors.New("loyalty service rejected the request")
+	// ErrInsufficientLoyaltyPoints is returned when a user does not have the
+	// points they asked to redeem
+	ErrInsufficientLoyaltyPoints = fmt.Errorf("%w: insufficient loyalty points", ErrLoyaltyRequestRejected)
+)
+
+// LoyaltyPointsPerUnit is the amount of an order's total, in major currency
+// units, that earns one loyalty point
+const LoyaltyPointsPerUnit = 10
+
+// LoyaltyPointsFor returns the points earned by an order totaling total: one
+// point per full 10 units of its currency, so a $1,389.95 order earns 138
+func LoyaltyPointsFor(total models.Money) int {
+	if total.Amount <= 0 {
+		return 0
+	}
+	return int(total.Amount / (LoyaltyPointsPerUnit * 100))
+}
+
+// LoyaltyClient is an interface for interacting with the Loyalty Service.
+// Calls are abandoned when ctx is done.
+type LoyaltyClient interface {
+	// AwardPoints credits points to a user for an order and returns the
+	// Loyalty Service's transaction ID. Awards are keyed by order, so awarding
+	// the same order again returns the original transaction.
+	AwardPoints(ctx context.Context, userID, orderID string, points int) (string, error)
+	// ReversePoints undoes an award or redemption transaction, debiting or
+	// crediting its points again, and returns the reversal's transaction ID.
+	// Reversals are keyed by the original transaction, so reversing it again
+	// returns the original reversal.
+	ReversePoints(ctx context.Context, userID, orderID, transactionID string, points int) (string, error)
+	// ReservePoints holds points of a user for redemption by an order and
+	// returns the reservation ID. It fails with ErrInsufficientLoyaltyPoints
+	// if the user's balance is too low. Reservations are keyed by order.
+	ReservePoints(ctx context.Context, userID, orderID string, points int) (string, error)
+	// CommitReservation redeems the points held by a reservation and returns
+	// the redemption's transaction ID
+	CommitReservation(ctx context.Context, userID, reservationID string) (string, error)
+	// ReleaseReservation returns the points held by a reservation to the user
+	ReleaseReservation(ctx context.Context, userID, reservationID string) error
+}
+
+// LoyaltyServiceClient handles communication with the Loyalty Service
+type LoyaltyServiceClient struct {
+	baseURL    string
+	httpClient *http.Client
+	authToken  string
+}
+
+// NewLoyaltyServiceClient creates a new loyalty service client
+func NewLoyaltyServiceClient(baseURL, authToken string) *LoyaltyServiceClient {
+	return &LoyaltyServiceClient{
+		baseURL: baseURL,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+		authToken: authToken,
+	}
+}
+
+// loyaltyTransactionRequest is the body of a points transaction.
+// TransactionID is the transaction being reversed.
+type loyaltyTransactionRequest struct {
+	OrderID       string `json:"orderId"`
+	TransactionID string `json:"transactionId,omitempty"`
+	Points        int    `json:"points"`
+}
+
+// loyaltyTransactionResponse is the Loyalty Service's answer to a points transaction
+type loyaltyTransactionResponse struct {
+	TransactionID string `json:"transactionId"`
+}
+
+// loyaltyReservationResponse is the Loyalty Service's answer to a reservation
+type loyaltyReservationResponse struct {
+	ReservationID string `json:"reservationId"`
+}
+
+// AwardPoints credits points with POST /users/{userId}/points/awards. The
+// order ID is sent as the Idempotency-Key.
+func (c *LoyaltyServiceClient) AwardPoints(ctx context.Context, userID, orderID string, points int) (string, error) {
+	return c.transact(ctx, c.userPath(userID, "/awards"), "award-"+orderID,
+		loyaltyTransactionRequest{OrderID: orderID, Points: points})
+}
+
+// ReversePoints undoes a transaction with POST /users/{userId}/points/reversals.
+// The original transaction ID is sent as the Idempotency-Key.
+func (c *LoyaltyServiceClient) ReversePoints(ctx context.Context, userID, orderID, transactionID string, points int) (string, error) {
+	return c.transact(ctx, c.userPath(userID, "/reversals"), "reverse-"+transactionID,
+		loyaltyTransactionRequest{OrderID: orderID, TransactionID: transactionID, Points: points})
+}
+
+// ReservePoints holds points with POST /users/{userId}/points/reservations.
+// The order ID is sent as the Idempotency-Key.
+func (c *LoyaltyServiceClient) ReservePoints(ctx context.Context, userID, orderID string, points int) (string, error) {
+	var result loyaltyReservationResponse
+	if err := c.post(ctx, c.userPath(userID, "/reservations"), "reserve-"+orderID,
+		loyaltyTransactionRequest{OrderID: orderID, Points: points}, &result); err != nil {
+		return "", err
+	}
+	if result.ReservationID == "" {
+		return "", fmt.Errorf("%w: response has no reservationId", ErrLoyaltyServiceUnavailable)
+	}
+	return result.ReservationID, nil
+}
+
+// CommitReservation redeems held points with
+// POST /users/{userId}/points/reservations/{reservationId}/commit
+func (c *LoyaltyServiceClient) CommitReservation(ctx context.Context, userID, reservationID string) (string, error) {
+	return c.transact(ctx, c.userPath(userID, "/reservations/"+url.PathEscape(reservationID)+"/commit"), "commit-"+reservationID, struct{}{})
+}
+
+// ReleaseReservation returns held points with
+// POST /users/{userId}/points/reservations/{reservationId}/release
+func (c *LoyaltyServiceClient) ReleaseReservation(ctx context.Context, userID, reservationID string) error {
+	return c.post(ctx, c.userPath(userID, "/reservations/"+url.PathEscape(reservationID)+"/release"), "release-"+reservationID, struct{}{}, nil)
+}
+
+// userPath returns the path of a user's points resource
+func (c *LoyaltyServiceClient) userPath(userID, suffix string) string {
+	return "/users/" + url.PathEscape(userID) + "/points" + suffix
+}
+
+// transact posts a points transaction and returns its ID
+func (c *LoyaltyServiceClient) transact(ctx context.Context, path, idempotencyKey string, body any) (string, error) {
+	var result loyaltyTransactionResponse
+	if err := c.post(ctx, path, idempotencyKey, body, &result); err != nil {
+		return "", err
+	}
+	if result.TransactionID == "" {
+		return "", fmt.Errorf("%w: response has no transactionId", ErrLoyaltyServiceUnavailable)
+	}
+	return result.TransactionID, nil
+}
+
+// post sends a request to the Loyalty Service and decodes a successful
+// response into out, unless out is nil
+func (c *LoyaltyServiceClient) post(ctx context.Context, path, idempotencyKey string, body, out any) error {
+	if c.baseURL == "" {
+		return fmt.Errorf("loyalty service URL not configured")
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode loyalty request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	if c.authToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.authToken))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLoyaltyServiceUnavailable, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: failed to read response body: %w", ErrLoyaltyServiceUnavailable, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+		if out == nil {
+			return nil
+		}
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("%w: invalid response: %s", ErrLoyaltyServiceUnavailable, string(respBody))
+		}
+		return nil
+
+	case resp.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("%w: unauthorized access", ErrLoyaltyServiceUnavailable)
+
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("%w: status %d", ErrLoyaltyServiceUnavailable, resp.StatusCode)
+
+	default:
+		var errorResp models.ErrorResponse
+		if json.Unmarshal(respBody, &errorResp) == nil && errorResp.Code == "INSUFFICIENT_POINTS" {
+			return fmt.Errorf("%w: %s", ErrInsufficientLoyaltyPoints, errorResp.Message)
+		}
+		return fmt.Errorf("%w: status %d, body: %s", ErrLoyaltyRequestRejected, resp.StatusCode, string(respBody))
+	}
+}
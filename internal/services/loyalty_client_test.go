@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bitovi/example-go-server/internal/fakeloyaltyservice"
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// startFakeLoyaltyService returns a fake Loyalty Service and an order service
+// that awards points through it for orders totaling $1,389.95
+func startFakeLoyaltyService(t *testing.T, repo OrderRepository) (*fakeloyaltyservice.Server, *OrderService) {
+	t.Helper()
+	fake := fakeloyaltyservice.New()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	loyalty := NewLoyaltyServiceClient(server.URL, "")
+	return fake, NewOrderService(repo, newYieldingProductClient(usd(138995)), WithLoyaltyClient(loyalty))
+}
+
+// failingUpdateRepository fails the next failures order updates
+type failingUpdateRepository struct {
+	OrderRepository
+	failures int
+}
+
+func (r *failingUpdateRepository) Update(order *models.Order, event *models.OrderEvent) error {
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("disk full")
+	}
+	return r.OrderRepository.Update(order, event)
+}
+
+func TestLoyaltyPointsFor(t *testing.T) {
+	tests := []struct {
+		total    models.Money
+		expected int
+	}{
+		{usd(138995), 138},
+		{usd(1000), 1},
+		{usd(999), 0},
+		{usd(0), 0},
+	}
+	for _, tt := range tests {
+		if got := LoyaltyPointsFor(tt.total); got != tt.expected {
+			t.Errorf("LoyaltyPointsFor(%s) = %d, expected %d", tt.total, got, tt.expected)
+		}
+	}
+}
+
+func TestLoyaltyServiceClient_AwardPoints(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body loyaltyTransactionRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.Method != http.MethodPost || r.URL.Path != "/users/user-123/points/awards" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Idempotency-Key") != "award-order-1" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Unexpected headers %v", r.Header)
+		}
+		if body.OrderID != "order-1" || body.Points != 138 {
+			t.Errorf("Unexpected body %+v", body)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"transactionId": "txn-1"}`))
+	}))
+	defer server.Close()
+
+	client := NewLoyaltyServiceClient(server.URL, "secret")
+	transactionID, err := client.AwardPoints(context.Background(), "user-123", "order-1", 138)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if transactionID != "txn-1" {
+		t.Errorf("Expected transaction txn-1, got %s", transactionID)
+	}
+}
+
+func TestLoyaltyServiceClient_Errors(t *testing.T) {
+	tests := []struct {
+		status   int
+		body     string
+		expected error
+	}{
+		{http.StatusServiceUnavailable, `{}`, ErrLoyaltyServiceUnavailable},
+		{http.StatusUnauthorized, `{}`, ErrLoyaltyServiceUnavailable},
+		{http.StatusOK, `{}`, ErrLoyaltyServiceUnavailable},
+		{http.StatusNotFound, `{"code": "USER_NOT_FOUND"}`, ErrLoyaltyRequestRejected},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}))
+		_, err := NewLoyaltyServiceClient(server.URL, "").AwardPoints(context.Background(), "user-123", "order-1", 1)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("Status %d: expected %v, got %v", tt.status, tt.expected, err)
+		}
+		server.Close()
+	}
+}
+
+func TestSubmitOrder_AwardsLoyaltyPoints(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	fake, service := startFakeLoyaltyService(t, repo)
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+
+	submitted, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if submitted.AccruedLoyaltyPoints != 138 || submitted.LoyaltyTransactionID == "" {
+		t.Errorf("Expected 138 accrued points with a transaction, got %d (%q)", submitted.AccruedLoyaltyPoints, submitted.LoyaltyTransactionID)
+	}
+	if balance := fake.Balance("user-123"); balance != 138 {
+		t.Errorf("Expected 138 points credited to the order owner, got %d", balance)
+	}
+	if stored, _ := repo.Get(order.ID); stored.AccruedLoyaltyPoints != 138 || stored.LoyaltyTransactionID != submitted.LoyaltyTransactionID {
+		t.Errorf("Expected the award to be stored, got %+v", stored)
+	}
+}
+
+func TestSubmitOrder_LoyaltyFailureKeepsSubmission(t *testing.T) {
+	fake, service := startFakeLoyaltyService(t, NewInMemoryOrderRepository())
+	fake.SetFailing(true)
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+
+	submitted, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected the submission to succeed, got %v", err)
+	}
+	if submitted.Status != models.OrderStatusProcessing || submitted.AccruedLoyaltyPoints != 0 {
+		t.Errorf("Expected a PROCESSING order without points, got %s with %d points", submitted.Status, submitted.AccruedLoyaltyPoints)
+	}
+
+	// Without an award there is nothing to reverse
+	fake.SetFailing(false)
+	canceled, err := service.CancelOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil || canceled.LoyaltyReversalID != "" || len(fake.Transactions()) != 0 {
+		t.Errorf("Expected a cancellation without loyalty transactions, got %+v, %v, %+v", canceled, err, fake.Transactions())
+	}
+}
+
+func TestSubmitOrder_RetriedAwardIsNotDoubled(t *testing.T) {
+	repo := &failingUpdateRepository{OrderRepository: NewInMemoryOrderRepository()}
+	fake, service := startFakeLoyaltyService(t, repo)
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+
+	// The award is made but the submission is not stored, so it is retried
+	repo.failures = 1
+	if _, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion); err == nil {
+		t.Fatal("Expected the first submission to fail")
+	}
+	submitted, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected the retried submission to succeed, got %v", err)
+	}
+
+	if balance := fake.Balance("user-123"); balance != 138 {
+		t.Errorf("Expected 138 points credited once, got %d", balance)
+	}
+	if txns := fake.Transactions(); len(txns) != 1 || txns[0].ID != submitted.LoyaltyTransactionID {
+		t.Errorf("Expected a single award recorded on the order, got %+v", txns)
+	}
+}
+
+func TestCancelOrder_ReversesLoyaltyPoints(t *testing.T) {
+	repo := &failingUpdateRepository{OrderRepository: NewInMemoryOrderRepository()}
+	fake, service := startFakeLoyaltyService(t, repo)
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+	submitted, _ := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+
+	// A cancellation that is not stored is retried without a second debit
+	repo.failures = 1
+	if _, err := service.CancelOrder(context.Background(), order.ID, "test-admin", AnyVersion); err == nil {
+		t.Fatal("Expected the first cancellation to fail")
+	}
+	canceled, err := service.CancelOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if canceled.AccruedLoyaltyPoints != 0 || canceled.LoyaltyReversalID == "" || canceled.LoyaltyTransactionID != submitted.LoyaltyTransactionID {
+		t.Errorf("Expected the award to be recorded as reversed, got %+v", canceled)
+	}
+
+	// Canceling again is rejected and debits nothing
+	if _, err := service.CancelOrder(context.Background(), order.ID, "test-admin", AnyVersion); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition, got %v", err)
+	}
+	if balance := fake.Balance("user-123"); balance != 0 {
+		t.Errorf("Expected the points to be reversed exactly once, got balance %d", balance)
+	}
+	txns := fake.Transactions()
+	if len(txns) != 2 || txns[1].Type != fakeloyaltyservice.TransactionReversal || txns[1].ID != canceled.LoyaltyReversalID {
+		t.Errorf("Expected one award and one reversal, got %+v", txns)
+	}
+
+	rebuilt, _ := rebuildOrder(service, order.ID)
+	if rebuilt.LoyaltyReversalID != canceled.LoyaltyReversalID || rebuilt.AccruedLoyaltyPoints != 0 {
+		t.Errorf("Expected the reversal to be replayed from events, got %+v", rebuilt)
+	}
+}
+
+func TestReturnOrder_ReversesLoyaltyPoints(t *testing.T) {
+	fake, service := startFakeLoyaltyService(t, NewInMemoryOrderRepository())
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+	submitted, _ := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	service.ShipOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	service.DeliverOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+
+	returned, err := service.ReturnOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if returned.AccruedLoyaltyPoints != 0 || returned.LoyaltyReversalID == "" || returned.LoyaltyTransactionID != submitted.LoyaltyTransactionID {
+		t.Errorf("Expected the award to be recorded as reversed, got %+v", returned)
+	}
+
+	// Returning again is rejected and debits nothing
+	if _, err := service.ReturnOrder(context.Background(), order.ID, "test-admin", AnyVersion); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition, got %v", err)
+	}
+	if balance := fake.Balance("user-123"); balance != 0 {
+		t.Errorf("Expected the points to be reversed exactly once, got balance %d", balance)
+	}
+	txns := fake.Transactions()
+	if len(txns) != 2 || txns[1].Type != fakeloyaltyservice.TransactionReversal || txns[1].ID != returned.LoyaltyReversalID {
+		t.Errorf("Expected one award and one reversal, got %+v", txns)
+	}
+
+	rebuilt, _ := rebuildOrder(service, order.ID)
+	if rebuilt.Status != models.OrderStatusReturned || rebuilt.LoyaltyReversalID != returned.LoyaltyReversalID {
+		t.Errorf("Expected the return to be replayed from events, got %+v", rebuilt)
+	}
+}
+
+func TestCancelOrder_LoyaltyFailureKeepsCancellation(t *testing.T) {
+	fake, service := startFakeLoyaltyService(t, NewInMemoryOrderRepository())
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+	service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+
+	fake.SetFailing(true)
+	canceled, err := service.CancelOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected the cancellation to succeed, got %v", err)
+	}
+	// The award stays recorded so the points still credited are visible
+	if canceled.Status != models.OrderStatusCanceled || canceled.AccruedLoyaltyPoints != 138 || canceled.LoyaltyReversalID != "" {
+		t.Errorf("Expected a CANCELED order with the award unreversed, got %+v", canceled)
+	}
+}
+
+func TestLoyaltyServiceClient_IdempotentTransactions(t *testing.T) {
+	fake := fakeloyaltyservice.New()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := NewLoyaltyServiceClient(server.URL, "")
+
+	award, _ := client.AwardPoints(context.Background(), "user-123", "order-1", 138)
+	again, err := client.AwardPoints(context.Background(), "user-123", "order-1", 138)
+	if err != nil || again != award {
+		t.Errorf("Expected the award to be replayed as %s, got %s, %v", award, again, err)
+	}
+
+	reversal, _ := client.ReversePoints(context.Background(), "user-123", "order-1", award, 138)
+	again, err = client.ReversePoints(context.Background(), "user-123", "order-1", award, 138)
+	if err != nil || again != reversal {
+		t.Errorf("Expected the reversal to be replayed as %s, got %s, %v", reversal, again, err)
+	}
+
+	if _, err := client.ReversePoints(context.Background(), "user-123", "order-2", "txn-unknown", 10); !errors.Is(err, ErrLoyaltyRequestRejected) {
+		t.Errorf("Expected ErrLoyaltyRequestRejected for an unknown award, got %v", err)
+	}
+	if len(fake.Transactions()) != 2 || fake.Balance("user-123") != 0 {
+		t.Errorf("Expected one award and one reversal, got %+v", fake.Transactions())
+	}
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// InMemoryOrderRepository is an OutboxRepository backed by process memory.
+// It is safe for concurrent use.
+type InMemoryOrderRepository struct {
+	mu     sync.RWMutex
+	orders []models.Order
+	events map[string][]models.OrderEvent
+	outbox []models.OutboxMessage
+}
+
+// NewInMemoryOrderRepository creates an empty in-memory order repository
+func NewInMemoryOrderRepository() *InMemoryOrderRepository {
+	return &InMemoryOrderRepository{
+		orders: []models.Order{},
+		events: make(map[string][]models.OrderEvent),
+	}
+}
+
+// NewMockOrderRepository creates an in-memory order repository seeded with
+// mock orders, each with a history starting with an OrderCreated event
+func NewMockOrderRepository() *InMemoryOrderRepository {
+	repo := NewInMemoryOrderRepository()
+
+	repo.orders = []models.Order{
+		{
+			ID:     "650e8400-e29b-41d4-a716-446655440000",
+			UserID: "750e8400-e29b-41d4-a716-446655440000", // johndoe
+			Products: []models.OrderProduct{
+				{
+					ProductID:   "550e8400-e29b-41d4-a716-446655440000",
+					Quantity:    1,
+					ProductName: "Laptop",
+					UnitPrice:   models.NewMoney(129999, models.DefaultCurrency),
+					LineTotal:   models.NewMoney(129999, models.DefaultCurrency),
+				},
+				{
+					ProductID:   "550e8400-e29b-41d4-a716-446655440001",
+					Quantity:    2,
+					ProductName: "Wireless Mouse",
+					UnitPrice:   models.NewMoney(2999, models.DefaultCurrency),
+					LineTotal:   models.NewMoney(5998, models.DefaultCurrency),
+				},
+			},
+			TotalPrice: models.NewMoney(135997, models.DefaultCurrency),
+			OrderDate:  time.Now().AddDate(0, 0, -5),
+			Status:     models.OrderStatusPending,
+			Version:    1,
+		},
+		{
+			ID:     "650e8400-e29b-41d4-a716-446655440001",
+			UserID: "750e8400-e29b-41d4-a716-446655440000", // johndoe
+			Products: []models.OrderProduct{
+				{
+					ProductID:   "550e8400-e29b-41d4-a716-446655440002",
+					Quantity:    3,
+					ProductName: "Desk Lamp",
+					UnitPrice:   models.NewMoney(4999, models.DefaultCurrency),
+					LineTotal:   models.NewMoney(14997, models.DefaultCurrency),
+				},
+			},
+			TotalPrice: models.NewMoney(14997, models.DefaultCurrency),
+			OrderDate:  time.Now().AddDate(0, 0, -3),
+			Status:     models.OrderStatusShipped,
+			Version:    1,
+		},
+		{
+			ID:     "650e8400-e29b-41d4-a716-446655440002",
+			UserID: "750e8400-e29b-41d4-a716-446655440001", // janedoe
+			Products: []models.OrderProduct{
+				{
+					ProductID:   "550e8400-e29b-41d4-a716-446655440003",
+					Quantity:    5,
+					ProductName: "Notebook",
+					UnitPrice:   models.NewMoney(599, models.DefaultCurrency),
+					LineTotal:   models.NewMoney(2995, models.DefaultCurrency),
+				},
+				{
+					ProductID:   "550e8400-e29b-41d4-a716-446655440004",
+					Quantity:    1,
+					ProductName: "Coffee Maker",
+					UnitPrice:   models.NewMoney(14999, models.DefaultCurrency),
+					LineTotal:   models.NewMoney(14999, models.DefaultCurrency),
+				},
+			},
+			TotalPrice: models.NewMoney(17994, models.DefaultCurrency),
+			OrderDate:  time.Now().AddDate(0, 0, -1),
+			Status:     models.OrderStatusProcessing,
+			Version:    1,
+		},
+	}
+	repo.recordInitialEvents()
+
+	return repo
+}
+
+// recordInitialEvents starts the history of every order that has none with
+// an OrderCreated event and reports whether there were any. The caller must
+// hold the write lock or have exclusive access.
+func (r *InMemoryOrderRepository) recordInitialEvents() bool {
+	recorded := false
+	for i := range r.orders {
+		if len(r.events[r.orders[i].ID]) == 0 {
+			r.events[r.orders[i].ID] = []models.OrderEvent{initialOrderEvent(&r.orders[i])}
+			recorded = true
+		}
+	}
+	return recorded
+}
+
+// Get returns a copy of the order with the given ID
+func (r *InMemoryOrderRepository) Get(id string) (*models.Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, order := range r.orders {
+		if order.ID == id {
+			o := cloneOrder(order)
+			return &o, nil
+		}
+	}
+	return nil, ErrOrderNotFound
+}
+
+// List returns a copy of all orders
+func (r *InMemoryOrderRepository) List() ([]models.Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	orders := make([]models.Order, len(r.orders))
+	for i, order := range r.orders {
+		orders[i] = cloneOrder(order)
+	}
+	return orders, nil
+}
+
+// Query returns a copy of the page of orders selected by q
+func (r *InMemoryOrderRepository) Query(q OrderQuery) ([]models.Order, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	orders, total := queryOrders(r.orders, q)
+	return orders, total, nil
+}
+
+// Create stores a new order and the event recording its creation
+func (r *InMemoryOrderRepository) Create(order *models.Order, event *models.OrderEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.orders {
+		if existing.ID == order.ID {
+			return ErrOrderAlreadyExists
+		}
+	}
+
+	r.orders = append(r.orders, cloneOrder(*order))
+	if event != nil {
+		r.events[order.ID] = appendOrderEvent(nil, event)
+	}
+	return nil
+}
+
+// Update replaces the stored order with the same ID and appends its event
+func (r *InMemoryOrderRepository) Update(order *models.Order, event *models.OrderEvent) error {
+	return r.UpdateWithOutbox(order, event, nil)
+}
+
+// UpdateWithOutbox replaces the stored order with the same ID, appends its
+// event and appends messages to the outbox
+func (r *InMemoryOrderRepository) UpdateWithOutbox(order *models.Order, event *models.OrderEvent, messages []models.OutboxMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.orders {
+		if existing.ID == order.ID {
+			r.orders[i] = cloneOrder(*order)
+			if event != nil {
+				r.events[order.ID] = appendOrderEvent(r.events[order.ID], event)
+			}
+			for _, message := range messages {
+				r.outbox = append(r.outbox, cloneOutboxMessage(message))
+			}
+			return nil
+		}
+	}
+	return ErrOrderNotFound
+}
+
+// Delete removes the order with the given ID
+func (r *InMemoryOrderRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.orders {
+		if existing.ID == id {
+			r.orders = append(r.orders[:i], r.orders[i+1:]...)
+			delete(r.events, id)
+			return nil
+		}
+	}
+	return ErrOrderNotFound
+}
+
+// ListEvents returns a copy of the events recorded for an order
+func (r *InMemoryOrderRepository) ListEvents(orderID string) ([]models.OrderEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := make([]models.OrderEvent, len(r.events[orderID]))
+	for i, event := range r.events[orderID] {
+		events[i] = cloneEvent(event)
+	}
+	return events, nil
+}
+
+// ListOutbox returns a copy of the outbox messages with status, or of all
+// messages if status is empty
+func (r *InMemoryOrderRepository) ListOutbox(status models.OutboxStatus) ([]models.OutboxMessage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := []models.OutboxMessage{}
+	for _, message := range r.outbox {
+		if status == "" || message.Status == status {
+			messages = append(messages, cloneOutboxMessage(message))
+		}
+	}
+	return messages, nil
+}
+
+// GetOutbox returns a copy of the outbox message with the given ID
+func (r *InMemoryOrderRepository) GetOutbox(id string) (*models.OutboxMessage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, message := range r.outbox {
+		if message.ID == id {
+			m := cloneOutboxMessage(message)
+			return &m, nil
+		}
+	}
+	return nil, ErrOutboxMessageNotFound
+}
+
+// SaveOutbox replaces the stored outbox message with the same ID
+func (r *InMemoryOrderRepository) SaveOutbox(message *models.OutboxMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.outbox {
+		if existing.ID == message.ID {
+			r.outbox[i] = cloneOutboxMessage(*message)
+			return nil
+		}
+	}
+	return ErrOutboxMessageNotFound
+}
+
+// PruneOutbox removes the outbox messages delivered before deliveredBefore
+func (r *InMemoryOrderRepository) PruneOutbox(deliveredBefore time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before := len(r.outbox)
+	r.outbox = slices.DeleteFunc(r.outbox, func(message models.OutboxMessage) bool {
+		return prunable(message, deliveredBefore)
+	})
+	return before - len(r.outbox), nil
+}
+
+// prunable reports whether a message was delivered before deliveredBefore
+func prunable(message models.OutboxMessage, deliveredBefore time.Time) bool {
+	return message.Status == models.OutboxStatusDelivered && message.DeliveredAt != nil && message.DeliveredAt.Before(deliveredBefore)
+}
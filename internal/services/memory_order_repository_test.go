@@ -0,0 +1,123 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+func TestInMemoryOrderRepository_CreateAndGet(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+
+	order := &models.Order{
+		ID:         "order-1",
+		UserID:     "user-1",
+		Products:   []models.OrderProduct{{ProductID: "prod-1", Quantity: 2}},
+		TotalPrice: usd(5000),
+		OrderDate:  time.Now(),
+		Status:     models.OrderStatusPending,
+	}
+
+	if err := repo.Create(order, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Mutating the caller's copy must not affect stored state
+	order.Products[0].Quantity = 99
+
+	stored, err := repo.Get("order-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.Products[0].Quantity != 2 {
+		t.Errorf("Expected stored quantity 2, got %d", stored.Products[0].Quantity)
+	}
+
+	// Mutating the returned copy must not affect stored state either
+	stored.Products[0].Quantity = 42
+	again, _ := repo.Get("order-1")
+	if again.Products[0].Quantity != 2 {
+		t.Errorf("Expected stored quantity 2 after mutating returned order, got %d", again.Products[0].Quantity)
+	}
+}
+
+func TestInMemoryOrderRepository_CreateDuplicate(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	order := &models.Order{ID: "order-1", Status: models.OrderStatusPending}
+
+	if err := repo.Create(order, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.Create(order, nil); !errors.Is(err, ErrOrderAlreadyExists) {
+		t.Errorf("Expected ErrOrderAlreadyExists, got %v", err)
+	}
+}
+
+func TestInMemoryOrderRepository_UpdateAndDelete(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	order := &models.Order{ID: "order-1", Status: models.OrderStatusPending}
+	repo.Create(order, nil)
+
+	order.Status = models.OrderStatusProcessing
+	if err := repo.Update(order, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	stored, _ := repo.Get("order-1")
+	if stored.Status != models.OrderStatusProcessing {
+		t.Errorf("Expected status PROCESSING, got %s", stored.Status)
+	}
+
+	if err := repo.Delete("order-1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.Get("order-1"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound after delete, got %v", err)
+	}
+	if err := repo.Update(order, nil); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound when updating deleted order, got %v", err)
+	}
+	if err := repo.Delete("order-1"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound when deleting twice, got %v", err)
+	}
+}
+
+func TestNewMockOrderRepository_Seeded(t *testing.T) {
+	repo := NewMockOrderRepository()
+
+	orders, err := repo.List()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(orders) != 3 {
+		t.Errorf("Expected 3 seeded orders, got %d", len(orders))
+	}
+	for _, order := range orders {
+		if events, _ := repo.ListEvents(order.ID); len(events) != 1 || events[0].Type != models.OrderEventCreated {
+			t.Errorf("Expected %s to have an OrderCreated event, got %+v", order.ID, events)
+		}
+	}
+}
+
+func TestInMemoryOrderRepository_QueryByUser(t *testing.T) {
+	repo := NewMockOrderRepository()
+
+	orders, total, err := repo.Query(OrderQuery{Filter: OrderFilter{UserID: "750e8400-e29b-41d4-a716-446655440000"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(orders) != 2 || total != 2 {
+		t.Fatalf("Expected 2 orders for johndoe, got %d", len(orders))
+	}
+	for _, order := range orders {
+		if order.UserID != "750e8400-e29b-41d4-a716-446655440000" {
+			t.Errorf("Expected only johndoe's orders, got order owned by %s", order.UserID)
+		}
+	}
+
+	none, _, _ := repo.Query(OrderQuery{Filter: OrderFilter{UserID: "750e8400-e29b-41d4-a716-446655440002"}})
+	if none == nil || len(none) != 0 {
+		t.Errorf("Expected empty non-nil list for user without orders, got %+v", none)
+	}
+}
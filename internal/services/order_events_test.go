@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// rebuildOrder replays the stored history of an order
+func rebuildOrder(service *OrderService, orderID string) (*models.Order, error) {
+	events, err := service.repo.ListEvents(orderID)
+	if err != nil {
+		return nil, err
+	}
+	return replayOrderEvents(events)
+}
+
+func TestOrderService_RecordsEvents(t *testing.T) {
+	service := NewOrderService(NewInMemoryOrderRepository(), newYieldingProductClient(usd(1000)))
+
+	order, err := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "alice")
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	service.UpdateOrderProducts(context.Background(), order.ID, []models.OrderProduct{{ProductID: "prod-2", Quantity: 2}}, "", "bob", AnyVersion)
+	service.SubmitOrder(context.Background(), order.ID, "carol", AnyVersion)
+
+	// A rejected change must not be recorded
+	if _, err := service.UpdateOrderProducts(context.Background(), order.ID, []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "bob", AnyVersion); err == nil {
+		t.Fatal("Expected error updating a submitted order, got nil")
+	}
+
+	events, err := service.GetOrderEvents(context.Background(), order.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []struct {
+		eventType models.OrderEventType
+		actor     string
+	}{
+		{models.OrderEventCreated, "alice"},
+		{models.OrderEventProductsAdjusted, "bob"},
+		{models.OrderEventSubmitted, "carol"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(events))
+	}
+	for i, want := range expected {
+		if events[i].Sequence != i+1 || events[i].Type != want.eventType || events[i].Actor != want.actor {
+			t.Errorf("Event %d: expected #%d %s by %s, got #%d %s by %s",
+				i, i+1, want.eventType, want.actor, events[i].Sequence, events[i].Type, events[i].Actor)
+		}
+	}
+
+	if events[0].Before != nil {
+		t.Errorf("Expected creation event to have no before snapshot")
+	}
+	if len(events[1].Before.Products) != 1 || len(events[1].After.Products) != 2 {
+		t.Errorf("Expected product snapshots before and after adjustment, got %+v and %+v",
+			events[1].Before.Products, events[1].After.Products)
+	}
+	if events[2].Before.Status != models.OrderStatusPending || events[2].After.Status != models.OrderStatusProcessing {
+		t.Errorf("Expected PENDING -> PROCESSING, got %s -> %s", events[2].Before.Status, events[2].After.Status)
+	}
+}
+
+func TestOrderService_HistoryMatchesRepository(t *testing.T) {
+	repositories := []struct {
+		name string
+		open func(t *testing.T) (repo OrderRepository, reopen func() OrderRepository)
+	}{
+		{
+			name: "Memory",
+			open: func(t *testing.T) (OrderRepository, func() OrderRepository) {
+				repo := NewInMemoryOrderRepository()
+				return repo, func() OrderRepository { return repo }
+			},
+		},
+		{
+			name: "File",
+			open: func(t *testing.T) (OrderRepository, func() OrderRepository) {
+				dir := t.TempDir()
+				repo := openFileRepo(t, dir, 3)
+				return repo, func() OrderRepository {
+					repo.Close()
+					return openFileRepo(t, dir, 3)
+				}
+			},
+		},
+		{
+			name: "SQLite",
+			open: func(t *testing.T) (OrderRepository, func() OrderRepository) {
+				repo := newTestSQLRepo(t)
+				return repo, func() OrderRepository { return NewSQLOrderRepository(repo.db) }
+			},
+		},
+	}
+
+	for _, tt := range repositories {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, reopen := tt.open(t)
+			service := NewOrderService(repo, newYieldingProductClient(usd(1000)))
+
+			order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 3}}, "", "alice")
+			service.UpdateOrderProducts(context.Background(), order.ID, []models.OrderProduct{{ProductID: "prod-1", Quantity: -1}, {ProductID: "prod-2", Quantity: 4}}, "", "alice", AnyVersion)
+			service.SubmitOrder(context.Background(), order.ID, "alice", AnyVersion)
+			service.ShipOrder(context.Background(), order.ID, "admin", AnyVersion)
+			service.DeliverOrder(context.Background(), order.ID, "admin", AnyVersion)
+
+			other, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-3", Quantity: 1}}, "", "bob")
+			service.CancelOrder(context.Background(), other.ID, "bob", AnyVersion)
+
+			// The history is stored with the orders, so it survives a restart
+			service = NewOrderService(reopen(), newYieldingProductClient(usd(1000)))
+			for id, length := range map[string]int{order.ID: 5, other.ID: 2} {
+				events, _ := service.GetOrderEvents(context.Background(), id)
+				if len(events) != length {
+					t.Fatalf("Expected %d events for %s, got %d", length, id, len(events))
+				}
+				rebuilt, err := rebuildOrder(service, id)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				stored, _ := service.GetOrderByID(context.Background(), id)
+				if !rebuilt.OrderDate.Equal(stored.OrderDate) {
+					t.Errorf("Expected order date %v, got %v", stored.OrderDate, rebuilt.OrderDate)
+				}
+				rebuilt.OrderDate = stored.OrderDate
+				if !reflect.DeepEqual(rebuilt, stored) {
+					t.Errorf("Expected replay to match stored order\nstored:  %+v\nrebuilt: %+v", stored, rebuilt)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderService_ChangeFailsWithoutItsEvent(t *testing.T) {
+	repo := newTestSQLRepo(t)
+	service := NewOrderService(repo, newYieldingProductClient(usd(1000)))
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "alice")
+
+	// An event that cannot be stored rolls the change back with it
+	events, _ := repo.ListEvents(order.ID)
+	changed := cloneOrder(*order)
+	changed.Status = models.OrderStatusCanceled
+	event := newOrderEvent(models.OrderEventCanceled, "alice", order, &changed)
+	event.ID = events[0].ID
+	if err := repo.Update(&changed, event); err == nil {
+		t.Fatal("Expected an error storing a duplicate event, got nil")
+	}
+
+	if stored, _ := repo.Get(order.ID); stored.Status != models.OrderStatusPending {
+		t.Errorf("Expected the order to stay PENDING, got %s", stored.Status)
+	}
+	if events, _ := repo.ListEvents(order.ID); len(events) != 1 {
+		t.Errorf("Expected 1 event, got %d", len(events))
+	}
+}
+
+func TestOrderService_GetOrderEventsNotFound(t *testing.T) {
+	service := NewOrderService(NewInMemoryOrderRepository(), newYieldingProductClient(usd(1000)))
+
+	if _, err := service.GetOrderEvents(context.Background(), "missing"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+}
+
+func TestReplayOrderEvents_InvalidStreams(t *testing.T) {
+	order := newTestOrder("order-1", 1)
+
+	tests := []struct {
+		name   string
+		events []models.OrderEvent
+	}{
+		{
+			name:   "Gap in sequence",
+			events: []models.OrderEvent{{Sequence: 1, Type: models.OrderEventCreated, After: order}, {Sequence: 3, Type: models.OrderEventSubmitted, After: order}},
+		},
+		{
+			name:   "Does not start with creation",
+			events: []models.OrderEvent{{Sequence: 1, Type: models.OrderEventSubmitted, After: order}},
+		},
+		{
+			name:   "Created twice",
+			events: []models.OrderEvent{{Sequence: 1, Type: models.OrderEventCreated, After: order}, {Sequence: 2, Type: models.OrderEventCreated, After: order}},
+		},
+		{
+			name:   "Unknown type",
+			events: []models.OrderEvent{{Sequence: 1, Type: models.OrderEventCreated, After: order}, {Sequence: 2, Type: "Teleported", After: order}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := replayOrderEvents(tt.events); !errors.Is(err, errInvalidEventStream) {
+				t.Errorf("Expected errInvalidEventStream, got %v", err)
+			}
+		})
+	}
+}
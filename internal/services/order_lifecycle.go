@@ -0,0 +1,57 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+var (
+	// ErrInvalidTransition is returned when an order cannot move from its
+	// current status to the requested one
+	ErrInvalidTransition = errors.New("invalid order status transition")
+	// ErrOrderNotPending is returned when an operation that requires a PENDING
+	// order is attempted on an order in any other status
+	ErrOrderNotPending = fmt.Errorf("%w: order is not pending", ErrInvalidTransition)
+)
+
+// orderTransitions lists the statuses each status may move to. An order moves
+// forward through PENDING, PROCESSING, SHIPPED and DELIVERED, can be canceled
+// until it ships and returned once delivered. CANCELED and RETURNED are final.
+var orderTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderStatusPending:    {models.OrderStatusProcessing, models.OrderStatusCanceled},
+	models.OrderStatusProcessing: {models.OrderStatusShipped, models.OrderStatusCanceled},
+	models.OrderStatusShipped:    {models.OrderStatusDelivered},
+	models.OrderStatusDelivered:  {models.OrderStatusReturned},
+	models.OrderStatusCanceled:   {},
+	models.OrderStatusReturned:   {},
+}
+
+// CanTransition reports whether an order in status from may move to status to
+func CanTransition(from, to models.OrderStatus) bool {
+	return slices.Contains(orderTransitions[from], to)
+}
+
+// checkTransition returns ErrInvalidTransition unless the order may move to status
+func checkTransition(order *models.Order, status models.OrderStatus) error {
+	if !CanTransition(order.Status, status) {
+		return fmt.Errorf("%w: cannot move order from %s to %s", ErrInvalidTransition, order.Status, status)
+	}
+	return nil
+}
+
+// givesBackLoyaltyPoints reports whether an order in status gives back the
+// loyalty points it was awarded and those it redeemed
+func givesBackLoyaltyPoints(status models.OrderStatus) bool {
+	return status == models.OrderStatusCanceled || status == models.OrderStatusReturned
+}
+
+// checkPending returns ErrOrderNotPending unless the order is PENDING
+func checkPending(order *models.Order) error {
+	if order.Status != models.OrderStatusPending {
+		return fmt.Errorf("%w: order is %s", ErrOrderNotPending, order.Status)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+func TestCanTransition(t *testing.T) {
+	allowed := map[[2]models.OrderStatus]bool{
+		{models.OrderStatusPending, models.OrderStatusProcessing}:  true,
+		{models.OrderStatusPending, models.OrderStatusCanceled}:    true,
+		{models.OrderStatusProcessing, models.OrderStatusShipped}:  true,
+		{models.OrderStatusProcessing, models.OrderStatusCanceled}: true,
+		{models.OrderStatusShipped, models.OrderStatusDelivered}:   true,
+		{models.OrderStatusDelivered, models.OrderStatusReturned}:  true,
+	}
+	statuses := []models.OrderStatus{
+		models.OrderStatusPending,
+		models.OrderStatusProcessing,
+		models.OrderStatusShipped,
+		models.OrderStatusDelivered,
+		models.OrderStatusCanceled,
+		models.OrderStatusReturned,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			if got := CanTransition(from, to); got != allowed[[2]models.OrderStatus{from, to}] {
+				t.Errorf("CanTransition(%s, %s) = %v", from, to, got)
+			}
+		}
+	}
+}
+
+func TestOrderLifecycle_FullFulfillment(t *testing.T) {
+	service := NewOrderService(NewInMemoryOrderRepository(), newYieldingProductClient(usd(1000)))
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+
+	steps := []struct {
+		name   string
+		change func(ctx context.Context, orderID, actor string, expectedVersion int) (*models.Order, error)
+		status models.OrderStatus
+	}{
+		{"Submit", service.SubmitOrder, models.OrderStatusProcessing},
+		{"Ship", service.ShipOrder, models.OrderStatusShipped},
+		{"Deliver", service.DeliverOrder, models.OrderStatusDelivered},
+		{"Return", service.ReturnOrder, models.OrderStatusReturned},
+	}
+	for _, step := range steps {
+		updated, err := step.change(context.Background(), order.ID, "test-admin", AnyVersion)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", step.name, err)
+		}
+		if updated.Status != step.status {
+			t.Errorf("%s: expected status %s, got %s", step.name, step.status, updated.Status)
+		}
+	}
+
+	events, _ := service.GetOrderEvents(context.Background(), order.ID)
+	if last := events[len(events)-1]; last.Type != models.OrderEventReturned {
+		t.Errorf("Expected last event %s, got %s", models.OrderEventReturned, last.Type)
+	}
+}
+
+func TestOrderLifecycle_RejectedTransitions(t *testing.T) {
+	service := NewOrderService(NewInMemoryOrderRepository(), newYieldingProductClient(usd(1000)))
+	products := []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}
+
+	canceled, _ := service.CreateOrder(context.Background(), "user-123", products, "", "test-admin")
+	service.CancelOrder(context.Background(), canceled.ID, "test-admin", AnyVersion)
+
+	delivered, _ := service.CreateOrder(context.Background(), "user-123", products, "", "test-admin")
+	service.SubmitOrder(context.Background(), delivered.ID, "test-admin", AnyVersion)
+	service.ShipOrder(context.Background(), delivered.ID, "test-admin", AnyVersion)
+	service.DeliverOrder(context.Background(), delivered.ID, "test-admin", AnyVersion)
+
+	pending, _ := service.CreateOrder(context.Background(), "user-123", products, "", "test-admin")
+
+	tests := []struct {
+		name     string
+		change   func() (*models.Order, error)
+		expected error
+	}{
+		{"Cancel a canceled order", func() (*models.Order, error) {
+			return service.CancelOrder(context.Background(), canceled.ID, "test-admin", AnyVersion)
+		}, ErrInvalidTransition},
+		{"Cancel a delivered order", func() (*models.Order, error) {
+			return service.CancelOrder(context.Background(), delivered.ID, "test-admin", AnyVersion)
+		}, ErrInvalidTransition},
+		{"Ship a pending order", func() (*models.Order, error) {
+			return service.ShipOrder(context.Background(), pending.ID, "test-admin", AnyVersion)
+		}, ErrInvalidTransition},
+		{"Deliver a pending order", func() (*models.Order, error) {
+			return service.DeliverOrder(context.Background(), pending.ID, "test-admin", AnyVersion)
+		}, ErrInvalidTransition},
+		{"Return a canceled order", func() (*models.Order, error) {
+			return service.ReturnOrder(context.Background(), canceled.ID, "test-admin", AnyVersion)
+		}, ErrInvalidTransition},
+		{"Submit a canceled order", func() (*models.Order, error) {
+			return service.SubmitOrder(context.Background(), canceled.ID, "test-admin", AnyVersion)
+		}, ErrOrderNotPending},
+		{"Update products of a delivered order", func() (*models.Order, error) {
+			return service.UpdateOrderProducts(context.Background(), delivered.ID, products, "", "test-admin", AnyVersion)
+		}, ErrOrderNotPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := tt.change()
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+			if order != nil {
+				t.Errorf("Expected nil order, got %+v", order)
+			}
+		})
+	}
+
+	// Rejected changes leave the orders untouched
+	if order, _ := service.GetOrderByID(context.Background(), pending.ID); order.Status != models.OrderStatusPending || order.Version != 1 {
+		t.Errorf("Expected pending order at version 1, got %s at version %d", order.Status, order.Version)
+	}
+	if order, _ := service.GetOrderByID(context.Background(), delivered.ID); order.Status != models.OrderStatusDelivered || order.Version != 4 {
+		t.Errorf("Expected delivered order at version 4, got %s at version %d", order.Status, order.Version)
+	}
+}
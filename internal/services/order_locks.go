@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// orderLocks hands out one lock per order ID so read-modify-write cycles on
+// the same order are serialized while different orders proceed in parallel.
+// Entries are reference counted and removed once no goroutine holds or waits
+// on them, so the map does not grow with the number of orders ever touched.
+type orderLocks struct {
+	mu    sync.Mutex
+	locks map[string]*orderLock
+}
+
+// orderLock is held by whoever has put a token in held. A channel is used
+// instead of a mutex so that waiting can be abandoned when a context is done.
+type orderLock struct {
+	held chan struct{}
+	refs int
+}
+
+func newOrderLocks() *orderLocks {
+	return &orderLocks{locks: make(map[string]*orderLock)}
+}
+
+// lock blocks until the caller holds the lock for orderID and returns the
+// function that releases it. It gives up with the context's error if ctx is
+// done first.
+func (l *orderLocks) lock(ctx context.Context, orderID string) (func(), error) {
+	l.mu.Lock()
+	entry, ok := l.locks[orderID]
+	if !ok {
+		entry = &orderLock{held: make(chan struct{}, 1)}
+		l.locks[orderID] = entry
+	}
+	entry.refs++
+	l.mu.Unlock()
+
+	select {
+	case entry.held <- struct{}{}:
+	case <-ctx.Done():
+		l.release(orderID, entry)
+		return nil, ctx.Err()
+	}
+
+	return func() {
+		<-entry.held
+		l.release(orderID, entry)
+	}, nil
+}
+
+// release drops a reference to entry, removing it once it is unused
+func (l *orderLocks) release(orderID string, entry *orderLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.refs--
+	if entry.refs == 0 {
+		delete(l.locks, orderID)
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// WithOutbox queues the loyalty point redemptions, awards and reversals of
+// order changes in the repository's outbox, written together with the change, instead of
+// calling the Loyalty Service while the change is made. The messages are
+// delivered by an OutboxDispatcher calling DeliverOutboxMessage. It has no
+// effect unless the repository implements OutboxRepository.
+func WithOutbox() OrderServiceOption {
+	return func(s *OrderService) {
+		s.useOutbox = true
+	}
+}
+
+// loyaltyMessages returns the outbox message for a loyalty side effect of a
+// change actor is making to order, or none if there is nothing to deliver
+func (s *OrderService) loyaltyMessages(messageType models.OutboxMessageType, order *models.Order, actor string) []models.OutboxMessage {
+	// Points reserved for the order are redeemed even without a Loyalty
+	// Service, so that the message fails and waits for an operator rather
+	// than the order keeping a discount it never paid for
+	if messageType == models.OutboxLoyaltyRedemption {
+		if discount := pointsDiscount(order); discount == nil || discount.RedemptionID != "" {
+			return nil
+		}
+		return []models.OutboxMessage{NewOutboxMessage(messageType, order.ID, actor)}
+	}
+	if s.loyaltyClient == nil {
+		return nil
+	}
+	switch messageType {
+	case models.OutboxLoyaltyAward:
+		if LoyaltyPointsFor(order.TotalPrice) == 0 || order.UserID == "" {
+			return nil
+		}
+	case models.OutboxLoyaltyReversal:
+		// A pending order has no award, pending or made, to reverse
+		if order.Status == models.OrderStatusPending && pointsDiscount(order) == nil {
+			return nil
+		}
+	}
+	return []models.OutboxMessage{NewOutboxMessage(messageType, order.ID, actor)}
+}
+
+// updateOrder stores a changed order and its event, together with its outbox
+// messages if it has any
+func (s *OrderService) updateOrder(order *models.Order, event *models.OrderEvent, messages []models.OutboxMessage) error {
+	if len(messages) == 0 {
+		return s.repo.Update(order, event)
+	}
+	return s.outbox.UpdateWithOutbox(order, event, messages)
+}
+
+// DeliverOutboxMessage makes the loyalty side effect of an order change and
+// records the outcome on the order as a PointsRedeemed, LoyaltyAwarded or
+// LoyaltyReversed event. Loyalty Service calls are idempotent and progress is stored even if
+// part of the delivery fails, so a message can be delivered again safely.
+// Messages of an order that no longer exists are dropped.
+func (s *OrderService) DeliverOutboxMessage(ctx context.Context, message *models.OutboxMessage) error {
+	unlock, err := s.locks.lock(ctx, message.OrderID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	order, err := s.repo.Get(message.OrderID)
+	if errors.Is(err, ErrOrderNotFound) {
+		log.Printf("Dropping outbox message %s: order %s no longer exists", message.ID, message.OrderID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	before := cloneOrder(*order)
+	var eventType models.OrderEventType
+	var deliverErr error
+	switch message.Type {
+	case models.OutboxLoyaltyRedemption:
+		// Points the reversal of a canceled order already released are not
+		// redeemed, as commitRedemption finds no discount left to commit
+		eventType = models.OrderEventPointsRedeemed
+		deliverErr = s.commitRedemption(ctx, order)
+	case models.OutboxLoyaltyAward:
+		eventType = models.OrderEventLoyaltyAwarded
+		deliverErr = s.awardLoyaltyPoints(ctx, order)
+		// An order canceled or returned before its award was delivered gives
+		// the points back at once, as its reversal may already have found
+		// nothing to do
+		if deliverErr == nil && givesBackLoyaltyPoints(order.Status) {
+			deliverErr = s.reverseLoyaltyPoints(ctx, order)
+		}
+	case models.OutboxLoyaltyReversal:
+		eventType = models.OrderEventLoyaltyReversed
+		deliverErr = s.giveBackLoyaltyPoints(ctx, order)
+	default:
+		return fmt.Errorf("unknown outbox message type %q", message.Type)
+	}
+
+	if loyaltyChanged(&before, order) {
+		order.Version++
+		if err := s.repo.Update(order, newOrderEvent(eventType, message.Actor, &before, order)); err != nil {
+			return errors.Join(deliverErr, err)
+		}
+	}
+	return deliverErr
+}
+
+// loyaltyChanged reports whether the loyalty points of an order, or the
+// discounts they pay for, differ between before and after
+func loyaltyChanged(before, after *models.Order) bool {
+	return before.AccruedLoyaltyPoints != after.AccruedLoyaltyPoints ||
+		before.LoyaltyTransactionID != after.LoyaltyTransactionID ||
+		before.LoyaltyReversalID != after.LoyaltyReversalID ||
+		before.TotalPrice != after.TotalPrice ||
+		!slices.Equal(before.Discounts, after.Discounts)
+}
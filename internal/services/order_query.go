@@ -0,0 +1,171 @@
+package services
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded or
+// was issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	// DefaultOrderPageSize is the number of orders returned when no limit is given
+	DefaultOrderPageSize = 20
+	// MaxOrderPageSize is the largest page of orders that can be requested
+	MaxOrderPageSize = 100
+)
+
+// OrderSortField is a field orders can be sorted by
+type OrderSortField string
+
+const (
+	OrderSortByOrderDate  OrderSortField = "orderDate"
+	OrderSortByTotalPrice OrderSortField = "totalPrice"
+)
+
+// OrderFilter restricts which orders are listed. Zero values match every order.
+type OrderFilter struct {
+	Status    models.OrderStatus
+	UserID    string
+	ProductID string
+	// OrderDateFrom is inclusive and OrderDateTo exclusive
+	OrderDateFrom time.Time
+	OrderDateTo   time.Time
+}
+
+// matches reports whether an order passes the filter
+func (f OrderFilter) matches(order *models.Order) bool {
+	if f.Status != "" && order.Status != f.Status {
+		return false
+	}
+	if f.UserID != "" && order.UserID != f.UserID {
+		return false
+	}
+	if !f.OrderDateFrom.IsZero() && order.OrderDate.Before(f.OrderDateFrom) {
+		return false
+	}
+	if !f.OrderDateTo.IsZero() && !order.OrderDate.Before(f.OrderDateTo) {
+		return false
+	}
+	if f.ProductID != "" {
+		return slices.ContainsFunc(order.Products, func(p models.OrderProduct) bool {
+			return p.ProductID == f.ProductID
+		})
+	}
+	return true
+}
+
+// OrderCursor marks the last order of a page. The next page starts with the
+// first order that sorts after it; ties on the sort field are broken by ID.
+type OrderCursor struct {
+	SortBy     OrderSortField `json:"s"`
+	Descending bool           `json:"d,omitempty"`
+	ID         string         `json:"id"`
+	OrderDate  time.Time      `json:"od"`
+	TotalPrice models.Money   `json:"tp"`
+}
+
+// OrderQuery selects a page of orders
+type OrderQuery struct {
+	Filter     OrderFilter
+	SortBy     OrderSortField
+	Descending bool
+	// Limit is the maximum number of orders to return; <= 0 means no limit
+	Limit int
+	// After, if set, skips orders up to and including the cursor position
+	After *OrderCursor
+}
+
+// OrderPage is one page of a listing
+type OrderPage struct {
+	Orders []models.Order
+	// Total is the number of orders matching the filter across all pages
+	Total int
+	// NextCursor is empty on the last page
+	NextCursor string
+}
+
+// cursorFor returns the cursor positioned at order for the query's sort order
+func (q OrderQuery) cursorFor(order *models.Order) *OrderCursor {
+	return &OrderCursor{
+		SortBy:     q.SortBy,
+		Descending: q.Descending,
+		ID:         order.ID,
+		OrderDate:  order.OrderDate,
+		TotalPrice: order.TotalPrice,
+	}
+}
+
+// compareOrderPositions orders two positions by the sort field, then by ID
+func compareOrderPositions(a, b *OrderCursor, sortBy OrderSortField, descending bool) int {
+	var c int
+	switch sortBy {
+	case OrderSortByTotalPrice:
+		c = a.TotalPrice.Cmp(b.TotalPrice)
+	default:
+		c = a.OrderDate.Compare(b.OrderDate)
+	}
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	if descending {
+		return -c
+	}
+	return c
+}
+
+// queryOrders applies a query to a full set of orders in memory, returning the
+// selected page and the number of orders matching the filter
+func queryOrders(orders []models.Order, q OrderQuery) ([]models.Order, int) {
+	matched := []models.Order{}
+	for i := range orders {
+		if q.Filter.matches(&orders[i]) {
+			matched = append(matched, cloneOrder(orders[i]))
+		}
+	}
+	total := len(matched)
+
+	slices.SortStableFunc(matched, func(a, b models.Order) int {
+		return compareOrderPositions(q.cursorFor(&a), q.cursorFor(&b), q.SortBy, q.Descending)
+	})
+
+	if q.After != nil {
+		start, _ := slices.BinarySearchFunc(matched, q.After, func(order models.Order, after *OrderCursor) int {
+			if compareOrderPositions(q.cursorFor(&order), after, q.SortBy, q.Descending) <= 0 {
+				return -1
+			}
+			return 1
+		})
+		matched = matched[start:]
+	}
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+	return matched, total
+}
+
+// encodeOrderCursor turns a cursor into an opaque URL-safe token
+func encodeOrderCursor(cursor *OrderCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeOrderCursor parses a token from encodeOrderCursor
+func decodeOrderCursor(token string) (*OrderCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor OrderCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
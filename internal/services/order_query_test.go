@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// seedQueryOrders stores ten orders with repeating prices and dates so that
+// paging has to break ties by ID
+func seedQueryOrders(t *testing.T, repo OrderRepository) {
+	t.Helper()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		order := &models.Order{
+			ID:         fmt.Sprintf("order-%02d", 9-i),
+			UserID:     fmt.Sprintf("user-%d", i%2),
+			Products:   []models.OrderProduct{{ProductID: fmt.Sprintf("prod-%d", i%3), Quantity: 1}},
+			TotalPrice: usd(int64(i%4) * 1000),
+			OrderDate:  base.Add(time.Duration(i/2) * 24 * time.Hour),
+			Status:     models.OrderStatusPending,
+			Version:    1,
+		}
+		if i%5 == 0 {
+			order.Status = models.OrderStatusShipped
+		}
+		if err := repo.Create(order, nil); err != nil {
+			t.Fatalf("Failed to seed order: %v", err)
+		}
+	}
+}
+
+// collectPages walks every page of a query and returns the orders in order
+func collectPages(t *testing.T, service *OrderService, query OrderQuery) []models.Order {
+	t.Helper()
+	var all []models.Order
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 20 {
+			t.Fatal("Paging did not terminate")
+		}
+		page, err := service.QueryOrders(context.Background(), query, cursor)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(page.Orders) > query.Limit {
+			t.Fatalf("Expected at most %d orders per page, got %d", query.Limit, len(page.Orders))
+		}
+		all = append(all, page.Orders...)
+		if page.NextCursor == "" {
+			return all
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func testOrderQueries(t *testing.T, repo OrderRepository) {
+	seedQueryOrders(t, repo)
+	service := NewOrderService(repo, &MockProductServiceClient{})
+
+	sorts := []struct {
+		sortBy     OrderSortField
+		descending bool
+	}{
+		{OrderSortByOrderDate, false},
+		{OrderSortByOrderDate, true},
+		{OrderSortByTotalPrice, false},
+		{OrderSortByTotalPrice, true},
+	}
+	for _, sort := range sorts {
+		t.Run(fmt.Sprintf("Paging by %s desc=%v", sort.sortBy, sort.descending), func(t *testing.T) {
+			query := OrderQuery{SortBy: sort.sortBy, Descending: sort.descending, Limit: 3}
+			orders := collectPages(t, service, query)
+			if len(orders) != 10 {
+				t.Fatalf("Expected 10 orders across pages, got %d", len(orders))
+			}
+			seen := map[string]bool{}
+			for i, order := range orders {
+				if seen[order.ID] {
+					t.Errorf("Order %s returned twice", order.ID)
+				}
+				seen[order.ID] = true
+				if i > 0 && compareOrderPositions(query.cursorFor(&orders[i-1]), query.cursorFor(&order), sort.sortBy, sort.descending) >= 0 {
+					t.Errorf("Orders %s and %s are out of order", orders[i-1].ID, order.ID)
+				}
+			}
+		})
+	}
+
+	filters := []struct {
+		name     string
+		filter   OrderFilter
+		expected int
+	}{
+		{"Status", OrderFilter{Status: models.OrderStatusShipped}, 2},
+		{"User", OrderFilter{UserID: "user-1"}, 5},
+		{"Product", OrderFilter{ProductID: "prod-0"}, 4},
+		{"Date range", OrderFilter{
+			OrderDateFrom: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+			OrderDateTo:   time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC),
+		}, 4},
+		{"Combined", OrderFilter{UserID: "user-0", ProductID: "prod-0"}, 2},
+	}
+	for _, tt := range filters {
+		t.Run("Filter by "+tt.name, func(t *testing.T) {
+			query := OrderQuery{Filter: tt.filter, Limit: 2}
+			page, err := service.QueryOrders(context.Background(), query, "")
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if page.Total != tt.expected {
+				t.Errorf("Expected total %d, got %d", tt.expected, page.Total)
+			}
+			orders := collectPages(t, service, query)
+			if len(orders) != tt.expected {
+				t.Errorf("Expected %d orders across pages, got %d", tt.expected, len(orders))
+			}
+			for _, order := range orders {
+				if !tt.filter.matches(&order) {
+					t.Errorf("Order %+v does not match filter", order)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderQueries_InMemory(t *testing.T) {
+	testOrderQueries(t, NewInMemoryOrderRepository())
+}
+
+func TestOrderQueries_SQL(t *testing.T) {
+	testOrderQueries(t, newTestSQLRepo(t))
+}
+
+func TestQueryOrders_InvalidCursor(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	seedQueryOrders(t, repo)
+	service := NewOrderService(repo, &MockProductServiceClient{})
+
+	if _, err := service.QueryOrders(context.Background(), OrderQuery{Limit: 2}, "not a cursor"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for garbage, got %v", err)
+	}
+
+	page, _ := service.QueryOrders(context.Background(), OrderQuery{SortBy: OrderSortByTotalPrice, Limit: 2}, "")
+	if _, err := service.QueryOrders(context.Background(), OrderQuery{SortBy: OrderSortByOrderDate, Limit: 2}, page.NextCursor); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for a different sort field, got %v", err)
+	}
+	if _, err := service.QueryOrders(context.Background(), OrderQuery{SortBy: OrderSortByTotalPrice, Descending: true, Limit: 2}, page.NextCursor); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for a different direction, got %v", err)
+	}
+}
+
+func TestQueryOrders_LimitDefaults(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	for i := 0; i < MaxOrderPageSize+5; i++ {
+		repo.Create(newTestOrder(fmt.Sprintf("order-%03d", i), 1), nil)
+	}
+	service := NewOrderService(repo, &MockProductServiceClient{})
+
+	page, _ := service.QueryOrders(context.Background(), OrderQuery{}, "")
+	if len(page.Orders) != DefaultOrderPageSize || page.NextCursor == "" {
+		t.Errorf("Expected a default page of %d with a next cursor, got %d", DefaultOrderPageSize, len(page.Orders))
+	}
+	page, _ = service.QueryOrders(context.Background(), OrderQuery{Limit: 1000}, "")
+	if len(page.Orders) != MaxOrderPageSize {
+		t.Errorf("Expected page size capped at %d, got %d", MaxOrderPageSize, len(page.Orders))
+	}
+	if page.Total != MaxOrderPageSize+5 {
+		t.Errorf("Expected total %d, got %d", MaxOrderPageSize+5, page.Total)
+	}
+}
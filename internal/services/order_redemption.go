@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+var (
+	// ErrRedemptionUnavailable is returned when points are to be redeemed but
+	// no Loyalty Service is configured
+	ErrRedemptionUnavailable = errors.New("loyalty points cannot be redeemed: no loyalty service configured")
+	// ErrRedemptionExceedsTotal is returned when the points to redeem are worth
+	// more than the order
+	ErrRedemptionExceedsTotal = errors.New("redeemed points are worth more than the order total")
+	// ErrRedemptionFailed is returned when the points reserved for an order
+	// cannot be redeemed on submission
+	ErrRedemptionFailed = errors.New("failed to redeem reserved loyalty points")
+)
+
+// DefaultLoyaltyPointValue is the discount given for each redeemed point
+var DefaultLoyaltyPointValue = models.NewMoney(1, models.DefaultCurrency)
+
+// WithLoyaltyPointValue sets the discount given for each redeemed point. By
+// default a point is worth DefaultLoyaltyPointValue.
+func WithLoyaltyPointValue(value models.Money) OrderServiceOption {
+	return func(s *OrderService) {
+		s.pointValue = value
+	}
+}
+
+// orderTotal returns the sum of the line totals less the discounts, or zero
+// if the discounts exceed the lines
+func orderTotal(lines []models.OrderProduct, discounts []models.OrderDiscount) models.Money {
+	total := models.NewMoney(0, models.DefaultCurrency)
+	for _, line := range lines {
+		total = total.Add(line.LineTotal)
+	}
+	for _, discount := range discounts {
+		total = total.Sub(discount.Amount)
+	}
+	if total.Amount < 0 {
+		return models.NewMoney(0, total.Currency)
+	}
+	return total
+}
+
+// pointsDiscount returns the order's loyalty points discount, or nil if it has none
+func pointsDiscount(order *models.Order) *models.OrderDiscount {
+	for i := range order.Discounts {
+		if order.Discounts[i].Type == models.DiscountLoyaltyPoints {
+			return &order.Discounts[i]
+		}
+	}
+	return nil
+}
+
+// removePointsDiscount drops the order's loyalty points discount and recomputes its total
+func removePointsDiscount(order *models.Order) {
+	order.Discounts = slices.DeleteFunc(order.Discounts, func(d models.OrderDiscount) bool {
+		return d.Type == models.DiscountLoyaltyPoints
+	})
+	if len(order.Discounts) == 0 {
+		order.Discounts = nil
+	}
+	order.TotalPrice = orderTotal(order.Products, order.Discounts)
+}
+
+// checkRedemptionCovered returns ErrRedemptionExceedsTotal if the order's
+// points discount is worth more than lines, so that a change to a pending
+// order cannot leave it discounted by more than it is worth
+func checkRedemptionCovered(order *models.Order, lines []models.OrderProduct) error {
+	discount := pointsDiscount(order)
+	if discount == nil {
+		return nil
+	}
+	if subtotal := orderTotal(lines, nil); discount.Amount.Cmp(subtotal) > 0 {
+		return fmt.Errorf("%w: %d redeemed points are worth %s, the order would total %s", ErrRedemptionExceedsTotal, discount.Points, discount.Amount, subtotal)
+	}
+	return nil
+}
+
+// reservePoints holds points of a user for a new order and returns the
+// discount they are worth. The points may not be worth more than subtotal.
+func (s *OrderService) reservePoints(ctx context.Context, userID, orderID string, points int, subtotal models.Money) (*models.OrderDiscount, error) {
+	if s.loyaltyClient == nil {
+		return nil, ErrRedemptionUnavailable
+	}
+	amount := s.pointValue.Mul(points)
+	if amount.Cmp(subtotal) > 0 {
+		return nil, fmt.Errorf("%w: %d points are worth %s, the order totals %s", ErrRedemptionExceedsTotal, points, amount, subtotal)
+	}
+
+	reservationID, err := s.loyaltyClient.ReservePoints(ctx, userID, orderID, points)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Reserved %d loyalty points of user %s for order %s (reservation %s)", points, userID, orderID, reservationID)
+	return &models.OrderDiscount{Type: models.DiscountLoyaltyPoints, Points: points, Amount: amount, ReservationID: reservationID}, nil
+}
+
+// commitRedemption redeems the points reserved for an order that is being
+// submitted. Unlike the award of points, a failure fails the submission: the
+// order stays PENDING with its reservation and can be submitted again, or the
+// outbox message retries it. The commit is keyed by reservation, so a retried
+// submission redeems once.
+func (s *OrderService) commitRedemption(ctx context.Context, order *models.Order) error {
+	discount := pointsDiscount(order)
+	if discount == nil || discount.RedemptionID != "" {
+		return nil
+	}
+	if s.loyaltyClient == nil {
+		return fmt.Errorf("%w: %w", ErrRedemptionFailed, ErrRedemptionUnavailable)
+	}
+
+	redemptionID, err := s.loyaltyClient.CommitReservation(ctx, order.UserID, discount.ReservationID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRedemptionFailed, err)
+	}
+	log.Printf("Redeemed %d loyalty points of user %s for order %s (transaction %s)", discount.Points, order.UserID, order.ID, redemptionID)
+	discount.RedemptionID = redemptionID
+	return nil
+}
+
+// releaseRedemption gives back the points redeemed by an order that is
+// canceled or never submitted. Points still reserved are released and the
+// discount is removed; points already redeemed are refunded and the discount
+// is kept as a record of the refund. A failure leaves the discount unchanged.
+func (s *OrderService) releaseRedemption(ctx context.Context, order *models.Order) error {
+	discount := pointsDiscount(order)
+	if discount == nil || discount.RefundID != "" {
+		return nil
+	}
+	if s.loyaltyClient == nil {
+		return fmt.Errorf("cannot give back the loyalty points redeemed by order %s: %w", order.ID, ErrRedemptionUnavailable)
+	}
+
+	if discount.RedemptionID == "" {
+		if err := s.loyaltyClient.ReleaseReservation(ctx, order.UserID, discount.ReservationID); err != nil {
+			return fmt.Errorf("failed to release loyalty reservation %s of order %s: %w", discount.ReservationID, order.ID, err)
+		}
+		log.Printf("Released loyalty reservation %s of order %s", discount.ReservationID, order.ID)
+		removePointsDiscount(order)
+		return nil
+	}
+
+	refundID, err := s.loyaltyClient.ReversePoints(ctx, order.UserID, order.ID, discount.RedemptionID, discount.Points)
+	if err != nil {
+		return fmt.Errorf("failed to refund %d loyalty points of user %s for order %s: %w", discount.Points, order.UserID, order.ID, err)
+	}
+	log.Printf("Refunded %d loyalty points of user %s for order %s (transaction %s)", discount.Points, order.UserID, order.ID, refundID)
+	discount.RefundID = refundID
+	return nil
+}
+
+// ReleaseExpiredRedemptions releases the points reserved by orders that have
+// been pending for longer than maxAge, removing their discounts, and returns
+// how many were released. It is run periodically so that points are not held
+// by orders that are never submitted.
+func (s *OrderService) ReleaseExpiredRedemptions(ctx context.Context, maxAge time.Duration, actor string) (int, error) {
+	orders, _, err := s.repo.Query(OrderQuery{Filter: OrderFilter{
+		Status:      models.OrderStatusPending,
+		OrderDateTo: time.Now().Add(-maxAge),
+	}})
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, order := range orders {
+		if discount := pointsDiscount(&order); discount == nil || discount.RedemptionID != "" {
+			continue
+		}
+		ok, err := s.releaseExpiredRedemption(ctx, order.ID, actor)
+		if err != nil {
+			return released, err
+		}
+		if ok {
+			released++
+		}
+	}
+	return released, nil
+}
+
+// releaseExpiredRedemption releases the points reserved by a pending order,
+// reporting whether they were released
+func (s *OrderService) releaseExpiredRedemption(ctx context.Context, orderID, actor string) (bool, error) {
+	unlock, err := s.locks.lock(ctx, orderID)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	// The order may have been submitted or canceled since it was listed
+	order, err := s.repo.Get(orderID)
+	if err != nil {
+		return false, err
+	}
+	if discount := pointsDiscount(order); order.Status != models.OrderStatusPending || discount == nil || discount.RedemptionID != "" {
+		return false, nil
+	}
+
+	before := cloneOrder(*order)
+	if err := s.releaseRedemption(ctx, order); err != nil {
+		log.Printf("Expired redemption of order %s kept: %v", order.ID, err)
+		return false, nil
+	}
+	order.Version++
+	if err := s.repo.Update(order, newOrderEvent(models.OrderEventRedemptionReleased, actor, &before, order)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/fakeloyaltyservice"
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// startRedemption returns a fake Loyalty Service where user-123 has 1000
+// points, and an order service redeeming them at a cent each against orders
+// totaling $1,389.95
+func startRedemption(t *testing.T, repo OrderRepository) (*fakeloyaltyservice.Server, *OrderService) {
+	t.Helper()
+	fake, service := startFakeLoyaltyService(t, repo)
+	fake.SetBalance("user-123", 1000)
+	return fake, service
+}
+
+// createRedeemingOrder creates an order for user-123 redeeming points
+func createRedeemingOrder(t *testing.T, service *OrderService, points int) *models.Order {
+	t.Helper()
+	order, err := service.CreateOrderRedeemingPoints(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, points, "", "test-admin")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return order
+}
+
+func TestCreateOrderRedeemingPoints(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	fake, service := startRedemption(t, repo)
+
+	order := createRedeemingOrder(t, service, 500)
+	if len(order.Discounts) != 1 || order.Discounts[0].Amount != usd(500) || order.Discounts[0].Points != 500 || order.Discounts[0].ReservationID == "" {
+		t.Fatalf("Expected a $5.00 discount for 500 reserved points, got %+v", order.Discounts)
+	}
+	if order.TotalPrice != usd(138495) {
+		t.Errorf("Expected total 1384.95, got %s", order.TotalPrice)
+	}
+	if held := fake.Held("user-123"); held != 500 {
+		t.Errorf("Expected 500 points held, got %d", held)
+	}
+
+	// Submitting redeems the points and earns points on the discounted total
+	submitted, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if submitted.Discounts[0].RedemptionID == "" || submitted.AccruedLoyaltyPoints != 138 {
+		t.Errorf("Expected the points to be redeemed and 138 awarded, got %+v", submitted)
+	}
+	if balance, held := fake.Balance("user-123"), fake.Held("user-123"); balance != 1000-500+138 || held != 0 {
+		t.Errorf("Expected balance 638 with nothing held, got %d with %d held", balance, held)
+	}
+	if stored, _ := repo.Get(order.ID); stored.Discounts[0].RedemptionID != submitted.Discounts[0].RedemptionID {
+		t.Errorf("Expected the redemption to be stored, got %+v", stored.Discounts)
+	}
+}
+
+func TestCreateOrderRedeemingPoints_Rejected(t *testing.T) {
+	fake, service := startRedemption(t, NewInMemoryOrderRepository())
+	products := []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}
+
+	if _, err := service.CreateOrderRedeemingPoints(context.Background(), "user-123", products, 1001, "", "test-admin"); !errors.Is(err, ErrInsufficientLoyaltyPoints) {
+		t.Errorf("Expected ErrInsufficientLoyaltyPoints, got %v", err)
+	}
+
+	pricey := NewOrderService(NewInMemoryOrderRepository(), newYieldingProductClient(usd(138995)),
+		WithLoyaltyClient(service.loyaltyClient), WithLoyaltyPointValue(usd(1000)))
+	if _, err := pricey.CreateOrderRedeemingPoints(context.Background(), "user-123", products, 139, "", "test-admin"); !errors.Is(err, ErrRedemptionExceedsTotal) {
+		t.Errorf("Expected ErrRedemptionExceedsTotal, got %v", err)
+	}
+
+	disabled := NewOrderService(NewInMemoryOrderRepository(), newYieldingProductClient(usd(138995)))
+	if _, err := disabled.CreateOrderRedeemingPoints(context.Background(), "user-123", products, 1, "", "test-admin"); !errors.Is(err, ErrRedemptionUnavailable) {
+		t.Errorf("Expected ErrRedemptionUnavailable, got %v", err)
+	}
+
+	if held := fake.Held("user-123"); held != 0 {
+		t.Errorf("Expected no points held, got %d", held)
+	}
+}
+
+func TestRedeemedPointsMustStayCovered(t *testing.T) {
+	fake, loyalty := startRedemption(t, NewInMemoryOrderRepository())
+	prices := map[string]models.Money{"prod-1": usd(500), "prod-2": usd(200)}
+	service := NewOrderService(NewInMemoryOrderRepository(), newPricedProductClient(prices), WithLoyaltyClient(loyalty.loyaltyClient))
+
+	// $7.00 of products with $6.00 of points redeemed against them
+	order, err := service.CreateOrderRedeemingPoints(context.Background(), "user-123", []models.OrderProduct{
+		{ProductID: "prod-1", Quantity: 1},
+		{ProductID: "prod-2", Quantity: 1},
+	}, 600, "", "test-admin")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	removed := []models.OrderProduct{{ProductID: "prod-1", Quantity: -1}}
+	if _, err := service.UpdateOrderProducts(context.Background(), order.ID, removed, "", "test-admin", AnyVersion); !errors.Is(err, ErrRedemptionExceedsTotal) {
+		t.Errorf("Expected ErrRedemptionExceedsTotal removing products, got %v", err)
+	}
+
+	prices["prod-1"] = usd(300)
+	if _, err := service.RepriceOrder(context.Background(), order.ID, "", "test-admin", AnyVersion); !errors.Is(err, ErrRedemptionExceedsTotal) {
+		t.Errorf("Expected ErrRedemptionExceedsTotal repricing, got %v", err)
+	}
+
+	// Rejected changes leave the order and its reservation as they were
+	stored, _ := service.GetOrderByID(context.Background(), order.ID)
+	if stored.Version != order.Version || stored.TotalPrice != usd(100) || len(stored.Products) != 2 {
+		t.Errorf("Expected the order unchanged, got %+v", stored)
+	}
+	if held := fake.Held("user-123"); held != 600 {
+		t.Errorf("Expected 600 points held, got %d", held)
+	}
+
+	// Changes the points still cover go through
+	prices["prod-1"] = usd(450)
+	repriced, err := service.RepriceOrder(context.Background(), order.ID, "", "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if repriced.TotalPrice != usd(50) {
+		t.Errorf("Expected total 0.50, got %s", repriced.TotalPrice)
+	}
+}
+
+func TestCancelOrder_ReleasesReservedPoints(t *testing.T) {
+	fake, service := startRedemption(t, NewInMemoryOrderRepository())
+	order := createRedeemingOrder(t, service, 500)
+
+	canceled, err := service.CancelOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(canceled.Discounts) != 0 || canceled.TotalPrice != usd(138995) {
+		t.Errorf("Expected the discount to be removed, got %+v totaling %s", canceled.Discounts, canceled.TotalPrice)
+	}
+	reservation, _ := fake.Reservation(order.Discounts[0].ReservationID)
+	if reservation.Status != fakeloyaltyservice.ReservationReleased || fake.Balance("user-123") != 1000 {
+		t.Errorf("Expected the reservation to be released, got %+v with balance %d", reservation, fake.Balance("user-123"))
+	}
+}
+
+func TestCancelOrder_RefundsRedeemedPoints(t *testing.T) {
+	fake, service := startRedemption(t, NewInMemoryOrderRepository())
+	order := createRedeemingOrder(t, service, 500)
+	service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+
+	canceled, err := service.CancelOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(canceled.Discounts) != 1 || canceled.Discounts[0].RefundID == "" {
+		t.Errorf("Expected the discount to record its refund, got %+v", canceled.Discounts)
+	}
+	// The redeemed points are credited back and the awarded points debited
+	if balance := fake.Balance("user-123"); balance != 1000 {
+		t.Errorf("Expected the balance to be restored to 1000, got %d", balance)
+	}
+}
+
+func TestReturnOrder_RefundsRedeemedPoints(t *testing.T) {
+	fake, service := startRedemption(t, NewInMemoryOrderRepository())
+	order := createRedeemingOrder(t, service, 500)
+	service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	service.ShipOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	service.DeliverOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+
+	returned, err := service.ReturnOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(returned.Discounts) != 1 || returned.Discounts[0].RefundID == "" {
+		t.Errorf("Expected the discount to record its refund, got %+v", returned.Discounts)
+	}
+	if balance := fake.Balance("user-123"); balance != 1000 {
+		t.Errorf("Expected the balance to be restored to 1000, got %d", balance)
+	}
+}
+
+func TestSubmitOrder_RedemptionFailureKeepsOrderPending(t *testing.T) {
+	fake, service := startRedemption(t, NewInMemoryOrderRepository())
+	order := createRedeemingOrder(t, service, 500)
+
+	fake.SetFailing(true)
+	_, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if !errors.Is(err, ErrRedemptionFailed) || !errors.Is(err, ErrLoyaltyServiceUnavailable) {
+		t.Fatalf("Expected ErrRedemptionFailed, got %v", err)
+	}
+	if stored, _ := service.GetOrderByID(context.Background(), order.ID); stored.Status != models.OrderStatusPending {
+		t.Errorf("Expected the order to stay PENDING, got %s", stored.Status)
+	}
+
+	fake.SetFailing(false)
+	if _, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion); err != nil {
+		t.Fatalf("Expected the retried submission to succeed, got %v", err)
+	}
+	if balance := fake.Balance("user-123"); balance != 1000-500+138 {
+		t.Errorf("Expected the points to be redeemed once, got balance %d", balance)
+	}
+}
+
+func TestReleaseExpiredRedemptions(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	fake, service := startRedemption(t, repo)
+	stale := createRedeemingOrder(t, service, 300)
+	fresh := createRedeemingOrder(t, service, 200)
+	submitted := createRedeemingOrder(t, service, 100)
+	service.SubmitOrder(context.Background(), submitted.ID, "test-admin", AnyVersion)
+
+	// Age every order past the reservation TTL except fresh
+	for _, id := range []string{stale.ID, submitted.ID} {
+		order, _ := repo.Get(id)
+		order.OrderDate = time.Now().Add(-2 * time.Hour)
+		repo.Update(order, nil)
+	}
+
+	released, err := service.ReleaseExpiredRedemptions(context.Background(), time.Hour, "system")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if released != 1 {
+		t.Errorf("Expected one reservation released, got %d", released)
+	}
+	if held := fake.Held("user-123"); held != 200 {
+		t.Errorf("Expected only the fresh order's 200 points held, got %d", held)
+	}
+	if kept, _ := service.GetOrderByID(context.Background(), fresh.ID); len(kept.Discounts) != 1 {
+		t.Errorf("Expected the fresh order to keep its discount, got %+v", kept.Discounts)
+	}
+
+	order, _ := service.GetOrderByID(context.Background(), stale.ID)
+	if order.Status != models.OrderStatusPending || len(order.Discounts) != 0 || order.TotalPrice != usd(138995) || order.Version != stale.Version+1 {
+		t.Errorf("Expected a pending order without its discount, got %+v", order)
+	}
+	rebuilt, err := rebuildOrder(service, stale.ID)
+	if err != nil || len(rebuilt.Discounts) != 0 || rebuilt.TotalPrice != order.TotalPrice {
+		t.Errorf("Expected the release to be replayed from events, got %+v, %v", rebuilt, err)
+	}
+}
+
+func TestLoyaltyServiceClient_Reservations(t *testing.T) {
+	fake := fakeloyaltyservice.New()
+	fake.SetBalance("user-123", 100)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := NewLoyaltyServiceClient(server.URL, "")
+
+	reservationID, err := client.ReservePoints(context.Background(), "user-123", "order-1", 60)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if again, _ := client.ReservePoints(context.Background(), "user-123", "order-1", 60); again != reservationID {
+		t.Errorf("Expected the reservation to be replayed as %s, got %s", reservationID, again)
+	}
+	if _, err := client.ReservePoints(context.Background(), "user-123", "order-2", 60); !errors.Is(err, ErrInsufficientLoyaltyPoints) {
+		t.Errorf("Expected ErrInsufficientLoyaltyPoints while 60 of 100 points are held, got %v", err)
+	}
+
+	redemptionID, err := client.CommitReservation(context.Background(), "user-123", reservationID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if again, _ := client.CommitReservation(context.Background(), "user-123", reservationID); again != redemptionID {
+		t.Errorf("Expected the commit to be replayed as %s, got %s", redemptionID, again)
+	}
+	if err := client.ReleaseReservation(context.Background(), "user-123", reservationID); !errors.Is(err, ErrLoyaltyRequestRejected) {
+		t.Errorf("Expected a committed reservation not to be released, got %v", err)
+	}
+	if balance := fake.Balance("user-123"); balance != 40 {
+		t.Errorf("Expected 60 of 100 points redeemed, got balance %d", balance)
+	}
+}
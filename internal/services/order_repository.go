@@ -0,0 +1,55 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+var (
+	// ErrOrderNotFound is returned when an order is not found
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrOrderAlreadyExists is returned when creating an order whose ID is already stored
+	ErrOrderAlreadyExists = errors.New("order already exists")
+)
+
+// OrderRepository abstracts the storage of orders so OrderService does not
+// depend on a particular backend. Implementations must return copies so that
+// callers cannot mutate stored state without going through Update.
+//
+// Each order has an append-only history of events. An event passed to Create
+// or Update is stored in the same write as the order, after being given the
+// next sequence number of its order, so the history cannot miss a change that
+// was stored nor record one that was not.
+type OrderRepository interface {
+	// Get returns the order with the given ID or ErrOrderNotFound
+	Get(id string) (*models.Order, error)
+	// List returns all stored orders in creation order
+	List() ([]models.Order, error)
+	// Query returns the page of orders selected by q, along with the number
+	// of orders matching q.Filter across all pages
+	Query(q OrderQuery) ([]models.Order, int, error)
+	// Create stores a new order and the event recording its creation, if not nil
+	Create(order *models.Order, event *models.OrderEvent) error
+	// Update replaces a stored order and appends the event recording the
+	// change, if not nil, returning ErrOrderNotFound if the order does not exist
+	Update(order *models.Order, event *models.OrderEvent) error
+	// Delete removes an order and its events, returning ErrOrderNotFound if it does not exist
+	Delete(id string) error
+	// ListEvents returns the events recorded for an order in sequence order
+	ListEvents(orderID string) ([]models.OrderEvent, error)
+}
+
+// cloneOrder returns a deep copy of an order so the products and discounts
+// slices are not shared
+func cloneOrder(order models.Order) models.Order {
+	if order.Products != nil {
+		products := make([]models.OrderProduct, len(order.Products))
+		copy(products, order.Products)
+		order.Products = products
+	}
+	if order.Discounts != nil {
+		order.Discounts = append([]models.OrderDiscount{}, order.Discounts...)
+	}
+	return order
+}
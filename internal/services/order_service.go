@@ -1,8 +1,10 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
@@ -11,247 +13,297 @@ import (
 )
 
 var (
-	// ErrOrderNotFound is returned when an order is not found
-	ErrOrderNotFound = errors.New("order not found")
 	// ErrProductServiceUnavailable is returned when product service is unavailable
 	ErrProductServiceUnavailable = errors.New("product service unavailable")
 	// ErrProductNotFound is returned when a product is not found
 	ErrProductNotFound = errors.New("product not found")
-
-	// orderUserMap tracks which user owns which order
-	orderUserMap = map[string]string{
-		"650e8400-e29b-41d4-a716-446655440000": "750e8400-e29b-41d4-a716-446655440000", // johndoe
-		"650e8400-e29b-41d4-a716-446655440001": "750e8400-e29b-41d4-a716-446655440000", // johndoe
-		"650e8400-e29b-41d4-a716-446655440002": "750e8400-e29b-41d4-a716-446655440001", // janedoe
-	}
-
-	// Mock order data
-	mockOrders = []models.Order{
-		{
-			ID: "650e8400-e29b-41d4-a716-446655440000",
-			Products: []models.OrderProduct{
-				{
-					ProductID: "550e8400-e29b-41d4-a716-446655440000", // Laptop
-					Quantity:  1,
-				},
-				{
-					ProductID: "550e8400-e29b-41d4-a716-446655440001", // Wireless Mouse
-					Quantity:  2,
-				},
-			},
-			TotalPrice: 1359.97,
-			OrderDate:  time.Now().AddDate(0, 0, -5),
-			Status:     models.OrderStatusPending,
-		},
-		{
-			ID: "650e8400-e29b-41d4-a716-446655440001",
-			Products: []models.OrderProduct{
-				{
-					ProductID: "550e8400-e29b-41d4-a716-446655440002", // Desk Lamp
-					Quantity:  3,
-				},
-			},
-			TotalPrice: 149.97,
-			OrderDate:  time.Now().AddDate(0, 0, -3),
-			Status:     models.OrderStatusShipped,
-		},
-		{
-			ID: "650e8400-e29b-41d4-a716-446655440002",
-			Products: []models.OrderProduct{
-				{
-					ProductID: "550e8400-e29b-41d4-a716-446655440003", // Notebook
-					Quantity:  5,
-				},
-				{
-					ProductID: "550e8400-e29b-41d4-a716-446655440004", // Coffee Maker
-					Quantity:  1,
-				},
-			},
-			TotalPrice: 179.94,
-			OrderDate:  time.Now().AddDate(0, 0, -1),
-			Status:     models.OrderStatusProcessing,
-		},
-	}
+	// ErrVersionMismatch is returned when an order changed since the caller read it
+	ErrVersionMismatch = errors.New("order version mismatch")
 )
 
-// ResetOrderMockData resets the mock order data to its initial state
-// This should be called in test setup to ensure test isolation
-func ResetOrderMockData() {
-	orderUserMap = map[string]string{
-		"650e8400-e29b-41d4-a716-446655440000": "750e8400-e29b-41d4-a716-446655440000", // johndoe
-		"650e8400-e29b-41d4-a716-446655440001": "750e8400-e29b-41d4-a716-446655440000", // johndoe
-		"650e8400-e29b-41d4-a716-446655440002": "750e8400-e29b-41d4-a716-446655440001", // janedoe
-	}
-
-	mockOrders = []models.Order{
-		{
-			ID: "650e8400-e29b-41d4-a716-446655440000",
-			Products: []models.OrderProduct{
-				{
-					ProductID: "550e8400-e29b-41d4-a716-446655440000", // Laptop
-					Quantity:  1,
-				},
-				{
-					ProductID: "550e8400-e29b-41d4-a716-446655440001", // Wireless Mouse
-					Quantity:  2,
-				},
-			},
-			TotalPrice: 1359.97,
-			OrderDate:  time.Now().AddDate(0, 0, -5),
-			Status:     models.OrderStatusPending,
-		},
-		{
-			ID: "650e8400-e29b-41d4-a716-446655440001",
-			Products: []models.OrderProduct{
-				{
-					ProductID: "550e8400-e29b-41d4-a716-446655440002", // Desk Lamp
-					Quantity:  3,
-				},
-			},
-			TotalPrice: 149.97,
-			OrderDate:  time.Now().AddDate(0, 0, -3),
-			Status:     models.OrderStatusShipped,
-		},
-		{
-			ID: "650e8400-e29b-41d4-a716-446655440002",
-			Products: []models.OrderProduct{
-				{
-					ProductID: "550e8400-e29b-41d4-a716-446655440003", // Notebook
-					Quantity:  5,
-				},
-				{
-					ProductID: "550e8400-e29b-41d4-a716-446655440004", // Coffee Maker
-					Quantity:  1,
-				},
-			},
-			TotalPrice: 179.94,
-			OrderDate:  time.Now().AddDate(0, 0, -1),
-			Status:     models.OrderStatusProcessing,
-		},
+// AnyVersion can be passed as the expected version of a mutation to apply it
+// regardless of the order's current version
+const AnyVersion = 0
+
+// checkVersion returns ErrVersionMismatch unless expectedVersion is AnyVersion
+// or the order's current version
+func checkVersion(order *models.Order, expectedVersion int) error {
+	if expectedVersion != AnyVersion && expectedVersion != order.Version {
+		return fmt.Errorf("%w: expected version %d, current version is %d", ErrVersionMismatch, expectedVersion, order.Version)
 	}
+	return nil
 }
 
-// GetMockOrders returns a copy of mock orders for cross-service access
-func GetMockOrders() []models.Order {
-	orders := make([]models.Order, len(mockOrders))
-	copy(orders, mockOrders)
-	return orders
+// OrderService handles business logic for orders
+// It is safe for concurrent use: mutations of the same order are serialized so
+// that each read-modify-write cycle is atomic.
+type OrderService struct {
+	repo          OrderRepository
+	productClient ProductClient
+	loyaltyClient LoyaltyClient
+	pointValue    models.Money
+	locks         *orderLocks
+	// outbox is set when loyalty side effects are queued rather than made
+	// while orders change
+	outbox    OutboxRepository
+	useOutbox bool
 }
 
-// GetMockOrdersReference returns a reference to the actual mock orders slice
-// This allows other services to modify orders directly (e.g., cancelling on user deletion)
-func GetMockOrdersReference() []models.Order {
-	return mockOrders
-}
+// OrderServiceOption configures optional OrderService dependencies
+type OrderServiceOption func(*OrderService)
 
-// UpdateMockOrderStatus updates the status of an order at the given index
-// This is used by UserService to cancel pending orders when deleting a user
-func UpdateMockOrderStatus(index int, status models.OrderStatus) {
-	if index >= 0 && index < len(mockOrders) {
-		mockOrders[index].Status = status
+// WithLoyaltyClient sets the client used to award loyalty points when orders
+// are submitted and reverse them when orders are canceled. Without one, no
+// points are awarded.
+func WithLoyaltyClient(loyaltyClient LoyaltyClient) OrderServiceOption {
+	return func(s *OrderService) {
+		s.loyaltyClient = loyaltyClient
 	}
 }
 
-// OrderService handles business logic for orders
-type OrderService struct {
-	productClient ProductClient
+// NewOrderService creates a new OrderService with an order repository and a product client
+func NewOrderService(repo OrderRepository, productClient ProductClient, opts ...OrderServiceOption) *OrderService {
+	s := &OrderService{
+		repo:          repo,
+		productClient: productClient,
+		pointValue:    DefaultLoyaltyPointValue,
+		locks:         newOrderLocks(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.useOutbox {
+		outbox, ok := repo.(OutboxRepository)
+		if !ok {
+			log.Printf("Order repository %T has no outbox: loyalty points are updated while orders change", repo)
+		}
+		s.outbox = outbox
+	}
+	return s
 }
 
-// NewOrderService creates a new OrderService with a product client
-func NewOrderService(productClient ProductClient) *OrderService {
-	return &OrderService{
-		productClient: productClient,
+// GetOrderEvents returns the history of changes to an order, oldest first.
+// Every change is stored together with its event, so the history is complete.
+func (s *OrderService) GetOrderEvents(ctx context.Context, orderID string) ([]models.OrderEvent, error) {
+	if _, err := s.repo.Get(orderID); err != nil {
+		return nil, err
 	}
+
+	return s.repo.ListEvents(orderID)
 }
 
 // ListOrders returns a list of all orders
-func (s *OrderService) ListOrders() ([]models.Order, int) {
-	total := len(mockOrders)
+func (s *OrderService) ListOrders(ctx context.Context) ([]models.Order, int, error) {
+	orders, err := s.repo.List()
+	if err != nil {
+		return nil, 0, err
+	}
 
-	// Return a copy to prevent modification
-	orders := make([]models.Order, len(mockOrders))
-	copy(orders, mockOrders)
+	return orders, len(orders), nil
+}
 
-	return orders, total
+// ListOrdersByUser returns all orders placed by a user, oldest first
+func (s *OrderService) ListOrdersByUser(ctx context.Context, userID string) ([]models.Order, int, error) {
+	return s.repo.Query(OrderQuery{
+		Filter: OrderFilter{UserID: userID},
+		SortBy: OrderSortByOrderDate,
+	})
 }
 
-// GetOrderByID returns an order by its ID
-func (s *OrderService) GetOrderByID(id string) (*models.Order, error) {
-	for _, order := range mockOrders {
-		if order.ID == id {
-			// Return a copy to prevent modification
-			o := order
-			return &o, nil
+// QueryOrders returns one page of the orders matching query. cursor is the
+// NextCursor of the previous page, or empty for the first page; it must be
+// used with the same filter and sort order it was issued for.
+func (s *OrderService) QueryOrders(ctx context.Context, query OrderQuery, cursor string) (*OrderPage, error) {
+	if query.SortBy == "" {
+		query.SortBy = OrderSortByOrderDate
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultOrderPageSize
+	}
+	if query.Limit > MaxOrderPageSize {
+		query.Limit = MaxOrderPageSize
+	}
+
+	if cursor != "" {
+		after, err := decodeOrderCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if after.SortBy != query.SortBy || after.Descending != query.Descending {
+			return nil, fmt.Errorf("%w: cursor was issued for a different sort order", ErrInvalidCursor)
 		}
+		query.After = after
+	}
+
+	// Fetch one extra order to learn whether another page follows
+	limit := query.Limit
+	query.Limit++
+	orders, total, err := s.repo.Query(query)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, ErrOrderNotFound
+	page := &OrderPage{Orders: orders, Total: total}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		page.NextCursor = encodeOrderCursor(query.cursorFor(&page.Orders[limit-1]))
+	}
+	return page, nil
+}
+
+// GetOrderByID returns an order by its ID
+func (s *OrderService) GetOrderByID(ctx context.Context, id string) (*models.Order, error) {
+	return s.repo.Get(id)
 }
 
 // CreateOrder creates a new order with product validation from Product Service
-func (s *OrderService) CreateOrder(userID string, products []models.OrderProduct, authToken string) (*models.Order, error) {
+func (s *OrderService) CreateOrder(ctx context.Context, userID string, products []models.OrderProduct, authToken, actor string) (*models.Order, error) {
+	return s.CreateOrderRedeemingPoints(ctx, userID, products, 0, authToken, actor)
+}
+
+// CreateOrderRedeemingPoints creates a new order like CreateOrder, redeeming
+// pointsToRedeem of the user's loyalty points against it. The points are
+// reserved with the Loyalty Service and applied as a discount; they are
+// redeemed when the order is submitted and given back if it is canceled.
+func (s *OrderService) CreateOrderRedeemingPoints(ctx context.Context, userID string, products []models.OrderProduct, pointsToRedeem int, authToken, actor string) (*models.Order, error) {
 	if len(products) == 0 {
 		return nil, errors.New("order must contain at least one product")
 	}
 
-	// Validate products and calculate total price using Product Service
-	var invalidProducts []string
-	totalPrice := 0.0
-
-	for i := range products {
-		price, name, err := s.productClient.ValidateProduct(products[i].ProductID, authToken)
-		if err != nil {
-			if strings.Contains(err.Error(), "product not found") {
-				invalidProducts = append(invalidProducts, products[i].ProductID)
-				continue
-			}
-			// Product service unavailable or other error
-			return nil, fmt.Errorf("%w: %v", ErrProductServiceUnavailable, err)
-		}
-
-		// Store product name for reference (optional, not in current model)
-		_ = name
-		
-		// Calculate line total
-		totalPrice += price * float64(products[i].Quantity)
+	// Validate all products at once, capturing each line's current product
+	// name and price from the Product Service
+	catalog, err := s.validateProducts(ctx, orderProductIDs(products), authToken)
+	if err != nil {
+		return nil, err
 	}
 
-	// If any products were invalid, return error with details
-	if len(invalidProducts) > 0 {
-		return nil, fmt.Errorf("%w: %s", ErrProductNotFound, strings.Join(invalidProducts, ", "))
+	lines := make([]models.OrderProduct, len(products))
+	for i, product := range products {
+		lines[i] = models.OrderProduct{ProductID: product.ProductID, Quantity: product.Quantity}
+		priceOrderLine(&lines[i], catalog[product.ProductID])
 	}
 
 	// Generate new order with proper UUID
 	orderID := uuid.New().String()
 	newOrder := models.Order{
 		ID:         orderID,
-		Products:   products,
-		TotalPrice: totalPrice,
+		UserID:     userID,
+		Products:   lines,
+		TotalPrice: orderTotal(lines, nil),
 		OrderDate:  time.Now(),
 		Status:     models.OrderStatusPending,
+		Version:    1,
 	}
 
-	// If userId is provided, track the order-user relationship
-	if userID != "" {
-		orderUserMap[orderID] = userID
+	if pointsToRedeem > 0 {
+		discount, err := s.reservePoints(ctx, userID, orderID, pointsToRedeem, newOrder.TotalPrice)
+		if err != nil {
+			return nil, err
+		}
+		newOrder.Discounts = []models.OrderDiscount{*discount}
+		newOrder.TotalPrice = orderTotal(lines, newOrder.Discounts)
 	}
 
-	// Add to mock orders
-	mockOrders = append(mockOrders, newOrder)
+	if err := s.repo.Create(&newOrder, newOrderEvent(models.OrderEventCreated, actor, nil, &newOrder)); err != nil {
+		// Do not hold points for an order that does not exist
+		if releaseErr := s.releaseRedemption(ctx, &newOrder); releaseErr != nil {
+			log.Printf("Points reserved for unsaved order %s are still held: %v", orderID, releaseErr)
+		}
+		return nil, err
+	}
 
 	return &newOrder, nil
 }
 
-// UpdateOrderStatus updates the status of an order
-func (s *OrderService) UpdateOrderStatus(orderID string, status models.OrderStatus) (*models.Order, error) {
-	for i, order := range mockOrders {
-		if order.ID == orderID {
-			mockOrders[i].Status = status
-			return &mockOrders[i], nil
+// productServiceError returns a failed product lookup as an
+// ErrProductServiceUnavailable, wrapping it unless it already is one
+func productServiceError(err error) error {
+	if errors.Is(err, ErrProductServiceUnavailable) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrProductServiceUnavailable, err)
+}
+
+// validateProducts validates products with the Product Service and returns
+// them by ID. Every unknown product is listed in a single ErrProductNotFound.
+func (s *OrderService) validateProducts(ctx context.Context, productIDs []string, authToken string) (map[string]*ProductResponse, error) {
+	catalog := make(map[string]*ProductResponse, len(productIDs))
+	var invalidProducts []string
+
+	for _, result := range s.productClient.ValidateProducts(ctx, productIDs, authToken) {
+		if result.Err != nil {
+			if errors.Is(result.Err, ErrProductNotFound) {
+				invalidProducts = append(invalidProducts, result.ProductID)
+				continue
+			}
+			// Product service unavailable or other error
+			return nil, productServiceError(result.Err)
 		}
+		catalog[result.ProductID] = result.Product
 	}
 
-	return nil, ErrOrderNotFound
+	// If any products were invalid, return error with details
+	if len(invalidProducts) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrProductNotFound, strings.Join(invalidProducts, ", "))
+	}
+	return catalog, nil
+}
+
+// priceOrderLine captures product's current name and price on line
+func priceOrderLine(line *models.OrderProduct, product *ProductResponse) {
+	line.ProductName = product.Name
+	line.UnitPrice = product.Price
+	line.LineTotal = product.Price.Mul(line.Quantity)
+}
+
+// orderProductIDs returns the distinct product IDs of order lines in order
+func orderProductIDs(products []models.OrderProduct) []string {
+	ids := make([]string, 0, len(products))
+	seen := make(map[string]bool, len(products))
+	for _, product := range products {
+		if !seen[product.ProductID] {
+			seen[product.ProductID] = true
+			ids = append(ids, product.ProductID)
+		}
+	}
+	return ids
+}
+
+// changeStatus moves an order to status and records the change as eventType
+func (s *OrderService) changeStatus(ctx context.Context, orderID string, status models.OrderStatus, eventType models.OrderEventType, actor string, expectedVersion int) (*models.Order, error) {
+	unlock, err := s.locks.lock(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	order, err := s.repo.Get(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(order, expectedVersion); err != nil {
+		return nil, err
+	}
+	if err := checkTransition(order, status); err != nil {
+		return nil, err
+	}
+
+	before := cloneOrder(*order)
+	var messages []models.OutboxMessage
+	if givesBackLoyaltyPoints(status) {
+		if s.outbox != nil {
+			messages = s.loyaltyMessages(models.OutboxLoyaltyReversal, order, actor)
+		} else if err := s.giveBackLoyaltyPoints(ctx, order); err != nil {
+			log.Printf("Keeping order %s %s: %v", order.ID, status, err)
+		}
+	}
+	order.Status = status
+	order.Version++
+	if err := s.updateOrder(order, newOrderEvent(eventType, actor, &before, order), messages); err != nil {
+		return nil, err
+	}
+
+	return order, nil
 }
 
 // UpdateOrderProducts updates the products in an order (only for PENDING orders)
@@ -259,115 +311,276 @@ func (s *OrderService) UpdateOrderStatus(orderID string, status models.OrderStat
 // - If quantity > 0: adds the quantity to existing product (or creates new product)
 // - If quantity < 0: subtracts the quantity from existing product (removes if result <= 0)
 // - If quantity = 0: does nothing
-func (s *OrderService) UpdateOrderProducts(orderID string, products []models.OrderProduct, authToken string) (*models.Order, error) {
-	for i, order := range mockOrders {
-		if order.ID == orderID {
-			// Only allow updating products for pending orders
-			if order.Status != models.OrderStatusPending {
-				return nil, errors.New("can only update products for pending orders")
-			}
+// New lines capture the product's current name and price; existing lines keep
+// the price captured when they were added.
+// The update is rejected with ErrVersionMismatch if the order is no longer at
+// expectedVersion; pass AnyVersion to skip the check. It is rejected with
+// ErrRedemptionExceedsTotal if the products left total less than the points
+// redeemed against the order.
+func (s *OrderService) UpdateOrderProducts(ctx context.Context, orderID string, products []models.OrderProduct, authToken, actor string, expectedVersion int) (*models.Order, error) {
+	// Hold the order lock across the product service calls so a concurrent
+	// update cannot be lost between reading and writing the order
+	unlock, err := s.locks.lock(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
-			// Create a map of existing products for quick lookup
-			existingProducts := make(map[string]models.OrderProduct)
-			for _, product := range order.Products {
-				existingProducts[product.ProductID] = product
-			}
+	order, err := s.repo.Get(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(order, expectedVersion); err != nil {
+		return nil, err
+	}
 
-			// Track new products that need validation
-			var newProductIDs []string
-
-			// Process each product in the request
-			for _, product := range products {
-				if product.Quantity == 0 {
-					// Do nothing
-					continue
-				}
-
-				existing, exists := existingProducts[product.ProductID]
-				if exists {
-					// Product already exists - add or subtract quantity
-					newQuantity := existing.Quantity + product.Quantity
-					if newQuantity <= 0 {
-						// Remove the product if quantity becomes 0 or negative
-						delete(existingProducts, product.ProductID)
-					} else {
-						// Update the quantity
-						existing.Quantity = newQuantity
-						existingProducts[product.ProductID] = existing
-					}
-				} else if product.Quantity > 0 {
-					// New product with positive quantity - validate it first
-					newProductIDs = append(newProductIDs, product.ProductID)
-					existingProducts[product.ProductID] = product
-				}
-				// If product doesn't exist and quantity is negative, ignore it
-			}
+	// Only allow updating products for pending orders
+	if err := checkPending(order); err != nil {
+		return nil, err
+	}
 
-			// Validate new products with Product Service
-			var invalidProducts []string
-			for _, productID := range newProductIDs {
-				_, _, err := s.productClient.ValidateProduct(productID, authToken)
-				if err != nil {
-					if strings.Contains(err.Error(), "product not found") {
-						invalidProducts = append(invalidProducts, productID)
-						// Remove the invalid product from existingProducts
-						delete(existingProducts, productID)
-						continue
-					}
-					// Product service unavailable or other error
-					return nil, fmt.Errorf("%w: %v", ErrProductServiceUnavailable, err)
-				}
-			}
+	// Create a map of existing products for quick lookup
+	existingProducts := make(map[string]models.OrderProduct)
+	for _, product := range order.Products {
+		existingProducts[product.ProductID] = product
+	}
 
-			// If any products were invalid, return error with details
-			if len(invalidProducts) > 0 {
-				return nil, fmt.Errorf("%w: %s", ErrProductNotFound, strings.Join(invalidProducts, ", "))
-			}
+	// Track new products that need validation
+	var newProductIDs []string
 
-			// Convert map back to slice
-			updatedProducts := make([]models.OrderProduct, 0, len(existingProducts))
-			for _, product := range existingProducts {
-				updatedProducts = append(updatedProducts, product)
-			}
+	// Process each product in the request
+	for _, product := range products {
+		if product.Quantity == 0 {
+			// Do nothing
+			continue
+		}
 
-			// Recalculate total price using Product Service
-			totalPrice := 0.0
-			for _, orderProduct := range updatedProducts {
-				price, _, err := s.productClient.ValidateProduct(orderProduct.ProductID, authToken)
-				if err != nil {
-					return nil, fmt.Errorf("%w: %v", ErrProductServiceUnavailable, err)
-				}
-				totalPrice += price * float64(orderProduct.Quantity)
+		existing, exists := existingProducts[product.ProductID]
+		if exists {
+			// Product already exists - add or subtract quantity
+			newQuantity := existing.Quantity + product.Quantity
+			if newQuantity <= 0 {
+				// Remove the product if quantity becomes 0 or negative
+				delete(existingProducts, product.ProductID)
+			} else {
+				// Update the quantity
+				existing.Quantity = newQuantity
+				existingProducts[product.ProductID] = existing
 			}
+		} else if product.Quantity > 0 {
+			// New product with positive quantity - validate it first
+			newProductIDs = append(newProductIDs, product.ProductID)
+			existingProducts[product.ProductID] = models.OrderProduct{ProductID: product.ProductID, Quantity: product.Quantity}
+		}
+		// If product doesn't exist and quantity is negative, ignore it
+	}
 
-			// Update the order
-			mockOrders[i].Products = updatedProducts
-			mockOrders[i].TotalPrice = totalPrice
+	// Validate new products with Product Service, capturing their names and
+	// prices on the new lines below
+	catalog, err := s.validateProducts(ctx, newProductIDs, authToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lines stored before prices were captured are priced now
+	var unpricedIDs []string
+	for _, product := range existingProducts {
+		if _, ok := catalog[product.ProductID]; !ok && !product.HasPriceSnapshot() {
+			unpricedIDs = append(unpricedIDs, product.ProductID)
+		}
+	}
+	if len(unpricedIDs) > 0 {
+		for _, result := range s.productClient.ValidateProducts(ctx, unpricedIDs, authToken) {
+			if result.Err != nil {
+				return nil, productServiceError(result.Err)
+			}
+			catalog[result.ProductID] = result.Product
+		}
+	}
 
-			return &mockOrders[i], nil
+	// Convert map back to slice, keeping captured prices for existing lines
+	updatedProducts := make([]models.OrderProduct, 0, len(existingProducts))
+	for _, product := range existingProducts {
+		if current, ok := catalog[product.ProductID]; ok {
+			priceOrderLine(&product, current)
+		} else {
+			product.LineTotal = product.UnitPrice.Mul(product.Quantity)
 		}
+		updatedProducts = append(updatedProducts, product)
+	}
+
+	// Points redeemed against the order must stay covered by its products
+	if err := checkRedemptionCovered(order, updatedProducts); err != nil {
+		return nil, err
+	}
+
+	// Update the order
+	before := cloneOrder(*order)
+	order.Products = updatedProducts
+	order.TotalPrice = orderTotal(updatedProducts, order.Discounts)
+	order.Version++
+	if err := s.repo.Update(order, newOrderEvent(models.OrderEventProductsAdjusted, actor, &before, order)); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// RepriceOrder captures the current name and price of every product on a
+// pending order, replacing those captured when its lines were added. It fails
+// with ErrProductNotFound if a product no longer exists, and with
+// ErrRedemptionExceedsTotal if the new prices total less than the points
+// redeemed against the order.
+func (s *OrderService) RepriceOrder(ctx context.Context, orderID, authToken, actor string, expectedVersion int) (*models.Order, error) {
+	unlock, err := s.locks.lock(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	order, err := s.repo.Get(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(order, expectedVersion); err != nil {
+		return nil, err
+	}
+	if err := checkPending(order); err != nil {
+		return nil, err
+	}
+
+	catalog, err := s.validateProducts(ctx, orderProductIDs(order.Products), authToken)
+	if err != nil {
+		return nil, err
+	}
+
+	before := cloneOrder(*order)
+	for i := range order.Products {
+		priceOrderLine(&order.Products[i], catalog[order.Products[i].ProductID])
+	}
+	if err := checkRedemptionCovered(order, order.Products); err != nil {
+		return nil, err
+	}
+	order.TotalPrice = orderTotal(order.Products, order.Discounts)
+	order.Version++
+	if err := s.repo.Update(order, newOrderEvent(models.OrderEventRepriced, actor, &before, order)); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// CancelOrder cancels an order that has not shipped yet
+func (s *OrderService) CancelOrder(ctx context.Context, orderID, actor string, expectedVersion int) (*models.Order, error) {
+	return s.changeStatus(ctx, orderID, models.OrderStatusCanceled, models.OrderEventCanceled, actor, expectedVersion)
+}
+
+// awardLoyaltyPoints credits the points earned by an order to its owner and
+// records them on the order with the Loyalty Service transaction. The award is
+// keyed by order, so an award retried after a failed write is not credited
+// twice. A failed award leaves the order without points.
+func (s *OrderService) awardLoyaltyPoints(ctx context.Context, order *models.Order) error {
+	points := LoyaltyPointsFor(order.TotalPrice)
+	if s.loyaltyClient == nil || points == 0 || order.UserID == "" || order.LoyaltyTransactionID != "" {
+		return nil
+	}
+
+	transactionID, err := s.loyaltyClient.AwardPoints(ctx, order.UserID, order.ID, points)
+	if err != nil {
+		return fmt.Errorf("failed to award %d loyalty points to user %s for order %s: %w", points, order.UserID, order.ID, err)
+	}
+	log.Printf("Awarded %d loyalty points to user %s for order %s (transaction %s)", points, order.UserID, order.ID, transactionID)
+	order.AccruedLoyaltyPoints = points
+	order.LoyaltyTransactionID = transactionID
+	return nil
+}
+
+// reverseLoyaltyPoints debits the points awarded for a canceled order and
+// records the reversal on the order. Orders without an award, or whose award
+// was already reversed, are left alone; the reversal is keyed by the award
+// transaction, so a reversal retried after a failed write is not debited
+// twice. A failed reversal leaves the award recorded.
+func (s *OrderService) reverseLoyaltyPoints(ctx context.Context, order *models.Order) error {
+	if order.LoyaltyTransactionID == "" || order.LoyaltyReversalID != "" {
+		return nil
+	}
+	if s.loyaltyClient == nil {
+		return fmt.Errorf("cannot reverse loyalty transaction %s of order %s: no Loyalty Service configured", order.LoyaltyTransactionID, order.ID)
+	}
+
+	reversalID, err := s.loyaltyClient.ReversePoints(ctx, order.UserID, order.ID, order.LoyaltyTransactionID, order.AccruedLoyaltyPoints)
+	if err != nil {
+		return fmt.Errorf("failed to reverse %d loyalty points of user %s for order %s: %w", order.AccruedLoyaltyPoints, order.UserID, order.ID, err)
 	}
+	log.Printf("Reversed %d loyalty points of user %s for order %s (transaction %s)", order.AccruedLoyaltyPoints, order.UserID, order.ID, reversalID)
+	order.AccruedLoyaltyPoints = 0
+	order.LoyaltyReversalID = reversalID
+	return nil
+}
+
+// giveBackLoyaltyPoints reverses the award of a canceled order and gives back
+// the points it redeemed or reserved, attempting both even if one fails
+func (s *OrderService) giveBackLoyaltyPoints(ctx context.Context, order *models.Order) error {
+	return errors.Join(s.reverseLoyaltyPoints(ctx, order), s.releaseRedemption(ctx, order))
+}
+
+// ShipOrder marks a PROCESSING order as shipped
+func (s *OrderService) ShipOrder(ctx context.Context, orderID, actor string, expectedVersion int) (*models.Order, error) {
+	return s.changeStatus(ctx, orderID, models.OrderStatusShipped, models.OrderEventShipped, actor, expectedVersion)
+}
 
-	return nil, ErrOrderNotFound
+// DeliverOrder marks a SHIPPED order as delivered
+func (s *OrderService) DeliverOrder(ctx context.Context, orderID, actor string, expectedVersion int) (*models.Order, error) {
+	return s.changeStatus(ctx, orderID, models.OrderStatusDelivered, models.OrderEventDelivered, actor, expectedVersion)
 }
 
-// CancelOrder cancels an order
-func (s *OrderService) CancelOrder(orderID string) (*models.Order, error) {
-	return s.UpdateOrderStatus(orderID, models.OrderStatusCanceled)
+// ReturnOrder marks a DELIVERED order as returned, reversing the loyalty
+// points it was awarded and giving back those it redeemed
+func (s *OrderService) ReturnOrder(ctx context.Context, orderID, actor string, expectedVersion int) (*models.Order, error) {
+	return s.changeStatus(ctx, orderID, models.OrderStatusReturned, models.OrderEventReturned, actor, expectedVersion)
 }
 
 // SubmitOrder submits a pending order for processing
-func (s *OrderService) SubmitOrder(orderID string) (*models.Order, error) {
-	for i, order := range mockOrders {
-		if order.ID == orderID {
-			if order.Status != models.OrderStatusPending {
-				return nil, errors.New("only pending orders can be submitted")
-			}
-			mockOrders[i].Status = models.OrderStatusProcessing
+func (s *OrderService) SubmitOrder(ctx context.Context, orderID, actor string, expectedVersion int) (*models.Order, error) {
+	unlock, err := s.locks.lock(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
-			return &mockOrders[i], nil
+	order, err := s.repo.Get(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(order, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	if err := checkPending(order); err != nil {
+		return nil, err
+	}
+	before := cloneOrder(*order)
+	// The redemption and the award are queued in the outbox with the
+	// submission, in that order, so neither is made for a submission that is
+	// not stored. Without an outbox both are made before the submission is
+	// stored so they are written together; a failed redemption fails the
+	// submission, while a failed award earns no points.
+	var messages []models.OutboxMessage
+	if s.outbox != nil {
+		messages = append(s.loyaltyMessages(models.OutboxLoyaltyRedemption, order, actor), s.loyaltyMessages(models.OutboxLoyaltyAward, order, actor)...)
+	} else {
+		if err := s.commitRedemption(ctx, order); err != nil {
+			return nil, err
 		}
+		if err := s.awardLoyaltyPoints(ctx, order); err != nil {
+			log.Printf("Keeping the submission of order %s: %v", order.ID, err)
+		}
+	}
+	order.Status = models.OrderStatusProcessing
+	order.Version++
+	if err := s.updateOrder(order, newOrderEvent(models.OrderEventSubmitted, actor, &before, order), messages); err != nil {
+		return nil, err
 	}
 
-	return nil, ErrOrderNotFound
+	return order, nil
 }
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// newYieldingProductClient returns a product client that yields the scheduler on
+// every lookup, widening the window between reading and writing an order so
+// that lost updates surface reliably when locking is missing
+func newYieldingProductClient(price models.Money) *MockProductServiceClient {
+	return &MockProductServiceClient{
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			runtime.Gosched()
+			return price, "Product", nil
+		},
+	}
+}
+
+func TestConcurrentUpdateOrderProducts_NoLostUpdates(t *testing.T) {
+	service := NewOrderService(NewInMemoryOrderRepository(), newYieldingProductClient(usd(1000)))
+
+	order, err := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	const workers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.UpdateOrderProducts(context.Background(), order.ID, []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin", AnyVersion); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	final, err := service.GetOrderByID(context.Background(), order.ID)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	if final.Products[0].Quantity != 1+workers {
+		t.Errorf("Expected quantity %d, got %d", 1+workers, final.Products[0].Quantity)
+	}
+	if expected := usd(int64(1+workers) * 1000); final.TotalPrice != expected {
+		t.Errorf("Expected total price %s, got %s", expected, final.TotalPrice)
+	}
+}
+
+func TestConcurrentUpdateOrderProducts_DistinctProducts(t *testing.T) {
+	service := NewOrderService(NewInMemoryOrderRepository(), newYieldingProductClient(usd(500)))
+
+	order, err := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-0", Quantity: 1}}, "", "test-admin")
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	// Each worker adds a different new product; none of them may be dropped
+	const workers = 25
+	var wg sync.WaitGroup
+	for i := 1; i <= workers; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			productID := "prod-" + string(rune('a'+n))
+			if _, err := service.UpdateOrderProducts(context.Background(), order.ID, []models.OrderProduct{{ProductID: productID, Quantity: 1}}, "", "test-admin", AnyVersion); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	final, _ := service.GetOrderByID(context.Background(), order.ID)
+	if len(final.Products) != workers+1 {
+		t.Errorf("Expected %d products, got %d", workers+1, len(final.Products))
+	}
+}
+
+func TestConcurrentSubmitOrder_OnlyOneSucceeds(t *testing.T) {
+	service := NewOrderService(NewInMemoryOrderRepository(), newYieldingProductClient(usd(1000)))
+
+	order, err := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	const workers = 20
+	var succeeded atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion); err == nil {
+				succeeded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded.Load() != 1 {
+		t.Errorf("Expected exactly 1 successful submission, got %d", succeeded.Load())
+	}
+}
+
+func TestConcurrentUpdateAndSubmit_NoUpdateAfterSubmit(t *testing.T) {
+	service := NewOrderService(NewInMemoryOrderRepository(), newYieldingProductClient(usd(1000)))
+
+	order, err := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	// Updates racing a submission must either land before it or be rejected;
+	// an update must never overwrite the PROCESSING status with stale data
+	const workers = 30
+	var applied atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			if n == workers/2 {
+				if _, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion); err != nil {
+					t.Errorf("Unexpected submit error: %v", err)
+				}
+				return
+			}
+			if _, err := service.UpdateOrderProducts(context.Background(), order.ID, []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin", AnyVersion); err == nil {
+				applied.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	final, _ := service.GetOrderByID(context.Background(), order.ID)
+	if final.Status != models.OrderStatusProcessing {
+		t.Errorf("Expected status PROCESSING, got %s", final.Status)
+	}
+	if final.Products[0].Quantity != 1+int(applied.Load()) {
+		t.Errorf("Expected quantity %d, got %d", 1+applied.Load(), final.Products[0].Quantity)
+	}
+}
+
+func TestConcurrentCreateOrder(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	service := NewOrderService(repo, newYieldingProductClient(usd(1000)))
+
+	const workers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin"); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			// Interleave reads with the writes
+			if _, _, err := service.ListOrders(context.Background()); err != nil {
+				t.Errorf("Unexpected list error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, total, _ := service.ListOrders(context.Background())
+	if total != workers {
+		t.Errorf("Expected %d orders, got %d", workers, total)
+	}
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// newBlockingProductClient returns a product client whose lookups block until
+// their context is done, signalling started as each one begins
+func newBlockingProductClient(started chan<- string) *MockProductServiceClient {
+	return &MockProductServiceClient{
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			if started != nil {
+				started <- productID
+			}
+			<-ctx.Done()
+			return models.Money{}, "", ctx.Err()
+		},
+	}
+}
+
+func TestCreateOrder_CanceledDuringValidation(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	started := make(chan string, 1)
+	service := NewOrderService(repo, newBlockingProductClient(started))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, err := service.CreateOrder(ctx, "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if orders, _ := repo.List(); len(orders) != 0 {
+		t.Errorf("Expected no order to be created, got %d", len(orders))
+	}
+}
+
+func TestCreateOrder_DeadlineReachesProductService(t *testing.T) {
+	requestDone := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hang until the client gives up on the request
+		<-r.Context().Done()
+		close(requestDone)
+	}))
+	defer server.Close()
+
+	service := NewOrderService(NewInMemoryOrderRepository(), NewProductServiceClient(server.URL, ""))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := service.CreateOrder(ctx, "user-123", []models.OrderProduct{{ProductID: "123", Quantity: 1}}, "", "test-admin")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the deadline to cut the lookup short, took %v", elapsed)
+	}
+	select {
+	case <-requestDone:
+	case <-time.After(time.Second):
+		t.Error("Expected the Product Service request to be canceled")
+	}
+}
+
+func TestUpdateOrderProducts_GivesUpWaitingForOrderLock(t *testing.T) {
+	started := make(chan string, 1)
+	service := NewOrderService(NewMockOrderRepository(), newBlockingProductClient(started))
+	const orderID = "650e8400-e29b-41d4-a716-446655440000" // PENDING
+
+	// Hold the order lock with an update stuck on the Product Service
+	blockedCtx, unblock := context.WithCancel(context.Background())
+	blocked := make(chan error, 1)
+	go func() {
+		_, err := service.UpdateOrderProducts(blockedCtx, orderID, []models.OrderProduct{{ProductID: "prod-new", Quantity: 1}}, "", "test-admin", AnyVersion)
+		blocked <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := service.SubmitOrder(ctx, orderID, "test-admin", AnyVersion); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded waiting for the order, got %v", err)
+	}
+
+	unblock()
+	if err := <-blocked; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the blocked update to be canceled, got %v", err)
+	}
+
+	// The lock is free again once both callers have given up
+	if _, err := service.SubmitOrder(context.Background(), orderID, "test-admin", AnyVersion); err != nil {
+		t.Errorf("Expected submit to succeed, got %v", err)
+	}
+}
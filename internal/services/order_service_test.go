@@ -1,7 +1,9 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/Bitovi/example-go-server/internal/models"
@@ -9,31 +11,51 @@ import (
 
 // MockProductServiceClient is a mock implementation of ProductClient for testing
 type MockProductServiceClient struct {
-	GetProductFunc     func(productID string, authToken string) (*ProductResponse, error)
-	ValidateProductFunc func(productID string, authToken string) (float64, string, error)
+	GetProductFunc     func(ctx context.Context, productID string, authToken string) (*ProductResponse, error)
+	ValidateProductFunc func(ctx context.Context, productID string, authToken string) (models.Money, string, error)
+	ValidateProductsFunc func(ctx context.Context, productIDs []string, authToken string) []ProductValidation
 }
 
-func (m *MockProductServiceClient) GetProduct(productID string, authToken string) (*ProductResponse, error) {
+func (m *MockProductServiceClient) GetProduct(ctx context.Context, productID string, authToken string) (*ProductResponse, error) {
 	if m.GetProductFunc != nil {
-		return m.GetProductFunc(productID, authToken)
+		return m.GetProductFunc(ctx, productID, authToken)
 	}
 	return nil, errors.New("GetProduct not mocked")
 }
 
-func (m *MockProductServiceClient) ValidateProduct(productID string, authToken string) (float64, string, error) {
+func (m *MockProductServiceClient) ValidateProduct(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
 	if m.ValidateProductFunc != nil {
-		return m.ValidateProductFunc(productID, authToken)
+		return m.ValidateProductFunc(ctx, productID, authToken)
 	}
-	return 0, "", errors.New("ValidateProduct not mocked")
+	return models.Money{}, "", errors.New("ValidateProduct not mocked")
+}
+
+// ValidateProducts uses ValidateProductsFunc if set and otherwise validates
+// each product with ValidateProduct
+func (m *MockProductServiceClient) ValidateProducts(ctx context.Context, productIDs []string, authToken string) []ProductValidation {
+	if m.ValidateProductsFunc != nil {
+		return m.ValidateProductsFunc(ctx, productIDs, authToken)
+	}
+	results := make([]ProductValidation, len(productIDs))
+	for i, id := range productIDs {
+		results[i].ProductID = id
+		price, name, err := m.ValidateProduct(ctx, id, authToken)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Product = &ProductResponse{Name: name, Price: price, Availability: true}
+	}
+	return results
 }
 
 func TestCreateOrder_Success(t *testing.T) {
 	// Create mock product client that returns successful validation
 	mockClient := &MockProductServiceClient{
-		ValidateProductFunc: func(productID string, authToken string) (float64, string, error) {
-			prices := map[string]float64{
-				"prod-1": 25.00,
-				"prod-2": 50.00,
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			prices := map[string]models.Money{
+				"prod-1": usd(2500),
+				"prod-2": usd(5000),
 			}
 			names := map[string]string{
 				"prod-1": "Product 1",
@@ -42,18 +64,18 @@ func TestCreateOrder_Success(t *testing.T) {
 			if price, ok := prices[productID]; ok {
 				return price, names[productID], nil
 			}
-			return 0, "", ErrProductNotFound
+			return models.Money{}, "", ErrProductNotFound
 		},
 	}
 
-	service := NewOrderService(mockClient)
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
 
 	products := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: 2},
 		{ProductID: "prod-2", Quantity: 1},
 	}
 
-	order, err := service.CreateOrder("user-123", products, "")
+	order, err := service.CreateOrder(context.Background(), "user-123", products, "", "test-admin")
 
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
@@ -78,8 +100,8 @@ func TestCreateOrder_Success(t *testing.T) {
 		t.Errorf("Expected product 2 quantity 1, got %d", order.Products[1].Quantity)
 	}
 	// Total should be (2 * 25.00) + (1 * 50.00) = 100.00
-	if order.TotalPrice != 100.00 {
-		t.Errorf("Expected total price 100.00, got %f", order.TotalPrice)
+	if order.TotalPrice != usd(10000) {
+		t.Errorf("Expected total price 100.00, got %s", order.TotalPrice)
 	}
 	if order.Status != "PENDING" {
 		t.Errorf("Expected status PENDING, got %s", order.Status)
@@ -89,22 +111,22 @@ func TestCreateOrder_Success(t *testing.T) {
 func TestCreateOrder_ProductNotFound(t *testing.T) {
 	// Create mock product client that returns not found
 	mockClient := &MockProductServiceClient{
-		ValidateProductFunc: func(productID string, authToken string) (float64, string, error) {
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
 			if productID == "prod-1" {
-				return 25.00, "Product 1", nil
+				return usd(2500), "Product 1", nil
 			}
-			return 0, "", ErrProductNotFound
+			return models.Money{}, "", ErrProductNotFound
 		},
 	}
 
-	service := NewOrderService(mockClient)
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
 
 	products := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: 2},
 		{ProductID: "invalid", Quantity: 1},
 	}
 
-	order, err := service.CreateOrder("user-123", products, "")
+	order, err := service.CreateOrder(context.Background(), "user-123", products, "", "test-admin")
 
 	if err == nil {
 		t.Fatal("Expected error for invalid product, got nil")
@@ -120,18 +142,18 @@ func TestCreateOrder_ProductNotFound(t *testing.T) {
 func TestCreateOrder_ProductServiceUnavailable(t *testing.T) {
 	// Create mock product client that returns unavailable
 	mockClient := &MockProductServiceClient{
-		ValidateProductFunc: func(productID string, authToken string) (float64, string, error) {
-			return 0, "", ErrProductServiceUnavailable
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			return models.Money{}, "", ErrProductServiceUnavailable
 		},
 	}
 
-	service := NewOrderService(mockClient)
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
 
 	products := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: 2},
 	}
 
-	order, err := service.CreateOrder("user-123", products, "")
+	order, err := service.CreateOrder(context.Background(), "user-123", products, "", "test-admin")
 
 	if err == nil {
 		t.Fatal("Expected error for unavailable service, got nil")
@@ -147,11 +169,11 @@ func TestCreateOrder_ProductServiceUnavailable(t *testing.T) {
 func TestUpdateOrderProducts_AddNewProduct(t *testing.T) {
 	// Create mock product client
 	mockClient := &MockProductServiceClient{
-		ValidateProductFunc: func(productID string, authToken string) (float64, string, error) {
-			prices := map[string]float64{
-				"prod-1": 25.00,
-				"prod-2": 50.00,
-				"prod-3": 75.00,
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			prices := map[string]models.Money{
+				"prod-1": usd(2500),
+				"prod-2": usd(5000),
+				"prod-3": usd(7500),
 			}
 			names := map[string]string{
 				"prod-1": "Product 1",
@@ -161,24 +183,24 @@ func TestUpdateOrderProducts_AddNewProduct(t *testing.T) {
 			if price, ok := prices[productID]; ok {
 				return price, names[productID], nil
 			}
-			return 0, "", ErrProductNotFound
+			return models.Money{}, "", ErrProductNotFound
 		},
 	}
 
-	service := NewOrderService(mockClient)
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
 
 	// Create initial order
 	initialProducts := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: 2},
 	}
-	order, _ := service.CreateOrder("user-123", initialProducts, "")
+	order, _ := service.CreateOrder(context.Background(), "user-123", initialProducts, "", "test-admin")
 
 	// Add new product
 	updates := []models.OrderProduct{
 		{ProductID: "prod-3", Quantity: 1},
 	}
 
-	updatedOrder, err := service.UpdateOrderProducts(order.ID, updates, "")
+	updatedOrder, err := service.UpdateOrderProducts(context.Background(), order.ID, updates, "", "test-admin", AnyVersion)
 
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
@@ -204,25 +226,25 @@ func TestUpdateOrderProducts_AddNewProduct(t *testing.T) {
 func TestUpdateOrderProducts_IncreaseQuantity(t *testing.T) {
 	// Create mock product client
 	mockClient := &MockProductServiceClient{
-		ValidateProductFunc: func(productID string, authToken string) (float64, string, error) {
-			return 25.00, "Product 1", nil
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			return usd(2500), "Product 1", nil
 		},
 	}
 
-	service := NewOrderService(mockClient)
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
 
 	// Create initial order
 	initialProducts := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: 2},
 	}
-	order, _ := service.CreateOrder("user-123", initialProducts, "")
+	order, _ := service.CreateOrder(context.Background(), "user-123", initialProducts, "", "test-admin")
 
 	// Increase quantity (no validation needed for existing products)
 	updates := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: 3},
 	}
 
-	updatedOrder, err := service.UpdateOrderProducts(order.ID, updates, "")
+	updatedOrder, err := service.UpdateOrderProducts(context.Background(), order.ID, updates, "", "test-admin", AnyVersion)
 
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
@@ -238,26 +260,26 @@ func TestUpdateOrderProducts_IncreaseQuantity(t *testing.T) {
 func TestUpdateOrderProducts_RemoveProduct(t *testing.T) {
 	// Create mock product client
 	mockClient := &MockProductServiceClient{
-		ValidateProductFunc: func(productID string, authToken string) (float64, string, error) {
-			return 25.00, "Product 1", nil
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			return usd(2500), "Product 1", nil
 		},
 	}
 
-	service := NewOrderService(mockClient)
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
 
 	// Create initial order with 2 products
 	initialProducts := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: 3},
 		{ProductID: "prod-2", Quantity: 2},
 	}
-	order, _ := service.CreateOrder("user-123", initialProducts, "")
+	order, _ := service.CreateOrder(context.Background(), "user-123", initialProducts, "", "test-admin")
 
 	// Remove all of prod-1
 	updates := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: -3},
 	}
 
-	updatedOrder, err := service.UpdateOrderProducts(order.ID, updates, "")
+	updatedOrder, err := service.UpdateOrderProducts(context.Background(), order.ID, updates, "", "test-admin", AnyVersion)
 
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
@@ -273,28 +295,28 @@ func TestUpdateOrderProducts_RemoveProduct(t *testing.T) {
 func TestUpdateOrderProducts_InvalidNewProduct(t *testing.T) {
 	// Create mock product client that returns not found for prod-3
 	mockClient := &MockProductServiceClient{
-		ValidateProductFunc: func(productID string, authToken string) (float64, string, error) {
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
 			if productID == "prod-1" {
-				return 25.00, "Product 1", nil
+				return usd(2500), "Product 1", nil
 			}
-			return 0, "", ErrProductNotFound
+			return models.Money{}, "", ErrProductNotFound
 		},
 	}
 
-	service := NewOrderService(mockClient)
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
 
 	// Create initial order
 	initialProducts := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: 2},
 	}
-	order, _ := service.CreateOrder("user-123", initialProducts, "")
+	order, _ := service.CreateOrder(context.Background(), "user-123", initialProducts, "", "test-admin")
 
 	// Try to add invalid product
 	updates := []models.OrderProduct{
 		{ProductID: "invalid", Quantity: 1},
 	}
 
-	updatedOrder, err := service.UpdateOrderProducts(order.ID, updates, "")
+	updatedOrder, err := service.UpdateOrderProducts(context.Background(), order.ID, updates, "", "test-admin", AnyVersion)
 
 	if err == nil {
 		t.Fatal("Expected error for invalid product, got nil")
@@ -310,20 +332,20 @@ func TestUpdateOrderProducts_InvalidNewProduct(t *testing.T) {
 func TestSubmitOrder_Success(t *testing.T) {
 	// Create mock product client
 	mockClient := &MockProductServiceClient{
-		ValidateProductFunc: func(productID string, authToken string) (float64, string, error) {
-			return 25.00, "Product 1", nil
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			return usd(2500), "Product 1", nil
 		},
 	}
 
-	service := NewOrderService(mockClient)
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
 
 	// Create and submit order
 	initialProducts := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: 2},
 	}
-	order, _ := service.CreateOrder("user-123", initialProducts, "")
+	order, _ := service.CreateOrder(context.Background(), "user-123", initialProducts, "", "test-admin")
 
-	submittedOrder, err := service.SubmitOrder(order.ID)
+	submittedOrder, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
 
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
@@ -336,21 +358,21 @@ func TestSubmitOrder_Success(t *testing.T) {
 func TestSubmitOrder_CannotSubmitCancelled(t *testing.T) {
 	// Create mock product client
 	mockClient := &MockProductServiceClient{
-		ValidateProductFunc: func(productID string, authToken string) (float64, string, error) {
-			return 25.00, "Product 1", nil
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			return usd(2500), "Product 1", nil
 		},
 	}
 
-	service := NewOrderService(mockClient)
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
 
 	// Create, cancel, then try to submit order
 	initialProducts := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: 2},
 	}
-	order, _ := service.CreateOrder("user-123", initialProducts, "")
-	service.CancelOrder(order.ID)
+	order, _ := service.CreateOrder(context.Background(), "user-123", initialProducts, "", "test-admin")
+	service.CancelOrder(context.Background(), order.ID, "test-admin", AnyVersion)
 
-	submittedOrder, err := service.SubmitOrder(order.ID)
+	submittedOrder, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
 
 	if err == nil {
 		t.Fatal("Expected error when submitting cancelled order, got nil")
@@ -363,20 +385,20 @@ func TestSubmitOrder_CannotSubmitCancelled(t *testing.T) {
 func TestCancelOrder_Success(t *testing.T) {
 	// Create mock product client
 	mockClient := &MockProductServiceClient{
-		ValidateProductFunc: func(productID string, authToken string) (float64, string, error) {
-			return 25.00, "Product 1", nil
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			return usd(2500), "Product 1", nil
 		},
 	}
 
-	service := NewOrderService(mockClient)
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
 
 	// Create and cancel order
 	initialProducts := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: 2},
 	}
-	order, _ := service.CreateOrder("user-123", initialProducts, "")
+	order, _ := service.CreateOrder(context.Background(), "user-123", initialProducts, "", "test-admin")
 
-	cancelledOrder, err := service.CancelOrder(order.ID)
+	cancelledOrder, err := service.CancelOrder(context.Background(), order.ID, "test-admin", AnyVersion)
 
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
@@ -389,21 +411,21 @@ func TestCancelOrder_Success(t *testing.T) {
 func TestGetOrderByID_Success(t *testing.T) {
 	// Create mock product client
 	mockClient := &MockProductServiceClient{
-		ValidateProductFunc: func(productID string, authToken string) (float64, string, error) {
-			return 25.00, "Product 1", nil
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			return usd(2500), "Product 1", nil
 		},
 	}
 
-	service := NewOrderService(mockClient)
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
 
 	// Create order
 	initialProducts := []models.OrderProduct{
 		{ProductID: "prod-1", Quantity: 2},
 	}
-	order, _ := service.CreateOrder("user-123", initialProducts, "")
+	order, _ := service.CreateOrder(context.Background(), "user-123", initialProducts, "", "test-admin")
 
 	// Get order by ID
-	retrievedOrder, err := service.GetOrderByID(order.ID)
+	retrievedOrder, err := service.GetOrderByID(context.Background(), order.ID)
 
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
@@ -415,9 +437,9 @@ func TestGetOrderByID_Success(t *testing.T) {
 
 func TestGetOrderByID_NotFound(t *testing.T) {
 	mockClient := &MockProductServiceClient{}
-	service := NewOrderService(mockClient)
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
 
-	retrievedOrder, err := service.GetOrderByID("non-existent")
+	retrievedOrder, err := service.GetOrderByID(context.Background(), "non-existent")
 
 	if err == nil {
 		t.Fatal("Expected error for non-existent order, got nil")
@@ -429,3 +451,242 @@ func TestGetOrderByID_NotFound(t *testing.T) {
 		t.Errorf("Expected nil order, got %+v", retrievedOrder)
 	}
 }
+
+func TestOrderVersion_IncrementsOnEveryChange(t *testing.T) {
+	mockClient := &MockProductServiceClient{
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			return usd(2500), "Product 1", nil
+		},
+	}
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
+
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+	if order.Version != 1 {
+		t.Fatalf("Expected new order at version 1, got %d", order.Version)
+	}
+
+	updated, err := service.UpdateOrderProducts(context.Background(), order.ID, []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin", 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("Expected version 2, got %d", updated.Version)
+	}
+
+	submitted, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if submitted.Version != 3 {
+		t.Errorf("Expected version 3, got %d", submitted.Version)
+	}
+}
+
+func TestOrderVersion_StaleVersionRejected(t *testing.T) {
+	mockClient := &MockProductServiceClient{
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			return usd(2500), "Product 1", nil
+		},
+	}
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
+
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+
+	// Two admins read version 1; the first change wins
+	if _, err := service.UpdateOrderProducts(context.Background(), order.ID, []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "admin-a", 1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := service.UpdateOrderProducts(context.Background(), order.ID, []models.OrderProduct{{ProductID: "prod-1", Quantity: 5}}, "", "admin-b", 1); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("Expected ErrVersionMismatch, got %v", err)
+	}
+	if _, err := service.CancelOrder(context.Background(), order.ID, "admin-b", 1); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("Expected ErrVersionMismatch, got %v", err)
+	}
+	if _, err := service.SubmitOrder(context.Background(), order.ID, "admin-b", 1); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("Expected ErrVersionMismatch, got %v", err)
+	}
+
+	final, _ := service.GetOrderByID(context.Background(), order.ID)
+	if final.Products[0].Quantity != 2 || final.Status != models.OrderStatusPending || final.Version != 2 {
+		t.Errorf("Expected only the first update to apply, got %+v", final)
+	}
+}
+
+func TestCreateOrder_ReportsAllInvalidProducts(t *testing.T) {
+	var batches int
+	mockClient := &MockProductServiceClient{
+		ValidateProductsFunc: func(ctx context.Context, productIDs []string, authToken string) []ProductValidation {
+			batches++
+			results := make([]ProductValidation, len(productIDs))
+			for i, id := range productIDs {
+				results[i] = ProductValidation{ProductID: id, Product: &ProductResponse{Price: usd(1000), Availability: true}}
+				if id != "prod-1" {
+					results[i] = ProductValidation{ProductID: id, Err: ErrProductNotFound}
+				}
+			}
+			return results
+		},
+	}
+
+	service := NewOrderService(NewInMemoryOrderRepository(), mockClient)
+	products := []models.OrderProduct{
+		{ProductID: "prod-1", Quantity: 1},
+		{ProductID: "prod-2", Quantity: 1},
+		{ProductID: "prod-3", Quantity: 1},
+	}
+
+	_, err := service.CreateOrder(context.Background(), "user-123", products, "", "test-admin")
+	if !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("Expected ErrProductNotFound, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "prod-2, prod-3") {
+		t.Errorf("Expected both invalid products in the error, got %v", err)
+	}
+	if batches != 1 {
+		t.Errorf("Expected products to be validated in a single call, got %d", batches)
+	}
+}
+
+// newPricedProductClient returns a product client serving the given prices,
+// which the test may change between calls
+func newPricedProductClient(prices map[string]models.Money) *MockProductServiceClient {
+	return &MockProductServiceClient{
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			if price, ok := prices[productID]; ok {
+				return price, "Product " + strings.TrimPrefix(productID, "prod-"), nil
+			}
+			return models.Money{}, "", ErrProductNotFound
+		},
+	}
+}
+
+// findOrderLine returns the order's line for productID
+func findOrderLine(t *testing.T, order *models.Order, productID string) models.OrderProduct {
+	t.Helper()
+	for _, line := range order.Products {
+		if line.ProductID == productID {
+			return line
+		}
+	}
+	t.Fatalf("Expected a line for %s in %+v", productID, order.Products)
+	return models.OrderProduct{}
+}
+
+func TestCreateOrder_CapturesPriceSnapshots(t *testing.T) {
+	service := NewOrderService(NewInMemoryOrderRepository(), newPricedProductClient(map[string]models.Money{"prod-1": usd(2500), "prod-2": usd(5000)}))
+
+	// Prices sent by the client are ignored
+	order, err := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{
+		{ProductID: "prod-1", Quantity: 2, UnitPrice: usd(1), LineTotal: usd(2)},
+		{ProductID: "prod-2", Quantity: 1},
+	}, "", "test-admin")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []models.OrderProduct{
+		{ProductID: "prod-1", Quantity: 2, ProductName: "Product 1", UnitPrice: usd(2500), LineTotal: usd(5000)},
+		{ProductID: "prod-2", Quantity: 1, ProductName: "Product 2", UnitPrice: usd(5000), LineTotal: usd(5000)},
+	}
+	for i, line := range expected {
+		if order.Products[i] != line {
+			t.Errorf("Expected line %+v, got %+v", line, order.Products[i])
+		}
+	}
+	if order.TotalPrice != usd(10000) {
+		t.Errorf("Expected total price 100.00, got %s", order.TotalPrice)
+	}
+}
+
+func TestUpdateOrderProducts_KeepsCapturedPrices(t *testing.T) {
+	prices := map[string]models.Money{"prod-1": usd(2500), "prod-2": usd(5000)}
+	service := NewOrderService(NewInMemoryOrderRepository(), newPricedProductClient(prices))
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 2}}, "", "test-admin")
+
+	// The price changes after the line was added
+	prices["prod-1"] = usd(3000)
+	updated, err := service.UpdateOrderProducts(context.Background(), order.ID, []models.OrderProduct{
+		{ProductID: "prod-1", Quantity: 1},
+		{ProductID: "prod-2", Quantity: 1},
+	}, "", "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if line := findOrderLine(t, updated, "prod-1"); line.UnitPrice != usd(2500) || line.LineTotal != usd(7500) {
+		t.Errorf("Expected prod-1 to keep its captured price, got %+v", line)
+	}
+	if line := findOrderLine(t, updated, "prod-2"); line.UnitPrice != usd(5000) || line.LineTotal != usd(5000) || line.ProductName != "Product 2" {
+		t.Errorf("Expected prod-2 at its current price, got %+v", line)
+	}
+	if updated.TotalPrice != usd(12500) {
+		t.Errorf("Expected total price 125.00, got %s", updated.TotalPrice)
+	}
+}
+
+func TestUpdateOrderProducts_PricesLinesWithoutSnapshot(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	repo.Create(&models.Order{
+		ID:       "order-1",
+		Products: []models.OrderProduct{{ProductID: "prod-1", Quantity: 2}},
+		Status:   models.OrderStatusPending,
+		Version:  1,
+	}, nil)
+	service := NewOrderService(repo, newPricedProductClient(map[string]models.Money{"prod-1": usd(2500), "prod-2": usd(5000)}))
+
+	updated, err := service.UpdateOrderProducts(context.Background(), "order-1", []models.OrderProduct{{ProductID: "prod-2", Quantity: 1}}, "", "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if line := findOrderLine(t, updated, "prod-1"); line.UnitPrice != usd(2500) || line.LineTotal != usd(5000) || line.ProductName != "Product 1" {
+		t.Errorf("Expected prod-1 to be priced, got %+v", line)
+	}
+	if updated.TotalPrice != usd(10000) {
+		t.Errorf("Expected total price 100.00, got %s", updated.TotalPrice)
+	}
+}
+
+func TestRepriceOrder(t *testing.T) {
+	prices := map[string]models.Money{"prod-1": usd(2500), "prod-2": usd(5000)}
+	service := NewOrderService(NewInMemoryOrderRepository(), newPricedProductClient(prices))
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{
+		{ProductID: "prod-1", Quantity: 2},
+		{ProductID: "prod-2", Quantity: 1},
+	}, "", "test-admin")
+
+	prices["prod-1"] = usd(3000)
+	repriced, err := service.RepriceOrder(context.Background(), order.ID, "", "test-admin", order.Version)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if line := findOrderLine(t, repriced, "prod-1"); line.UnitPrice != usd(3000) || line.LineTotal != usd(6000) {
+		t.Errorf("Expected prod-1 at its current price, got %+v", line)
+	}
+	if repriced.TotalPrice != usd(11000) || repriced.Version != order.Version+1 {
+		t.Errorf("Expected total 110.00 at version %d, got %s at version %d", order.Version+1, repriced.TotalPrice, repriced.Version)
+	}
+
+	rebuilt, err := rebuildOrder(service, order.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rebuilt.TotalPrice != repriced.TotalPrice || rebuilt.Products[0] != repriced.Products[0] {
+		t.Errorf("Expected replay to match %+v, got %+v", repriced, rebuilt)
+	}
+
+	// A product that no longer exists cannot be repriced
+	delete(prices, "prod-2")
+	if _, err := service.RepriceOrder(context.Background(), order.ID, "", "test-admin", AnyVersion); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+
+	service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if _, err := service.RepriceOrder(context.Background(), order.ID, "", "test-admin", AnyVersion); !errors.Is(err, ErrOrderNotPending) {
+		t.Errorf("Expected ErrOrderNotPending, got %v", err)
+	}
+}
+
+// usd returns an amount of cents in the default currency
+func usd(cents int64) models.Money {
+	return models.NewMoney(cents, models.DefaultCurrency)
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrOutboxMessageNotFound is returned when an outbox message is not found
+	ErrOutboxMessageNotFound = errors.New("outbox message not found")
+	// ErrOutboxMessageDelivered is returned when replaying a message that has
+	// already been delivered
+	ErrOutboxMessageDelivered = errors.New("outbox message already delivered")
+)
+
+// OutboxStore keeps the side effects of order changes until they are delivered.
+// Implementations must return copies, like OrderRepository.
+type OutboxStore interface {
+	// ListOutbox returns the messages with status, or all messages if status
+	// is empty, in the order they were written
+	ListOutbox(status models.OutboxStatus) ([]models.OutboxMessage, error)
+	// GetOutbox returns the message with the given ID or ErrOutboxMessageNotFound
+	GetOutbox(id string) (*models.OutboxMessage, error)
+	// SaveOutbox replaces a stored message, returning ErrOutboxMessageNotFound
+	// if it does not exist
+	SaveOutbox(message *models.OutboxMessage) error
+	// PruneOutbox removes the messages delivered before deliveredBefore and
+	// returns how many were removed
+	PruneOutbox(deliveredBefore time.Time) (int, error)
+}
+
+// OutboxRepository is an OrderRepository that also stores outbox messages. An
+// order change and the messages it produces are written together, so a crash
+// cannot keep one without the other.
+type OutboxRepository interface {
+	OrderRepository
+	OutboxStore
+	// UpdateWithOutbox replaces a stored order and appends its event like
+	// Update, and appends messages to the outbox in the same write
+	UpdateWithOutbox(order *models.Order, event *models.OrderEvent, messages []models.OutboxMessage) error
+}
+
+// NewOutboxMessage returns a message, due now, for a side effect of a change
+// made to an order by actor
+func NewOutboxMessage(messageType models.OutboxMessageType, orderID, actor string) models.OutboxMessage {
+	now := time.Now().UTC()
+	return models.OutboxMessage{
+		ID:            uuid.New().String(),
+		Type:          messageType,
+		OrderID:       orderID,
+		Actor:         actor,
+		Status:        models.OutboxStatusPending,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+}
+
+// cloneOutboxMessage returns a copy of a message that shares no pointers
+func cloneOutboxMessage(message models.OutboxMessage) models.OutboxMessage {
+	if message.DeliveredAt != nil {
+		deliveredAt := *message.DeliveredAt
+		message.DeliveredAt = &deliveredAt
+	}
+	return message
+}
+
+// OutboxHandler delivers a message. A returned error makes the dispatcher try
+// again later, so handlers must be safe to repeat.
+type OutboxHandler func(ctx context.Context, message *models.OutboxMessage) error
+
+// DefaultOutboxRetryPolicy tries a message ten times over roughly twenty
+// minutes before dead-lettering it
+var DefaultOutboxRetryPolicy = RetryPolicy{
+	MaxAttempts:    10,
+	InitialBackoff: time.Second,
+	MaxBackoff:     5 * time.Minute,
+}
+
+// outboxBatchSize bounds the number of messages delivered in one round
+const outboxBatchSize = 100
+
+// OutboxDispatcher delivers pending outbox messages. A failed delivery is
+// retried with the backoff of its retry policy until MaxAttempts is reached;
+// the message is then dead-lettered and kept for an operator to inspect and
+// replay. Messages of the same order are delivered in the order they were
+// written: a message waits while an earlier one of its order is pending.
+type OutboxDispatcher struct {
+	// mu serializes delivery rounds and replays so a message is never
+	// delivered and reset at the same time
+	mu      sync.Mutex
+	store   OutboxStore
+	deliver OutboxHandler
+	retry   RetryPolicy
+	now     func() time.Time
+}
+
+// NewOutboxDispatcher creates a dispatcher delivering the messages of store
+// with deliver. The policy's Budget is not used.
+func NewOutboxDispatcher(store OutboxStore, deliver OutboxHandler, retry RetryPolicy) *OutboxDispatcher {
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+	return &OutboxDispatcher{
+		store:   store,
+		deliver: deliver,
+		retry:   retry,
+		now:     time.Now,
+	}
+}
+
+// Dispatch delivers the pending messages that are due, oldest first, and
+// returns how many were delivered
+func (d *OutboxDispatcher) Dispatch(ctx context.Context) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pending, err := d.store.ListOutbox(models.OutboxStatusPending)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered, attempted := 0, 0
+	// Orders with an earlier message still pending
+	blocked := make(map[string]bool)
+	for _, message := range pending {
+		if attempted == outboxBatchSize || ctx.Err() != nil {
+			break
+		}
+		now := d.now()
+		if blocked[message.OrderID] || message.NextAttemptAt.After(now) {
+			blocked[message.OrderID] = true
+			continue
+		}
+
+		attempted++
+		err := d.deliver(ctx, &message)
+		if err != nil && ctx.Err() != nil {
+			// Shutting down; the attempt does not count against the message
+			break
+		}
+
+		message.Attempts++
+		switch {
+		case err == nil:
+			deliveredAt := d.now().UTC()
+			message.Status = models.OutboxStatusDelivered
+			message.DeliveredAt = &deliveredAt
+			message.LastError = ""
+			delivered++
+		case message.Attempts >= d.retry.MaxAttempts:
+			message.Status = models.OutboxStatusDead
+			message.LastError = err.Error()
+			blocked[message.OrderID] = true
+			log.Printf("Outbox message %s (%s for order %s) dead-lettered after %d attempts: %v", message.ID, message.Type, message.OrderID, message.Attempts, err)
+		default:
+			message.NextAttemptAt = now.Add(d.retry.backoff(message.Attempts))
+			message.LastError = err.Error()
+			blocked[message.OrderID] = true
+			log.Printf("Outbox message %s (%s for order %s) failed, attempt %d of %d: %v", message.ID, message.Type, message.OrderID, message.Attempts, d.retry.MaxAttempts, err)
+		}
+		if err := d.store.SaveOutbox(&message); err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+// Run dispatches pending messages every interval and removes messages
+// delivered more than retention ago, until ctx is done. A non-positive
+// interval polls every second.
+func (d *OutboxDispatcher) Run(ctx context.Context, interval, retention time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.Dispatch(ctx); err != nil {
+				log.Printf("Outbox dispatch failed: %v", err)
+			}
+			if pruned, err := d.store.PruneOutbox(d.now().Add(-retention)); err != nil {
+				log.Printf("Outbox pruning failed: %v", err)
+			} else if pruned > 0 {
+				log.Printf("Removed %d delivered outbox messages", pruned)
+			}
+		}
+	}
+}
+
+// Messages returns the messages with status, or all messages if status is
+// empty, oldest first
+func (d *OutboxDispatcher) Messages(status models.OutboxStatus) ([]models.OutboxMessage, error) {
+	return d.store.ListOutbox(status)
+}
+
+// Replay makes a dead or pending message due now with a fresh set of
+// attempts. The last error is kept until the message is delivered.
+func (d *OutboxDispatcher) Replay(id string) (*models.OutboxMessage, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	message, err := d.store.GetOutbox(id)
+	if err != nil {
+		return nil, err
+	}
+	if message.Status == models.OutboxStatusDelivered {
+		return nil, ErrOutboxMessageDelivered
+	}
+
+	message.Status = models.OutboxStatusPending
+	message.Attempts = 0
+	message.NextAttemptAt = d.now().UTC()
+	if err := d.store.SaveOutbox(message); err != nil {
+		return nil, err
+	}
+	log.Printf("Outbox message %s (%s for order %s) replayed", message.ID, message.Type, message.OrderID)
+	return message, nil
+}
+
+// Health reports the outbox as degraded while any message is dead-lettered
+func (d *OutboxDispatcher) Health() models.ComponentHealth {
+	messages, err := d.store.ListOutbox("")
+	if err != nil {
+		return models.ComponentHealth{
+			Status:  models.HealthStatusUnhealthy,
+			Details: map[string]any{"error": err.Error()},
+		}
+	}
+
+	pending, dead := 0, 0
+	for _, message := range messages {
+		switch message.Status {
+		case models.OutboxStatusPending:
+			pending++
+		case models.OutboxStatusDead:
+			dead++
+		}
+	}
+	health := models.ComponentHealth{
+		Status:  models.HealthStatusHealthy,
+		Details: map[string]any{"pending": pending, "dead": dead},
+	}
+	if dead > 0 {
+		health.Status = models.HealthStatusDegraded
+	}
+	return health
+}
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/fakeloyaltyservice"
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// outboxTestPolicy dead-letters a message after three attempts, retrying it a
+// second after each failure
+var outboxTestPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Second}
+
+// newTestDispatcher returns a dispatcher on a clock that only moves when the
+// returned function is called
+func newTestDispatcher(store OutboxStore, deliver OutboxHandler) (*OutboxDispatcher, func(time.Duration)) {
+	now := time.Now()
+	dispatcher := NewOutboxDispatcher(store, deliver, outboxTestPolicy)
+	dispatcher.now = func() time.Time { return now }
+	return dispatcher, func(d time.Duration) { now = now.Add(d) }
+}
+
+// queueOutbox queues an award for each of orderIDs, creating the orders as
+// needed, and returns the messages in order
+func queueOutbox(t *testing.T, repo OutboxRepository, orderIDs ...string) []models.OutboxMessage {
+	t.Helper()
+	var queued []models.OutboxMessage
+	for _, orderID := range orderIDs {
+		if _, err := repo.Get(orderID); errors.Is(err, ErrOrderNotFound) {
+			repo.Create(newTestOrder(orderID, 1), nil)
+		}
+		message := NewOutboxMessage(models.OutboxLoyaltyAward, orderID, "test-admin")
+		message.NextAttemptAt = time.Time{}
+		order, _ := repo.Get(orderID)
+		if err := repo.UpdateWithOutbox(order, nil, []models.OutboxMessage{message}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		queued = append(queued, message)
+	}
+	return queued
+}
+
+func TestOutboxDispatcher_RetriesAndDeadLetters(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	queued := queueOutbox(t, repo, "order-1")
+	attempts := 0
+	dispatcher, advance := newTestDispatcher(repo, func(ctx context.Context, message *models.OutboxMessage) error {
+		attempts++
+		return errors.New("loyalty service down")
+	})
+
+	dispatcher.Dispatch(context.Background())
+	// Not due again until the backoff has passed
+	dispatcher.Dispatch(context.Background())
+	message, _ := repo.GetOutbox(queued[0].ID)
+	if attempts != 1 || message.Status != models.OutboxStatusPending || message.Attempts != 1 || message.LastError != "loyalty service down" {
+		t.Fatalf("Expected one failed attempt, got %d: %+v", attempts, message)
+	}
+
+	for range 2 {
+		advance(time.Second)
+		dispatcher.Dispatch(context.Background())
+	}
+	message, _ = repo.GetOutbox(queued[0].ID)
+	if attempts != 3 || message.Status != models.OutboxStatusDead {
+		t.Errorf("Expected the message to be dead-lettered after 3 attempts, got %d: %+v", attempts, message)
+	}
+	if health := dispatcher.Health(); health.Status != models.HealthStatusDegraded || health.Details["dead"] != 1 {
+		t.Errorf("Expected a degraded outbox with one dead message, got %+v", health)
+	}
+
+	// Dead messages are not retried until replayed
+	advance(time.Hour)
+	dispatcher.Dispatch(context.Background())
+	if attempts != 3 {
+		t.Errorf("Expected no attempt on a dead message, got %d", attempts)
+	}
+}
+
+func TestOutboxDispatcher_DeliversEachOrderInSequence(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	queued := queueOutbox(t, repo, "order-1", "order-1", "order-2")
+	var delivered []string
+	dispatcher, advance := newTestDispatcher(repo, func(ctx context.Context, message *models.OutboxMessage) error {
+		if message.ID == queued[0].ID && message.Attempts == 0 {
+			return errors.New("try again")
+		}
+		delivered = append(delivered, message.ID)
+		return nil
+	})
+
+	// The second message of order-1 waits for the first; order-2 does not
+	if n, err := dispatcher.Dispatch(context.Background()); n != 1 || err != nil {
+		t.Fatalf("Expected one message delivered, got %d, %v", n, err)
+	}
+	advance(time.Second)
+	dispatcher.Dispatch(context.Background())
+
+	expected := []string{queued[2].ID, queued[0].ID, queued[1].ID}
+	if len(delivered) != 3 || delivered[0] != expected[0] || delivered[1] != expected[1] || delivered[2] != expected[2] {
+		t.Errorf("Expected delivery order %v, got %v", expected, delivered)
+	}
+	if pending, _ := repo.ListOutbox(models.OutboxStatusPending); len(pending) != 0 {
+		t.Errorf("Expected nothing pending, got %+v", pending)
+	}
+}
+
+func TestOutboxDispatcher_Replay(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	queued := queueOutbox(t, repo, "order-1")
+	failing := true
+	dispatcher, advance := newTestDispatcher(repo, func(ctx context.Context, message *models.OutboxMessage) error {
+		if failing {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+	for range 3 {
+		dispatcher.Dispatch(context.Background())
+		advance(time.Second)
+	}
+
+	failing = false
+	replayed, err := dispatcher.Replay(queued[0].ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if replayed.Status != models.OutboxStatusPending || replayed.Attempts != 0 || replayed.LastError != "rejected" {
+		t.Errorf("Expected a fresh pending message keeping its last error, got %+v", replayed)
+	}
+	if n, _ := dispatcher.Dispatch(context.Background()); n != 1 {
+		t.Errorf("Expected the replayed message to be delivered, got %d", n)
+	}
+
+	if _, err := dispatcher.Replay(queued[0].ID); !errors.Is(err, ErrOutboxMessageDelivered) {
+		t.Errorf("Expected ErrOutboxMessageDelivered, got %v", err)
+	}
+	if _, err := dispatcher.Replay("missing"); !errors.Is(err, ErrOutboxMessageNotFound) {
+		t.Errorf("Expected ErrOutboxMessageNotFound, got %v", err)
+	}
+}
+
+// startOutboxLoyalty returns a fake Loyalty Service, an order service queuing
+// loyalty side effects in repo's outbox and a dispatcher delivering them
+func startOutboxLoyalty(t *testing.T, repo OutboxRepository) (*fakeloyaltyservice.Server, *OrderService, *OutboxDispatcher) {
+	t.Helper()
+	fake, direct := startFakeLoyaltyService(t, repo)
+	service := NewOrderService(repo, newYieldingProductClient(usd(138995)), WithLoyaltyClient(direct.loyaltyClient), WithOutbox())
+	return fake, service, NewOutboxDispatcher(repo, service.DeliverOutboxMessage, outboxTestPolicy)
+}
+
+func TestSubmitOrder_QueuesLoyaltyAward(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	fake, service, dispatcher := startOutboxLoyalty(t, repo)
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+
+	submitted, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// The award is stored with the submission instead of being made
+	pending, _ := repo.ListOutbox(models.OutboxStatusPending)
+	if submitted.AccruedLoyaltyPoints != 0 || fake.Balance("user-123") != 0 || len(pending) != 1 || pending[0].Type != models.OutboxLoyaltyAward {
+		t.Fatalf("Expected a queued award, got %+v with outbox %+v", submitted, pending)
+	}
+
+	if n, err := dispatcher.Dispatch(context.Background()); n != 1 || err != nil {
+		t.Fatalf("Expected the award to be delivered, got %d, %v", n, err)
+	}
+	awarded, _ := service.GetOrderByID(context.Background(), order.ID)
+	if awarded.AccruedLoyaltyPoints != 138 || awarded.LoyaltyTransactionID == "" || awarded.Version != submitted.Version+1 || fake.Balance("user-123") != 138 {
+		t.Errorf("Expected 138 points awarded and recorded, got %+v", awarded)
+	}
+
+	events, _ := service.GetOrderEvents(context.Background(), order.ID)
+	if last := events[len(events)-1]; last.Type != models.OrderEventLoyaltyAwarded || last.Actor != "test-admin" {
+		t.Errorf("Expected a LoyaltyAwarded event by test-admin, got %s by %s", last.Type, last.Actor)
+	}
+	rebuilt, _ := rebuildOrder(service, order.ID)
+	if rebuilt.LoyaltyTransactionID != awarded.LoyaltyTransactionID || rebuilt.Version != awarded.Version {
+		t.Errorf("Expected the award to be replayed from events, got %+v", rebuilt)
+	}
+}
+
+// failingOutboxRepository fails the next failures order updates written with
+// outbox messages
+type failingOutboxRepository struct {
+	*InMemoryOrderRepository
+	failures int
+}
+
+func (r *failingOutboxRepository) UpdateWithOutbox(order *models.Order, event *models.OrderEvent, messages []models.OutboxMessage) error {
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("disk full")
+	}
+	return r.InMemoryOrderRepository.UpdateWithOutbox(order, event, messages)
+}
+
+func TestSubmitOrder_QueuesRedemption(t *testing.T) {
+	repo := &failingOutboxRepository{InMemoryOrderRepository: NewInMemoryOrderRepository()}
+	fake, service, dispatcher := startOutboxLoyalty(t, repo)
+	fake.SetBalance("user-123", 1000)
+	order := createRedeemingOrder(t, service, 500)
+
+	// A submission that is not stored redeems nothing
+	repo.failures = 1
+	if _, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion); err == nil {
+		t.Fatal("Expected the first submission to fail")
+	}
+	if fake.Held("user-123") != 500 || fake.Balance("user-123") != 1000 {
+		t.Fatalf("Expected the points to stay reserved, got %d held of %d", fake.Held("user-123"), fake.Balance("user-123"))
+	}
+
+	submitted, err := service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	pending, _ := repo.ListOutbox(models.OutboxStatusPending)
+	if len(pending) != 2 || pending[0].Type != models.OutboxLoyaltyRedemption || pending[1].Type != models.OutboxLoyaltyAward {
+		t.Fatalf("Expected a queued redemption followed by an award, got %+v", pending)
+	}
+	if submitted.Discounts[0].RedemptionID != "" || fake.Held("user-123") != 500 {
+		t.Fatalf("Expected the points to stay reserved until the outbox is delivered, got %+v", submitted.Discounts)
+	}
+
+	if n, err := dispatcher.Dispatch(context.Background()); n != 2 || err != nil {
+		t.Fatalf("Expected the redemption and the award to be delivered, got %d, %v", n, err)
+	}
+	redeemed, _ := service.GetOrderByID(context.Background(), order.ID)
+	if redeemed.Discounts[0].RedemptionID == "" || fake.Held("user-123") != 0 || fake.Balance("user-123") != 500+redeemed.AccruedLoyaltyPoints {
+		t.Errorf("Expected the points to be redeemed once, got %+v with balance %d", redeemed.Discounts, fake.Balance("user-123"))
+	}
+
+	events, _ := service.GetOrderEvents(context.Background(), order.ID)
+	if len(events) < 2 || events[len(events)-2].Type != models.OrderEventPointsRedeemed {
+		t.Errorf("Expected a PointsRedeemed event before the award, got %+v", events)
+	}
+	rebuilt, _ := rebuildOrder(service, order.ID)
+	if rebuilt.Discounts[0].RedemptionID != redeemed.Discounts[0].RedemptionID {
+		t.Errorf("Expected the redemption to be replayed from events, got %+v", rebuilt.Discounts)
+	}
+}
+
+func TestOutbox_CancelBeforeAwardIsDelivered(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	fake, service, dispatcher := startOutboxLoyalty(t, repo)
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+	service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	service.CancelOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+
+	if n, _ := dispatcher.Dispatch(context.Background()); n != 2 {
+		t.Fatalf("Expected the award and its reversal to be delivered, got %d", n)
+	}
+	canceled, _ := service.GetOrderByID(context.Background(), order.ID)
+	if canceled.Status != models.OrderStatusCanceled || canceled.LoyaltyReversalID == "" || canceled.AccruedLoyaltyPoints != 0 {
+		t.Errorf("Expected the award to be reversed, got %+v", canceled)
+	}
+	if balance := fake.Balance("user-123"); balance != 0 {
+		t.Errorf("Expected no points left credited, got %d", balance)
+	}
+}
+
+func TestOutbox_ReturnReversesDeliveredAward(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	fake, service, dispatcher := startOutboxLoyalty(t, repo)
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+	service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	dispatcher.Dispatch(context.Background())
+	service.ShipOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	service.DeliverOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	awarded := fake.Balance("user-123")
+
+	service.ReturnOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if balance := fake.Balance("user-123"); balance != awarded || balance == 0 {
+		t.Fatalf("Expected the points to stay credited until the outbox is delivered, got %d", balance)
+	}
+
+	if n, _ := dispatcher.Dispatch(context.Background()); n != 1 {
+		t.Fatalf("Expected the reversal to be delivered, got %d", n)
+	}
+	returned, _ := service.GetOrderByID(context.Background(), order.ID)
+	if returned.Status != models.OrderStatusReturned || returned.LoyaltyReversalID == "" || returned.AccruedLoyaltyPoints != 0 {
+		t.Errorf("Expected the award to be reversed, got %+v", returned)
+	}
+	if balance := fake.Balance("user-123"); balance != 0 {
+		t.Errorf("Expected no points left credited, got %d", balance)
+	}
+}
+
+func TestOutbox_CancelReleasesReservedPoints(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	fake, service, dispatcher := startOutboxLoyalty(t, repo)
+	fake.SetBalance("user-123", 1000)
+	order := createRedeemingOrder(t, service, 500)
+
+	service.CancelOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	if held := fake.Held("user-123"); held != 500 {
+		t.Fatalf("Expected the points to stay held until the outbox is delivered, got %d", held)
+	}
+
+	dispatcher.Dispatch(context.Background())
+	canceled, _ := service.GetOrderByID(context.Background(), order.ID)
+	if fake.Held("user-123") != 0 || len(canceled.Discounts) != 0 || canceled.TotalPrice != usd(138995) {
+		t.Errorf("Expected the reservation to be released, got %+v", canceled)
+	}
+}
+
+func TestOutbox_CancelBeforeRedemptionIsDelivered(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	fake, service, dispatcher := startOutboxLoyalty(t, repo)
+	fake.SetBalance("user-123", 1000)
+	order := createRedeemingOrder(t, service, 500)
+	service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	service.CancelOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+
+	if n, _ := dispatcher.Dispatch(context.Background()); n != 3 {
+		t.Fatalf("Expected the redemption, the award and their reversal to be delivered, got %d", n)
+	}
+	canceled, _ := service.GetOrderByID(context.Background(), order.ID)
+	if len(canceled.Discounts) != 1 || canceled.Discounts[0].RefundID == "" || canceled.LoyaltyReversalID == "" {
+		t.Errorf("Expected the redemption and the award to be given back, got %+v", canceled)
+	}
+	if fake.Held("user-123") != 0 || fake.Balance("user-123") != 1000 {
+		t.Errorf("Expected the balance to be restored to 1000, got %d with %d held", fake.Balance("user-123"), fake.Held("user-123"))
+	}
+}
+
+func TestOutbox_LoyaltyOutageIsRetried(t *testing.T) {
+	repo := NewInMemoryOrderRepository()
+	fake, service, dispatcher := startOutboxLoyalty(t, repo)
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+	service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+	now := time.Now()
+	dispatcher.now = func() time.Time { return now }
+
+	fake.SetFailing(true)
+	dispatcher.Dispatch(context.Background())
+	pending, _ := repo.ListOutbox(models.OutboxStatusPending)
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Fatalf("Expected the award to stay pending after a failed attempt, got %+v", pending)
+	}
+
+	fake.SetFailing(false)
+	now = now.Add(time.Second)
+	dispatcher.Dispatch(context.Background())
+	if balance := fake.Balance("user-123"); balance != 138 {
+		t.Errorf("Expected the retried award to credit 138 points, got %d", balance)
+	}
+}
+
+func TestOutboxRepositories(t *testing.T) {
+	repos := map[string]func(t *testing.T) OutboxRepository{
+		"memory": func(t *testing.T) OutboxRepository { return NewInMemoryOrderRepository() },
+		"file":   func(t *testing.T) OutboxRepository { return openFileRepo(t, t.TempDir(), 100) },
+		"sql":    func(t *testing.T) OutboxRepository { return newTestSQLRepo(t) },
+	}
+	for name, open := range repos {
+		t.Run(name, func(t *testing.T) {
+			repo := open(t)
+			queued := queueOutbox(t, repo, "order-1", "order-2")
+
+			if err := repo.UpdateWithOutbox(newTestOrder("missing", 1), nil, []models.OutboxMessage{NewOutboxMessage(models.OutboxLoyaltyAward, "missing", "")}); !errors.Is(err, ErrOrderNotFound) {
+				t.Errorf("Expected ErrOrderNotFound, got %v", err)
+			}
+			all, _ := repo.ListOutbox("")
+			if len(all) != 2 || all[0].ID != queued[0].ID || all[1].ID != queued[1].ID {
+				t.Fatalf("Expected the two queued messages in order, got %+v", all)
+			}
+
+			deliveredAt := time.Now().Add(-time.Hour).UTC()
+			delivered := queued[0]
+			delivered.Status = models.OutboxStatusDelivered
+			delivered.Attempts = 1
+			delivered.DeliveredAt = &deliveredAt
+			if err := repo.SaveOutbox(&delivered); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			stored, _ := repo.GetOutbox(delivered.ID)
+			if stored.Status != models.OutboxStatusDelivered || stored.Attempts != 1 || !stored.DeliveredAt.Equal(deliveredAt) {
+				t.Errorf("Expected the delivery to be saved, got %+v", stored)
+			}
+			if pending, _ := repo.ListOutbox(models.OutboxStatusPending); len(pending) != 1 || pending[0].ID != queued[1].ID {
+				t.Errorf("Expected only the second message pending, got %+v", pending)
+			}
+
+			if pruned, err := repo.PruneOutbox(time.Now()); pruned != 1 || err != nil {
+				t.Errorf("Expected one message pruned, got %d, %v", pruned, err)
+			}
+			if _, err := repo.GetOutbox(delivered.ID); !errors.Is(err, ErrOutboxMessageNotFound) {
+				t.Errorf("Expected ErrOutboxMessageNotFound, got %v", err)
+			}
+			if err := repo.SaveOutbox(&delivered); !errors.Is(err, ErrOutboxMessageNotFound) {
+				t.Errorf("Expected ErrOutboxMessageNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileOrderRepository_OutboxPersistsAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	repo := openFileRepo(t, dir, 3)
+	queued := queueOutbox(t, repo, "order-1", "order-2")
+	dead := queued[1]
+	dead.Status = models.OutboxStatusDead
+	repo.SaveOutbox(&dead)
+	repo.Close()
+
+	reopened := openFileRepo(t, dir, 3)
+	messages, err := reopened.ListOutbox("")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(messages) != 2 || messages[0].Status != models.OutboxStatusPending || messages[1].Status != models.OutboxStatusDead {
+		t.Errorf("Expected the outbox to survive a restart, got %+v", messages)
+	}
+}
+
+func TestSQLOrderRepository_OutboxIsWrittenWithTheOrder(t *testing.T) {
+	repo := newTestSQLRepo(t)
+	order := newTestOrder("order-1", 1)
+	repo.Create(order, nil)
+
+	// The line violates the quantity check, so the message must not be kept
+	order.Products[0].Quantity = 0
+	if err := repo.UpdateWithOutbox(order, nil, []models.OutboxMessage{NewOutboxMessage(models.OutboxLoyaltyAward, order.ID, "")}); err == nil {
+		t.Fatal("Expected error for invalid line, got nil")
+	}
+	if messages, _ := repo.ListOutbox(""); len(messages) != 0 {
+		t.Errorf("Expected no outbox message without the order change, got %+v", messages)
+	}
+}
+
+func TestOutboxDispatcher_WithFileRepository(t *testing.T) {
+	repo := openFileRepo(t, filepath.Join(t.TempDir(), "orders"), 100)
+	fake, service, dispatcher := startOutboxLoyalty(t, repo)
+	order, _ := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 1}}, "", "test-admin")
+	service.SubmitOrder(context.Background(), order.ID, "test-admin", AnyVersion)
+
+	if n, err := dispatcher.Dispatch(context.Background()); n != 1 || err != nil {
+		t.Fatalf("Expected the award to be delivered, got %d, %v", n, err)
+	}
+	if awarded, _ := repo.Get(order.ID); awarded.AccruedLoyaltyPoints != 138 || fake.Balance("user-123") != 138 {
+		t.Errorf("Expected 138 points awarded, got %+v", awarded)
+	}
+}
@@ -1,33 +1,85 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"sync/atomic"
 	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
 )
 
-// ProductClient is an interface for interacting with the Product Service
+// ProductClient is an interface for interacting with the Product Service.
+// Lookups are abandoned when ctx is done.
 type ProductClient interface {
-	GetProduct(productID string, authToken string) (*ProductResponse, error)
-	ValidateProduct(productID string, authToken string) (float64, string, error)
+	GetProduct(ctx context.Context, productID string, authToken string) (*ProductResponse, error)
+	ValidateProduct(ctx context.Context, productID string, authToken string) (models.Money, string, error)
+	// ValidateProducts validates several products at once, returning one
+	// result per ID in the order given
+	ValidateProducts(ctx context.Context, productIDs []string, authToken string) []ProductValidation
 }
 
+// DefaultProductValidationConcurrency is the number of products validated in
+// parallel when the Product Service has no bulk lookup
+const DefaultProductValidationConcurrency = 8
+
 // ProductServiceClient handles communication with the Product Service
 type ProductServiceClient struct {
 	baseURL    string
 	httpClient *http.Client
 	authToken  string
+
+	// concurrency bounds the parallel requests made by ValidateProducts
+	concurrency int
+	// bulkLookup is set while GET /products?ids= is believed to be supported
+	bulkLookup atomic.Bool
+	// retry controls retries of failed requests; by default there are none
+	retry RetryPolicy
+	// idScheme is the format of the Product Service's product IDs
+	idScheme ProductIDScheme
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+// ProductClientOption configures optional ProductServiceClient behavior
+type ProductClientOption func(*ProductServiceClient)
+
+// WithValidationConcurrency sets how many products ValidateProducts looks up
+// in parallel. Values below 1 are ignored.
+func WithValidationConcurrency(n int) ProductClientOption {
+	return func(c *ProductServiceClient) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// WithBulkLookup makes ValidateProducts fetch all products with a single
+// GET /products?ids= request. If the Product Service turns out not to support
+// it, the client falls back to one request per product.
+func WithBulkLookup() ProductClientOption {
+	return func(c *ProductServiceClient) {
+		c.bulkLookup.Store(true)
+	}
+}
+
+// WithProductIDScheme sets the format of the Product Service's product IDs.
+// IDs outside it are reported as not found without a request being made. By
+// default both UUIDs and numeric IDs are accepted.
+func WithProductIDScheme(scheme ProductIDScheme) ProductClientOption {
+	return func(c *ProductServiceClient) {
+		c.idScheme = scheme
+	}
 }
 
 // ProductResponse represents the Product Service response for a single product
 type ProductResponse struct {
-	ID           int     `json:"id"`
-	Name         string  `json:"name"`
-	Description  string  `json:"description"`
-	Price        float64 `json:"price"`
-	Availability bool    `json:"availability"`
+	ID           ProductID    `json:"id"`
+	Name         string       `json:"name"`
+	Description  string       `json:"description"`
+	Price        models.Money `json:"price"`
+	Availability bool         `json:"availability"`
 }
 
 // ProductListResponse represents the Product Service response for multiple products
@@ -37,54 +89,52 @@ type ProductListResponse struct {
 }
 
 // NewProductServiceClient creates a new product service client
-func NewProductServiceClient(baseURL, authToken string) *ProductServiceClient {
-	return &ProductServiceClient{
+func NewProductServiceClient(baseURL, authToken string, opts ...ProductClientOption) *ProductServiceClient {
+	c := &ProductServiceClient{
 		baseURL: baseURL,
 		httpClient: &http.Client{
 			Timeout: 5 * time.Second,
 		},
-		authToken: authToken,
+		authToken:   authToken,
+		concurrency: DefaultProductValidationConcurrency,
+		sleep:       sleepContext,
+		idScheme:    ProductIDSchemeAny,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
-// GetProduct fetches a product by ID from the Product Service
-func (c *ProductServiceClient) GetProduct(productID string, authToken string) (*ProductResponse, error) {
+// GetProduct fetches a product by ID from the Product Service. It fails with
+// ErrProductIDMismatch if the Product Service returns a different product.
+func (c *ProductServiceClient) GetProduct(ctx context.Context, productID string, authToken string) (*ProductResponse, error) {
 	if c.baseURL == "" {
 		return nil, fmt.Errorf("product service URL not configured")
 	}
 
-	url := fmt.Sprintf("%s/products/%s", c.baseURL, productID)
-	
-	req, err := http.NewRequest("GET", url, nil)
+	id, err := c.idScheme.Normalize(productID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrProductNotFound, err)
 	}
+	url := fmt.Sprintf("%s/products/%s", c.baseURL, id)
 
-	// Add authentication header if token is provided (from request or client)
-	if authToken != "" {
-		req.Header.Set("Authorization", authToken)
-	} else if c.authToken != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.authToken))
-	}
-
-	resp, err := c.httpClient.Do(req)
+	// Transient failures are retried as configured by the retry policy
+	resp, err := c.get(ctx, url, authToken)
 	if err != nil {
-		return nil, fmt.Errorf("product service unavailable: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
 	// Handle different status codes
 	switch resp.StatusCode {
 	case http.StatusOK:
 		var product ProductResponse
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %w", err)
-		}
-
-		if err := json.Unmarshal(body, &product); err != nil {
+		if err := json.Unmarshal(resp.Body, &product); err != nil {
 			return nil, fmt.Errorf("failed to parse product response: %w", err)
 		}
+		if !sameProductID(string(product.ID), id) {
+			return nil, fmt.Errorf("%w: asked for %s, got %q", ErrProductIDMismatch, id, product.ID)
+		}
 
 		return &product, nil
 
@@ -94,26 +144,41 @@ func (c *ProductServiceClient) GetProduct(productID string, authToken string) (*
 	case http.StatusUnauthorized:
 		return nil, fmt.Errorf("%w: unauthorized access", ErrProductServiceUnavailable)
 
-	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
 		return nil, fmt.Errorf("%w: status %d", ErrProductServiceUnavailable, resp.StatusCode)
 
 	default:
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected response from product service: status %d, body: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("unexpected response from product service: status %d, body: %s", resp.StatusCode, string(resp.Body))
 	}
 }
 
 // ValidateProduct checks if a product exists and is available, returns its price and name
-func (c *ProductServiceClient) ValidateProduct(productID string, authToken string) (float64, string, error) {
-	product, err := c.GetProduct(productID, authToken)
+func (c *ProductServiceClient) ValidateProduct(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+	product, err := c.GetProduct(ctx, productID, authToken)
 	if err != nil {
-		return 0, "", err
+		return models.Money{}, "", err
 	}
 
+	return checkProductAvailable(productID, product)
+}
+
+// checkProductAvailable returns the price and name of a product that is available
+func checkProductAvailable(productID string, product *ProductResponse) (models.Money, string, error) {
 	// Check if product is available
 	if !product.Availability {
-		return 0, "", fmt.Errorf("product '%s' (%s) is not available", productID, product.Name)
+		return models.Money{}, "", fmt.Errorf("product '%s' (%s) is not available", productID, product.Name)
 	}
 
 	return product.Price, product.Name, nil
 }
+
+// setAuthorization adds the request's auth token, or the client's own token
+// when the request has none
+func (c *ProductServiceClient) setAuthorization(req *http.Request, authToken string) {
+	if authToken != "" {
+		req.Header.Set("Authorization", authToken)
+	} else if c.authToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.authToken))
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -26,10 +27,10 @@ func TestGetProduct_Success(t *testing.T) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		response := ProductResponse{
-			ID:           123,
+			ID:           "123",
 			Name:         "Test Product",
 			Description:  "A test product",
-			Price:        99.99,
+			Price:        usd(9999),
 			Availability: true,
 		}
 		json.NewEncoder(w).Encode(response)
@@ -40,20 +41,20 @@ func TestGetProduct_Success(t *testing.T) {
 	client := NewProductServiceClient(server.URL, "test-token")
 
 	// Call GetProduct
-	product, err := client.GetProduct("123", "")
+	product, err := client.GetProduct(context.Background(), "123", "")
 
 	// Verify results
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
-	if product.ID != 123 {
-		t.Errorf("Expected ID 123, got %d", product.ID)
+	if product.ID != "123" {
+		t.Errorf("Expected ID 123, got %s", product.ID)
 	}
 	if product.Name != "Test Product" {
 		t.Errorf("Expected name 'Test Product', got %s", product.Name)
 	}
-	if product.Price != 99.99 {
-		t.Errorf("Expected price 99.99, got %f", product.Price)
+	if product.Price != usd(9999) {
+		t.Errorf("Expected price 99.99, got %s", product.Price)
 	}
 	if !product.Availability {
 		t.Errorf("Expected availability true, got false")
@@ -73,7 +74,7 @@ func TestGetProduct_NotFound(t *testing.T) {
 	client := NewProductServiceClient(server.URL, "test-token")
 
 	// Call GetProduct
-	product, err := client.GetProduct("999", "")
+	product, err := client.GetProduct(context.Background(), "999", "")
 
 	// Verify results
 	if !errors.Is(err, ErrProductNotFound) {
@@ -97,7 +98,7 @@ func TestGetProduct_Unauthorized(t *testing.T) {
 	client := NewProductServiceClient(server.URL, "invalid-token")
 
 	// Call GetProduct
-	product, err := client.GetProduct("123", "")
+	product, err := client.GetProduct(context.Background(), "123", "")
 
 	// Verify results
 	if !errors.Is(err, ErrProductServiceUnavailable) {
@@ -121,7 +122,7 @@ func TestGetProduct_ServerError(t *testing.T) {
 	client := NewProductServiceClient(server.URL, "test-token")
 
 	// Call GetProduct
-	product, err := client.GetProduct("123", "")
+	product, err := client.GetProduct(context.Background(), "123", "")
 
 	// Verify results
 	if !errors.Is(err, ErrProductServiceUnavailable) {
@@ -145,7 +146,7 @@ func TestGetProduct_ServiceUnavailable(t *testing.T) {
 	client := NewProductServiceClient(server.URL, "test-token")
 
 	// Call GetProduct
-	product, err := client.GetProduct("123", "")
+	product, err := client.GetProduct(context.Background(), "123", "")
 
 	// Verify results
 	if !errors.Is(err, ErrProductServiceUnavailable) {
@@ -162,10 +163,10 @@ func TestValidateProduct_Success(t *testing.T) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		response := ProductResponse{
-			ID:           456,
+			ID:           "456",
 			Name:         "Validated Product",
 			Description:  "A validated product",
-			Price:        49.99,
+			Price:        usd(4999),
 			Availability: true,
 		}
 		json.NewEncoder(w).Encode(response)
@@ -175,14 +176,14 @@ func TestValidateProduct_Success(t *testing.T) {
 	client := NewProductServiceClient(server.URL, "test-token")
 
 	// Call ValidateProduct
-	price, name, err := client.ValidateProduct("456", "")
+	price, name, err := client.ValidateProduct(context.Background(), "456", "")
 
 	// Verify results
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
-	if price != 49.99 {
-		t.Errorf("Expected price 49.99, got %f", price)
+	if price != usd(4999) {
+		t.Errorf("Expected price 49.99, got %s", price)
 	}
 	if name != "Validated Product" {
 		t.Errorf("Expected name 'Validated Product', got %s", name)
@@ -199,14 +200,14 @@ func TestValidateProduct_NotFound(t *testing.T) {
 	client := NewProductServiceClient(server.URL, "test-token")
 
 	// Call ValidateProduct
-	price, name, err := client.ValidateProduct("999", "")
+	price, name, err := client.ValidateProduct(context.Background(), "999", "")
 
 	// Verify results
 	if !errors.Is(err, ErrProductNotFound) {
 		t.Errorf("Expected wrapped ErrProductNotFound, got %v", err)
 	}
-	if price != 0 {
-		t.Errorf("Expected price 0, got %f", price)
+	if !price.IsZero() {
+		t.Errorf("Expected price 0, got %s", price)
 	}
 	if name != "" {
 		t.Errorf("Expected empty name, got %s", name)
@@ -219,10 +220,10 @@ func TestValidateProduct_Unavailable(t *testing.T) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		response := ProductResponse{
-			ID:           789,
+			ID:           "789",
 			Name:         "Unavailable Product",
 			Description:  "An unavailable product",
-			Price:        29.99,
+			Price:        usd(2999),
 			Availability: false,
 		}
 		json.NewEncoder(w).Encode(response)
@@ -232,7 +233,7 @@ func TestValidateProduct_Unavailable(t *testing.T) {
 	client := NewProductServiceClient(server.URL, "test-token")
 
 	// Call ValidateProduct
-	price, name, err := client.ValidateProduct("789", "")
+	price, name, err := client.ValidateProduct(context.Background(), "789", "")
 
 	// Verify results
 	if err == nil {
@@ -241,8 +242,8 @@ func TestValidateProduct_Unavailable(t *testing.T) {
 	if err.Error() != "product '789' (Unavailable Product) is not available" {
 		t.Errorf("Expected unavailable error message, got %v", err)
 	}
-	if price != 0 {
-		t.Errorf("Expected price 0, got %f", price)
+	if !price.IsZero() {
+		t.Errorf("Expected price 0, got %s", price)
 	}
 	if name != "" {
 		t.Errorf("Expected empty name, got %s", name)
@@ -259,14 +260,14 @@ func TestValidateProduct_ServerError(t *testing.T) {
 	client := NewProductServiceClient(server.URL, "test-token")
 
 	// Call ValidateProduct
-	price, name, err := client.ValidateProduct("123", "")
+	price, name, err := client.ValidateProduct(context.Background(), "123", "")
 
 	// Verify results
 	if !errors.Is(err, ErrProductServiceUnavailable) {
 		t.Errorf("Expected wrapped ErrProductServiceUnavailable, got %v", err)
 	}
-	if price != 0 {
-		t.Errorf("Expected price 0, got %f", price)
+	if !price.IsZero() {
+		t.Errorf("Expected price 0, got %s", price)
 	}
 	if name != "" {
 		t.Errorf("Expected empty name, got %s", name)
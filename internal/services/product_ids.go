@@ -0,0 +1,114 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidProductID is returned for a product ID that is not in the
+	// Product Service's ID scheme
+	ErrInvalidProductID = errors.New("invalid product ID")
+	// ErrProductIDMismatch is returned when the Product Service answers a lookup
+	// with a different product. It matches ErrProductServiceUnavailable.
+	ErrProductIDMismatch = fmt.Errorf("%w: returned product does not match the requested ID", ErrProductServiceUnavailable)
+)
+
+// ProductIDScheme is the format of the product IDs used by a Product Service
+// deployment. The orders API accepts product IDs in that format and stores
+// them in their canonical form.
+type ProductIDScheme string
+
+const (
+	// ProductIDSchemeUUID identifies products by UUID, stored in lower case
+	ProductIDSchemeUUID ProductIDScheme = "uuid"
+	// ProductIDSchemeNumeric identifies products by positive integer, stored
+	// without leading zeros
+	ProductIDSchemeNumeric ProductIDScheme = "numeric"
+	// ProductIDSchemeAny accepts both UUIDs and positive integers, for
+	// deployments migrating from one scheme to the other
+	ProductIDSchemeAny ProductIDScheme = "any"
+)
+
+// ParseProductIDScheme parses a PRODUCT_ID_SCHEME value
+func ParseProductIDScheme(s string) (ProductIDScheme, error) {
+	switch scheme := ProductIDScheme(strings.ToLower(s)); scheme {
+	case ProductIDSchemeUUID, ProductIDSchemeNumeric, ProductIDSchemeAny:
+		return scheme, nil
+	}
+	return "", fmt.Errorf("unknown product ID scheme %q: must be uuid, numeric or any", s)
+}
+
+// Normalize returns the canonical form of id, or an error matching
+// ErrInvalidProductID if id is not in the scheme
+func (s ProductIDScheme) Normalize(id string) (string, error) {
+	if s != ProductIDSchemeNumeric {
+		if parsed, err := uuid.Parse(id); err == nil {
+			return parsed.String(), nil
+		}
+	}
+	if s != ProductIDSchemeUUID {
+		if n, err := strconv.ParseUint(id, 10, 63); err == nil && n > 0 {
+			return strconv.FormatUint(n, 10), nil
+		}
+	}
+
+	switch s {
+	case ProductIDSchemeUUID:
+		return "", fmt.Errorf("%w: %q must be a UUID", ErrInvalidProductID, id)
+	case ProductIDSchemeNumeric:
+		return "", fmt.Errorf("%w: %q must be a positive integer", ErrInvalidProductID, id)
+	}
+	return "", fmt.Errorf("%w: %q must be a UUID or a positive integer", ErrInvalidProductID, id)
+}
+
+// sameProductID reports whether two product IDs name the same product, such
+// as "7" and "007" or a UUID in upper and lower case
+func sameProductID(a, b string) bool {
+	return canonicalProductID(a) == canonicalProductID(b)
+}
+
+// canonicalProductID returns the canonical form of an ID in any scheme, or the
+// ID unchanged if it is in none
+func canonicalProductID(id string) string {
+	if canonical, err := ProductIDSchemeAny.Normalize(id); err == nil {
+		return canonical
+	}
+	return id
+}
+
+// ProductID is a product identifier as sent by the Product Service: a JSON
+// number for numeric IDs or a string for UUIDs. It is encoded the same way.
+type ProductID string
+
+// MarshalJSON encodes numeric IDs as numbers and all others as strings
+func (id ProductID) MarshalJSON() ([]byte, error) {
+	if _, err := strconv.ParseUint(string(id), 10, 64); err == nil {
+		return []byte(id), nil
+	}
+	return json.Marshal(string(id))
+}
+
+// UnmarshalJSON accepts a number or a string
+func (id *ProductID) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*id = ProductID(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("product ID must be a number or a string: %w", err)
+	}
+	*id = ProductID(n.String())
+	return nil
+}
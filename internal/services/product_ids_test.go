@@ -0,0 +1,70 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestProductIDScheme_Normalize(t *testing.T) {
+	const id = "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	tests := []struct {
+		scheme   ProductIDScheme
+		value    string
+		expected string
+	}{
+		{ProductIDSchemeUUID, id, id},
+		{ProductIDSchemeUUID, "3FA85F64-5717-4562-B3FC-2C963F66AFA6", id},
+		{ProductIDSchemeUUID, "7", ""},
+		{ProductIDSchemeNumeric, "7", "7"},
+		{ProductIDSchemeNumeric, "007", "7"},
+		{ProductIDSchemeNumeric, "0", ""},
+		{ProductIDSchemeNumeric, "-7", ""},
+		{ProductIDSchemeNumeric, id, ""},
+		{ProductIDSchemeAny, id, id},
+		{ProductIDSchemeAny, "007", "7"},
+		{ProductIDSchemeAny, "laptop", ""},
+	}
+	for _, tt := range tests {
+		normalized, err := tt.scheme.Normalize(tt.value)
+		if tt.expected == "" {
+			if !errors.Is(err, ErrInvalidProductID) {
+				t.Errorf("%s scheme: expected %q to be invalid, got %q, %v", tt.scheme, tt.value, normalized, err)
+			}
+			continue
+		}
+		if err != nil || normalized != tt.expected {
+			t.Errorf("%s scheme: expected %q to normalize to %q, got %q, %v", tt.scheme, tt.value, tt.expected, normalized, err)
+		}
+	}
+}
+
+func TestParseProductIDScheme(t *testing.T) {
+	if scheme, err := ParseProductIDScheme("Numeric"); err != nil || scheme != ProductIDSchemeNumeric {
+		t.Errorf("Expected numeric scheme, got %q, %v", scheme, err)
+	}
+	if _, err := ParseProductIDScheme("sku"); err == nil {
+		t.Error("Expected an unknown scheme to be rejected")
+	}
+}
+
+func TestProductID_JSON(t *testing.T) {
+	var products []ProductResponse
+	if err := json.Unmarshal([]byte(`[{"id": 7}, {"id": "3fa85f64-5717-4562-b3fc-2c963f66afa6"}]`), &products); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if products[0].ID != "7" || products[1].ID != "3fa85f64-5717-4562-b3fc-2c963f66afa6" {
+		t.Errorf("Unexpected IDs %q and %q", products[0].ID, products[1].ID)
+	}
+
+	for id, expected := range map[ProductID]string{"7": `7`, "3fa85f64-5717-4562-b3fc-2c963f66afa6": `"3fa85f64-5717-4562-b3fc-2c963f66afa6"`} {
+		if data, err := json.Marshal(id); err != nil || string(data) != expected {
+			t.Errorf("Expected %q to encode as %s, got %s, %v", id, expected, data, err)
+		}
+	}
+
+	var id ProductID
+	if err := json.Unmarshal([]byte(`true`), &id); err == nil {
+		t.Error("Expected a boolean ID to be rejected")
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how ProductServiceClient retries failed lookups, and
+// how OutboxDispatcher retries failed deliveries. Only network errors and 429
+// or 5xx responses are retried by ProductServiceClient.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first; 1 or
+	// less disables retries
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. Each further retry
+	// doubles it, up to MaxBackoff. Delays are jittered to between half and
+	// all of the computed value. A Retry-After header overrides the delay.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Budget bounds the total time spent on a lookup, including all attempts
+	// and delays; zero means no limit beyond the HTTP client timeout
+	Budget time.Duration
+}
+
+// DefaultRetryPolicy retries twice within a three second budget
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Budget:         3 * time.Second,
+}
+
+// WithRetryPolicy makes the client retry transient Product Service failures
+func WithRetryPolicy(policy RetryPolicy) ProductClientOption {
+	return func(c *ProductServiceClient) {
+		c.retry = policy
+	}
+}
+
+// backoff returns the jittered delay before retry number n, starting at 1
+func (p RetryPolicy) backoff(n int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < n && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// productServiceResponse is a Product Service response that has been read in full
+type productServiceResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// get performs an idempotent GET request, retrying network errors and 429 or
+// 5xx responses as the retry policy allows. The last response is returned
+// whatever its status.
+func (c *ProductServiceClient) get(ctx context.Context, url, authToken string) (*productServiceResponse, error) {
+	if c.retry.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.retry.Budget)
+		defer cancel()
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, retryAfter, err := c.getOnce(ctx, url, authToken)
+		retryable := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		if !retryable || attempt >= c.retry.MaxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := c.retry.backoff(attempt)
+		if retryAfter >= 0 {
+			delay = retryAfter
+		}
+		// Give up rather than wait past the budget
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+		if c.sleep(ctx, delay) != nil {
+			return resp, err
+		}
+	}
+}
+
+// getOnce makes a single GET request. retryAfter is negative unless the
+// response carried a valid Retry-After header.
+func (c *ProductServiceClient) getOnce(ctx context.Context, url, authToken string) (resp *productServiceResponse, retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Add authentication header if token is provided (from request or client)
+	c.setAuthorization(req, authToken)
+
+	httpResp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, -1, fmt.Errorf("%w: %w", ErrProductServiceUnavailable, err)
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, -1, fmt.Errorf("%w: failed to read response body: %w", ErrProductServiceUnavailable, err)
+	}
+
+	retryAfter = -1
+	if d, ok := parseRetryAfter(httpResp.Header.Get("Retry-After"), time.Now()); ok {
+		retryAfter = d
+	}
+	return &productServiceResponse{StatusCode: httpResp.StatusCode, Body: body}, retryAfter, nil
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
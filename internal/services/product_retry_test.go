@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyProductServer fails the first failures requests with status, then
+// serves product 123
+func newFlakyProductServer(t *testing.T, failures int32, status int, header map[string]string, requests *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			for name, value := range header {
+				w.Header().Set(name, value)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(w).Encode(ProductResponse{ID: "123", Name: "Test Product", Price: usd(9999), Availability: true})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newRetryingClient returns a client for server that records its retry delays
+// instead of sleeping
+func newRetryingClient(url string, policy RetryPolicy, delays *[]time.Duration) *ProductServiceClient {
+	client := NewProductServiceClient(url, "", WithRetryPolicy(policy))
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		*delays = append(*delays, d)
+		return nil
+	}
+	return client
+}
+
+func TestGetProduct_RetriesTransientFailures(t *testing.T) {
+	for _, status := range []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		var requests atomic.Int32
+		var delays []time.Duration
+		server := newFlakyProductServer(t, 2, status, nil, &requests)
+		client := newRetryingClient(server.URL, DefaultRetryPolicy, &delays)
+
+		product, err := client.GetProduct(context.Background(), "123", "")
+		if err != nil {
+			t.Fatalf("Status %d: expected success after retries, got %v", status, err)
+		}
+		if product.ID != "123" {
+			t.Errorf("Status %d: expected product 123, got %s", status, product.ID)
+		}
+		if requests.Load() != 3 {
+			t.Errorf("Status %d: expected 3 requests, got %d", status, requests.Load())
+		}
+		if len(delays) != 2 {
+			t.Errorf("Status %d: expected 2 delays, got %v", status, delays)
+		}
+	}
+}
+
+func TestGetProduct_GivesUpAfterMaxAttempts(t *testing.T) {
+	var requests atomic.Int32
+	var delays []time.Duration
+	server := newFlakyProductServer(t, 5, http.StatusServiceUnavailable, nil, &requests)
+	client := newRetryingClient(server.URL, DefaultRetryPolicy, &delays)
+
+	if _, err := client.GetProduct(context.Background(), "123", ""); !errors.Is(err, ErrProductServiceUnavailable) {
+		t.Errorf("Expected ErrProductServiceUnavailable, got %v", err)
+	}
+	if requests.Load() != int32(DefaultRetryPolicy.MaxAttempts) {
+		t.Errorf("Expected %d requests, got %d", DefaultRetryPolicy.MaxAttempts, requests.Load())
+	}
+}
+
+func TestGetProduct_DoesNotRetryClientErrors(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusUnauthorized, http.StatusBadRequest} {
+		var requests atomic.Int32
+		var delays []time.Duration
+		server := newFlakyProductServer(t, 5, status, nil, &requests)
+		client := newRetryingClient(server.URL, DefaultRetryPolicy, &delays)
+
+		if _, err := client.GetProduct(context.Background(), "123", ""); err == nil {
+			t.Errorf("Status %d: expected an error", status)
+		}
+		if requests.Load() != 1 {
+			t.Errorf("Status %d: expected 1 request, got %d", status, requests.Load())
+		}
+	}
+}
+
+func TestGetProduct_NoRetriesByDefault(t *testing.T) {
+	var requests atomic.Int32
+	server := newFlakyProductServer(t, 1, http.StatusServiceUnavailable, nil, &requests)
+
+	if _, err := NewProductServiceClient(server.URL, "").GetProduct(context.Background(), "123", ""); !errors.Is(err, ErrProductServiceUnavailable) {
+		t.Errorf("Expected ErrProductServiceUnavailable, got %v", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected 1 request, got %d", requests.Load())
+	}
+}
+
+func TestGetProduct_RetriesNetworkErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	var delays []time.Duration
+	client := newRetryingClient(url, DefaultRetryPolicy, &delays)
+
+	if _, err := client.GetProduct(context.Background(), "123", ""); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if len(delays) != DefaultRetryPolicy.MaxAttempts-1 {
+		t.Errorf("Expected %d retries, got %d", DefaultRetryPolicy.MaxAttempts-1, len(delays))
+	}
+}
+
+func TestGetProduct_HonorsRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	var delays []time.Duration
+	server := newFlakyProductServer(t, 1, http.StatusTooManyRequests, map[string]string{"Retry-After": "2"}, &requests)
+	policy := DefaultRetryPolicy
+	policy.Budget = 10 * time.Second
+	client := newRetryingClient(server.URL, policy, &delays)
+
+	if _, err := client.GetProduct(context.Background(), "123", ""); err != nil {
+		t.Fatalf("Expected success after retry, got %v", err)
+	}
+	if len(delays) != 1 || delays[0] != 2*time.Second {
+		t.Errorf("Expected a single 2s delay, got %v", delays)
+	}
+}
+
+func TestGetProduct_RetryAfterBeyondBudget(t *testing.T) {
+	var requests atomic.Int32
+	var delays []time.Duration
+	server := newFlakyProductServer(t, 1, http.StatusServiceUnavailable, map[string]string{"Retry-After": "60"}, &requests)
+	client := newRetryingClient(server.URL, DefaultRetryPolicy, &delays)
+
+	if _, err := client.GetProduct(context.Background(), "123", ""); !errors.Is(err, ErrProductServiceUnavailable) {
+		t.Errorf("Expected ErrProductServiceUnavailable, got %v", err)
+	}
+	if requests.Load() != 1 || len(delays) != 0 {
+		t.Errorf("Expected to give up without waiting, got %d requests and delays %v", requests.Load(), delays)
+	}
+}
+
+func TestGetProduct_RetryBudget(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(30 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewProductServiceClient(server.URL, "", WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    100,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Budget:         100 * time.Millisecond,
+	}))
+
+	start := time.Now()
+	if _, err := client.GetProduct(context.Background(), "123", ""); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the budget to stop retries, took %v", elapsed)
+	}
+	if requests.Load() > 5 {
+		t.Errorf("Expected the budget to limit attempts, got %d requests", requests.Load())
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, ceiling := range expected {
+		ceiling *= time.Millisecond
+		for j := 0; j < 20; j++ {
+			if d := policy.backoff(i + 1); d < ceiling/2 || d > ceiling {
+				t.Errorf("Retry %d: expected a delay between %v and %v, got %v", i+1, ceiling/2, ceiling, d)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 14, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"3", 3 * time.Second, true},
+		{"Wed, 14 Jan 2026 12:00:05 GMT", 5 * time.Second, true},
+		{"Wed, 14 Jan 2026 11:00:00 GMT", 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		d, ok := parseRetryAfter(tt.value, now)
+		if d != tt.expected || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; expected %v, %v", tt.value, d, ok, tt.expected, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// errBulkLookupUnsupported is returned when the Product Service has no bulk lookup
+var errBulkLookupUnsupported = errors.New("bulk product lookup not supported")
+
+// ProductValidation is the outcome of validating one product
+type ProductValidation struct {
+	ProductID string
+	// Product is the product as returned by the Product Service, or nil if it
+	// could not be fetched
+	Product *ProductResponse
+	// Err is nil when the product exists and is available. It wraps
+	// ErrProductNotFound for unknown products.
+	Err error
+}
+
+// newProductValidation validates the outcome of looking up one product
+func newProductValidation(productID string, product *ProductResponse, err error) ProductValidation {
+	if err == nil {
+		_, _, err = checkProductAvailable(productID, product)
+	}
+	return ProductValidation{ProductID: productID, Product: product, Err: err}
+}
+
+// ValidateProducts validates products with a single bulk request when enabled
+// and supported, and otherwise with up to the configured number of parallel
+// GetProduct requests
+func (c *ProductServiceClient) ValidateProducts(ctx context.Context, productIDs []string, authToken string) []ProductValidation {
+	if c.bulkLookup.Load() && len(productIDs) > 1 {
+		products, err := c.getProducts(ctx, productIDs, authToken)
+		switch {
+		case err == nil:
+			results := make([]ProductValidation, len(productIDs))
+			for i, id := range productIDs {
+				product, ok := products[canonicalProductID(id)]
+				if !ok {
+					results[i] = newProductValidation(id, nil, ErrProductNotFound)
+					continue
+				}
+				results[i] = newProductValidation(id, product, nil)
+			}
+			return results
+		case errors.Is(err, errBulkLookupUnsupported):
+			c.bulkLookup.Store(false)
+		default:
+			results := make([]ProductValidation, len(productIDs))
+			for i, id := range productIDs {
+				results[i] = ProductValidation{ProductID: id, Err: err}
+			}
+			return results
+		}
+	}
+
+	return validateConcurrently(ctx, productIDs, c.concurrency, func(productID string) ProductValidation {
+		product, err := c.GetProduct(ctx, productID, authToken)
+		return newProductValidation(productID, product, err)
+	})
+}
+
+// getProducts fetches products with GET /products?ids=, keyed by canonical
+// product ID. Products missing from the response do not exist, nor do IDs
+// outside the client's ID scheme, which are not requested.
+func (c *ProductServiceClient) getProducts(ctx context.Context, productIDs []string, authToken string) (map[string]*ProductResponse, error) {
+	if c.baseURL == "" {
+		return nil, fmt.Errorf("product service URL not configured")
+	}
+
+	ids := make([]string, 0, len(productIDs))
+	for _, productID := range productIDs {
+		if id, err := c.idScheme.Normalize(productID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return map[string]*ProductResponse{}, nil
+	}
+
+	query := url.Values{"ids": {strings.Join(ids, ",")}}
+	resp, err := c.get(ctx, c.baseURL+"/products?"+query.Encode(), authToken)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, errBulkLookupUnsupported
+	default:
+		return nil, fmt.Errorf("%w: status %d", ErrProductServiceUnavailable, resp.StatusCode)
+	}
+
+	var list ProductListResponse
+	if err := json.Unmarshal(resp.Body, &list); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse product list response: %v", ErrProductServiceUnavailable, err)
+	}
+
+	products := make(map[string]*ProductResponse, len(list.Data))
+	for i := range list.Data {
+		products[canonicalProductID(string(list.Data[i].ID))] = &list.Data[i]
+	}
+	return products, nil
+}
+
+// validateConcurrently runs validate for every product ID with at most limit
+// running at once. Products not started before ctx is done fail with the
+// context's error.
+func validateConcurrently(ctx context.Context, productIDs []string, limit int, validate func(productID string) ProductValidation) []ProductValidation {
+	if limit < 1 {
+		limit = 1
+	}
+	results := make([]ProductValidation, len(productIDs))
+	semaphore := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+
+	for i, id := range productIDs {
+		if ctx.Err() == nil {
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			results[i] = ProductValidation{ProductID: id, Err: fmt.Errorf("%w: %w", ErrProductServiceUnavailable, ctx.Err())}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i] = validate(id)
+		}(i, id)
+	}
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCatalogServer serves products 1 and 2 (2 is unavailable) by ID and, when
+// bulk is set, as a list from GET /products?ids=. It counts requests and the
+// highest number of requests in flight at once.
+func newCatalogServer(t *testing.T, bulk bool, requests, maxInFlight *atomic.Int32) *httptest.Server {
+	catalog := map[string]ProductResponse{
+		"1": {ID: "1", Name: "Laptop", Price: usd(99999), Availability: true},
+		"2": {ID: "2", Name: "Lamp", Price: usd(4999), Availability: false},
+	}
+	var inFlight atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			max := maxInFlight.Load()
+			if n <= max || maxInFlight.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		if r.URL.Path == "/products" {
+			if !bulk {
+				http.NotFound(w, r)
+				return
+			}
+			list := ProductListResponse{Data: []ProductResponse{}}
+			for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+				if product, ok := catalog[id]; ok {
+					list.Data = append(list.Data, product)
+				}
+			}
+			list.Count = len(list.Data)
+			json.NewEncoder(w).Encode(list)
+			return
+		}
+
+		product, ok := catalog[strings.TrimPrefix(r.URL.Path, "/products/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(product)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// checkCatalogResults verifies the validation results for IDs 1, 2 and 3
+func checkCatalogResults(t *testing.T, results []ProductValidation) {
+	t.Helper()
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for i, id := range []string{"1", "2", "3"} {
+		if results[i].ProductID != id {
+			t.Errorf("Expected result %d for product %s, got %s", i, id, results[i].ProductID)
+		}
+	}
+	if results[0].Err != nil || results[0].Product.Price != usd(99999) {
+		t.Errorf("Expected product 1 to be valid, got %+v", results[0])
+	}
+	if results[1].Err == nil || results[1].Product == nil || errors.Is(results[1].Err, ErrProductNotFound) {
+		t.Errorf("Expected product 2 to be found but unavailable, got %+v", results[1])
+	}
+	if !errors.Is(results[2].Err, ErrProductNotFound) {
+		t.Errorf("Expected product 3 to be not found, got %v", results[2].Err)
+	}
+}
+
+func TestValidateProducts_BoundedConcurrency(t *testing.T) {
+	var requests, maxInFlight atomic.Int32
+	server := newCatalogServer(t, false, &requests, &maxInFlight)
+
+	client := NewProductServiceClient(server.URL, "", WithValidationConcurrency(2))
+	ids := make([]string, 10)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i%3 + 1)
+	}
+	results := client.ValidateProducts(context.Background(), ids, "")
+
+	checkCatalogResults(t, results[:3])
+	if requests.Load() != 10 {
+		t.Errorf("Expected 10 requests, got %d", requests.Load())
+	}
+	if maxInFlight.Load() > 2 {
+		t.Errorf("Expected at most 2 requests in flight, got %d", maxInFlight.Load())
+	}
+}
+
+func TestValidateProducts_BulkLookup(t *testing.T) {
+	var requests, maxInFlight atomic.Int32
+	server := newCatalogServer(t, true, &requests, &maxInFlight)
+
+	client := NewProductServiceClient(server.URL, "", WithBulkLookup())
+	checkCatalogResults(t, client.ValidateProducts(context.Background(), []string{"1", "2", "3"}, ""))
+
+	if requests.Load() != 1 {
+		t.Errorf("Expected a single bulk request, got %d", requests.Load())
+	}
+}
+
+func TestValidateProducts_FallsBackWithoutBulkLookup(t *testing.T) {
+	var requests, maxInFlight atomic.Int32
+	server := newCatalogServer(t, false, &requests, &maxInFlight)
+
+	client := NewProductServiceClient(server.URL, "", WithBulkLookup())
+	checkCatalogResults(t, client.ValidateProducts(context.Background(), []string{"1", "2", "3"}, ""))
+	if requests.Load() != 4 {
+		t.Fatalf("Expected a failed bulk request and 3 lookups, got %d requests", requests.Load())
+	}
+
+	// The bulk endpoint is not tried again
+	requests.Store(0)
+	client.ValidateProducts(context.Background(), []string{"1", "2"}, "")
+	if requests.Load() != 2 {
+		t.Errorf("Expected 2 lookups, got %d requests", requests.Load())
+	}
+}
+
+func TestValidateProducts_CanceledContext(t *testing.T) {
+	var requests, maxInFlight atomic.Int32
+	server := newCatalogServer(t, false, &requests, &maxInFlight)
+
+	client := NewProductServiceClient(server.URL, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, result := range client.ValidateProducts(ctx, []string{"1", "2"}, "") {
+		if !errors.Is(result.Err, ErrProductServiceUnavailable) {
+			t.Errorf("Expected ErrProductServiceUnavailable, got %v", result.Err)
+		}
+	}
+	if requests.Load() != 0 {
+		t.Errorf("Expected no requests after cancellation, got %d", requests.Load())
+	}
+}
+
+func TestCachingProductClient_ValidateProducts(t *testing.T) {
+	var batches [][]string
+	next := &MockProductServiceClient{
+		ValidateProductsFunc: func(ctx context.Context, productIDs []string, authToken string) []ProductValidation {
+			batches = append(batches, productIDs)
+			results := make([]ProductValidation, len(productIDs))
+			for i, id := range productIDs {
+				switch id {
+				case "1":
+					results[i] = newProductValidation(id, &ProductResponse{ID: "1", Name: "Laptop", Price: usd(99999), Availability: true}, nil)
+				case "2":
+					results[i] = newProductValidation(id, &ProductResponse{ID: "2", Name: "Lamp", Price: usd(4999)}, nil)
+				default:
+					results[i] = newProductValidation(id, nil, ErrProductNotFound)
+				}
+			}
+			return results
+		},
+	}
+	client := NewCachingProductClient(next, time.Minute, time.Minute)
+
+	checkCatalogResults(t, client.ValidateProducts(context.Background(), []string{"1", "2", "3"}, ""))
+	checkCatalogResults(t, client.ValidateProducts(context.Background(), []string{"1", "2", "3"}, ""))
+	client.ValidateProducts(context.Background(), []string{"1", "4", "4"}, "")
+
+	if len(batches) != 2 || strings.Join(batches[0], ",") != "1,2,3" || strings.Join(batches[1], ",") != "4" {
+		t.Errorf("Expected only uncached products to be fetched once each, got %v", batches)
+	}
+	if stats := client.Stats(); stats.Hits != 4 || stats.Misses != 4 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+// sqlMigration is one versioned, forward-only schema change
+type sqlMigration struct {
+	version     int
+	description string
+	statements  []string
+	// migrate, if set, runs after the statements for data changes that SQL
+	// alone cannot make
+	migrate func(tx *sql.Tx) error
+}
+
+// orderMigrations lists the order store schema history. Migrations are applied
+// in order and must never be edited once released; add a new version instead.
+var orderMigrations = []sqlMigration{
+	{
+		version:     1,
+		description: "create orders, order lines and ownership tables",
+		statements: []string{
+			`CREATE TABLE orders (
+				id          TEXT PRIMARY KEY,
+				total_price REAL NOT NULL,
+				order_date  TEXT NOT NULL,
+				status      TEXT NOT NULL
+			)`,
+			`CREATE TABLE order_lines (
+				order_id   TEXT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+				line_no    INTEGER NOT NULL,
+				product_id TEXT NOT NULL,
+				quantity   INTEGER NOT NULL CHECK (quantity > 0),
+				PRIMARY KEY (order_id, line_no)
+			)`,
+			`CREATE TABLE order_owners (
+				order_id TEXT PRIMARY KEY REFERENCES orders(id) ON DELETE CASCADE,
+				user_id  TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_order_owners_user_id ON order_owners(user_id)`,
+		},
+	},
+	{
+		version:     2,
+		description: "add order version for optimistic concurrency control",
+		statements: []string{
+			`ALTER TABLE orders ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		},
+	},
+	{
+		version:     3,
+		description: "store the order owner on the order row",
+		statements: []string{
+			`ALTER TABLE orders ADD COLUMN user_id TEXT NOT NULL DEFAULT ''`,
+			`UPDATE orders SET user_id = COALESCE(
+				(SELECT user_id FROM order_owners WHERE order_owners.order_id = orders.id), '')`,
+			`DROP TABLE order_owners`,
+			`CREATE INDEX idx_orders_user_id ON orders(user_id)`,
+		},
+	},
+	{
+		version:     4,
+		description: "store order dates in sortable UTC form and index listing sort keys",
+		statements: []string{
+			// Earlier rows used RFC 3339 with the server's offset; strftime
+			// normalizes them to UTC (keeping millisecond precision)
+			`UPDATE orders SET order_date = strftime('%Y-%m-%dT%H:%M:%f000000Z', order_date)`,
+			`CREATE INDEX idx_orders_order_date ON orders(order_date, id)`,
+			`CREATE INDEX idx_orders_total_price ON orders(total_price, id)`,
+		},
+	},
+	{
+		version:     5,
+		description: "capture product name, unit price and line total on order lines",
+		statements: []string{
+			// Existing lines are left without a snapshot and are priced the
+			// next time their order's products are updated
+			`ALTER TABLE order_lines ADD COLUMN product_name TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE order_lines ADD COLUMN unit_price REAL NOT NULL DEFAULT 0`,
+			`ALTER TABLE order_lines ADD COLUMN line_total REAL NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		version:     6,
+		description: "store prices as integer minor units",
+		statements: []string{
+			`ALTER TABLE orders ADD COLUMN total_price_minor INTEGER NOT NULL DEFAULT 0`,
+			`UPDATE orders SET total_price_minor = CAST(ROUND(total_price * 100) AS INTEGER)`,
+			`DROP INDEX idx_orders_total_price`,
+			`ALTER TABLE orders DROP COLUMN total_price`,
+			`CREATE INDEX idx_orders_total_price_minor ON orders(total_price_minor, id)`,
+			`ALTER TABLE order_lines ADD COLUMN unit_price_minor INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE order_lines ADD COLUMN line_total_minor INTEGER NOT NULL DEFAULT 0`,
+			`UPDATE order_lines SET
+				unit_price_minor = CAST(ROUND(unit_price * 100) AS INTEGER),
+				line_total_minor = CAST(ROUND(line_total * 100) AS INTEGER)`,
+			`ALTER TABLE order_lines DROP COLUMN unit_price`,
+			`ALTER TABLE order_lines DROP COLUMN line_total`,
+		},
+	},
+	{
+		version:     7,
+		description: "record loyalty points awarded on submission",
+		statements: []string{
+			`ALTER TABLE orders ADD COLUMN accrued_loyalty_points INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		version:     8,
+		description: "record loyalty award and reversal transactions",
+		statements: []string{
+			`ALTER TABLE orders ADD COLUMN loyalty_transaction_id TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE orders ADD COLUMN loyalty_reversal_id TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version:     9,
+		description: "create order discounts table",
+		statements: []string{
+			`CREATE TABLE order_discounts (
+				order_id       TEXT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+				line_no        INTEGER NOT NULL,
+				type           TEXT NOT NULL,
+				points         INTEGER NOT NULL DEFAULT 0,
+				amount_minor   INTEGER NOT NULL,
+				reservation_id TEXT NOT NULL DEFAULT '',
+				redemption_id  TEXT NOT NULL DEFAULT '',
+				refund_id      TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (order_id, line_no)
+			)`,
+		},
+	},
+	{
+		version:     10,
+		description: "create order outbox table",
+		statements: []string{
+			// seq orders messages by when they were written; AUTOINCREMENT keeps
+			// it from reusing the sequence numbers of pruned messages
+			`CREATE TABLE order_outbox (
+				seq             INTEGER PRIMARY KEY AUTOINCREMENT,
+				id              TEXT NOT NULL UNIQUE,
+				type            TEXT NOT NULL,
+				order_id        TEXT NOT NULL,
+				actor           TEXT NOT NULL DEFAULT '',
+				status          TEXT NOT NULL,
+				attempts        INTEGER NOT NULL DEFAULT 0,
+				last_error      TEXT NOT NULL DEFAULT '',
+				created_at      TEXT NOT NULL,
+				next_attempt_at TEXT NOT NULL,
+				delivered_at    TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX idx_order_outbox_status ON order_outbox(status, seq)`,
+		},
+	},
+	{
+		version:     11,
+		description: "create order events table",
+		statements: []string{
+			`CREATE TABLE order_events (
+				order_id    TEXT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+				sequence    INTEGER NOT NULL,
+				id          TEXT NOT NULL UNIQUE,
+				type        TEXT NOT NULL,
+				actor       TEXT NOT NULL DEFAULT '',
+				timestamp   TEXT NOT NULL,
+				before_json TEXT NOT NULL DEFAULT '',
+				after_json  TEXT NOT NULL,
+				PRIMARY KEY (order_id, sequence)
+			)`,
+		},
+		migrate: recordExistingOrderHistory,
+	},
+}
+
+// recordExistingOrderHistory starts the history of every order stored before
+// migration 11 with an OrderCreated event. Like the statements of a migration,
+// its queries name the columns as they are at version 11 rather than reusing
+// the repository's, so later schema changes cannot break it.
+func recordExistingOrderHistory(tx *sql.Tx) error {
+	var orders []*models.Order
+	byID := make(map[string]*models.Order)
+	rows, err := tx.Query(`SELECT id, user_id, total_price_minor, accrued_loyalty_points, loyalty_transaction_id, loyalty_reversal_id, order_date, status, version FROM orders ORDER BY rowid`)
+	if err != nil {
+		return fmt.Errorf("failed to list orders: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		order := &models.Order{}
+		var orderDate string
+		if err := rows.Scan(&order.ID, &order.UserID, &order.TotalPrice, &order.AccruedLoyaltyPoints, &order.LoyaltyTransactionID, &order.LoyaltyReversalID, &orderDate, &order.Status, &order.Version); err != nil {
+			return fmt.Errorf("failed to scan order: %w", err)
+		}
+		if order.OrderDate, err = time.Parse(time.RFC3339Nano, orderDate); err != nil {
+			return fmt.Errorf("failed to parse order date: %w", err)
+		}
+		orders = append(orders, order)
+		byID[order.ID] = order
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list orders: %w", err)
+	}
+
+	lines, err := tx.Query(`SELECT order_id, product_id, quantity, product_name, unit_price_minor, line_total_minor FROM order_lines ORDER BY order_id, line_no`)
+	if err != nil {
+		return fmt.Errorf("failed to load order lines: %w", err)
+	}
+	defer lines.Close()
+	for lines.Next() {
+		var orderID string
+		var line models.OrderProduct
+		if err := lines.Scan(&orderID, &line.ProductID, &line.Quantity, &line.ProductName, &line.UnitPrice, &line.LineTotal); err != nil {
+			return fmt.Errorf("failed to scan order line: %w", err)
+		}
+		if order := byID[orderID]; order != nil {
+			order.Products = append(order.Products, line)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return fmt.Errorf("failed to load order lines: %w", err)
+	}
+
+	discounts, err := tx.Query(`SELECT order_id, type, points, amount_minor, reservation_id, redemption_id, refund_id FROM order_discounts ORDER BY order_id, line_no`)
+	if err != nil {
+		return fmt.Errorf("failed to load order discounts: %w", err)
+	}
+	defer discounts.Close()
+	for discounts.Next() {
+		var orderID string
+		var discount models.OrderDiscount
+		if err := discounts.Scan(&orderID, &discount.Type, &discount.Points, &discount.Amount, &discount.ReservationID, &discount.RedemptionID, &discount.RefundID); err != nil {
+			return fmt.Errorf("failed to scan order discount: %w", err)
+		}
+		if order := byID[orderID]; order != nil {
+			order.Discounts = append(order.Discounts, discount)
+		}
+	}
+	if err := discounts.Err(); err != nil {
+		return fmt.Errorf("failed to load order discounts: %w", err)
+	}
+
+	for _, order := range orders {
+		event := initialOrderEvent(order)
+		after, err := json.Marshal(event.After)
+		if err != nil {
+			return fmt.Errorf("failed to encode order event: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO order_events (order_id, sequence, id, type, actor, timestamp, before_json, after_json) VALUES (?, ?, ?, ?, ?, ?, '', ?)`,
+			event.OrderID, event.Sequence, event.ID, event.Type, event.Actor, formatSQLTime(event.Timestamp), string(after)); err != nil {
+			return fmt.Errorf("failed to insert order event: %w", err)
+		}
+	}
+	return nil
+}
+
+// MigrateOrderDB brings the order database schema up to the latest version.
+// Each migration runs in its own transaction together with the bookkeeping row
+// in schema_migrations, so a failed migration leaves the schema unchanged.
+func MigrateOrderDB(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range orderMigrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", m.version, err)
+		}
+		for _, stmt := range m.statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+			}
+		}
+		if m.migrate != nil {
+			if err := m.migrate(tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+			m.version, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", m.version, err)
+		}
+
+		log.Printf("Applied order database migration %d: %s", m.version, m.description)
+	}
+
+	return nil
+}
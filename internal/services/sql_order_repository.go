@@ -0,0 +1,546 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+
+	// Pure-Go SQLite driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+// SQLOrderRepository is an OutboxRepository backed by an SQL database. Orders,
+// their product lines, events and outbox messages live in separate tables;
+// every write runs in a single transaction so a failure never leaves
+// partially written lines, or an order change without its event or outbox
+// messages.
+type SQLOrderRepository struct {
+	db *sql.DB
+}
+
+// OpenSQLiteOrderDB opens the embedded SQLite database at path with foreign
+// keys enforced. Migrations are not applied; call MigrateOrderDB.
+func OpenSQLiteOrderDB(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create order database directory: %w", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open order database: %w", err)
+	}
+
+	// SQLite allows a single writer; funnel all access through one connection
+	// instead of surfacing SQLITE_BUSY to callers
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to order database: %w", err)
+	}
+	return db, nil
+}
+
+// NewSQLOrderRepository creates an order repository using an already migrated database
+func NewSQLOrderRepository(db *sql.DB) *SQLOrderRepository {
+	return &SQLOrderRepository{db: db}
+}
+
+// sqlTimeLayout stores timestamps in UTC with fixed-width fractional seconds
+// so that their text sorts and compares chronologically
+const sqlTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// formatSQLTime formats a timestamp for storage
+func formatSQLTime(t time.Time) string {
+	return t.UTC().Format(sqlTimeLayout)
+}
+
+// Get returns the order with the given ID. The order, its lines and its
+// discounts are read in one transaction, so a concurrent update is seen
+// either entirely or not at all.
+func (r *SQLOrderRepository) Get(id string) (*models.Order, error) {
+	var orders []models.Order
+	err := r.inTx(func(tx *sql.Tx) error {
+		var err error
+		orders, err = listOrders(tx, `WHERE id = ?`, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, ErrOrderNotFound
+	}
+	return &orders[0], nil
+}
+
+// List returns all orders in creation order
+func (r *SQLOrderRepository) List() ([]models.Order, error) {
+	var orders []models.Order
+	err := r.inTx(func(tx *sql.Tx) error {
+		var err error
+		orders, err = listOrders(tx, `ORDER BY rowid`)
+		return err
+	})
+	return orders, err
+}
+
+// Query returns a page of the orders matching q.Filter and the number of
+// matching orders. Filtering, ordering and paging are done by the database.
+func (r *SQLOrderRepository) Query(q OrderQuery) ([]models.Order, int, error) {
+	var conds []string
+	var args []any
+	if q.Filter.Status != "" {
+		conds = append(conds, `status = ?`)
+		args = append(args, q.Filter.Status)
+	}
+	if q.Filter.UserID != "" {
+		conds = append(conds, `user_id = ?`)
+		args = append(args, q.Filter.UserID)
+	}
+	if q.Filter.ProductID != "" {
+		conds = append(conds, `id IN (SELECT order_id FROM order_lines WHERE product_id = ?)`)
+		args = append(args, q.Filter.ProductID)
+	}
+	if !q.Filter.OrderDateFrom.IsZero() {
+		conds = append(conds, `order_date >= ?`)
+		args = append(args, formatSQLTime(q.Filter.OrderDateFrom))
+	}
+	if !q.Filter.OrderDateTo.IsZero() {
+		conds = append(conds, `order_date < ?`)
+		args = append(args, formatSQLTime(q.Filter.OrderDateTo))
+	}
+
+	column, direction, after := "order_date", "ASC", ">"
+	if q.SortBy == OrderSortByTotalPrice {
+		column = "total_price_minor"
+	}
+	if q.Descending {
+		direction, after = "DESC", "<"
+	}
+
+	pageConds := slices.Clone(conds)
+	pageArgs := slices.Clone(args)
+	if q.After != nil {
+		var value any = formatSQLTime(q.After.OrderDate)
+		if q.SortBy == OrderSortByTotalPrice {
+			value = q.After.TotalPrice
+		}
+		pageConds = append(pageConds, fmt.Sprintf(`(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))`, column, after))
+		pageArgs = append(pageArgs, value, value, q.After.ID)
+	}
+	page := fmt.Sprintf(`%s ORDER BY %s %s, id %s`, whereClause(pageConds), column, direction, direction)
+	if q.Limit > 0 {
+		page += ` LIMIT ?`
+		pageArgs = append(pageArgs, q.Limit)
+	}
+
+	var orders []models.Order
+	var total int
+	err := r.inTx(func(tx *sql.Tx) error {
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM orders `+whereClause(conds), args...).Scan(&total); err != nil {
+			return fmt.Errorf("failed to count orders: %w", err)
+		}
+		var err error
+		orders, err = listOrders(tx, page, pageArgs...)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return orders, total, nil
+}
+
+// whereClause joins conditions into a WHERE clause, or returns "" if there are none
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return `WHERE ` + strings.Join(conds, ` AND `)
+}
+
+// listOrders returns the orders selected by clause (conditions, ordering and
+// limit), with their lines, in the order given by the clause
+func listOrders(tx *sql.Tx, clause string, args ...any) ([]models.Order, error) {
+	rows, err := tx.Query(`SELECT id, user_id, total_price_minor, accrued_loyalty_points, loyalty_transaction_id, loyalty_reversal_id, order_date, status, version FROM orders `+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	for rows.Next() {
+		var order models.Order
+		var orderDate string
+		if err := rows.Scan(&order.ID, &order.UserID, &order.TotalPrice, &order.AccruedLoyaltyPoints, &order.LoyaltyTransactionID, &order.LoyaltyReversalID, &orderDate, &order.Status, &order.Version); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		if order.OrderDate, err = time.Parse(time.RFC3339Nano, orderDate); err != nil {
+			return nil, fmt.Errorf("failed to parse order date: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+
+	lines, err := loadOrderLines(tx, `WHERE order_id IN (SELECT id FROM orders `+clause+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	discounts, err := loadOrderDiscounts(tx, `WHERE order_id IN (SELECT id FROM orders `+clause+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		orders[i].Products = lines[orders[i].ID]
+		orders[i].Discounts = discounts[orders[i].ID]
+	}
+
+	return orders, nil
+}
+
+// loadOrderLines returns product lines grouped by order ID, in line order
+func loadOrderLines(tx *sql.Tx, where string, args ...any) (map[string][]models.OrderProduct, error) {
+	rows, err := tx.Query(`SELECT order_id, product_id, quantity, product_name, unit_price_minor, line_total_minor FROM order_lines `+where+` ORDER BY order_id, line_no`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load order lines: %w", err)
+	}
+	defer rows.Close()
+
+	lines := make(map[string][]models.OrderProduct)
+	for rows.Next() {
+		var orderID string
+		var line models.OrderProduct
+		if err := rows.Scan(&orderID, &line.ProductID, &line.Quantity, &line.ProductName, &line.UnitPrice, &line.LineTotal); err != nil {
+			return nil, fmt.Errorf("failed to scan order line: %w", err)
+		}
+		lines[orderID] = append(lines[orderID], line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load order lines: %w", err)
+	}
+	return lines, nil
+}
+
+// loadOrderDiscounts returns discounts grouped by order ID, in line order
+func loadOrderDiscounts(tx *sql.Tx, where string, args ...any) (map[string][]models.OrderDiscount, error) {
+	rows, err := tx.Query(`SELECT order_id, type, points, amount_minor, reservation_id, redemption_id, refund_id FROM order_discounts `+where+` ORDER BY order_id, line_no`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load order discounts: %w", err)
+	}
+	defer rows.Close()
+
+	discounts := make(map[string][]models.OrderDiscount)
+	for rows.Next() {
+		var orderID string
+		var discount models.OrderDiscount
+		if err := rows.Scan(&orderID, &discount.Type, &discount.Points, &discount.Amount, &discount.ReservationID, &discount.RedemptionID, &discount.RefundID); err != nil {
+			return nil, fmt.Errorf("failed to scan order discount: %w", err)
+		}
+		discounts[orderID] = append(discounts[orderID], discount)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load order discounts: %w", err)
+	}
+	return discounts, nil
+}
+
+// Create stores a new order, its lines, discounts and event in one transaction
+func (r *SQLOrderRepository) Create(order *models.Order, event *models.OrderEvent) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM orders WHERE id = ?`, order.ID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check order: %w", err)
+		}
+		if exists > 0 {
+			return ErrOrderAlreadyExists
+		}
+
+		if _, err := tx.Exec(`INSERT INTO orders (id, user_id, total_price_minor, accrued_loyalty_points, loyalty_transaction_id, loyalty_reversal_id, order_date, status, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			order.ID, order.UserID, order.TotalPrice, order.AccruedLoyaltyPoints, order.LoyaltyTransactionID, order.LoyaltyReversalID, formatSQLTime(order.OrderDate), order.Status, order.Version); err != nil {
+			return fmt.Errorf("failed to insert order: %w", err)
+		}
+		if err := insertOrderLines(tx, order); err != nil {
+			return err
+		}
+		if err := insertOrderDiscounts(tx, order); err != nil {
+			return err
+		}
+		return insertOrderEvent(tx, event)
+	})
+}
+
+// Update replaces the order row and all of its lines and discounts, and
+// appends its event, in one transaction
+func (r *SQLOrderRepository) Update(order *models.Order, event *models.OrderEvent) error {
+	return r.UpdateWithOutbox(order, event, nil)
+}
+
+// UpdateWithOutbox replaces the order like Update and inserts messages into
+// the outbox in the same transaction
+func (r *SQLOrderRepository) UpdateWithOutbox(order *models.Order, event *models.OrderEvent, messages []models.OutboxMessage) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE orders SET user_id = ?, total_price_minor = ?, accrued_loyalty_points = ?, loyalty_transaction_id = ?, loyalty_reversal_id = ?, order_date = ?, status = ?, version = ? WHERE id = ?`,
+			order.UserID, order.TotalPrice, order.AccruedLoyaltyPoints, order.LoyaltyTransactionID, order.LoyaltyReversalID, formatSQLTime(order.OrderDate), order.Status, order.Version, order.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update order: %w", err)
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to update order: %w", err)
+		} else if n == 0 {
+			return ErrOrderNotFound
+		}
+
+		if _, err := tx.Exec(`DELETE FROM order_lines WHERE order_id = ?`, order.ID); err != nil {
+			return fmt.Errorf("failed to clear order lines: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM order_discounts WHERE order_id = ?`, order.ID); err != nil {
+			return fmt.Errorf("failed to clear order discounts: %w", err)
+		}
+		if err := insertOrderLines(tx, order); err != nil {
+			return err
+		}
+		if err := insertOrderDiscounts(tx, order); err != nil {
+			return err
+		}
+		if err := insertOrderEvent(tx, event); err != nil {
+			return err
+		}
+		return insertOutboxMessages(tx, messages)
+	})
+}
+
+// Delete removes an order; its lines and events are removed by cascade
+func (r *SQLOrderRepository) Delete(id string) error {
+	result, err := r.db.Exec(`DELETE FROM orders WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete order: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete order: %w", err)
+	} else if n == 0 {
+		return ErrOrderNotFound
+	}
+	return nil
+}
+
+// insertOrderLines writes the order's product lines, numbered in slice order
+func insertOrderLines(tx *sql.Tx, order *models.Order) error {
+	for i, product := range order.Products {
+		if _, err := tx.Exec(`INSERT INTO order_lines (order_id, line_no, product_id, quantity, product_name, unit_price_minor, line_total_minor) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			order.ID, i, product.ProductID, product.Quantity, product.ProductName, product.UnitPrice, product.LineTotal); err != nil {
+			return fmt.Errorf("failed to insert order line %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// insertOrderDiscounts writes the order's discounts, numbered in slice order
+func insertOrderDiscounts(tx *sql.Tx, order *models.Order) error {
+	for i, discount := range order.Discounts {
+		if _, err := tx.Exec(`INSERT INTO order_discounts (order_id, line_no, type, points, amount_minor, reservation_id, redemption_id, refund_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			order.ID, i, discount.Type, discount.Points, discount.Amount, discount.ReservationID, discount.RedemptionID, discount.RefundID); err != nil {
+			return fmt.Errorf("failed to insert order discount %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// insertOrderEvent appends event, if not nil, to its order's history with the
+// next sequence number
+func insertOrderEvent(tx *sql.Tx, event *models.OrderEvent) error {
+	if event == nil {
+		return nil
+	}
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(sequence), 0) + 1 FROM order_events WHERE order_id = ?`, event.OrderID).Scan(&event.Sequence); err != nil {
+		return fmt.Errorf("failed to number order event: %w", err)
+	}
+
+	var before []byte
+	if event.Before != nil {
+		var err error
+		if before, err = json.Marshal(event.Before); err != nil {
+			return fmt.Errorf("failed to encode order event: %w", err)
+		}
+	}
+	after, err := json.Marshal(event.After)
+	if err != nil {
+		return fmt.Errorf("failed to encode order event: %w", err)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO order_events (order_id, sequence, id, type, actor, timestamp, before_json, after_json) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.OrderID, event.Sequence, event.ID, event.Type, event.Actor, formatSQLTime(event.Timestamp), string(before), string(after)); err != nil {
+		return fmt.Errorf("failed to insert order event: %w", err)
+	}
+	return nil
+}
+
+// ListEvents returns the events recorded for an order in sequence order
+func (r *SQLOrderRepository) ListEvents(orderID string) ([]models.OrderEvent, error) {
+	rows, err := r.db.Query(`SELECT order_id, sequence, id, type, actor, timestamp, before_json, after_json FROM order_events WHERE order_id = ? ORDER BY sequence`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load order events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.OrderEvent{}
+	for rows.Next() {
+		var event models.OrderEvent
+		var timestamp, before, after string
+		if err := rows.Scan(&event.OrderID, &event.Sequence, &event.ID, &event.Type, &event.Actor, &timestamp, &before, &after); err != nil {
+			return nil, fmt.Errorf("failed to scan order event: %w", err)
+		}
+		if event.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp); err != nil {
+			return nil, fmt.Errorf("failed to parse order event time: %w", err)
+		}
+		if before != "" {
+			event.Before = &models.Order{}
+			if err := json.Unmarshal([]byte(before), event.Before); err != nil {
+				return nil, fmt.Errorf("failed to parse order event: %w", err)
+			}
+		}
+		event.After = &models.Order{}
+		if err := json.Unmarshal([]byte(after), event.After); err != nil {
+			return nil, fmt.Errorf("failed to parse order event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load order events: %w", err)
+	}
+	return events, nil
+}
+
+// insertOutboxMessages appends messages to the outbox
+func insertOutboxMessages(tx *sql.Tx, messages []models.OutboxMessage) error {
+	for _, message := range messages {
+		if _, err := tx.Exec(`INSERT INTO order_outbox (id, type, order_id, actor, status, attempts, last_error, created_at, next_attempt_at, delivered_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			message.ID, message.Type, message.OrderID, message.Actor, message.Status, message.Attempts, message.LastError,
+			formatSQLTime(message.CreatedAt), formatSQLTime(message.NextAttemptAt), formatOptionalSQLTime(message.DeliveredAt)); err != nil {
+			return fmt.Errorf("failed to insert outbox message %s: %w", message.ID, err)
+		}
+	}
+	return nil
+}
+
+// formatOptionalSQLTime formats a timestamp for storage, or returns "" for nil
+func formatOptionalSQLTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatSQLTime(*t)
+}
+
+// ListOutbox returns the outbox messages with status, or all messages if
+// status is empty, in the order they were written
+func (r *SQLOrderRepository) ListOutbox(status models.OutboxStatus) ([]models.OutboxMessage, error) {
+	var conds []string
+	var args []any
+	if status != "" {
+		conds = append(conds, `status = ?`)
+		args = append(args, status)
+	}
+	return r.loadOutbox(whereClause(conds)+` ORDER BY seq`, args...)
+}
+
+// GetOutbox returns the outbox message with the given ID
+func (r *SQLOrderRepository) GetOutbox(id string) (*models.OutboxMessage, error) {
+	messages, err := r.loadOutbox(`WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrOutboxMessageNotFound
+	}
+	return &messages[0], nil
+}
+
+// loadOutbox returns the outbox messages selected by clause
+func (r *SQLOrderRepository) loadOutbox(clause string, args ...any) ([]models.OutboxMessage, error) {
+	rows, err := r.db.Query(`SELECT id, type, order_id, actor, status, attempts, last_error, created_at, next_attempt_at, delivered_at FROM order_outbox `+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load outbox messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.OutboxMessage{}
+	for rows.Next() {
+		var message models.OutboxMessage
+		var createdAt, nextAttemptAt, deliveredAt string
+		if err := rows.Scan(&message.ID, &message.Type, &message.OrderID, &message.Actor, &message.Status, &message.Attempts, &message.LastError, &createdAt, &nextAttemptAt, &deliveredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		if message.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return nil, fmt.Errorf("failed to parse outbox message time: %w", err)
+		}
+		if message.NextAttemptAt, err = time.Parse(time.RFC3339Nano, nextAttemptAt); err != nil {
+			return nil, fmt.Errorf("failed to parse outbox message time: %w", err)
+		}
+		if deliveredAt != "" {
+			t, err := time.Parse(time.RFC3339Nano, deliveredAt)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse outbox message time: %w", err)
+			}
+			message.DeliveredAt = &t
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load outbox messages: %w", err)
+	}
+	return messages, nil
+}
+
+// SaveOutbox replaces the delivery state of a stored outbox message
+func (r *SQLOrderRepository) SaveOutbox(message *models.OutboxMessage) error {
+	result, err := r.db.Exec(`UPDATE order_outbox SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ?, delivered_at = ? WHERE id = ?`,
+		message.Status, message.Attempts, message.LastError, formatSQLTime(message.NextAttemptAt), formatOptionalSQLTime(message.DeliveredAt), message.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update outbox message: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update outbox message: %w", err)
+	} else if n == 0 {
+		return ErrOutboxMessageNotFound
+	}
+	return nil
+}
+
+// PruneOutbox removes the outbox messages delivered before deliveredBefore
+func (r *SQLOrderRepository) PruneOutbox(deliveredBefore time.Time) (int, error) {
+	result, err := r.db.Exec(`DELETE FROM order_outbox WHERE status = ? AND delivered_at < ?`,
+		models.OutboxStatusDelivered, formatSQLTime(deliveredBefore))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", err)
+	}
+	return int(n), nil
+}
+
+// inTx runs fn in a transaction, committing only if it returns nil
+func (r *SQLOrderRepository) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Bitovi/example-go-server/internal/models"
+)
+
+func newTestSQLRepo(t *testing.T) *SQLOrderRepository {
+	t.Helper()
+	db, err := OpenSQLiteOrderDB(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := MigrateOrderDB(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return NewSQLOrderRepository(db)
+}
+
+func TestMigrateOrderDB_Idempotent(t *testing.T) {
+	repo := newTestSQLRepo(t)
+
+	// Running migrations again must be a no-op
+	if err := MigrateOrderDB(repo.db); err != nil {
+		t.Fatalf("Expected no error on second migration run, got %v", err)
+	}
+
+	var version int
+	repo.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if version != orderMigrations[len(orderMigrations)-1].version {
+		t.Errorf("Expected schema version %d, got %d", orderMigrations[len(orderMigrations)-1].version, version)
+	}
+}
+
+func TestSQLOrderRepository_CreateGetList(t *testing.T) {
+	repo := newTestSQLRepo(t)
+
+	order := newTestOrder("order-1", 2)
+	order.UserID = "user-1"
+	order.AccruedLoyaltyPoints = 13
+	order.Products = append(order.Products, models.OrderProduct{ProductID: "prod-2", Quantity: 3, ProductName: "Lamp", UnitPrice: usd(4999), LineTotal: usd(14997)})
+	if err := repo.Create(order, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo.Create(newTestOrder("order-2", 1), nil)
+
+	stored, err := repo.Get("order-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(stored.Products) != 2 || stored.Products[1] != order.Products[1] {
+		t.Errorf("Expected product lines to round trip in order, got %+v", stored.Products)
+	}
+	if stored.UserID != order.UserID || stored.TotalPrice != order.TotalPrice || !stored.OrderDate.Equal(order.OrderDate) ||
+		stored.Status != order.Status || stored.Version != order.Version || stored.AccruedLoyaltyPoints != order.AccruedLoyaltyPoints {
+		t.Errorf("Expected %+v, got %+v", order, stored)
+	}
+
+	orders, err := repo.List()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(orders) != 2 || orders[0].ID != "order-1" || orders[1].ID != "order-2" {
+		t.Errorf("Expected orders in creation order, got %+v", orders)
+	}
+
+	owned, _, err := repo.Query(OrderQuery{Filter: OrderFilter{UserID: "user-1"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(owned) != 1 || owned[0].ID != "order-1" || len(owned[0].Products) != 2 {
+		t.Errorf("Expected only order-1 with its lines, got %+v", owned)
+	}
+}
+
+func TestSQLOrderRepository_Discounts(t *testing.T) {
+	repo := newTestSQLRepo(t)
+
+	order := newTestOrder("order-1", 2)
+	order.Discounts = []models.OrderDiscount{{Type: models.DiscountLoyaltyPoints, Points: 500, Amount: usd(500), ReservationID: "res-1"}}
+	if err := repo.Create(order, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	order.Discounts[0].RedemptionID = "txn-1"
+	if err := repo.Update(order, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	stored, _ := repo.Get("order-1")
+	if len(stored.Discounts) != 1 || stored.Discounts[0] != order.Discounts[0] {
+		t.Errorf("Expected the discount to round trip, got %+v", stored.Discounts)
+	}
+
+	order.Discounts = nil
+	repo.Update(order, nil)
+	listed, _, _ := repo.Query(OrderQuery{})
+	if len(listed) != 1 || len(listed[0].Discounts) != 0 {
+		t.Errorf("Expected the discount to be removed, got %+v", listed)
+	}
+}
+
+func TestSQLOrderRepository_UpdateIsTransactional(t *testing.T) {
+	repo := newTestSQLRepo(t)
+	repo.Create(newTestOrder("order-1", 2), nil)
+
+	// The second line violates the quantity check after the first line has been
+	// written; the whole update must roll back
+	broken := newTestOrder("order-1", 2)
+	broken.Status = models.OrderStatusProcessing
+	broken.Products = []models.OrderProduct{
+		{ProductID: "prod-9", Quantity: 4},
+		{ProductID: "prod-10", Quantity: 0},
+	}
+	if err := repo.Update(broken, nil); err == nil {
+		t.Fatal("Expected error for invalid line, got nil")
+	}
+
+	stored, _ := repo.Get("order-1")
+	if stored.Status != models.OrderStatusPending {
+		t.Errorf("Expected status to remain PENDING, got %s", stored.Status)
+	}
+	if len(stored.Products) != 1 || stored.Products[0].ProductID != "prod-1" || stored.Products[0].Quantity != 2 {
+		t.Errorf("Expected original lines to be intact, got %+v", stored.Products)
+	}
+}
+
+func TestSQLOrderRepository_GetIsConsistent(t *testing.T) {
+	repo := newTestSQLRepo(t)
+	repo.Create(newTestOrder("order-1", 1), nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for quantity := 2; quantity <= 200; quantity++ {
+			repo.Update(newTestOrder("order-1", quantity), nil)
+		}
+	}()
+
+	// Every read sees the lines and total of the same update
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		order, err := repo.Get("order-1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if want := usd(int64(order.Products[0].Quantity) * 1000); order.TotalPrice != want {
+			t.Fatalf("Expected total %s for quantity %d, got %s", want, order.Products[0].Quantity, order.TotalPrice)
+		}
+	}
+}
+
+func TestSQLOrderRepository_DeleteCascades(t *testing.T) {
+	repo := newTestSQLRepo(t)
+	repo.Create(newTestOrder("order-1", 2), nil)
+
+	if err := repo.Delete("order-1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var lines int
+	repo.db.QueryRow(`SELECT COUNT(*) FROM order_lines`).Scan(&lines)
+	if lines != 0 {
+		t.Errorf("Expected lines to be removed, got %d lines", lines)
+	}
+}
+
+func TestSQLOrderRepository_TypedErrors(t *testing.T) {
+	repo := newTestSQLRepo(t)
+
+	if _, err := repo.Get("missing"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+	if err := repo.Update(newTestOrder("missing", 1), nil); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+	if err := repo.Delete("missing"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+	repo.Create(newTestOrder("order-1", 1), nil)
+	if err := repo.Create(newTestOrder("order-1", 1), nil); !errors.Is(err, ErrOrderAlreadyExists) {
+		t.Errorf("Expected ErrOrderAlreadyExists, got %v", err)
+	}
+}
+
+func TestOrderService_WithSQLRepository(t *testing.T) {
+	repo := newTestSQLRepo(t)
+	mockClient := &MockProductServiceClient{
+		ValidateProductFunc: func(ctx context.Context, productID string, authToken string) (models.Money, string, error) {
+			if productID == "invalid" {
+				return models.Money{}, "", ErrProductNotFound
+			}
+			return usd(2500), "Product", nil
+		},
+	}
+	service := NewOrderService(repo, mockClient)
+
+	order, err := service.CreateOrder(context.Background(), "user-123", []models.OrderProduct{{ProductID: "prod-1", Quantity: 2}}, "", "test-admin")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// A failed product validation must not write any line items
+	if _, err := service.UpdateOrderProducts(context.Background(), order.ID, []models.OrderProduct{
+		{ProductID: "prod-1", Quantity: 5},
+		{ProductID: "invalid", Quantity: 1},
+	}, "", "test-admin", AnyVersion); !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("Expected ErrProductNotFound, got %v", err)
+	}
+
+	stored, _ := repo.Get(order.ID)
+	if len(stored.Products) != 1 || stored.Products[0].Quantity != 2 {
+		t.Errorf("Expected order to be unchanged, got %+v", stored.Products)
+	}
+	if stored.TotalPrice != usd(5000) {
+		t.Errorf("Expected total price 50.00, got %s", stored.TotalPrice)
+	}
+}
+
+func TestMigrateOrderDB_MovesOwnersOntoOrders(t *testing.T) {
+	db, err := OpenSQLiteOrderDB(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Bring the schema up to the version that still had the order_owners table
+	allMigrations := orderMigrations
+	orderMigrations = allMigrations[:2]
+	err = MigrateOrderDB(db)
+	orderMigrations = allMigrations
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Exec(`INSERT INTO orders (id, total_price, order_date, status) VALUES ('order-1', 10, '2026-01-14T12:00:00Z', 'PENDING')`)
+	db.Exec(`INSERT INTO orders (id, total_price, order_date, status) VALUES ('order-2', 10, '2026-01-14T12:00:00Z', 'PENDING')`)
+	db.Exec(`INSERT INTO order_owners (order_id, user_id) VALUES ('order-1', 'user-1')`)
+
+	if err := MigrateOrderDB(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	repo := NewSQLOrderRepository(db)
+	first, _ := repo.Get("order-1")
+	second, _ := repo.Get("order-2")
+	if first.UserID != "user-1" || second.UserID != "" {
+		t.Errorf("Expected owners user-1 and none, got %q and %q", first.UserID, second.UserID)
+	}
+}
+
+func TestMigrateOrderDB_NormalizesOrderDates(t *testing.T) {
+	db, err := OpenSQLiteOrderDB(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	allMigrations := orderMigrations
+	orderMigrations = allMigrations[:3]
+	err = MigrateOrderDB(db)
+	orderMigrations = allMigrations
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	// Dates written by earlier versions kept the server's UTC offset
+	db.Exec(`INSERT INTO orders (id, total_price, order_date, status) VALUES ('order-1', 10, '2026-01-14T13:00:00.123456789+01:00', 'PENDING')`)
+
+	if err := MigrateOrderDB(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	var stored string
+	db.QueryRow(`SELECT order_date FROM orders WHERE id = 'order-1'`).Scan(&stored)
+	if stored != "2026-01-14T12:00:00.123000000Z" {
+		t.Errorf("Expected normalized UTC date, got %q", stored)
+	}
+	order, err := NewSQLOrderRepository(db).Get("order-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !order.OrderDate.Equal(time.Date(2026, 1, 14, 12, 0, 0, 123000000, time.UTC)) {
+		t.Errorf("Expected order date to be preserved, got %v", order.OrderDate)
+	}
+}
+
+func TestMigrateOrderDB_LeavesExistingLinesUnpriced(t *testing.T) {
+	db, err := OpenSQLiteOrderDB(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	allMigrations := orderMigrations
+	orderMigrations = allMigrations[:4]
+	err = MigrateOrderDB(db)
+	orderMigrations = allMigrations
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Exec(`INSERT INTO orders (id, total_price, order_date, status) VALUES ('order-1', 10, '2026-01-14T12:00:00Z', 'PENDING')`)
+	db.Exec(`INSERT INTO order_lines (order_id, line_no, product_id, quantity) VALUES ('order-1', 0, 'prod-1', 2)`)
+
+	if err := MigrateOrderDB(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	order, err := NewSQLOrderRepository(db).Get("order-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(order.Products) != 1 || order.Products[0].Quantity != 2 || order.Products[0].HasPriceSnapshot() {
+		t.Errorf("Expected an unpriced line, got %+v", order.Products)
+	}
+}
+
+func TestMigrateOrderDB_ConvertsPricesToMinorUnits(t *testing.T) {
+	db, err := OpenSQLiteOrderDB(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	allMigrations := orderMigrations
+	orderMigrations = allMigrations[:5]
+	err = MigrateOrderDB(db)
+	orderMigrations = allMigrations
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	// Prices were stored as REAL, so 1359.97 was only approximately stored
+	db.Exec(`INSERT INTO orders (id, total_price, order_date, status) VALUES ('order-1', 1359.97, '2026-01-14T12:00:00Z', 'PENDING')`)
+	db.Exec(`INSERT INTO order_lines (order_id, line_no, product_id, quantity, product_name, unit_price, line_total) VALUES ('order-1', 0, 'prod-1', 1, 'Laptop', 1299.99, 1299.99)`)
+	db.Exec(`INSERT INTO order_lines (order_id, line_no, product_id, quantity, product_name, unit_price, line_total) VALUES ('order-1', 1, 'prod-2', 2, 'Wireless Mouse', 29.99, 59.98)`)
+
+	if err := MigrateOrderDB(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	order, err := NewSQLOrderRepository(db).Get("order-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if order.TotalPrice != usd(135997) {
+		t.Errorf("Expected total price 1359.97, got %s", order.TotalPrice)
+	}
+	if len(order.Products) != 2 || order.Products[1].UnitPrice != usd(2999) || order.Products[1].LineTotal != usd(5998) {
+		t.Errorf("Expected line prices in cents, got %+v", order.Products)
+	}
+}
+
+func TestMigrateOrderDB_RecordsHistoryOfExistingOrders(t *testing.T) {
+	db, err := OpenSQLiteOrderDB(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	allMigrations := orderMigrations
+	orderMigrations = allMigrations[:10]
+	err = MigrateOrderDB(db)
+	orderMigrations = allMigrations
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Exec(`INSERT INTO orders (id, user_id, total_price_minor, order_date, status, version) VALUES ('order-1', 'user-1', 2500, '2026-01-14T12:00:00.000000000Z', 'SHIPPED', 3)`)
+	db.Exec(`INSERT INTO order_lines (order_id, line_no, product_id, quantity, product_name, unit_price_minor, line_total_minor) VALUES ('order-1', 0, 'prod-1', 1, 'Lamp', 2500, 2500)`)
+	db.Exec(`INSERT INTO order_discounts (order_id, line_no, type, points, amount_minor, redemption_id) VALUES ('order-1', 0, 'LOYALTY_POINTS', 500, 500, 'redemption-1')`)
+
+	if err := MigrateOrderDB(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	repo := NewSQLOrderRepository(db)
+	events, err := repo.ListEvents("order-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(events) != 1 || events[0].Type != models.OrderEventCreated || events[0].Actor != SystemActor {
+		t.Fatalf("Expected an OrderCreated event by %s, got %+v", SystemActor, events)
+	}
+	stored, _ := repo.Get("order-1")
+	rebuilt, err := replayOrderEvents(events)
+	if err != nil || rebuilt.Status != stored.Status || rebuilt.Version != stored.Version || !reflect.DeepEqual(rebuilt.Products, stored.Products) || !reflect.DeepEqual(rebuilt.Discounts, stored.Discounts) {
+		t.Errorf("Expected the history to replay to the stored order %+v, got %+v, %v", stored, rebuilt, err)
+	}
+}
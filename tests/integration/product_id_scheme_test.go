@@ -0,0 +1,163 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Bitovi/example-go-server/internal/fakeproductservice"
+	"github.com/Bitovi/example-go-server/internal/handlers"
+	"github.com/Bitovi/example-go-server/internal/models"
+	"github.com/Bitovi/example-go-server/internal/services"
+)
+
+const (
+	numericCatalog = `
+products:
+  - {id: 7, name: Laptop, price: 1299.99, availability: true}
+  - {id: 12, name: Wireless Mouse, price: 29.99, availability: true}
+`
+	uuidCatalog = `
+products:
+  - {id: 3fa85f64-5717-4562-b3fc-2c963f66afa6, name: Laptop, price: 1299.99, availability: true}
+  - {id: 9b2e4c1a-6f3d-4e8b-a1c7-5d0f2e8b3a94, name: Wireless Mouse, price: 29.99, availability: true}
+`
+)
+
+// startFakeProductService serves a YAML catalog from a fake Product Service
+func startFakeProductService(t *testing.T, catalog string) *httptest.Server {
+	t.Helper()
+	products, err := fakeproductservice.ParseCatalog([]byte(catalog), "yaml")
+	if err != nil {
+		t.Fatalf("Invalid catalog: %v", err)
+	}
+	server := httptest.NewServer(fakeproductservice.New(products))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// useProductService points the order handlers at a Product Service deployment
+// using scheme
+func useProductService(t *testing.T, url string, scheme services.ProductIDScheme, opts ...services.ProductClientOption) {
+	t.Helper()
+	opts = append(opts, services.WithProductIDScheme(scheme))
+	handlers.SetProductIDScheme(scheme)
+	handlers.InitializeOrderService(services.NewMockOrderRepository(), services.NewProductServiceClient(url, "", opts...))
+	t.Cleanup(func() {
+		handlers.SetProductIDScheme(services.ProductIDSchemeUUID)
+		handlers.InitializeOrderService(services.NewMockOrderRepository(), nil)
+	})
+}
+
+// createOrderWithProducts posts an order for the given product IDs, one of each
+func createOrderWithProducts(productIDs ...string) *httptest.ResponseRecorder {
+	products := make([]map[string]any, len(productIDs))
+	for i, id := range productIDs {
+		products[i] = map[string]any{"productId": id, "quantity": i + 1}
+	}
+	body, _ := json.Marshal(map[string]any{"userId": "550e8400-e29b-41d4-a716-446655440000", "products": products})
+
+	w := httptest.NewRecorder()
+	handlers.CreateOrder(w, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(string(body))))
+	return w
+}
+
+func expectCreatedOrder(t *testing.T, w *httptest.ResponseRecorder, expectedIDs ...string) {
+	t.Helper()
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var order models.Order
+	if err := json.NewDecoder(w.Body).Decode(&order); err != nil {
+		t.Fatalf("Failed to decode order: %v", err)
+	}
+	for i, id := range expectedIDs {
+		if order.Products[i].ProductID != id {
+			t.Errorf("Expected line %d to be product %s, got %s", i, id, order.Products[i].ProductID)
+		}
+	}
+	// Laptop plus two mice
+	if order.TotalPrice.String() != "1359.97" {
+		t.Errorf("Expected total price 1359.97, got %s", order.TotalPrice)
+	}
+}
+
+func expectErrorCode(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	var errorResp map[string]any
+	json.NewDecoder(w.Body).Decode(&errorResp)
+	if w.Code != status || errorResp["code"] != code {
+		t.Errorf("Expected %d %s, got %d %v", status, code, w.Code, errorResp)
+	}
+}
+
+func TestProductIDScheme_Numeric(t *testing.T) {
+	server := startFakeProductService(t, numericCatalog)
+
+	t.Run("One lookup per product", func(t *testing.T) {
+		useProductService(t, server.URL, services.ProductIDSchemeNumeric)
+		expectCreatedOrder(t, createOrderWithProducts("7", "012"), "7", "12")
+	})
+
+	t.Run("Bulk lookup", func(t *testing.T) {
+		useProductService(t, server.URL, services.ProductIDSchemeNumeric, services.WithBulkLookup())
+		expectCreatedOrder(t, createOrderWithProducts("7", "12"), "7", "12")
+	})
+
+	t.Run("UUIDs are rejected", func(t *testing.T) {
+		useProductService(t, server.URL, services.ProductIDSchemeNumeric)
+		expectErrorCode(t, createOrderWithProducts("3fa85f64-5717-4562-b3fc-2c963f66afa6"), http.StatusBadRequest, "INVALID_PRODUCT_ID")
+	})
+
+	t.Run("Unknown products", func(t *testing.T) {
+		useProductService(t, server.URL, services.ProductIDSchemeNumeric)
+		expectErrorCode(t, createOrderWithProducts("7", "99"), http.StatusBadRequest, "INVALID_PRODUCT")
+	})
+}
+
+func TestProductIDScheme_UUID(t *testing.T) {
+	server := startFakeProductService(t, uuidCatalog)
+
+	t.Run("One lookup per product", func(t *testing.T) {
+		useProductService(t, server.URL, services.ProductIDSchemeUUID)
+		expectCreatedOrder(t, createOrderWithProducts("3FA85F64-5717-4562-B3FC-2C963F66AFA6", "9b2e4c1a-6f3d-4e8b-a1c7-5d0f2e8b3a94"),
+			"3fa85f64-5717-4562-b3fc-2c963f66afa6", "9b2e4c1a-6f3d-4e8b-a1c7-5d0f2e8b3a94")
+	})
+
+	t.Run("Bulk lookup", func(t *testing.T) {
+		useProductService(t, server.URL, services.ProductIDSchemeUUID, services.WithBulkLookup())
+		expectCreatedOrder(t, createOrderWithProducts("3fa85f64-5717-4562-b3fc-2c963f66afa6", "9b2e4c1a-6f3d-4e8b-a1c7-5d0f2e8b3a94"),
+			"3fa85f64-5717-4562-b3fc-2c963f66afa6", "9b2e4c1a-6f3d-4e8b-a1c7-5d0f2e8b3a94")
+	})
+
+	t.Run("Numeric IDs are rejected", func(t *testing.T) {
+		useProductService(t, server.URL, services.ProductIDSchemeUUID)
+		expectErrorCode(t, createOrderWithProducts("7"), http.StatusBadRequest, "INVALID_PRODUCT_ID")
+	})
+}
+
+func TestProductIDScheme_Any(t *testing.T) {
+	// A deployment serving both kinds of ID while migrating between them
+	server := startFakeProductService(t, `
+products:
+  - {id: 7, name: Laptop, price: 1299.99, availability: true}
+  - {id: 9b2e4c1a-6f3d-4e8b-a1c7-5d0f2e8b3a94, name: Wireless Mouse, price: 29.99, availability: true}
+`)
+	useProductService(t, server.URL, services.ProductIDSchemeAny)
+
+	expectCreatedOrder(t, createOrderWithProducts("7", "9b2e4c1a-6f3d-4e8b-a1c7-5d0f2e8b3a94"), "7", "9b2e4c1a-6f3d-4e8b-a1c7-5d0f2e8b3a94")
+	expectErrorCode(t, createOrderWithProducts("laptop"), http.StatusBadRequest, "INVALID_PRODUCT_ID")
+}
+
+func TestProductIDScheme_MismatchedProduct(t *testing.T) {
+	// The Product Service answers a lookup of product 7 with product 12
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 12, "name": "Wireless Mouse", "price": 29.99, "availability": true}`))
+	}))
+	defer server.Close()
+	useProductService(t, server.URL, services.ProductIDSchemeNumeric)
+
+	expectErrorCode(t, createOrderWithProducts("7"), http.StatusServiceUnavailable, "PRODUCT_SERVICE_UNAVAILABLE")
+}
@@ -40,8 +40,7 @@ func TestProductServiceIntegration(t *testing.T) {
 
 	// Initialize Product Service client
 	productClient := services.NewProductServiceClient(productServiceURL, "")
-	handlers.InitializeOrderService(productClient)
-	services.ResetOrderMockData()
+	handlers.InitializeOrderService(services.NewMockOrderRepository(), productClient)
 
 	t.Run("CreateOrderWithValidProducts", func(t *testing.T) {
 		// Get available products from Product Service
@@ -151,7 +150,7 @@ func TestProductServiceIntegration(t *testing.T) {
 	t.Run("ProductServiceUnavailable", func(t *testing.T) {
 		// Initialize with a non-existent Product Service URL
 		badClient := services.NewProductServiceClient("http://localhost:9999", "")
-		handlers.InitializeOrderService(badClient)
+		handlers.InitializeOrderService(services.NewMockOrderRepository(), badClient)
 
 		orderData := map[string]interface{}{
 			"userId": "550e8400-e29b-41d4-a716-446655440000",
@@ -190,7 +189,7 @@ func TestProductServiceIntegration(t *testing.T) {
 
 		// Restore the good client
 		goodClient := services.NewProductServiceClient(productServiceURL, "")
-		handlers.InitializeOrderService(goodClient)
+		handlers.InitializeOrderService(services.NewMockOrderRepository(), goodClient)
 	})
 }
 
@@ -215,8 +214,7 @@ func TestCompleteOrderWorkflow(t *testing.T) {
 
 	// Initialize
 	productClient := services.NewProductServiceClient(productServiceURL, "")
-	handlers.InitializeOrderService(productClient)
-	services.ResetOrderMockData()
+	handlers.InitializeOrderService(services.NewMockOrderRepository(), productClient)
 
 	var orderID string
 